@@ -98,3 +98,14 @@ Return the init container image name
 {{- define "free5gc-nwdaf.initImage" -}}
 {{- printf "%s/%s:%s" .Values.initcontainers.curl.registry .Values.initcontainers.curl.image .Values.initcontainers.curl.tag -}}
 {{- end }}
+
+{{/*
+Return the run mode of the main NWDAF deployment
+*/}}
+{{- define "free5gc-nwdaf.mode" -}}
+{{- if .Values.nwdaf.mtlf.enabled -}}
+anlf
+{{- else -}}
+{{- .Values.nwdaf.mode | default "combined" -}}
+{{- end -}}
+{{- end }}
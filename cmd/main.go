@@ -24,6 +24,10 @@ func main() {
 			Usage: "Load configuration from `FILE`",
 			Value: "config/nwdafcfg.yaml",
 		},
+		cli.StringFlag{
+			Name:  "mode, m",
+			Usage: "Run mode: anlf (analytics), mtlf (model training) or combined; overrides the configuration",
+		},
 		cli.StringFlag{
 			Name:  "log, l",
 			Usage: "Output log to `FILE`",
@@ -47,6 +51,17 @@ func action(c *cli.Context) error {
 		return fmt.Errorf("failed to initialize configuration: %w", err)
 	}
 
+	// The --mode flag overrides the configured run mode
+	mode := c.String("mode")
+	if mode == "" {
+		mode = factory.NwdafConfig.Configuration.Mode
+	}
+	mode, err := factory.ParseMode(mode)
+	if err != nil {
+		return err
+	}
+	factory.NwdafConfig.Configuration.Mode = mode
+
 	// Initialize logger
 	logLevel := c.String("loglevel")
 	if level, err := logrus.ParseLevel(logLevel); err == nil {
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/free5gc/nwdaf/pkg/importer"
+	"github.com/urfave/cli"
+)
+
+func main() {
+	app := cli.NewApp()
+	app.Name = "nwdaf-import"
+	app.Usage = "Import recorded NF, UE and slice statistics (CSV or JSON Lines) into a running NWDAF"
+	app.Action = action
+	app.Flags = []cli.Flag{
+		cli.StringFlag{
+			Name:  "mapping, m",
+			Usage: "Load the mapping spec from `FILE`",
+		},
+		cli.StringFlag{
+			Name:  "data, d",
+			Usage: "Dataset `FILE` to import",
+		},
+		cli.StringFlag{
+			Name:  "nwdaf",
+			Usage: "NWDAF SBI base `URL`",
+			Value: "http://127.0.0.1:8000",
+		},
+		cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "Parse the dataset locally and print a summary without uploading",
+		},
+	}
+
+	if err := app.Run(os.Args); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func action(c *cli.Context) error {
+	mappingPath := c.String("mapping")
+	dataPath := c.String("data")
+	if mappingPath == "" || dataPath == "" {
+		return fmt.Errorf("both --mapping and --data are required")
+	}
+
+	mappingContent, err := os.ReadFile(mappingPath)
+	if err != nil {
+		return fmt.Errorf("failed to read mapping: %w", err)
+	}
+	mapping, err := importer.ParseMapping(mappingContent)
+	if err != nil {
+		return err
+	}
+
+	if c.Bool("dry-run") {
+		data, err := os.Open(dataPath)
+		if err != nil {
+			return fmt.Errorf("failed to open dataset: %w", err)
+		}
+		defer data.Close()
+
+		batch, err := importer.Parse(data, mapping)
+		if err != nil {
+			return err
+		}
+		summary := batch.Summary()
+		fmt.Printf("Parsed %s dataset: %d NF, %d UE, %d slice records, %d skipped\n",
+			mapping.Kind, summary.NFStatistics, summary.UEStatistics, summary.SliceStatistics, summary.Skipped)
+		for _, e := range summary.Errors {
+			fmt.Printf("  %s\n", e)
+		}
+		return nil
+	}
+
+	return upload(strings.TrimRight(c.String("nwdaf"), "/")+"/import", mappingPath, mappingContent, dataPath)
+}
+
+func upload(url, mappingPath string, mappingContent []byte, dataPath string) error {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	part, err := writer.CreateFormFile("mapping", filepath.Base(mappingPath))
+	if err != nil {
+		return err
+	}
+	if _, err := part.Write(mappingContent); err != nil {
+		return fmt.Errorf("failed to write mapping: %w", err)
+	}
+
+	data, err := os.Open(dataPath)
+	if err != nil {
+		return fmt.Errorf("failed to open dataset: %w", err)
+	}
+	defer data.Close()
+
+	part, err = writer.CreateFormFile("data", filepath.Base(dataPath))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, data); err != nil {
+		return fmt.Errorf("failed to read dataset: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to finish the upload body: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", url, &body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	client := &http.Client{Timeout: 5 * time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot connect to NWDAF at %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+
+	result, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("import failed: HTTP %d - %s", resp.StatusCode, string(result))
+	}
+
+	fmt.Println(string(result))
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/free5gc/nwdaf/internal/logger"
+	nwdafContext "github.com/free5gc/nwdaf/pkg/context"
+	"github.com/free5gc/nwdaf/pkg/factory"
+	"github.com/free5gc/nwdaf/pkg/importer"
+	"github.com/free5gc/nwdaf/pkg/replay"
+	"github.com/free5gc/nwdaf/pkg/service"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+var NWDAF = &service.NWDAF{}
+
+func main() {
+	app := cli.NewApp()
+	app.Name = "nwdaf-replay"
+	app.Usage = "Replay a recorded trace through the NWDAF pipeline on an accelerated virtual clock"
+	app.Action = action
+	app.Flags = []cli.Flag{
+		cli.StringFlag{
+			Name:  "config, c",
+			Usage: "Load configuration from `FILE`",
+			Value: "config/nwdafcfg.yaml",
+		},
+		cli.StringFlag{
+			Name:  "mapping, m",
+			Usage: "Load the trace mapping spec from `FILE`",
+		},
+		cli.StringFlag{
+			Name:  "trace, t",
+			Usage: "Trace `FILE` (CSV or JSON Lines) with nf, ue, slice, upf and dn records",
+		},
+		cli.Float64Flag{
+			Name:  "speed",
+			Usage: "Virtual clock speed relative to real time",
+			Value: 60,
+		},
+		cli.IntFlag{
+			Name:  "tail",
+			Usage: "Keep the pipeline running for `SECONDS` of virtual time after the last record",
+			Value: 60,
+		},
+		cli.StringFlag{
+			Name:  "loglevel",
+			Usage: "Set log level (trace|debug|info|warn|error|fatal|panic)",
+			Value: "info",
+		},
+	}
+
+	if err := app.Run(os.Args); err != nil {
+		logger.AppLog.Errorf("NWDAF replay error: %v", err)
+		os.Exit(1)
+	}
+}
+
+func action(c *cli.Context) error {
+	if err := factory.InitConfigFactory(c.String("config")); err != nil {
+		return fmt.Errorf("failed to initialize configuration: %w", err)
+	}
+
+	if level, err := logrus.ParseLevel(c.String("loglevel")); err == nil {
+		logger.SetLogLevel(level)
+	}
+
+	mappingContent, err := os.ReadFile(c.String("mapping"))
+	if err != nil {
+		return fmt.Errorf("failed to read mapping: %w", err)
+	}
+	mapping, err := importer.ParseMapping(mappingContent)
+	if err != nil {
+		return err
+	}
+
+	trace, err := os.Open(c.String("trace"))
+	if err != nil {
+		return fmt.Errorf("failed to open trace: %w", err)
+	}
+	batch, err := importer.Parse(trace, mapping)
+	trace.Close()
+	if err != nil {
+		return err
+	}
+	if batch.Skipped > 0 {
+		logger.AppLog.Warnf("Skipped %d malformed trace records", batch.Skipped)
+	}
+
+	driver, err := replay.NewDriver(nwdafContext.GetSelf(), batch, c.Float64("speed"))
+	if err != nil {
+		return err
+	}
+
+	NWDAF.Clock = driver.Clock()
+	configuration := factory.NwdafConfig.Configuration
+	NWDAF.RateSource = replay.RateSource(nwdafContext.GetSelf(), configuration.GetEdges(), configuration.GetBranchingUpf())
+	NWDAF.Initialize(c)
+
+	go func() {
+		if err := driver.Run(context.Background()); err != nil {
+			logger.AppLog.Errorf("Replay aborted: %v", err)
+		}
+		tail := time.Duration(c.Int("tail")) * time.Second
+		time.Sleep(driver.Clock().RealDuration(tail))
+		NWDAF.Terminate()
+	}()
+
+	NWDAF.Start()
+	return nil
+}
@@ -12,6 +12,7 @@ var (
 	SbiLog      *logrus.Logger
 	AnalyticsLog *logrus.Logger
 	ContextLog  *logrus.Logger
+	NrfLog      *logrus.Logger
 )
 
 func init() {
@@ -20,6 +21,7 @@ func init() {
 	SbiLog = logrus.New()
 	AnalyticsLog = logrus.New()
 	ContextLog = logrus.New()
+	NrfLog = logrus.New()
 
 	// Set default log level and format
 	AppLog.SetLevel(logrus.InfoLevel)
@@ -27,6 +29,7 @@ func init() {
 	SbiLog.SetLevel(logrus.InfoLevel)
 	AnalyticsLog.SetLevel(logrus.InfoLevel)
 	ContextLog.SetLevel(logrus.InfoLevel)
+	NrfLog.SetLevel(logrus.InfoLevel)
 
 	// Set formatter
 	formatter := &logrus.TextFormatter{
@@ -39,6 +42,7 @@ func init() {
 	SbiLog.SetFormatter(formatter)
 	AnalyticsLog.SetFormatter(formatter)
 	ContextLog.SetFormatter(formatter)
+	NrfLog.SetFormatter(formatter)
 
 	// Set output
 	AppLog.SetOutput(os.Stdout)
@@ -46,6 +50,7 @@ func init() {
 	SbiLog.SetOutput(os.Stdout)
 	AnalyticsLog.SetOutput(os.Stdout)
 	ContextLog.SetOutput(os.Stdout)
+	NrfLog.SetOutput(os.Stdout)
 }
 
 func SetLogLevel(level logrus.Level) {
@@ -54,6 +59,7 @@ func SetLogLevel(level logrus.Level) {
 	SbiLog.SetLevel(level)
 	AnalyticsLog.SetLevel(level)
 	ContextLog.SetLevel(level)
+	NrfLog.SetLevel(level)
 }
 
 func SetLogFile(path string) error {
@@ -67,6 +73,7 @@ func SetLogFile(path string) error {
 	SbiLog.SetOutput(file)
 	AnalyticsLog.SetOutput(file)
 	ContextLog.SetOutput(file)
+	NrfLog.SetOutput(file)
 
 	return nil
 }
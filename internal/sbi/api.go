@@ -1,34 +1,99 @@
 package sbi
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
 
 	"github.com/free5gc/nwdaf/internal/logger"
+	"github.com/free5gc/nwdaf/pkg/adrf"
 	"github.com/free5gc/nwdaf/pkg/agent"
 	"github.com/free5gc/nwdaf/pkg/analytics"
 	nwdafContext "github.com/free5gc/nwdaf/pkg/context"
+	"github.com/free5gc/nwdaf/pkg/factory"
+	"github.com/free5gc/nwdaf/pkg/importer"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-func RegisterRoutes(router *gin.Engine, ctx *nwdafContext.NWDAFContext, engine *analytics.AnalyticsEngine, a *agent.Agent) {
+// RegisterRoutes registers the SBI routes of a run mode: analytics services
+// for an AnLF, ML model provision for an MTLF and both when combined. Data
+// input, data management, metrics and health routes are always registered,
+// and the embedded stub ADRF when in use.
+func RegisterRoutes(router *gin.Engine, ctx *nwdafContext.NWDAFContext, engine *analytics.AnalyticsEngine, a *agent.Agent, mode string) {
+	if mode != factory.ModeMtlf {
+		registerAnlfRoutes(router, ctx, engine, a)
+	}
+	if mode != factory.ModeAnlf {
+		registerMtlfRoutes(router, ctx, engine)
+	}
+	if stub, ok := engine.ADRF().(*adrf.Stub); ok {
+		registerAdrfRoutes(router, stub)
+	}
+
+	// Raw collected data, for other NWDAFs and DCCFs
+	dataGroup := router.Group(analytics.DataManagementPath)
+	{
+		dataGroup.POST("/subscriptions", func(c *gin.Context) {
+			handleCreateDataSubscription(c, ctx, engine)
+		})
+		dataGroup.GET("/subscriptions/:subscriptionId", func(c *gin.Context) {
+			handleGetDataSubscription(c, ctx)
+		})
+		dataGroup.DELETE("/subscriptions/:subscriptionId", func(c *gin.Context) {
+			handleDeleteDataSubscription(c, ctx)
+		})
+		dataGroup.POST("/fetch", func(c *gin.Context) {
+			handleFetchData(c, engine)
+		})
+	}
+
+	// Historical data import
+	router.POST("/import", func(c *gin.Context) {
+		handleImport(c, ctx)
+	})
+
+	// AF-measured service experience, used to calibrate MOS estimates
+	router.POST("/af/service-experience", func(c *gin.Context) {
+		handleServiceExperienceSamples(c, ctx, engine)
+	})
+
+	router.GET("/agent-metrics", gin.WrapH(promhttp.Handler()))
+
+	// Health check endpoint
+	router.GET("/health", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"status": "healthy",
+		})
+	})
+}
+
+func registerAnlfRoutes(router *gin.Engine, ctx *nwdafContext.NWDAFContext, engine *analytics.AnalyticsEngine, a *agent.Agent) {
 	// Base path for NWDAF SBI
 	nwdafGroup := router.Group("/nnwdaf-eventssubscription/v1")
 	{
 		// Subscription endpoints
 		nwdafGroup.POST("/subscriptions", func(c *gin.Context) {
-			handleCreateSubscription(c, ctx)
+			handleCreateSubscription(c, ctx, engine)
 		})
 		nwdafGroup.GET("/subscriptions/:subscriptionId", func(c *gin.Context) {
 			handleGetSubscription(c, ctx)
 		})
 		nwdafGroup.DELETE("/subscriptions/:subscriptionId", func(c *gin.Context) {
-			handleDeleteSubscription(c, ctx)
+			handleDeleteSubscription(c, ctx, engine)
 		})
 		nwdafGroup.PUT("/subscriptions/:subscriptionId", func(c *gin.Context) {
-			handleUpdateSubscription(c, ctx)
+			handleUpdateSubscription(c, ctx, engine)
+		})
+		// Move subscriptions to a peer NWDAF, e.g. to drain this instance
+		nwdafGroup.POST("/subscription-transfer", func(c *gin.Context) {
+			handleSubscriptionTransfer(c, engine)
 		})
 	}
 
@@ -38,8 +103,29 @@ func RegisterRoutes(router *gin.Engine, ctx *nwdafContext.NWDAFContext, engine *
 		analyticsGroup.POST("/analytics", func(c *gin.Context) {
 			handleGetAnalytics(c, ctx, engine)
 		})
+		// Context transfer: export to the NWDAF a UE moves to, import from
+		// the one it leaves and acknowledge the import to it
+		analyticsGroup.GET("/context", func(c *gin.Context) {
+			handleGetContext(c, engine)
+		})
+		analyticsGroup.POST("/context-transfer", func(c *gin.Context) {
+			handleContextTransfer(c, engine)
+		})
+		analyticsGroup.POST("/context/ack", func(c *gin.Context) {
+			handleContextAck(c, engine)
+		})
 	}
 
+	// Notifications of the peers an aggregator subscribed at
+	router.POST(analytics.AggregationNotifyPath+"/:subscriptionId", func(c *gin.Context) {
+		handlePeerNotification(c, engine)
+	})
+
+	// Notifications of the MTLF whose models are subscribed to
+	router.POST(analytics.MLModelNotifyPath, func(c *gin.Context) {
+		handleMLModelNotification(c, engine)
+	})
+
 	// Agent Endpoints
 	router.GET("/metrics", func(c *gin.Context) {
 		handleAgentDirectMetrics(c, a)
@@ -50,17 +136,50 @@ func RegisterRoutes(router *gin.Engine, ctx *nwdafContext.NWDAFContext, engine *
 	router.POST("/chat", func(c *gin.Context) {
 		handleAgentChat(c, a)
 	})
-	router.GET("/agent-metrics", gin.WrapH(promhttp.Handler()))
+}
 
-	// Health check endpoint
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"status": "healthy",
+func registerMtlfRoutes(router *gin.Engine, ctx *nwdafContext.NWDAFContext, engine *analytics.AnalyticsEngine) {
+	// ML model provision
+	modelGroup := router.Group(analytics.MLModelProvisionPath)
+	{
+		modelGroup.POST("/subscriptions", func(c *gin.Context) {
+			handleCreateMLModelSubscription(c, ctx, engine)
 		})
-	})
+		modelGroup.PUT("/subscriptions/:subscriptionId", func(c *gin.Context) {
+			handleUpdateMLModelSubscription(c, ctx, engine)
+		})
+		modelGroup.DELETE("/subscriptions/:subscriptionId", func(c *gin.Context) {
+			handleDeleteMLModelSubscription(c, ctx)
+		})
+		modelGroup.GET("/models", func(c *gin.Context) {
+			c.JSON(http.StatusOK, engine.ModelInfos(analytics.TrainedEvents()))
+		})
+		modelGroup.GET("/models/:eventId/:version", func(c *gin.Context) {
+			handleGetMLModel(c, engine)
+		})
+	}
+}
+
+// registerAdrfRoutes serves the embedded stub ADRF (Nadrf_DataManagement)
+func registerAdrfRoutes(router *gin.Engine, stub *adrf.Stub) {
+	adrfGroup := router.Group(adrf.DataManagementPath)
+	{
+		adrfGroup.POST("/data-store-records", func(c *gin.Context) {
+			handleStoreRecord(c, stub)
+		})
+		adrfGroup.GET("/data-store-records", func(c *gin.Context) {
+			handleRetrieveRecords(c, stub)
+		})
+		adrfGroup.GET("/data-store-records/:recordId", func(c *gin.Context) {
+			handleGetRecord(c, stub)
+		})
+		adrfGroup.DELETE("/data-store-records/:recordId", func(c *gin.Context) {
+			handleDeleteRecord(c, stub)
+		})
+	}
 }
 
-func handleCreateSubscription(c *gin.Context, ctx *nwdafContext.NWDAFContext) {
+func handleCreateSubscription(c *gin.Context, ctx *nwdafContext.NWDAFContext, engine *analytics.AnalyticsEngine) {
 	logger.SbiLog.Infoln("Handle CreateSubscription")
 
 	var req SubscriptionRequest
@@ -69,8 +188,18 @@ func handleCreateSubscription(c *gin.Context, ctx *nwdafContext.NWDAFContext) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
 		return
 	}
+	if err := analytics.ValidateFilter(req.EventType, req.AnalyticsFilter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := analytics.ValidateReportingRequirement(req.EvtReq); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	// Create subscription
+	// Create subscription. A subscription transferred from another NWDAF
+	// keeps its ID when free; when the same consumer already holds it here,
+	// e.g. imported with the context of its UEs, it is not created twice.
 	subscription := &nwdafContext.AnalyticsSubscription{
 		SubscriptionId:  uuid.New().String(),
 		EventType:       req.EventType,
@@ -78,9 +207,34 @@ func handleCreateSubscription(c *gin.Context, ctx *nwdafContext.NWDAFContext) {
 		NotificationUri: req.NotificationUri,
 		AnalyticsFilter: req.AnalyticsFilter,
 		ReportingPeriod: req.ReportingPeriod,
+		EvtReq:          req.EvtReq,
+	}
+	added := false
+	if req.PrevSub != nil && req.PrevSub.SubscriptionId != "" {
+		logger.SbiLog.Infof("Accepting subscription %s transferred from %s", req.PrevSub.SubscriptionId, req.PrevSub.ProducerId)
+		transferred := *subscription
+		transferred.SubscriptionId = req.PrevSub.SubscriptionId
+		existing, ok := ctx.AddSubscriptionIfAbsent(&transferred)
+		if !ok && req.sameConsumer(existing) {
+			logger.SbiLog.Infof("Subscription %s already transferred", existing.SubscriptionId)
+			c.JSON(http.StatusCreated, SubscriptionResponse{
+				SubscriptionId:  existing.SubscriptionId,
+				EventType:       existing.EventType,
+				NotificationUri: existing.NotificationUri,
+			})
+			return
+		}
+		if ok {
+			subscription, added = &transferred, true
+		}
 	}
 
-	ctx.AddSubscription(subscription)
+	if !added {
+		ctx.AddSubscription(subscription)
+	}
+	if !forwarded(c) {
+		engine.SubscribePeers(subscription)
+	}
 
 	logger.SbiLog.Infof("Created subscription: %s", subscription.SubscriptionId)
 
@@ -109,7 +263,7 @@ func handleGetSubscription(c *gin.Context, ctx *nwdafContext.NWDAFContext) {
 	})
 }
 
-func handleDeleteSubscription(c *gin.Context, ctx *nwdafContext.NWDAFContext) {
+func handleDeleteSubscription(c *gin.Context, ctx *nwdafContext.NWDAFContext, engine *analytics.AnalyticsEngine) {
 	logger.SbiLog.Infoln("Handle DeleteSubscription")
 
 	subscriptionId := c.Param("subscriptionId")
@@ -121,13 +275,14 @@ func handleDeleteSubscription(c *gin.Context, ctx *nwdafContext.NWDAFContext) {
 	}
 
 	ctx.RemoveSubscription(subscriptionId)
+	engine.UnsubscribePeers(subscriptionId)
 
 	logger.SbiLog.Infof("Deleted subscription: %s", subscriptionId)
 
 	c.Status(http.StatusNoContent)
 }
 
-func handleUpdateSubscription(c *gin.Context, ctx *nwdafContext.NWDAFContext) {
+func handleUpdateSubscription(c *gin.Context, ctx *nwdafContext.NWDAFContext, engine *analytics.AnalyticsEngine) {
 	logger.SbiLog.Infoln("Handle UpdateSubscription")
 
 	subscriptionId := c.Param("subscriptionId")
@@ -138,6 +293,14 @@ func handleUpdateSubscription(c *gin.Context, ctx *nwdafContext.NWDAFContext) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
 		return
 	}
+	if err := analytics.ValidateFilter(req.EventType, req.AnalyticsFilter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := analytics.ValidateReportingRequirement(req.EvtReq); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	sub, ok := ctx.GetSubscription(subscriptionId)
 	if !ok {
@@ -145,11 +308,23 @@ func handleUpdateSubscription(c *gin.Context, ctx *nwdafContext.NWDAFContext) {
 		return
 	}
 
-	// Update subscription
+	// Update a copy and swap it in, as the analytics workers may be reading
+	// the stored subscription
 	sub.EventType = req.EventType
 	sub.NotificationUri = req.NotificationUri
 	sub.AnalyticsFilter = req.AnalyticsFilter
 	sub.ReportingPeriod = req.ReportingPeriod
+	sub.EvtReq = req.EvtReq
+	if !ctx.ReplaceSubscription(sub) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subscription not found"})
+		return
+	}
+
+	// The area may have changed: subscribe again at the peers serving it
+	engine.UnsubscribePeers(subscriptionId)
+	if !forwarded(c) {
+		engine.SubscribePeers(sub)
+	}
 
 	logger.SbiLog.Infof("Updated subscription: %s", subscriptionId)
 
@@ -170,8 +345,28 @@ func handleGetAnalytics(c *gin.Context, ctx *nwdafContext.NWDAFContext, engine *
 		return
 	}
 
-	// Get analytics from engine
-	analyticsData, err := engine.GetAnalytics(req.EventType, req.AnalyticsFilter)
+	evtReq := req.reportingRequirement()
+	if err := analytics.ValidateReportingRequirement(evtReq); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := analytics.ValidateFilter(req.EventType, req.AnalyticsFilter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get analytics from engine, merged with those of the peers of an
+	// aggregator unless another aggregator forwarded the request
+	get := engine.GetAggregatedAnalytics
+	if forwarded(c) {
+		get = engine.GetAnalyticsWithRequirement
+	}
+	analyticsData, err := get(c.Request.Context(), req.EventType, req.AnalyticsFilter, evtReq)
+	if errors.Is(err, analytics.ErrUnknownEvent) || errors.Is(err, analytics.ErrInvalidFilter) ||
+		errors.Is(err, analytics.ErrInvalidReportingRequirement) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		logger.SbiLog.Errorf("Failed to get analytics: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get analytics"})
@@ -184,6 +379,105 @@ func handleGetAnalytics(c *gin.Context, ctx *nwdafContext.NWDAFContext, engine *
 	})
 }
 
+// handleGetContext exports the analytics context of the UEs listed in the
+// supis query parameter (comma-separated or repeated)
+func handleGetContext(c *gin.Context, engine *analytics.AnalyticsEngine) {
+	logger.SbiLog.Infoln("Handle GetContext")
+
+	var supis []string
+	for _, value := range c.QueryArray("supis") {
+		for _, supi := range strings.Split(value, ",") {
+			if supi = strings.TrimSpace(supi); supi != "" {
+				supis = append(supis, supi)
+			}
+		}
+	}
+	if len(supis) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "supis is required"})
+		return
+	}
+
+	c.JSON(http.StatusOK, engine.ExportContext(supis))
+}
+
+// SubscriptionTransferRequest names the NWDAF to move subscriptions to, by
+// URI or by the NF instance ID of a known peer, and the subscriptions to move
+// (all when none are listed)
+type SubscriptionTransferRequest struct {
+	TargetUri       string   `json:"targetUri,omitempty"`
+	TargetNfId      string   `json:"targetNfId,omitempty"`
+	SubscriptionIds []string `json:"subscriptionIds,omitempty"`
+}
+
+// handleSubscriptionTransfer moves subscriptions to a peer NWDAF. The reply
+// gives the outcome of each subscription; those the peer refused stay here.
+func handleSubscriptionTransfer(c *gin.Context, engine *analytics.AnalyticsEngine) {
+	logger.SbiLog.Infoln("Handle SubscriptionTransfer")
+
+	var req SubscriptionTransferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.SbiLog.Errorf("Invalid request body: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	targetUri, err := engine.ResolvePeerUri(req.TargetUri, req.TargetNfId)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, engine.TransferSubscriptions(targetUri, req.SubscriptionIds))
+}
+
+// ContextTransferRequest asks the NWDAF a UE moves to for the import of its
+// context from the NWDAF serving it so far
+type ContextTransferRequest struct {
+	SourceUri string   `json:"sourceUri" binding:"required"`
+	Supis     []string `json:"supis" binding:"required"`
+}
+
+// handleContextTransfer imports the analytics context of some UEs from the
+// source NWDAF
+func handleContextTransfer(c *gin.Context, engine *analytics.AnalyticsEngine) {
+	logger.SbiLog.Infoln("Handle ContextTransfer")
+
+	var req ContextTransferRequest
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.Supis) == 0 {
+		logger.SbiLog.Errorf("Invalid request body: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	summary, err := engine.TransferContext(c.Request.Context(), req.SourceUri, req.Supis)
+	if err != nil {
+		logger.SbiLog.Errorf("Context transfer failed: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
+
+// handleContextAck hands over the subscriptions the NWDAF that imported a
+// context took on
+func handleContextAck(c *gin.Context, engine *analytics.AnalyticsEngine) {
+	logger.SbiLog.Infoln("Handle ContextAck")
+
+	var req analytics.ContextAcknowledgement
+	if err := c.ShouldBindJSON(&req); err != nil || req.TargetUri == "" {
+		logger.SbiLog.Errorf("Invalid request body: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	c.JSON(http.StatusOK, engine.AcknowledgeContext(&req))
+}
+
+// forwarded reports whether an aggregator forwarded the request
+func forwarded(c *gin.Context) bool {
+	return c.GetHeader(analytics.AggregatorHeader) != ""
+}
+
 // Request/Response models
 type SubscriptionRequest struct {
 	EventType       string                 `json:"eventType" binding:"required"`
@@ -191,6 +485,16 @@ type SubscriptionRequest struct {
 	NotificationUri string                 `json:"notificationUri" binding:"required"`
 	AnalyticsFilter map[string]interface{} `json:"analyticsFilter,omitempty"`
 	ReportingPeriod int                    `json:"reportingPeriod,omitempty"`
+	// Optional reporting window, accuracy and maximum number of objects
+	EvtReq *nwdafContext.EventReportingRequirement `json:"evtReq,omitempty"`
+	// Set when another NWDAF transfers the subscription
+	PrevSub *analytics.PrevSubInfo `json:"prevSub,omitempty"`
+}
+
+// sameConsumer reports whether a stored subscription is the one requested:
+// same event, consumer and notification URI
+func (r *SubscriptionRequest) sameConsumer(sub *nwdafContext.AnalyticsSubscription) bool {
+	return sub.EventType == r.EventType && sub.ConsumerNfId == r.ConsumerNfId && sub.NotificationUri == r.NotificationUri
 }
 
 type SubscriptionResponse struct {
@@ -202,6 +506,25 @@ type SubscriptionResponse struct {
 type AnalyticsRequest struct {
 	EventType       string                 `json:"eventType" binding:"required"`
 	AnalyticsFilter map[string]interface{} `json:"analyticsFilter,omitempty"`
+	// Optional reporting window, accuracy and maximum number of objects
+	EvtReq *nwdafContext.EventReportingRequirement `json:"evtReq,omitempty"`
+	// Shorthand for the evtReq window (Unix seconds)
+	StartTs int64 `json:"startTs,omitempty"`
+	EndTs   int64 `json:"endTs,omitempty"`
+}
+
+// reportingRequirement merges the shorthand window into evtReq, whose own
+// window takes precedence
+func (r *AnalyticsRequest) reportingRequirement() *nwdafContext.EventReportingRequirement {
+	evtReq := nwdafContext.EventReportingRequirement{StartTs: r.StartTs, EndTs: r.EndTs}
+	if r.EvtReq != nil {
+		evtReq.Accuracy = r.EvtReq.Accuracy
+		evtReq.MaxObjectNbr = r.EvtReq.MaxObjectNbr
+		if r.EvtReq.StartTs != 0 || r.EvtReq.EndTs != 0 {
+			evtReq.StartTs, evtReq.EndTs = r.EvtReq.StartTs, r.EvtReq.EndTs
+		}
+	}
+	return &evtReq
 }
 
 type AnalyticsResponse struct {
@@ -209,6 +532,376 @@ type AnalyticsResponse struct {
 	Data      interface{} `json:"data"`
 }
 
+// handleImport loads a recorded dataset into the data store. The request is
+// multipart with a "mapping" spec and a "data" file (CSV or JSON Lines).
+func handleImport(c *gin.Context, ctx *nwdafContext.NWDAFContext) {
+	logger.SbiLog.Infoln("Handle Import")
+
+	mappingContent, err := readFormFile(c, "mapping")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	mapping, err := importer.ParseMapping(mappingContent)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	dataFile, err := c.FormFile("data")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing 'data' file"})
+		return
+	}
+	data, err := dataFile.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot read 'data' file"})
+		return
+	}
+	defer data.Close()
+
+	batch, err := importer.Parse(data, mapping)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	importer.Load(ctx, batch)
+
+	summary := batch.Summary()
+	logger.SbiLog.Infof("Imported %s data: %d NF, %d UE, %d slice, %d UPF, %d DN records (%d skipped)",
+		mapping.Kind, summary.NFStatistics, summary.UEStatistics, summary.SliceStatistics,
+		summary.UPFStatistics, summary.DNStatistics, summary.Skipped)
+
+	c.JSON(http.StatusOK, summary)
+}
+
+// handleServiceExperienceSamples stores AF service experience samples. The
+// body is a single sample or a list of them; samples without a timestamp are
+// stamped with the engine clock.
+func handleServiceExperienceSamples(c *gin.Context, ctx *nwdafContext.NWDAFContext, engine *analytics.AnalyticsEngine) {
+	logger.SbiLog.Infoln("Handle ServiceExperienceSamples")
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	var samples []*nwdafContext.ServiceExperienceSample
+	if err := json.Unmarshal(body, &samples); err != nil {
+		var sample nwdafContext.ServiceExperienceSample
+		if err := json.Unmarshal(body, &sample); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+		samples = append(samples, &sample)
+	}
+
+	for i, s := range samples {
+		if s == nil || s.AppId == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("sample %d: appId is required", i)})
+			return
+		}
+		if s.Mos < 1 || s.Mos > 5 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("sample %d: mos must be between 1 and 5", i)})
+			return
+		}
+	}
+	for _, s := range samples {
+		if s.Timestamp == 0 {
+			s.Timestamp = engine.Clock().Now().Unix()
+		}
+		ctx.AddServiceExperienceSample(s)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"accepted": len(samples)})
+}
+
+func handleCreateMLModelSubscription(c *gin.Context, ctx *nwdafContext.NWDAFContext, engine *analytics.AnalyticsEngine) {
+	logger.SbiLog.Infoln("Handle CreateMLModelSubscription")
+
+	var req analytics.MLModelSubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.SbiLog.Errorf("Invalid request body: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if err := analytics.ValidateMLModelSubscription(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	subscription := analytics.NewMLModelSubscription(uuid.New().String(), &req)
+	ctx.AddMLModelSubscription(subscription)
+
+	logger.SbiLog.Infof("Created ML model subscription: %s", subscription.SubscriptionId)
+
+	c.JSON(http.StatusCreated, mlModelSubscriptionResponse(subscription.SubscriptionId, &req, engine))
+}
+
+func handleUpdateMLModelSubscription(c *gin.Context, ctx *nwdafContext.NWDAFContext, engine *analytics.AnalyticsEngine) {
+	logger.SbiLog.Infoln("Handle UpdateMLModelSubscription")
+
+	subscriptionId := c.Param("subscriptionId")
+
+	var req analytics.MLModelSubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.SbiLog.Errorf("Invalid request body: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if err := analytics.ValidateMLModelSubscription(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, ok := ctx.GetMLModelSubscription(subscriptionId); !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subscription not found"})
+		return
+	}
+	ctx.AddMLModelSubscription(analytics.NewMLModelSubscription(subscriptionId, &req))
+
+	logger.SbiLog.Infof("Updated ML model subscription: %s", subscriptionId)
+
+	c.JSON(http.StatusOK, mlModelSubscriptionResponse(subscriptionId, &req, engine))
+}
+
+func handleDeleteMLModelSubscription(c *gin.Context, ctx *nwdafContext.NWDAFContext) {
+	logger.SbiLog.Infoln("Handle DeleteMLModelSubscription")
+
+	subscriptionId := c.Param("subscriptionId")
+
+	if _, ok := ctx.GetMLModelSubscription(subscriptionId); !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subscription not found"})
+		return
+	}
+
+	ctx.RemoveMLModelSubscription(subscriptionId)
+
+	logger.SbiLog.Infof("Deleted ML model subscription: %s", subscriptionId)
+
+	c.Status(http.StatusNoContent)
+}
+
+// mlModelSubscriptionResponse echoes a subscription with the models already
+// available for its event types
+func mlModelSubscriptionResponse(subscriptionId string, req *analytics.MLModelSubscriptionRequest, engine *analytics.AnalyticsEngine) *analytics.MLModelSubscriptionResponse {
+	events := make([]string, 0, len(req.MLEventSubscs))
+	for _, s := range req.MLEventSubscs {
+		events = append(events, s.MLEvent)
+	}
+	return &analytics.MLModelSubscriptionResponse{
+		SubscriptionId: subscriptionId,
+		MLEventSubscs:  req.MLEventSubscs,
+		NotifUri:       req.NotifUri,
+		NotifCorreId:   req.NotifCorreId,
+		MLEventNotifs:  engine.ModelInfos(events),
+	}
+}
+
+// handleGetMLModel serves a model file at the URL given in model
+// notifications
+func handleGetMLModel(c *gin.Context, engine *analytics.AnalyticsEngine) {
+	logger.SbiLog.Infoln("Handle GetMLModel")
+
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid model version"})
+		return
+	}
+	file, err := engine.ModelFile(c.Param("eventId"), version)
+	if errors.Is(err, os.ErrNotExist) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Model not found"})
+		return
+	}
+	if err != nil {
+		logger.SbiLog.Errorf("Failed to read model: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read model"})
+		return
+	}
+
+	c.JSON(http.StatusOK, file)
+}
+
+// handleMLModelNotification fetches the model versions an MTLF notifies
+func handleMLModelNotification(c *gin.Context, engine *analytics.AnalyticsEngine) {
+	logger.SbiLog.Infoln("Handle MLModelNotification")
+
+	var notification analytics.MLModelNotification
+	if err := c.ShouldBindJSON(&notification); err != nil {
+		logger.SbiLog.Errorf("Invalid request body: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if err := engine.FetchModels(c.Request.Context(), notification.EventNotifs); err != nil {
+		logger.SbiLog.Errorf("Failed to fetch models: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// handlePeerNotification keeps the analytics a peer notified for a
+// subscription an aggregator federated
+func handlePeerNotification(c *gin.Context, engine *analytics.AnalyticsEngine) {
+	logger.SbiLog.Infoln("Handle PeerNotification")
+
+	var notification analytics.EventNotification
+	if err := c.ShouldBindJSON(&notification); err != nil {
+		logger.SbiLog.Errorf("Invalid request body: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if !engine.HandlePeerNotification(c.Param("subscriptionId"), &notification) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subscription not found"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Data management handlers
+
+func handleCreateDataSubscription(c *gin.Context, ctx *nwdafContext.NWDAFContext, engine *analytics.AnalyticsEngine) {
+	logger.SbiLog.Infoln("Handle CreateDataSubscription")
+
+	var subscription nwdafContext.DataSubscription
+	if err := c.ShouldBindJSON(&subscription); err != nil {
+		logger.SbiLog.Errorf("Invalid request body: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if err := engine.NewDataSubscription(&subscription); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	subscription.SubscriptionId = uuid.New().String()
+	ctx.AddDataSubscription(&subscription)
+
+	logger.SbiLog.Infof("Created data subscription: %s", subscription.SubscriptionId)
+
+	c.JSON(http.StatusCreated, &subscription)
+}
+
+func handleGetDataSubscription(c *gin.Context, ctx *nwdafContext.NWDAFContext) {
+	logger.SbiLog.Infoln("Handle GetDataSubscription")
+
+	sub, ok := ctx.GetDataSubscription(c.Param("subscriptionId"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subscription not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, sub)
+}
+
+func handleDeleteDataSubscription(c *gin.Context, ctx *nwdafContext.NWDAFContext) {
+	logger.SbiLog.Infoln("Handle DeleteDataSubscription")
+
+	subscriptionId := c.Param("subscriptionId")
+
+	if _, ok := ctx.GetDataSubscription(subscriptionId); !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subscription not found"})
+		return
+	}
+
+	ctx.RemoveDataSubscription(subscriptionId)
+
+	logger.SbiLog.Infof("Deleted data subscription: %s", subscriptionId)
+
+	c.Status(http.StatusNoContent)
+}
+
+func handleFetchData(c *gin.Context, engine *analytics.AnalyticsEngine) {
+	logger.SbiLog.Infoln("Handle FetchData")
+
+	var req analytics.DataRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.SbiLog.Errorf("Invalid request body: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	data, err := engine.FetchData(c.Request.Context(), &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, data)
+}
+
+// ADRF stub handlers
+
+func handleStoreRecord(c *gin.Context, stub *adrf.Stub) {
+	logger.SbiLog.Infoln("Handle StoreRecord")
+
+	var record adrf.DataStoreRecord
+	if err := c.ShouldBindJSON(&record); err != nil || record.RecordType == "" {
+		logger.SbiLog.Errorf("Invalid request body: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	recordId, _ := stub.Store(c.Request.Context(), &record)
+	record.RecordId = recordId
+
+	c.Header("Location", adrf.DataManagementPath+"/data-store-records/"+recordId)
+	c.JSON(http.StatusCreated, &record)
+}
+
+func handleRetrieveRecords(c *gin.Context, stub *adrf.Stub) {
+	logger.SbiLog.Infoln("Handle RetrieveRecords")
+
+	query, err := adrf.ParseQuery(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	records, _ := stub.Retrieve(c.Request.Context(), query)
+
+	c.JSON(http.StatusOK, records)
+}
+
+func handleGetRecord(c *gin.Context, stub *adrf.Stub) {
+	logger.SbiLog.Infoln("Handle GetRecord")
+
+	record, ok := stub.Get(c.Param("recordId"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Record not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, record)
+}
+
+func handleDeleteRecord(c *gin.Context, stub *adrf.Stub) {
+	logger.SbiLog.Infoln("Handle DeleteRecord")
+
+	if !stub.Delete(c.Param("recordId")) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Record not found"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// readFormFile returns a multipart field either uploaded as a file or sent
+// as a plain form value
+func readFormFile(c *gin.Context, name string) ([]byte, error) {
+	if fh, err := c.FormFile(name); err == nil {
+		f, err := fh.Open()
+		if err != nil {
+			return nil, fmt.Errorf("cannot read '%s' file", name)
+		}
+		defer f.Close()
+		return io.ReadAll(f)
+	}
+	if value := c.PostForm(name); value != "" {
+		return []byte(value), nil
+	}
+	return nil, fmt.Errorf("missing '%s' field", name)
+}
+
 // Agent Handlers
 
 func handleAgentDirectMetrics(c *gin.Context, a *agent.Agent) {
@@ -0,0 +1,99 @@
+package sbi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/free5gc/nwdaf/pkg/analytics"
+	nwdafContext "github.com/free5gc/nwdaf/pkg/context"
+	"github.com/free5gc/nwdaf/pkg/factory"
+	"github.com/gin-gonic/gin"
+)
+
+// newNwdaf serves the SBI of an AnLF over a fresh context
+func newNwdaf(t *testing.T, nfId string) (*analytics.AnalyticsEngine, *nwdafContext.NWDAFContext, *httptest.Server) {
+	ctx := &nwdafContext.NWDAFContext{
+		NfId:          nfId,
+		Subscriptions: make(map[string]*nwdafContext.AnalyticsSubscription),
+		DataStore:     nwdafContext.NewDataStore(),
+	}
+	engine := analytics.NewAnalyticsEngine(ctx)
+	router := gin.New()
+	RegisterRoutes(router, ctx, engine, nil, factory.ModeAnlf)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return engine, ctx, server
+}
+
+func TestSubscriptionHandover(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var mu sync.Mutex
+	var notifications []*analytics.SubscriptionTransferNotification
+	consumer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n analytics.SubscriptionTransferNotification
+		_ = json.NewDecoder(r.Body).Decode(&n)
+		mu.Lock()
+		notifications = append(notifications, &n)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer consumer.Close()
+
+	source, sourceCtx, sourceServer := newNwdaf(t, "nwdaf-a")
+	_, targetCtx, targetServer := newNwdaf(t, "nwdaf-b")
+
+	// The target fetches the UE context from the SBI URI of the source
+	sourceUrl, _ := url.Parse(sourceServer.URL)
+	port, _ := strconv.Atoi(sourceUrl.Port())
+	factory.NwdafConfig = &factory.Config{
+		Configuration: &factory.Configuration{
+			Sbi:            &factory.Sbi{Scheme: "http", RegisterIPv4: sourceUrl.Hostname(), Port: port},
+			AnalyticsDelay: 1,
+		},
+	}
+	defer func() { factory.NwdafConfig = nil }()
+
+	sourceCtx.UpdateUEStatistics("imsi-1", &nwdafContext.UEStatistics{SUPI: "imsi-1", Location: "tai-1", Timestamp: 100})
+	sourceCtx.AddSubscription(&nwdafContext.AnalyticsSubscription{
+		SubscriptionId:  "ue",
+		EventType:       "UE_MOBILITY",
+		ConsumerNfId:    "consumer",
+		NotificationUri: consumer.URL,
+		AnalyticsFilter: map[string]interface{}{"supis": []interface{}{"imsi-1"}},
+	})
+
+	summary := source.TransferSubscriptions(targetServer.URL, nil)
+	if summary.ContextError != "" || summary.Context == nil || summary.Context.Subscriptions != 1 {
+		t.Fatalf("Expected the UE context imported with its subscription, got %+v", summary)
+	}
+	if len(summary.Results) != 1 {
+		t.Fatalf("Expected 1 result, got %d", len(summary.Results))
+	}
+	if result := summary.Results[0]; result.TargetSubscriptionId != "ue" || !result.ConsumerNotified || result.Error != "" {
+		t.Errorf("Expected the subscription moved under its ID and its consumer notified, got %+v", result)
+	}
+
+	targetCtx.SubMutex.RLock()
+	created := len(targetCtx.Subscriptions)
+	targetCtx.SubMutex.RUnlock()
+	if created != 1 {
+		t.Errorf("Expected 1 subscription at the target, got %d", created)
+	}
+	if _, ok := targetCtx.GetSubscription("ue"); !ok {
+		t.Error("Expected the subscription to keep its ID at the target")
+	}
+	if _, ok := sourceCtx.GetSubscription("ue"); ok {
+		t.Error("Expected the subscription removed at the source")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(notifications) != 1 || notifications[0].SubscriptionId != "ue" {
+		t.Errorf("Expected one transfer notification for subscription ue, got %+v", notifications)
+	}
+}
@@ -0,0 +1,169 @@
+// Package adrf stores and retrieves analytics and collected data at an
+// Analytics Data Repository Function (Nadrf_DataManagement, TS 29.575) and
+// provides an in-memory stub ADRF for tests and single-node labs
+package adrf
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DataManagementPath is the API root path of Nadrf_DataManagement
+const DataManagementPath = "/nadrf-datamanagement/v1"
+
+const recordsPath = "/data-store-records"
+
+// Record types
+const (
+	// RecordAnalytics holds analytics generated by an NWDAF
+	RecordAnalytics = "ANALYTICS"
+	// RecordData holds data collected by an NWDAF
+	RecordData = "DATA"
+)
+
+// DataStoreRecord is one record stored at the ADRF (TS 29.575
+// DataStoreRecord)
+type DataStoreRecord struct {
+	// RecordId is assigned by the ADRF
+	RecordId     string `json:"recordId,omitempty"`
+	NfInstanceId string `json:"nfInstanceId,omitempty"`
+	RecordType   string `json:"recordType"`
+	// EventType is the analytics event of an ANALYTICS record
+	EventType string          `json:"eventType,omitempty"`
+	Filter    json.RawMessage `json:"filter,omitempty"`
+	// Time window (Unix seconds) the record covers
+	StartTs int64           `json:"startTs"`
+	EndTs   int64           `json:"endTs"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// Query selects stored records. Empty fields match every record; a record
+// matches the window when it overlaps it.
+type Query struct {
+	NfInstanceId string
+	RecordType   string
+	EventType    string
+	StartTs      int64
+	// A zero EndTs leaves the window open towards the future
+	EndTs int64
+}
+
+// Matches reports whether a record is selected
+func (q *Query) Matches(r *DataStoreRecord) bool {
+	return (q.NfInstanceId == "" || r.NfInstanceId == q.NfInstanceId) &&
+		(q.RecordType == "" || r.RecordType == q.RecordType) &&
+		(q.EventType == "" || r.EventType == q.EventType) &&
+		r.EndTs >= q.StartTs && (q.EndTs == 0 || r.StartTs <= q.EndTs)
+}
+
+// Values encodes the query as URI query parameters
+func (q *Query) Values() url.Values {
+	values := url.Values{}
+	for key, value := range map[string]string{"nfInstanceId": q.NfInstanceId, "recordType": q.RecordType, "eventType": q.EventType} {
+		if value != "" {
+			values.Set(key, value)
+		}
+	}
+	if q.StartTs != 0 {
+		values.Set("startTs", strconv.FormatInt(q.StartTs, 10))
+	}
+	if q.EndTs != 0 {
+		values.Set("endTs", strconv.FormatInt(q.EndTs, 10))
+	}
+	return values
+}
+
+// ParseQuery decodes a query from URI query parameters
+func ParseQuery(values url.Values) (*Query, error) {
+	q := &Query{
+		NfInstanceId: values.Get("nfInstanceId"),
+		RecordType:   values.Get("recordType"),
+		EventType:    values.Get("eventType"),
+	}
+	var err error
+	if v := values.Get("startTs"); v != "" {
+		if q.StartTs, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid startTs %q", v)
+		}
+	}
+	if v := values.Get("endTs"); v != "" {
+		if q.EndTs, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid endTs %q", v)
+		}
+	}
+	return q, nil
+}
+
+// Repository stores and retrieves records: a remote ADRF or the stub
+type Repository interface {
+	// Store stores a record and returns its identifier (StorageRequest)
+	Store(ctx context.Context, record *DataStoreRecord) (string, error)
+	// Retrieve returns the records a query selects, oldest first
+	// (RetrievalRequest)
+	Retrieve(ctx context.Context, q *Query) ([]*DataStoreRecord, error)
+}
+
+// Client talks to one ADRF
+type Client struct {
+	adrfUri string
+	client  *http.Client
+}
+
+func NewClient(adrfUri string, timeout time.Duration) *Client {
+	return &Client{
+		adrfUri: strings.TrimRight(adrfUri, "/"),
+		client:  &http.Client{Timeout: timeout},
+	}
+}
+
+func (c *Client) Store(ctx context.Context, record *DataStoreRecord) (string, error) {
+	body, err := json.Marshal(record)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.adrfUri+DataManagementPath+recordsPath, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	var stored DataStoreRecord
+	if err := c.do(req, http.StatusCreated, &stored); err != nil {
+		return "", err
+	}
+	return stored.RecordId, nil
+}
+
+func (c *Client) Retrieve(ctx context.Context, q *Query) ([]*DataStoreRecord, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.adrfUri+DataManagementPath+recordsPath+"?"+q.Values().Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []*DataStoreRecord
+	if err := c.do(req, http.StatusOK, &records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func (c *Client) do(req *http.Request, expected int, out interface{}) error {
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != expected {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("ADRF returned %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
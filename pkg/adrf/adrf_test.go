@@ -0,0 +1,89 @@
+package adrf
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStub(t *testing.T) {
+	stub := NewStub(2)
+	ctx := context.Background()
+	for _, r := range []*DataStoreRecord{
+		{RecordType: RecordData, StartTs: 0, EndTs: 100},
+		{RecordType: RecordAnalytics, EventType: "NF_LOAD", StartTs: 50, EndTs: 150},
+		{RecordType: RecordData, StartTs: 101, EndTs: 200},
+	} {
+		if id, err := stub.Store(ctx, r); err != nil || id == "" {
+			t.Fatalf("Store() = %q, %v", id, err)
+		}
+	}
+
+	// The oldest record was dropped
+	all, _ := stub.Retrieve(ctx, &Query{})
+	if len(all) != 2 || all[0].EventType != "NF_LOAD" {
+		t.Fatalf("Expected the 2 latest records, got %+v", all)
+	}
+	data, _ := stub.Retrieve(ctx, &Query{RecordType: RecordData, StartTs: 120, EndTs: 130})
+	if len(data) != 1 || data[0].StartTs != 101 {
+		t.Errorf("Expected the DATA record overlapping [120, 130], got %+v", data)
+	}
+	if none, _ := stub.Retrieve(ctx, &Query{StartTs: 300}); len(none) != 0 {
+		t.Errorf("Expected no record after 300, got %+v", none)
+	}
+
+	if !stub.Delete(all[0].RecordId) {
+		t.Error("Expected the record to be deleted")
+	}
+	if _, ok := stub.Get(all[0].RecordId); ok {
+		t.Error("Expected a deleted record to be gone")
+	}
+}
+
+func TestClient(t *testing.T) {
+	stub := NewStub(0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != DataManagementPath+recordsPath {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		switch r.Method {
+		case http.MethodPost:
+			var record DataStoreRecord
+			_ = json.NewDecoder(r.Body).Decode(&record)
+			record.RecordId, _ = stub.Store(r.Context(), &record)
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(&record)
+		case http.MethodGet:
+			q, err := ParseQuery(r.URL.Query())
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			records, _ := stub.Retrieve(r.Context(), q)
+			_ = json.NewEncoder(w).Encode(records)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL+"/", time.Second)
+	ctx := context.Background()
+	id, err := client.Store(ctx, &DataStoreRecord{NfInstanceId: "nwdaf-1", RecordType: RecordData, StartTs: 1, EndTs: 100, Data: json.RawMessage(`{"nf":{}}`)})
+	if err != nil || id == "" {
+		t.Fatalf("Store() = %q, %v", id, err)
+	}
+	if _, err := client.Store(ctx, &DataStoreRecord{NfInstanceId: "nwdaf-2", RecordType: RecordData, StartTs: 1, EndTs: 100}); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	records, err := client.Retrieve(ctx, &Query{NfInstanceId: "nwdaf-1", StartTs: 50, EndTs: 60})
+	if err != nil {
+		t.Fatalf("Retrieve() error = %v", err)
+	}
+	if len(records) != 1 || records[0].RecordId != id || string(records[0].Data) != `{"nf":{}}` {
+		t.Errorf("Expected the record of nwdaf-1, got %+v", records)
+	}
+}
@@ -0,0 +1,74 @@
+package adrf
+
+import (
+	"context"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// Stub is an in-memory ADRF keeping a bounded number of records, for tests
+// and single-node labs. Records are lost on restart.
+type Stub struct {
+	mu         sync.RWMutex
+	records    []*DataStoreRecord
+	maxRecords int
+}
+
+// NewStub returns an empty stub keeping at most maxRecords records, oldest
+// dropped first
+func NewStub(maxRecords int) *Stub {
+	return &Stub{maxRecords: maxRecords}
+}
+
+func (s *Stub) Store(_ context.Context, record *DataStoreRecord) (string, error) {
+	stored := *record
+	stored.RecordId = uuid.New().String()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, &stored)
+	if excess := len(s.records) - s.maxRecords; s.maxRecords > 0 && excess > 0 {
+		s.records = s.records[excess:]
+	}
+	return stored.RecordId, nil
+}
+
+// Retrieve returns the selected records in the order they were stored
+func (s *Stub) Retrieve(_ context.Context, q *Query) ([]*DataStoreRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]*DataStoreRecord, 0)
+	for _, r := range s.records {
+		if q.Matches(r) {
+			result = append(result, r)
+		}
+	}
+	return result, nil
+}
+
+// Get returns one record
+func (s *Stub) Get(recordId string) (*DataStoreRecord, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, r := range s.records {
+		if r.RecordId == recordId {
+			return r, true
+		}
+	}
+	return nil, false
+}
+
+// Delete removes one record
+func (s *Stub) Delete(recordId string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, r := range s.records {
+		if r.RecordId == recordId {
+			s.records = append(s.records[:i], s.records[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
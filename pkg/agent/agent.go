@@ -8,6 +8,8 @@ import (
 	"time"
 
 	"github.com/free5gc/nwdaf/internal/logger"
+	"github.com/free5gc/nwdaf/pkg/clock"
+	"github.com/free5gc/nwdaf/pkg/factory"
 	"github.com/tmc/langchaingo/agents"
 	"github.com/tmc/langchaingo/chains"
 	"github.com/tmc/langchaingo/llms/ollama"
@@ -27,6 +29,10 @@ type AgentConfig struct {
 	AutoSteerInterval     int
 	AutoSteerThresholdBps float64
 	AutoSteerCooldown     int
+	// Edges are the DNAIs traffic can be steered to
+	Edges                 []factory.EdgeConfig
+	// BranchingUpf carries the traffic not steered to an edge
+	BranchingUpf          factory.BranchingUpfConfig
 }
 
 type Agent struct {
@@ -37,6 +43,11 @@ type Agent struct {
 	cancel          context.CancelFunc
 	MonitorRunning  bool
 	LastSteerTime   time.Time
+
+	// Clock drives the auto-steer monitor; replaced by a virtual clock on replay
+	Clock clock.Clock
+	// RateSource overrides the Prometheus query for per-UPF traffic rates
+	RateSource func() (map[string]float64, error)
 }
 
 func NewAgent() *Agent {
@@ -54,10 +65,17 @@ func NewAgent() *Agent {
 		AutoSteerThresholdBps: getEnvFloat("AUTO_STEER_THRESHOLD_BPS", 100000),
 		AutoSteerCooldown:     getEnvInt("AUTO_STEER_COOLDOWN", 60),
 	}
+	var configuration *factory.Configuration
+	if factory.NwdafConfig != nil {
+		configuration = factory.NwdafConfig.Configuration
+	}
+	config.Edges = configuration.GetEdges()
+	config.BranchingUpf = configuration.GetBranchingUpf()
 
 	agent := &Agent{
 		Config: config,
 		LLM:    NewLLMClient(config.OllamaBase, config.ModelName),
+		Clock:  clock.Real,
 	}
 
 	// Initialize LangChainGo agent with tools
@@ -138,10 +156,10 @@ User Request: %s
 
 Think step by step:
 1. If the user asks about metrics, traffic, or network status, use get_upf_network_metrics first
-2. If the user wants to steer or redirect traffic, use steer_traffic with "edge1" or "edge2"
+2. If the user wants to steer or redirect traffic, use steer_traffic with %s
 3. Provide a helpful response based on the tool results
 
-Do not write code. Use the available tools to accomplish the task.`, request)
+Do not write code. Use the available tools to accomplish the task.`, request, a.edgeChoices())
 
 	result, err := chains.Run(ctx, a.AgentExecutor, enhancedRequest)
 	if err != nil {
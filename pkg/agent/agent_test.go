@@ -1,8 +1,14 @@
 package agent
 
 import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
+
+	"github.com/free5gc/nwdaf/pkg/factory"
 )
 
 func TestNewAgent(t *testing.T) {
@@ -28,3 +34,63 @@ func TestSteerTrafficValidation(t *testing.T) {
 		t.Error("Expected error message for invalid target")
 	}
 }
+
+func TestEdgeCatalog(t *testing.T) {
+	prometheus := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"success","data":{"result":[
+			{"metric":{"pod":"upf-mec-a-0"},"value":[0,"1000"]},
+			{"metric":{"pod":"upf-mec-b-0"},"value":[0,"300"]},
+			{"metric":{"pod":"upf-mec-b-1"},"value":[0,"200"]},
+			{"metric":{"pod":"upfb-0"},"value":[0,"700"]}]}}`))
+	}))
+	defer prometheus.Close()
+
+	var steered string
+	nef := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			var body struct {
+				TrafficRoutes []struct {
+					Dnai string `json:"dnai"`
+				} `json:"trafficRoutes"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			steered = body.TrafficRoutes[0].Dnai
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"self":"/subscriptions/1"}`))
+			return
+		}
+		w.Write([]byte(`[]`))
+	}))
+	defer nef.Close()
+
+	agent := &Agent{Config: AgentConfig{
+		PrometheusUrl: prometheus.URL,
+		NefUrl:        nef.URL,
+		Edges: []factory.EdgeConfig{
+			{Dnai: "mec-a", AnchorUpf: "UPF-A", Pool: "10.2.0.0/16", PodSelector: "mec-a"},
+			{Dnai: "mec-b", AnchorUpf: "UPF-B", PodSelector: "mec-b", Capacity: 50000},
+		},
+		BranchingUpf: factory.BranchingUpfConfig{Name: "upfb", PodSelector: "upfb"},
+	}}
+
+	rates, err := agent.getUpfTrafficRates()
+	if err != nil {
+		t.Fatalf("getUpfTrafficRates() error = %v", err)
+	}
+	if rates["mec-a"] != 1000 || rates["mec-b"] != 500 || rates["upfb"] != 700 {
+		t.Errorf("Expected rates aggregated per DNAI, got %v", rates)
+	}
+
+	description := NewSteerTrafficTool(agent).Description()
+	if !strings.Contains(description, `"mec-a" or "mec-b"`) || !strings.Contains(description, "UPF-B") {
+		t.Errorf("Expected the catalog in the tool description, got %s", description)
+	}
+
+	if res, _ := agent.SteerTraffic("edge1"); !strings.Contains(res, `"mec-a" or "mec-b"`) {
+		t.Errorf("Expected a DNAI outside the catalog to be refused, got %s", res)
+	}
+	res, _ := agent.SteerTraffic("MEC-B")
+	if steered != "mec-b" || !strings.Contains(res, "UPF-B") {
+		t.Errorf("Expected traffic steered to mec-b through UPF-B, got %q: %s", steered, res)
+	}
+}
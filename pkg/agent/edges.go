@@ -0,0 +1,59 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/free5gc/nwdaf/pkg/factory"
+)
+
+// findEdge returns the catalog entry of a DNAI, matched case-insensitively
+func (a *Agent) findEdge(dnai string) (factory.EdgeConfig, bool) {
+	for _, e := range a.Config.Edges {
+		if strings.EqualFold(e.Dnai, dnai) {
+			return e, true
+		}
+	}
+	return factory.EdgeConfig{}, false
+}
+
+// edgePosition returns the position of a DNAI in the catalog starting at 1,
+// 0 if it is not listed
+func (a *Agent) edgePosition(dnai string) int {
+	for i, e := range a.Config.Edges {
+		if strings.EqualFold(e.Dnai, dnai) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// edgeOfPod returns the DNAI whose pod selector matches a UPF pod, "" if none
+func (a *Agent) edgeOfPod(pod string) string {
+	for _, e := range a.Config.Edges {
+		if e.MatchesPod(pod) {
+			return e.Dnai
+		}
+	}
+	return ""
+}
+
+// edgeChoices lists the DNAIs of the catalog quoted, e.g. "edge1" or "edge2"
+func (a *Agent) edgeChoices() string {
+	quoted := make([]string, len(a.Config.Edges))
+	for i, e := range a.Config.Edges {
+		quoted[i] = fmt.Sprintf("%q", e.Dnai)
+	}
+	if len(quoted) < 2 {
+		return strings.Join(quoted, "")
+	}
+	return strings.Join(quoted[:len(quoted)-1], ", ") + " or " + quoted[len(quoted)-1]
+}
+
+// formatCapacity describes the capacity of an edge
+func formatCapacity(e factory.EdgeConfig) string {
+	if e.Capacity <= 0 {
+		return "unbounded"
+	}
+	return fmt.Sprintf("%.2f KB/s", e.Capacity/1000)
+}
@@ -3,6 +3,7 @@ package agent
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"strings"
 )
 
@@ -49,12 +50,22 @@ func (t *SteerTrafficTool) Name() string {
 }
 
 func (t *SteerTrafficTool) Description() string {
-	return `Steer 5G traffic to a specific edge UPF via the NEF API.
-Input should be the target edge: either "edge1" or "edge2".
-- edge1: Routes traffic through AnchorUPF1 (IP pool 10.1.0.0/17)
-- edge2: Routes traffic through AnchorUPF2 (IP pool 10.1.128.0/17)
-Use this tool when you need to redirect traffic, balance load between edges,
-or respond to high traffic conditions.`
+	var sb strings.Builder
+	sb.WriteString("Steer 5G traffic to a specific edge UPF via the NEF API.\n")
+	sb.WriteString(fmt.Sprintf("Input should be the target edge: one of %s.\n", t.agent.edgeChoices()))
+	for _, e := range t.agent.Config.Edges {
+		sb.WriteString(fmt.Sprintf("- %s: Routes traffic through %s", e.Dnai, e.AnchorUpf))
+		if e.Pool != "" {
+			sb.WriteString(fmt.Sprintf(" (IP pool %s)", e.Pool))
+		}
+		if e.Capacity > 0 {
+			sb.WriteString(fmt.Sprintf(", capacity %s", formatCapacity(e)))
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString(`Use this tool when you need to redirect traffic, balance load between edges,
+or respond to high traffic conditions.`)
+	return sb.String()
 }
 
 func (t *SteerTrafficTool) Call(ctx context.Context, input string) (string, error) {
@@ -84,7 +84,7 @@ var (
 	CurrentTarget = promauto.NewGauge(
 		prometheus.GaugeOpts{
 			Name: "traffic_steering_current_target",
-			Help: "Current steering target (1=edge1, 2=edge2, 0=none)",
+			Help: "Current steering target (position of its DNAI in the edge catalog starting at 1, 0=none)",
 		},
 	)
 
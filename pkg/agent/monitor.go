@@ -22,7 +22,7 @@ func (a *Agent) StartAutoSteerMonitor() {
 	a.MonitorRunning = true
 
 	go func() {
-		ticker := time.NewTicker(time.Duration(a.Config.AutoSteerInterval) * time.Second)
+		ticker := a.Clock.NewTicker(time.Duration(a.Config.AutoSteerInterval) * time.Second)
 		defer ticker.Stop()
 
 		for {
@@ -30,7 +30,7 @@ func (a *Agent) StartAutoSteerMonitor() {
 			case <-a.ctx.Done():
 				a.MonitorRunning = false
 				return
-			case <-ticker.C:
+			case <-ticker.C():
 				a.monitorLoop()
 			}
 		}
@@ -39,29 +39,31 @@ func (a *Agent) StartAutoSteerMonitor() {
 
 func (a *Agent) monitorLoop() {
 	// Get traffic rates
-	rates, err := a.getUpfTrafficRates()
+	getRates := a.getUpfTrafficRates
+	if a.RateSource != nil {
+		getRates = a.RateSource
+	}
+	rates, err := getRates()
 	if err != nil {
 		logger.AppLog.Errorf("⚠️  Monitor error querying traffic: %v", err)
 		return
 	}
 
 	// Update Prometheus metrics
-	UpfTrafficRate.WithLabelValues("edge1").Set(rates["edge1"])
-	UpfTrafficRate.WithLabelValues("edge2").Set(rates["edge2"])
-	UpfTrafficRate.WithLabelValues("upfb").Set(rates["upfb"])
+	var summary []string
+	for _, e := range a.Config.Edges {
+		UpfTrafficRate.WithLabelValues(e.Dnai).Set(rates[e.Dnai])
+		summary = append(summary, fmt.Sprintf("%s: %.1f KB/s", e.Dnai, rates[e.Dnai]/1000))
+	}
+	branching := a.Config.BranchingUpf.Name
+	UpfTrafficRate.WithLabelValues(branching).Set(rates[branching])
+	summary = append(summary, fmt.Sprintf("%s: %.1f KB/s", branching, rates[branching]/1000))
 
 	// Check active policy
 	activePolicy := a.getActivePolicy()
-	var currentTarget float64
-	if activePolicy == "edge1" {
-		currentTarget = 1
-	} else if activePolicy == "edge2" {
-		currentTarget = 2
-	}
-	CurrentTarget.Set(currentTarget)
+	CurrentTarget.Set(float64(a.edgePosition(activePolicy)))
 
-	logger.AppLog.Infof("📈 Traffic rates - edge1: %.1f KB/s, edge2: %.1f KB/s, upfb: %.1f KB/s (policy: %s)",
-		rates["edge1"]/1000, rates["edge2"]/1000, rates["upfb"]/1000, activePolicy)
+	logger.AppLog.Infof("📈 Traffic rates - %s (policy: %s)", strings.Join(summary, ", "), activePolicy)
 
 	// Ask LLM
 	decision := a.askLlmForDecision(rates, activePolicy)
@@ -74,7 +76,10 @@ func (a *Agent) monitorLoop() {
 }
 
 func (a *Agent) getUpfTrafficRates() (map[string]float64, error) {
-	rates := map[string]float64{"edge1": 0, "edge2": 0, "upfb": 0}
+	rates := map[string]float64{a.Config.BranchingUpf.Name: 0}
+	for _, e := range a.Config.Edges {
+		rates[e.Dnai] = 0
+	}
 
 	// Use a simpler query per-pod like in tools.go
 	query := `rate(container_network_receive_bytes_total{namespace="free5gc",pod=~".*upf.*"}[1m])`
@@ -122,7 +127,6 @@ func (a *Agent) getUpfTrafficRates() (map[string]float64, error) {
 		}
 
 		pod, _ := metric["pod"].(string)
-		podLower := strings.ToLower(pod)
 
 		// Get value
 		value, ok := r["value"].([]interface{})
@@ -138,13 +142,11 @@ func (a *Agent) getUpfTrafficRates() (map[string]float64, error) {
 		var val float64
 		fmt.Sscanf(valStr, "%f", &val)
 
-		// Aggregate by UPF type
-		if strings.Contains(podLower, "upf1") || (strings.Contains(podLower, "anchor") && strings.Contains(podLower, "1")) {
-			rates["edge1"] += val
-		} else if strings.Contains(podLower, "upf2") || (strings.Contains(podLower, "anchor") && strings.Contains(podLower, "2")) {
-			rates["edge2"] += val
-		} else if strings.Contains(podLower, "upfb") {
-			rates["upfb"] += val
+		// Aggregate by edge, the first matching pod selector winning
+		if dnai := a.edgeOfPod(pod); dnai != "" {
+			rates[dnai] += val
+		} else if a.Config.BranchingUpf.MatchesPod(pod) {
+			rates[a.Config.BranchingUpf.Name] += val
 		}
 	}
 
@@ -168,9 +170,8 @@ func (a *Agent) getActivePolicy() string {
 		if err := json.NewDecoder(resp.Body).Decode(&subs); err == nil {
 			for _, sub := range subs {
 				for _, route := range sub.TrafficRoutes {
-					dnai := strings.ToLower(route.Dnai)
-					if dnai == "edge1" || dnai == "edge2" {
-						return dnai
+					if e, ok := a.findEdge(route.Dnai); ok {
+						return e.Dnai
 					}
 				}
 			}
@@ -187,39 +188,48 @@ type SteeringDecision struct {
 
 func (a *Agent) askLlmForDecision(rates map[string]float64, activePolicy string) SteeringDecision {
 	// Check cooldown
-	if time.Since(a.LastSteerTime).Seconds() < float64(a.Config.AutoSteerCooldown) {
+	if a.Clock.Since(a.LastSteerTime).Seconds() < float64(a.Config.AutoSteerCooldown) {
 		return SteeringDecision{false, "", "cooldown"}
 	}
 
-	edge1Kb := rates["edge1"] / 1000
-	edge2Kb := rates["edge2"] / 1000
-	upfbKb := rates["upfb"] / 1000
+	upfbKb := rates[a.Config.BranchingUpf.Name] / 1000
 	thresholdKb := a.Config.AutoSteerThresholdBps / 1000
 
+	var metrics strings.Builder
+	decisions := make([]string, 0, len(a.Config.Edges)+1)
+	for _, e := range a.Config.Edges {
+		metrics.WriteString(fmt.Sprintf("- %s traffic: %.2f KB/s (anchor %s, capacity %s)\n", e.Dnai, rates[e.Dnai]/1000, e.AnchorUpf, formatCapacity(e)))
+		decisions = append(decisions, fmt.Sprintf("%q", e.Dnai))
+	}
+	decisions = append(decisions, `"none"`)
+	first := ""
+	if len(a.Config.Edges) > 0 {
+		first = a.Config.Edges[0].Dnai
+	}
+
 	prompt := fmt.Sprintf(`You are a 5G traffic steering expert. Based on these metrics, decide if traffic steering is needed.
 
 METRICS:
-- Edge1 traffic: %.2f KB/s
-- Edge2 traffic: %.2f KB/s
-- UPFB traffic: %.2f KB/s
+%s- UPFB traffic: %.2f KB/s
 - Active policy: %s
 - Threshold: %.2f KB/s
 
 RULES:
-1. If no policy exists and UPFB > threshold: steer to the edge with LOWER traffic (if equal, choose edge1)
-2. If policy exists and that edge > threshold: rebalance to the other edge (if it has 20%% less traffic)
-3. Otherwise: no action needed
+1. If no policy exists and UPFB > threshold: steer to the edge with the LOWEST traffic (if equal, choose the first listed, %s)
+2. If policy exists and that edge > threshold: rebalance to the edge with the lowest traffic (if it has 20%% less traffic)
+3. Never choose an edge whose traffic plus the UPFB traffic would exceed its capacity
+4. Otherwise: no action needed
 
 Respond with a JSON object:
 {
   "analysis": "Step-by-step analysis of the metrics against the rules. Mention exact values and thresholds compared.",
   "reasoning": "Final justification for the decision.",
-  "decision": "edge1" | "edge2" | "none"
+  "decision": %s
 }
 
-IMPORTANT: If UPFB traffic exceeds threshold and no policy exists, you MUST choose edge1 or edge2, NOT none!
+IMPORTANT: If UPFB traffic exceeds threshold and no policy exists, you MUST choose %s, NOT none!
 
-Your JSON response:`, edge1Kb, edge2Kb, upfbKb, activePolicy, thresholdKb)
+Your JSON response:`, metrics.String(), upfbKb, activePolicy, thresholdKb, first, strings.Join(decisions, " | "), a.edgeChoices())
 
 	logger.AppLog.Infoln("🤖 Asking LLM for steering decision...")
 	response, err := a.LLM.Query(prompt)
@@ -248,13 +258,10 @@ Your JSON response:`, edge1Kb, edge2Kb, upfbKb, activePolicy, thresholdKb)
 		return SteeringDecision{false, "", "json_parse_error"}
 	}
 
-	decisionClean := strings.ToLower(strings.TrimSpace(result.Decision))
 	fullReason := fmt.Sprintf("Analysis: %s | Reasoning: %s", result.Analysis, result.Reasoning)
 
-	if decisionClean == "edge1" {
-		return SteeringDecision{true, "edge1", fullReason}
-	} else if decisionClean == "edge2" {
-		return SteeringDecision{true, "edge2", fullReason}
+	if e, ok := a.findEdge(strings.TrimSpace(result.Decision)); ok {
+		return SteeringDecision{true, e.Dnai, fullReason}
 	}
 
 	return SteeringDecision{false, "", fullReason}
@@ -269,7 +276,7 @@ func (a *Agent) executeSteering(target, reason string) {
 	// Execute using tool
 	res, _ := a.SteerTraffic(target)
 	if strings.Contains(res, "✅") {
-		a.LastSteerTime = time.Now()
+		a.LastSteerTime = a.Clock.Now()
 		AutoSteerTriggers.WithLabelValues(oldTarget, target, reason).Inc()
 		logger.AppLog.Infof("✅ LLM auto-steer successful: now routing through %s", target)
 	} else {
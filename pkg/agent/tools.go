@@ -133,10 +133,11 @@ func (a *Agent) GetUPFNetworkMetrics() (string, error) {
 
 // Tool 2: Steer Traffic via NEF API
 func (a *Agent) SteerTraffic(target string) (string, error) {
-	target = strings.ToLower(strings.TrimSpace(target))
-	if target != "edge1" && target != "edge2" {
-		return fmt.Sprintf("❌ Invalid target: '%s'. Must be 'edge1' or 'edge2'", target), nil
+	edge, ok := a.findEdge(strings.TrimSpace(target))
+	if !ok {
+		return fmt.Sprintf("❌ Invalid target: '%s'. Must be %s", strings.TrimSpace(target), a.edgeChoices()), nil
 	}
+	target = edge.Dnai
 
 	baseUrl := fmt.Sprintf("%s/3gpp-traffic-influence/v1/%s/subscriptions", a.Config.NefUrl, a.Config.AfId)
 
@@ -214,11 +215,9 @@ func (a *Agent) SteerTraffic(target string) (string, error) {
 			subId = parts[len(parts)-1]
 		}
 
-		upfName := "AnchorUPF1"
-		pool := "10.1.0.0/17"
-		if target == "edge2" {
-			upfName = "AnchorUPF2"
-			pool = "10.1.128.0/17"
+		upfName, pool := edge.AnchorUpf, edge.Pool
+		if pool == "" {
+			pool = "not configured"
 		}
 
 		logger.AppLog.Infof("Traffic steering created: target=%s subId=%s", target, subId)
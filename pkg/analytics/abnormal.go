@@ -0,0 +1,645 @@
+package analytics
+
+import (
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/free5gc/nwdaf/internal/logger"
+	nwdafContext "github.com/free5gc/nwdaf/pkg/context"
+	"github.com/free5gc/nwdaf/pkg/factory"
+)
+
+// Exception identifiers (TS 29.520 ExceptionId)
+const (
+	ExceptionUnexpectedLocation = "UNEXPECTED_UE_LOCATION"
+	// Raised for traffic volume well above the UE's baseline
+	ExceptionUnexpectedLargeRateFlow = "UNEXPECTED_LARGE_RATE_FLOW"
+	ExceptionPingPong                = "PING_PONG_ACROSS_CELLS"
+	ExceptionDDoS                    = "SUSPICION_OF_DDOS_ATTACK"
+)
+
+// maxExceptionLevel caps the severity reported in excepLevel
+const maxExceptionLevel = 10
+
+type Exception struct {
+	ExcepId    string `json:"excepId"`
+	ExcepLevel int    `json:"excepLevel"`
+}
+
+// AbnormalBehaviour is a detected exception (TS 29.520 AbnormalBehaviour).
+// Ratio is the percentage of the UEs in scope showing it.
+type AbnormalBehaviour struct {
+	Supis        []string               `json:"supis,omitempty"`
+	IntGroupId   string                 `json:"intGroupId,omitempty"`
+	Excep        Exception              `json:"excep"`
+	Ratio        int                    `json:"ratio"`
+	Timestamp    int64                  `json:"timestamp"`
+	AddtMeasInfo map[string]interface{} `json:"addtMeasInfo,omitempty"`
+}
+
+// abnormalEvent is a detection along with who it is about. Group-level events
+// either belong to a configured group or, with an empty group, to all UEs.
+type abnormalEvent struct {
+	behaviour  *AbnormalBehaviour
+	supi       string
+	groupId    string
+	groupLevel bool
+}
+
+// abnormalState remembers when each exception was last pushed so that a
+// persisting condition is not reported on every sample. It also keeps the
+// running group traffic that live DDoS checks update, and the queue that
+// pushes detections to subscribers.
+type abnormalState struct {
+	mu     sync.Mutex
+	last   map[string]int64
+	groups map[string]*groupTraffic // by group id, "" for all UEs
+
+	pushes chan abnormalPush
+	start  sync.Once
+}
+
+// abnormalPush is a detection waiting to be sent to one subscription
+type abnormalPush struct {
+	sub  *nwdafContext.AnalyticsSubscription
+	data map[string]interface{}
+}
+
+const (
+	// abnormalQueueSize bounds the detections waiting to be pushed; beyond it
+	// they are dropped rather than piling up goroutines
+	abnormalQueueSize = 256
+	// abnormalPushWorkers is how many detections are pushed at once
+	abnormalPushWorkers = 4
+)
+
+func newAbnormalState() *abnormalState {
+	return &abnormalState{
+		last:   make(map[string]int64),
+		groups: make(map[string]*groupTraffic),
+		pushes: make(chan abnormalPush, abnormalQueueSize),
+	}
+}
+
+func (s *abnormalState) shouldPush(key string, ts, suppress int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if last, ok := s.last[key]; ok && ts-last < suppress {
+		return false
+	}
+	s.last[key] = ts
+	return true
+}
+
+// expire forgets the pushes made before the given time, which can no longer
+// hold back a repeat
+func (s *abnormalState) expire(before int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, last := range s.last {
+		if last < before {
+			delete(s.last, key)
+		}
+	}
+}
+
+// resetGroups drops the running group traffic, e.g. once no one subscribes;
+// it is seeded again from the stored history when needed
+func (s *abnormalState) resetGroups() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.groups) > 0 {
+		s.groups = make(map[string]*groupTraffic)
+	}
+}
+
+// baseline holds the mean and EWMA band of a series
+type baseline struct {
+	mean, std     float64
+	ewma, ewmaStd float64
+}
+
+func newBaseline(values []float64, alpha float64) baseline {
+	var b baseline
+	if len(values) == 0 {
+		return b
+	}
+	b.mean = mean(values)
+	var sse float64
+	for _, v := range values {
+		sse += (v - b.mean) * (v - b.mean)
+	}
+	b.std = math.Sqrt(sse / float64(len(values)))
+
+	b.ewma = values[0]
+	var variance float64
+	for _, v := range values[1:] {
+		d := v - b.ewma
+		b.ewma += alpha * d
+		variance = (1 - alpha) * (variance + alpha*d*d)
+	}
+	b.ewmaStd = math.Sqrt(variance)
+	return b
+}
+
+// surge returns the z-score of x and whether x lies above both the z-score
+// threshold and the EWMA band
+func (b baseline) surge(x, k float64) (float64, bool) {
+	// A flat history still flags a clear jump
+	floor := 1e-6 * math.Max(math.Abs(b.mean), 1)
+	z := (x - b.mean) / math.Max(b.std, floor)
+	upper := b.ewma + k*math.Max(b.ewmaStd, floor)
+	return z, z >= k && x > upper
+}
+
+func exceptionLevel(v float64) int {
+	return max(1, min(maxExceptionLevel, int(v)))
+}
+
+// detectUE checks one UE sample against the UE's history before it
+func detectUE(sample *nwdafContext.UEStatistics, history []*nwdafContext.UEStatistics, cfg factory.AbnormalBehaviourConfig) []*abnormalEvent {
+	var events []*abnormalEvent
+	raise := func(excepId string, level int, info map[string]interface{}) {
+		events = append(events, &abnormalEvent{
+			supi: sample.SUPI,
+			behaviour: &AbnormalBehaviour{
+				Supis:        []string{sample.SUPI},
+				Excep:        Exception{ExcepId: excepId, ExcepLevel: level},
+				Ratio:        100,
+				Timestamp:    sample.Timestamp,
+				AddtMeasInfo: info,
+			},
+		})
+	}
+
+	if len(history) >= cfg.MinSamples {
+		values := make([]float64, len(history))
+		for i, s := range history {
+			values[i] = s.Throughput
+		}
+		b := newBaseline(values, cfg.EwmaAlpha)
+		if z, ok := b.surge(sample.Throughput, cfg.ZScore); ok {
+			raise(ExceptionUnexpectedLargeRateFlow, exceptionLevel(z), map[string]interface{}{
+				"throughput": sample.Throughput,
+				"expected":   b.ewma,
+				"zScore":     z,
+			})
+		}
+	}
+
+	if sample.Location != "" {
+		seen, total := 0, 0
+		for _, s := range history {
+			if s.Location == "" {
+				continue
+			}
+			total++
+			if s.Location == sample.Location {
+				seen++
+			}
+		}
+		if total >= cfg.MinSamples {
+			share := float64(seen) / float64(total)
+			if share < cfg.RareLocationRatio {
+				raise(ExceptionUnexpectedLocation, exceptionLevel(math.Ceil((1-share/cfg.RareLocationRatio)*maxExceptionLevel)), map[string]interface{}{
+					"location":      sample.Location,
+					"locationRatio": share,
+				})
+			}
+		}
+	}
+
+	// Ping-pong is raised by the sample that returns to the location left
+	// just before
+	var recent []*nwdafContext.UEStatistics
+	for _, s := range history {
+		if s.Timestamp >= sample.Timestamp-int64(cfg.PingPongWindow) {
+			recent = append(recent, s)
+		}
+	}
+	visits := trajectory(append(recent, sample))
+	if n := len(visits); n >= 3 && visits[n-1].EnterTs == sample.Timestamp && visits[n-1].Tai == visits[n-3].Tai {
+		returns := 0
+		for i := 2; i < n; i++ {
+			if visits[i].Tai == visits[i-2].Tai {
+				returns++
+			}
+		}
+		if returns >= cfg.PingPongCount {
+			raise(ExceptionPingPong, exceptionLevel(float64(returns)), map[string]interface{}{
+				"locations": []string{visits[n-2].Tai, visits[n-1].Tai},
+				"returns":   returns,
+			})
+		}
+	}
+	return events
+}
+
+// groupTraffic is the throughput of a set of UEs bucketed by time: per UE the
+// average of its samples in each bucket, and their sum. It is updated one
+// sample at a time and forgets buckets older than its horizon.
+type groupTraffic struct {
+	step      int64
+	from      int64
+	perUE     map[string]map[int64]*bucketMean
+	totals    map[int64]float64
+	reporting map[int64][]string // UEs with samples in each bucket
+	buckets   []int64
+}
+
+// bucketMean accumulates the samples of one UE in one bucket
+type bucketMean struct {
+	sum   float64
+	count int
+}
+
+func (m *bucketMean) mean() float64 {
+	return m.sum / float64(m.count)
+}
+
+func newGroupTraffic(histories map[string][]*nwdafContext.UEStatistics, step int64) *groupTraffic {
+	g := &groupTraffic{
+		step:      step,
+		from:      math.MinInt64,
+		perUE:     make(map[string]map[int64]*bucketMean),
+		totals:    make(map[int64]float64),
+		reporting: make(map[int64][]string),
+	}
+	for _, samples := range histories {
+		for _, s := range samples {
+			g.add(s)
+		}
+	}
+	return g
+}
+
+// add folds a sample into its UE's bucket average and the bucket total
+func (g *groupTraffic) add(s *nwdafContext.UEStatistics) {
+	b := s.Timestamp / g.step * g.step
+	if b < g.from {
+		return
+	}
+	if _, ok := g.totals[b]; !ok {
+		i := sort.Search(len(g.buckets), func(i int) bool { return g.buckets[i] >= b })
+		g.buckets = append(g.buckets, 0)
+		copy(g.buckets[i+1:], g.buckets[i:])
+		g.buckets[i] = b
+	}
+
+	averages, ok := g.perUE[s.SUPI]
+	if !ok {
+		averages = make(map[int64]*bucketMean)
+		g.perUE[s.SUPI] = averages
+	}
+	m, ok := averages[b]
+	if ok {
+		g.totals[b] -= m.mean()
+	} else {
+		m = &bucketMean{}
+		averages[b] = m
+		g.reporting[b] = append(g.reporting[b], s.SUPI)
+	}
+	m.sum += s.Throughput
+	m.count++
+	g.totals[b] += m.mean()
+}
+
+// evict drops the buckets before from
+func (g *groupTraffic) evict(from int64) {
+	if from <= g.from {
+		return
+	}
+	g.from = from
+	i := sort.Search(len(g.buckets), func(i int) bool { return g.buckets[i] >= from })
+	if i == 0 {
+		return
+	}
+	for _, b := range g.buckets[:i] {
+		for _, supi := range g.reporting[b] {
+			delete(g.perUE[supi], b)
+			if len(g.perUE[supi]) == 0 {
+				delete(g.perUE, supi)
+			}
+		}
+		delete(g.reporting, b)
+		delete(g.totals, b)
+	}
+	g.buckets = append([]int64(nil), g.buckets[i:]...)
+}
+
+// detectDDoS checks the bucket holding ts: the group's total traffic must
+// surge while at least DdosRatio of its reporting UEs surge against their own
+// baselines
+func (g *groupTraffic) detectDDoS(ts int64, cfg factory.AbnormalBehaviourConfig) (*AbnormalBehaviour, bool) {
+	current := ts / g.step * g.step
+	total, ok := g.totals[current]
+	if !ok {
+		return nil, false
+	}
+
+	from := current - int64(cfg.History)
+	var prior []float64
+	for _, b := range g.buckets {
+		if b >= from && b < current {
+			prior = append(prior, g.totals[b])
+		}
+	}
+	if len(prior) < cfg.MinSamples {
+		return nil, false
+	}
+	z, ok := newBaseline(prior, cfg.EwmaAlpha).surge(total, cfg.ZScore)
+	if !ok {
+		return nil, false
+	}
+
+	var surging []string
+	reporting := g.reporting[current]
+	for _, supi := range reporting {
+		averages := g.perUE[supi]
+		x := averages[current].mean()
+		var own []float64
+		for b, m := range averages {
+			if b >= from && b < current {
+				own = append(own, m.mean())
+			}
+		}
+		if len(own) < 2 {
+			continue
+		}
+		if _, ok := newBaseline(own, cfg.EwmaAlpha).surge(x, cfg.ZScore); ok {
+			surging = append(surging, supi)
+		}
+	}
+	ratio := float64(len(surging)) / float64(max(len(reporting), 1))
+	if ratio < cfg.DdosRatio {
+		return nil, false
+	}
+	sort.Strings(surging)
+
+	return &AbnormalBehaviour{
+		Supis:     surging,
+		Excep:     Exception{ExcepId: ExceptionDDoS, ExcepLevel: exceptionLevel(z)},
+		Ratio:     int(math.Round(ratio * 100)),
+		Timestamp: ts,
+		AddtMeasInfo: map[string]interface{}{
+			"totalThroughput": total,
+			"zScore":          z,
+		},
+	}, true
+}
+
+// ueGroupsOf returns the configured groups a UE belongs to
+func ueGroupsOf(supi string) []string {
+	var groups []string
+	for id, members := range factory.NwdafConfig.Configuration.UeGroups {
+		if matchesAny(members, supi) && len(members) > 0 {
+			groups = append(groups, id)
+		}
+	}
+	sort.Strings(groups)
+	return groups
+}
+
+// groupHistories returns the UE histories of a group over [start, end] read
+// from src; an empty group id stands for every UE
+func groupHistories(src nwdafContext.HistorySource, groupId string, start, end int64) map[string][]*nwdafContext.UEStatistics {
+	all := src.GetUEStatisticsInWindow(start, end)
+	if groupId == "" {
+		return all
+	}
+	members, _ := factory.NwdafConfig.Configuration.GetUeGroup(groupId)
+	histories := make(map[string][]*nwdafContext.UEStatistics, len(members))
+	for _, supi := range members {
+		if samples := all[supi]; len(samples) > 0 {
+			histories[supi] = samples
+		}
+	}
+	return histories
+}
+
+// onUEStatistics checks each fresh UE sample as it is stored and pushes any
+// detection to the matching ABNORMAL_BEHAVIOUR subscriptions straight away
+func (e *AnalyticsEngine) onUEStatistics(sample *nwdafContext.UEStatistics) {
+	config := factory.NwdafConfig.Configuration
+	// Bulk imports of old data are history, not live behaviour
+	if sample.Timestamp < e.clock.Now().Unix()-int64(config.GetAnalyticsWindow()) {
+		return
+	}
+	subs := e.subscriptionsFor("ABNORMAL_BEHAVIOUR")
+	if len(subs) == 0 {
+		e.abnormal.resetGroups()
+		return
+	}
+
+	cfg := config.GetAbnormalBehaviour()
+	var history []*nwdafContext.UEStatistics
+	for _, s := range e.context.GetUEHistory(sample.SUPI, sample.Timestamp-int64(cfg.History), sample.Timestamp) {
+		if s != sample {
+			history = append(history, s)
+		}
+	}
+	events := append(detectUE(sample, history, cfg), e.detectGroups(sample, cfg)...)
+
+	for _, event := range events {
+		target := event.supi
+		if event.groupLevel {
+			target = "group:" + event.groupId
+		}
+		if !e.abnormal.shouldPush(target+"/"+event.behaviour.Excep.ExcepId, sample.Timestamp, int64(cfg.Suppress)) {
+			continue
+		}
+		logger.AnalyticsLog.Warnf("Abnormal behaviour %s (level %d) for %s",
+			event.behaviour.Excep.ExcepId, event.behaviour.Excep.ExcepLevel, target)
+
+		for _, sub := range subs {
+			f, err := ParseFilter(sub.AnalyticsFilter)
+			if err != nil || !event.matches(f) {
+				continue
+			}
+			e.queueAbnormalPush(abnormalPush{sub: sub, data: map[string]interface{}{
+				"eventType":          sub.EventType,
+				"timestamp":          event.behaviour.Timestamp,
+				"abnormalBehaviours": []*AbnormalBehaviour{event.behaviour},
+			}})
+		}
+	}
+}
+
+// detectGroups adds a sample to the running traffic of the UE's groups and of
+// all UEs, and checks each for a DDoS suspicion. A group's traffic is seeded
+// from the stored history, which already holds the sample, the first time it
+// is needed.
+func (e *AnalyticsEngine) detectGroups(sample *nwdafContext.UEStatistics, cfg factory.AbnormalBehaviourConfig) []*abnormalEvent {
+	step := int64(cfg.GroupStep)
+	from := sample.Timestamp - int64(cfg.History) - step
+
+	s := e.abnormal
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var events []*abnormalEvent
+	for _, groupId := range append(ueGroupsOf(sample.SUPI), "") {
+		traffic, ok := s.groups[groupId]
+		if ok && traffic.step == step {
+			traffic.add(sample)
+		} else {
+			traffic = newGroupTraffic(groupHistories(e.context, groupId, from, sample.Timestamp), step)
+			s.groups[groupId] = traffic
+		}
+		traffic.evict(from)
+		if b, ok := traffic.detectDDoS(sample.Timestamp, cfg); ok {
+			b.IntGroupId = groupId
+			events = append(events, &abnormalEvent{behaviour: b, groupId: groupId, groupLevel: true})
+		}
+	}
+	return events
+}
+
+// queueAbnormalPush hands a detection to the push workers, dropping it when
+// the consumers fall too far behind
+func (e *AnalyticsEngine) queueAbnormalPush(p abnormalPush) {
+	s := e.abnormal
+	s.start.Do(func() {
+		for i := 0; i < abnormalPushWorkers; i++ {
+			go func() {
+				for p := range s.pushes {
+					e.sendNotification(p.sub, p.data)
+				}
+			}()
+		}
+	})
+	select {
+	case s.pushes <- p:
+	default:
+		logger.AnalyticsLog.Warnf("Abnormal behaviour queue full, dropping the notification for subscription %s",
+			p.sub.SubscriptionId)
+	}
+}
+
+// matches reports whether a subscription filter covers the event. UE-level
+// events go to subscriptions targeting the UE, or any UE; group-level events
+// to subscriptions for the group, or to any-UE subscriptions for all UEs.
+func (ev *abnormalEvent) matches(f *EventFilter) bool {
+	if !matchesAny(f.ExcepIds, ev.behaviour.Excep.ExcepId) {
+		return false
+	}
+	scope := newUEScope(f)
+	if !ev.groupLevel {
+		return scope.matches(ev.supi)
+	}
+	if ev.groupId == "" {
+		return len(scope.supis) == 0
+	}
+	_, ok := scope.groups[ev.groupId]
+	return ok
+}
+
+func (e *AnalyticsEngine) subscriptionsFor(eventType string) []*nwdafContext.AnalyticsSubscription {
+	e.context.SubMutex.RLock()
+	defer e.context.SubMutex.RUnlock()
+	var subs []*nwdafContext.AnalyticsSubscription
+	for _, sub := range e.context.Subscriptions {
+		if sub.EventType == eventType {
+			copied := *sub
+			subs = append(subs, &copied)
+		}
+	}
+	return subs
+}
+
+// computeAbnormalBehaviour replays detection over the samples in [startTs,
+// endTs]. It returns every detection in time order and, per exception, the
+// affected UEs with the ratio of the UEs in scope they represent.
+func (e *AnalyticsEngine) computeAbnormalBehaviour(src nwdafContext.HistorySource, f *EventFilter, startTs, endTs int64) map[string]interface{} {
+	cfg := factory.NwdafConfig.Configuration.GetAbnormalBehaviour()
+	scope := newUEScope(f)
+	excepIds := f.ExcepIds
+	history := int64(cfg.History)
+
+	var detections []*AbnormalBehaviour
+	ues := 0
+	affected := make(map[string]map[string]int) // excepId -> SUPI -> max level
+	for supi, samples := range src.GetUEStatisticsInWindow(startTs-history, endTs) {
+		if !scope.matches(supi) {
+			continue
+		}
+		counted := false
+		for i, s := range samples {
+			if s.Timestamp < startTs {
+				continue
+			}
+			if !counted {
+				ues++
+				counted = true
+			}
+			lo := sort.Search(i, func(j int) bool { return samples[j].Timestamp >= s.Timestamp-history })
+			for _, event := range detectUE(s, samples[lo:i], cfg) {
+				b := event.behaviour
+				if !matchesAny(excepIds, b.Excep.ExcepId) {
+					continue
+				}
+				detections = append(detections, b)
+				if affected[b.Excep.ExcepId] == nil {
+					affected[b.Excep.ExcepId] = make(map[string]int)
+				}
+				affected[b.Excep.ExcepId][supi] = max(affected[b.Excep.ExcepId][supi], b.Excep.ExcepLevel)
+			}
+		}
+	}
+
+	behaviours := make([]*AbnormalBehaviour, 0, len(affected))
+	for excepId, levels := range affected {
+		b := &AbnormalBehaviour{Excep: Exception{ExcepId: excepId}, Timestamp: endTs}
+		for supi, level := range levels {
+			b.Supis = append(b.Supis, supi)
+			b.Excep.ExcepLevel = max(b.Excep.ExcepLevel, level)
+		}
+		sort.Strings(b.Supis)
+		b.Ratio = int(math.Round(float64(len(levels)) / float64(max(ues, 1)) * 100))
+		behaviours = append(behaviours, b)
+	}
+
+	// Group-level detections for the requested groups, or for all UEs
+	if matchesAny(excepIds, ExceptionDDoS) {
+		groupIds := []string{""}
+		if scope.groups != nil {
+			groupIds = groupIds[:0]
+			for id := range scope.groups {
+				groupIds = append(groupIds, id)
+			}
+			sort.Strings(groupIds)
+		} else if len(scope.supis) > 0 {
+			groupIds = nil
+		}
+		step := int64(cfg.GroupStep)
+		for _, groupId := range groupIds {
+			traffic := newGroupTraffic(groupHistories(src, groupId, startTs-history-step, endTs), step)
+			for _, bucket := range traffic.buckets {
+				if bucket < startTs/step*step || bucket > endTs {
+					continue
+				}
+				if b, ok := traffic.detectDDoS(bucket, cfg); ok {
+					b.IntGroupId = groupId
+					detections = append(detections, b)
+					behaviours = append(behaviours, b)
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(detections, func(i, j int) bool { return detections[i].Timestamp < detections[j].Timestamp })
+	sort.SliceStable(behaviours, func(i, j int) bool {
+		if behaviours[i].Excep.ExcepId != behaviours[j].Excep.ExcepId {
+			return behaviours[i].Excep.ExcepId < behaviours[j].Excep.ExcepId
+		}
+		return behaviours[i].Timestamp < behaviours[j].Timestamp
+	})
+
+	return map[string]interface{}{
+		"abnormalBehaviours": behaviours,
+		"detections":         detections,
+		"ueCount":            ues,
+		"window":             windowInfo(startTs, endTs),
+	}
+}
@@ -0,0 +1,185 @@
+package analytics
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/free5gc/nwdaf/pkg/clock"
+	nwdafContext "github.com/free5gc/nwdaf/pkg/context"
+	"github.com/free5gc/nwdaf/pkg/factory"
+)
+
+func ueSamples(supi string, start int64, locations []string, throughput []float64) []*nwdafContext.UEStatistics {
+	samples := make([]*nwdafContext.UEStatistics, len(throughput))
+	for i := range throughput {
+		samples[i] = &nwdafContext.UEStatistics{
+			SUPI:       supi,
+			Location:   locations[i%len(locations)],
+			Throughput: throughput[i],
+			Timestamp:  start + int64(i*60),
+		}
+	}
+	return samples
+}
+
+func TestDetectUE(t *testing.T) {
+	cfg := factory.NwdafConfig.Configuration.GetAbnormalBehaviour()
+	steady := []float64{10, 11, 9, 10, 12, 10, 9, 11, 10, 10, 11, 9}
+	history := ueSamples("imsi-1", 1000, []string{"home"}, steady)
+
+	tests := []struct {
+		name    string
+		history []*nwdafContext.UEStatistics
+		sample  *nwdafContext.UEStatistics
+		want    string
+	}{
+		{"Normal", history, &nwdafContext.UEStatistics{SUPI: "imsi-1", Location: "home", Throughput: 11, Timestamp: 2000}, ""},
+		{"Volume", history, &nwdafContext.UEStatistics{SUPI: "imsi-1", Location: "home", Throughput: 80, Timestamp: 2000}, ExceptionUnexpectedLargeRateFlow},
+		{"Location", history, &nwdafContext.UEStatistics{SUPI: "imsi-1", Location: "abroad", Throughput: 10, Timestamp: 2000}, ExceptionUnexpectedLocation},
+		{"Ping-pong", ueSamples("imsi-1", 1000, []string{"a", "b"}, []float64{10, 10, 10, 10, 10}),
+			&nwdafContext.UEStatistics{SUPI: "imsi-1", Location: "b", Throughput: 10, Timestamp: 1300}, ExceptionPingPong},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := detectUE(tt.sample, tt.history, cfg)
+			if tt.want == "" {
+				if len(events) != 0 {
+					t.Errorf("Expected no detection, got %s", events[0].behaviour.Excep.ExcepId)
+				}
+				return
+			}
+			if len(events) != 1 || events[0].behaviour.Excep.ExcepId != tt.want {
+				t.Fatalf("Expected a single %s detection, got %d", tt.want, len(events))
+			}
+			if b := events[0].behaviour; b.Ratio != 100 || b.Excep.ExcepLevel < 1 {
+				t.Errorf("Expected ratio 100 and a positive level, got %+v", b)
+			}
+		})
+	}
+}
+
+func TestAbnormalBehaviourPush(t *testing.T) {
+	received := make(chan EventNotification, 4)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n EventNotification
+		if err := json.NewDecoder(r.Body).Decode(&n); err == nil {
+			received <- n
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	ctx := &nwdafContext.NWDAFContext{
+		Subscriptions: make(map[string]*nwdafContext.AnalyticsSubscription),
+		DataStore:     nwdafContext.NewDataStore(),
+	}
+	engine := NewAnalyticsEngine(ctx)
+	engine.SetClock(clock.NewVirtual(time.Unix(2000, 0), 1))
+	defer ctx.AddUEStatisticsListener(engine.onUEStatistics)()
+
+	ctx.AddSubscription(&nwdafContext.AnalyticsSubscription{
+		SubscriptionId:  "sub-1",
+		EventType:       "ABNORMAL_BEHAVIOUR",
+		NotificationUri: server.URL,
+		AnalyticsFilter: map[string]interface{}{"supis": []interface{}{"imsi-1"}},
+	})
+
+	steady := []float64{10, 11, 9, 10, 12, 10, 9, 11, 10, 10, 11, 9}
+	for _, s := range ueSamples("imsi-1", 1280, []string{"home"}, steady) {
+		ctx.UpdateUEStatistics(s.SUPI, s)
+	}
+	ctx.UpdateUEStatistics("imsi-1", &nwdafContext.UEStatistics{SUPI: "imsi-1", Location: "home", Throughput: 90, Timestamp: 2000})
+
+	select {
+	case n := <-received:
+		data := n.Data.(map[string]interface{})
+		behaviours := data["abnormalBehaviours"].([]interface{})
+		excep := behaviours[0].(map[string]interface{})["excep"].(map[string]interface{})
+		if n.SubscriptionId != "sub-1" || excep["excepId"] != ExceptionUnexpectedLargeRateFlow {
+			t.Errorf("Unexpected notification: %+v", n)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the volume surge to be pushed")
+	}
+}
+
+func TestAbnormalBehaviourDDoS(t *testing.T) {
+	ctx := &nwdafContext.NWDAFContext{DataStore: nwdafContext.NewDataStore()}
+	engine := NewAnalyticsEngine(ctx)
+
+	// Four UEs with steady traffic, then three of them surge together. The
+	// steady part is only found in the archived history.
+	archived := &nwdafContext.HistoryData{UE: make(map[string][]*nwdafContext.UEStatistics)}
+	for _, supi := range []string{"imsi-1", "imsi-2", "imsi-3", "imsi-4"} {
+		throughput := []float64{10, 11, 9, 10, 12, 10, 9, 11, 10, 10, 11, 9, 10}
+		if supi != "imsi-4" {
+			throughput[12] = 200
+		}
+		samples := ueSamples(supi, 6000, []string{"home"}, throughput)
+		archived.UE[supi] = samples[:12]
+		ctx.UpdateUEStatistics(supi, samples[12])
+	}
+
+	result := engine.computeAbnormalBehaviour(nwdafContext.WithArchive(ctx, archived), &EventFilter{
+		ExcepIds: []string{ExceptionDDoS},
+	}, 6000, 6000+12*60)
+	behaviours := result["abnormalBehaviours"].([]*AbnormalBehaviour)
+	if len(behaviours) != 1 {
+		t.Fatalf("Expected a single DDoS suspicion, got %d", len(behaviours))
+	}
+	if b := behaviours[0]; len(b.Supis) != 3 || b.Ratio != 75 {
+		t.Errorf("Expected 3 of 4 UEs (75%%) surging, got %+v", b)
+	}
+}
+
+func TestGroupTrafficIncremental(t *testing.T) {
+	histories := map[string][]*nwdafContext.UEStatistics{
+		"imsi-1": ueSamples("imsi-1", 6000, []string{"home"}, []float64{10, 20, 30, 40, 50, 60}),
+		"imsi-2": ueSamples("imsi-2", 6030, []string{"home"}, []float64{1, 2, 3, 4, 5, 6}),
+	}
+
+	// Fed one sample at a time, with the first two minutes evicted, the
+	// running traffic matches one rebuilt over the rest
+	running := newGroupTraffic(nil, 60)
+	recent := make(map[string][]*nwdafContext.UEStatistics)
+	for supi, samples := range histories {
+		for _, s := range samples {
+			running.add(s)
+			if s.Timestamp >= 6120 {
+				recent[supi] = append(recent[supi], s)
+			}
+		}
+	}
+	running.evict(6120)
+	rebuilt := newGroupTraffic(recent, 60)
+
+	if len(running.buckets) != len(rebuilt.buckets) || running.buckets[0] != 6120 {
+		t.Fatalf("Expected buckets %v, got %v", rebuilt.buckets, running.buckets)
+	}
+	for _, b := range rebuilt.buckets {
+		if math.Abs(running.totals[b]-rebuilt.totals[b]) > 1e-9 {
+			t.Errorf("Expected total %.2f at %d, got %.2f", rebuilt.totals[b], b, running.totals[b])
+		}
+	}
+	if _, ok := running.perUE["imsi-1"][6000]; ok {
+		t.Error("Expected evicted buckets to be forgotten")
+	}
+}
+
+func TestAbnormalStateExpire(t *testing.T) {
+	s := newAbnormalState()
+	s.shouldPush("imsi-1/"+ExceptionPingPong, 1000, 300)
+	s.shouldPush("imsi-2/"+ExceptionPingPong, 2000, 300)
+	s.expire(1700)
+	if len(s.last) != 1 {
+		t.Fatalf("Expected one remembered push, got %d", len(s.last))
+	}
+	if !s.shouldPush("imsi-1/"+ExceptionPingPong, 1800, 300) {
+		t.Error("Expected an expired push not to hold back a new one")
+	}
+}
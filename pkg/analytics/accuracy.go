@@ -0,0 +1,323 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/free5gc/nwdaf/internal/logger"
+	nwdafContext "github.com/free5gc/nwdaf/pkg/context"
+	"github.com/free5gc/nwdaf/pkg/factory"
+)
+
+// AccuracyInfo is the rolling accuracy of the predictions one model made for
+// an event type (TS 23.288 analytics accuracy information). Accuracy is
+// 0..100 over the last Samples checked predictions.
+type AccuracyInfo struct {
+	Model    string `json:"model"`
+	Accuracy int    `json:"accuracy"`
+	Samples  int    `json:"samples"`
+}
+
+// verifiable is an output object whose value can be checked: a prediction is
+// compared with the statistics object of the same key over its window
+type verifiable interface {
+	accuracyKey() string
+	accuracyValue() float64
+}
+
+// modelled is a prediction naming the model that made it. Other predictions
+// are attributed to the configured default model.
+type modelled interface {
+	predictionModel() string
+}
+
+var verifiableType = reflect.TypeOf((*verifiable)(nil)).Elem()
+
+// issuedPrediction is one predicted value awaiting its observed value
+type issuedPrediction struct {
+	key   string
+	model string
+	value float64
+}
+
+// pendingPrediction is the output of one response or notification whose
+// prediction window has not elapsed yet
+type pendingPrediction struct {
+	eventType      string
+	filter         *EventFilter
+	startTs, endTs int64
+	predictions    []issuedPrediction
+}
+
+// modelKey identifies a rolling accuracy
+type modelKey struct {
+	eventType string
+	model     string
+}
+
+// accuracyState holds the predictions to check and the rolling accuracy of
+// each event type and model
+type accuracyState struct {
+	mu       sync.Mutex
+	pending  []*pendingPrediction
+	scores   map[modelKey][]float64
+	degraded map[modelKey]bool
+}
+
+func newAccuracyState() *accuracyState {
+	return &accuracyState{
+		scores:   make(map[modelKey][]float64),
+		degraded: make(map[modelKey]bool),
+	}
+}
+
+// recordPredictions remembers the predictions of a computed result so they
+// can be checked once their window elapses
+func (e *AnalyticsEngine) recordPredictions(eventType string, f *EventFilter, result interface{}) {
+	r, ok := result.(map[string]interface{})
+	if !ok {
+		return
+	}
+	window, ok := r["predictionWindow"].(map[string]int64)
+	if !ok {
+		return
+	}
+
+	defaultModel := factory.NwdafConfig.Configuration.GetForecast().DefaultModel
+	var predictions []issuedPrediction
+	eachObject(r["predictions"], func(v verifiable) {
+		model := defaultModel
+		if m, ok := v.(modelled); ok && m.predictionModel() != "" {
+			model = m.predictionModel()
+		}
+		predictions = append(predictions, issuedPrediction{key: v.accuracyKey(), model: model, value: v.accuracyValue()})
+	})
+	if len(predictions) == 0 {
+		return
+	}
+
+	maxPending := factory.NwdafConfig.Configuration.GetAccuracy().MaxPending
+	e.accuracy.mu.Lock()
+	defer e.accuracy.mu.Unlock()
+	e.accuracy.pending = append(e.accuracy.pending, &pendingPrediction{
+		eventType:   eventType,
+		filter:      f,
+		startTs:     window["startTs"],
+		endTs:       window["endTs"],
+		predictions: predictions,
+	})
+	if excess := len(e.accuracy.pending) - maxPending; excess > 0 {
+		e.accuracy.pending = e.accuracy.pending[excess:]
+	}
+}
+
+// addAccuracyInfo adds the accuracy of the event type's models so far to a
+// result with predictions
+func (e *AnalyticsEngine) addAccuracyInfo(eventType string, result interface{}) interface{} {
+	r, ok := result.(map[string]interface{})
+	if !ok {
+		return result
+	}
+	if _, ok := r["predictionWindow"]; !ok {
+		return r
+	}
+	if infos := e.accuracy.infos(eventType); len(infos) > 0 {
+		r["accuracyInfo"] = infos
+	}
+	return r
+}
+
+// checkPredictions compares the predictions whose window has elapsed with
+// the statistics observed over that window, then notifies the subscribers of
+// each event type whose accuracy fell below the threshold
+func (e *AnalyticsEngine) checkPredictions() {
+	now := e.clock.Now().Unix()
+	e.accuracy.mu.Lock()
+	var due []*pendingPrediction
+	pending := e.accuracy.pending[:0]
+	for _, p := range e.accuracy.pending {
+		if p.endTs <= now {
+			due = append(due, p)
+		} else {
+			pending = append(pending, p)
+		}
+	}
+	e.accuracy.pending = pending
+	e.accuracy.mu.Unlock()
+
+	checked := make(map[modelKey]bool)
+	for _, p := range due {
+		m, ok := LookupModule(p.eventType)
+		if !ok {
+			continue
+		}
+		observed := make(map[string]float64)
+		result, _ := m.Analytics(context.Background(), e, p.filter, p.startTs, p.endTs).(map[string]interface{})
+		for key, value := range result {
+			if key == "predictions" {
+				continue
+			}
+			eachObject(value, func(v verifiable) {
+				observed[v.accuracyKey()] = v.accuracyValue()
+			})
+		}
+
+		for _, prediction := range p.predictions {
+			value, ok := observed[prediction.key]
+			if !ok {
+				continue
+			}
+			key := modelKey{p.eventType, prediction.model}
+			e.accuracy.record(key, predictionAccuracy(prediction.value, value))
+			checked[key] = true
+		}
+	}
+
+	for key := range checked {
+		if info, degraded := e.accuracy.update(key); degraded {
+			e.notifyAccuracyDegraded(key.eventType, info)
+		}
+	}
+}
+
+// record adds a checked prediction to the rolling accuracy
+func (s *accuracyState) record(key modelKey, score float64) {
+	window := factory.NwdafConfig.Configuration.GetAccuracy().Window
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	scores := append(s.scores[key], score)
+	if len(scores) > window {
+		scores = scores[len(scores)-window:]
+	}
+	s.scores[key] = scores
+	PredictionsChecked.WithLabelValues(key.eventType, key.model).Inc()
+}
+
+// update publishes the rolling accuracy of a model and reports whether it
+// just fell below the threshold
+func (s *accuracyState) update(key modelKey) (*AccuracyInfo, bool) {
+	config := factory.NwdafConfig.Configuration.GetAccuracy()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	scores := s.scores[key]
+	accuracy := mean(scores)
+	PredictionAccuracy.WithLabelValues(key.eventType, key.model).Set(accuracy)
+
+	info := &AccuracyInfo{Model: key.model, Accuracy: percent(accuracy), Samples: len(scores)}
+	if len(scores) < config.MinSamples {
+		return info, false
+	}
+	below := accuracy < config.Threshold
+	wasBelow := s.degraded[key]
+	s.degraded[key] = below
+	return info, below && !wasBelow
+}
+
+// infos returns the rolling accuracy of each model of an event type
+func (s *accuracyState) infos(eventType string) []*AccuracyInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var infos []*AccuracyInfo
+	for key, scores := range s.scores {
+		if key.eventType == eventType && len(scores) > 0 {
+			infos = append(infos, &AccuracyInfo{Model: key.model, Accuracy: percent(mean(scores)), Samples: len(scores)})
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Model < infos[j].Model })
+	return infos
+}
+
+// notifyAccuracyDegraded tells the subscribers of an event type that the
+// accuracy of one of its models dropped below the threshold
+func (e *AnalyticsEngine) notifyAccuracyDegraded(eventType string, info *AccuracyInfo) {
+	threshold := factory.NwdafConfig.Configuration.GetAccuracy().Threshold
+	logger.AnalyticsLog.Warnf("%s predictions of model %s are %d%% accurate, below %d%%",
+		eventType, info.Model, info.Accuracy, percent(threshold))
+
+	e.context.SubMutex.RLock()
+	subs := make([]*nwdafContext.AnalyticsSubscription, 0)
+	for _, sub := range e.context.Subscriptions {
+		if sub.EventType == eventType {
+			copied := *sub
+			subs = append(subs, &copied)
+		}
+	}
+	e.context.SubMutex.RUnlock()
+
+	for _, sub := range subs {
+		e.sendNotification(sub, map[string]interface{}{
+			"accuracyInfo":      []*AccuracyInfo{info},
+			"accuracyThreshold": percent(threshold),
+			"accuracyDegraded":  true,
+		})
+	}
+}
+
+// predictionAccuracy scores a predicted value against the observed one: 1
+// when equal, down to 0 when the error reaches the larger of the two
+func predictionAccuracy(predicted, observed float64) float64 {
+	scale := math.Max(math.Abs(predicted), math.Abs(observed))
+	if scale < 1e-9 {
+		return 1
+	}
+	return math.Max(0, 1-math.Abs(predicted-observed)/scale)
+}
+
+// eachObject calls fn with each verifiable object of a list or map of output
+// objects, descending into nested results
+func eachObject(value interface{}, fn func(v verifiable)) {
+	if nested, ok := value.(map[string]interface{}); ok {
+		for _, v := range nested {
+			eachObject(v, fn)
+		}
+		return
+	}
+
+	v := reflect.ValueOf(value)
+	if (v.Kind() != reflect.Slice && v.Kind() != reflect.Map) || !v.Type().Elem().Implements(verifiableType) {
+		return
+	}
+	if v.Kind() == reflect.Map {
+		iter := v.MapRange()
+		for iter.Next() {
+			fn(iter.Value().Interface().(verifiable))
+		}
+		return
+	}
+	for i := 0; i < v.Len(); i++ {
+		fn(v.Index(i).Interface().(verifiable))
+	}
+}
+
+// Keys and values checked for each output object
+
+func (i *NfLoadLevelInformation) accuracyKey() string    { return i.NfInstanceId }
+func (i *NfLoadLevelInformation) accuracyValue() float64 { return float64(i.NfLoadLevelAverage) }
+func (p *NfLoadPrediction) accuracyKey() string          { return p.NfInstanceId }
+func (p *NfLoadPrediction) accuracyValue() float64       { return float64(p.NfLoadLevelAverage) }
+func (p *NfLoadPrediction) predictionModel() string      { return p.Model }
+func (s *SliceLoadSummary) accuracyKey() string          { return s.SNSSAI }
+func (s *SliceLoadSummary) accuracyValue() float64       { return s.AverageResourceUsage }
+func (p *SliceLoadPrediction) accuracyKey() string       { return p.SNSSAI }
+func (p *SliceLoadPrediction) accuracyValue() float64    { return p.AverageResourceUsage }
+func (p *SliceLoadPrediction) predictionModel() string   { return p.Model }
+func (i *NetworkPerfInfo) accuracyKey() string           { return i.Tai + "|" + i.AreaOfInterest }
+func (i *NetworkPerfInfo) accuracyValue() float64        { return i.AverageLatency }
+func (i *QosSustainabilityInfo) accuracyKey() string {
+	return fmt.Sprintf("%d|%s|%s", i.FiveQi, i.Tai, i.AreaOfInterest)
+}
+func (i *QosSustainabilityInfo) accuracyValue() float64 { return i.MinThroughput }
+func (i *ServiceExperienceInfo) accuracyKey() string    { return i.AppId + "|" + i.Snssai }
+func (i *ServiceExperienceInfo) accuracyValue() float64 { return i.SvcExprc.Mos }
+func (i *UserDataCongestionInfo) accuracyKey() string {
+	return i.CongType + "|" + i.Tai + "|" + i.AreaOfInterest
+}
+func (i *UserDataCongestionInfo) accuracyValue() float64 { return float64(i.AverageUtilization) }
+func (p *DnPerformance) accuracyKey() string             { return p.Dnai + "|" + p.AppServerInsAddr }
+func (p *DnPerformance) accuracyValue() float64          { return p.PerfData.AvgPacketDelay }
+func (p *DnaiPerformance) accuracyKey() string           { return p.Dnai }
+func (p *DnaiPerformance) accuracyValue() float64        { return p.PerfData.AvgPacketDelay }
@@ -0,0 +1,104 @@
+package analytics
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/free5gc/nwdaf/pkg/clock"
+	nwdafContext "github.com/free5gc/nwdaf/pkg/context"
+	"github.com/free5gc/nwdaf/pkg/factory"
+)
+
+func TestPredictionAccuracy(t *testing.T) {
+	tests := []struct {
+		name                string
+		predicted, observed float64
+		want                float64
+	}{
+		{"Exact", 40, 40, 1},
+		{"Both zero", 0, 0, 1},
+		{"Off by a quarter", 30, 40, 0.75},
+		{"Opposite sign", -10, 10, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := predictionAccuracy(tt.predicted, tt.observed); got != tt.want {
+				t.Errorf("predictionAccuracy() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAccuracyMonitoring(t *testing.T) {
+	factory.NwdafConfig.Configuration.Accuracy = &factory.AccuracyConfig{Threshold: 0.9, MinSamples: 2}
+	defer func() { factory.NwdafConfig.Configuration.Accuracy = nil }()
+
+	received := make(chan EventNotification, 4)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n EventNotification
+		if err := json.NewDecoder(r.Body).Decode(&n); err == nil {
+			received <- n
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	ctx := &nwdafContext.NWDAFContext{
+		Subscriptions: make(map[string]*nwdafContext.AnalyticsSubscription),
+		DataStore:     nwdafContext.NewDataStore(),
+	}
+	ctx.AddSubscription(&nwdafContext.AnalyticsSubscription{SubscriptionId: "sub-1", EventType: "NF_LOAD", NotificationUri: server.URL})
+	engine := NewAnalyticsEngine(ctx)
+	now := time.Unix(1700003600, 0)
+	virtual := clock.NewVirtual(now, 1)
+	engine.SetClock(virtual)
+
+	// A steady load of 50%, then 20% once the predictions are made: the window
+	// averages 35% against the 50% predicted
+	for i := 0; i <= 12; i++ {
+		for _, nf := range []string{"amf-1", "amf-2"} {
+			ctx.UpdateNFStatistics(nf, &nwdafContext.NFStatistics{NFInstanceId: nf, NFType: "AMF", Load: 0.5, Timestamp: now.Unix() - 3600 + int64(i*300)})
+		}
+	}
+	if _, err := engine.GetAnalyticsInWindow("NF_LOAD", nil, now.Unix(), now.Unix()+600); err != nil {
+		t.Fatalf("GetAnalyticsInWindow() error = %v", err)
+	}
+	for _, nf := range []string{"amf-1", "amf-2"} {
+		ctx.UpdateNFStatistics(nf, &nwdafContext.NFStatistics{NFInstanceId: nf, NFType: "AMF", Load: 0.2, Timestamp: now.Unix() + 300})
+	}
+
+	engine.checkPredictions()
+	if infos := engine.accuracy.infos("NF_LOAD"); len(infos) != 0 {
+		t.Fatalf("Expected no accuracy before the window elapses, got %+v", infos)
+	}
+
+	virtual.Advance(15 * time.Minute)
+	engine.checkPredictions()
+	infos := engine.accuracy.infos("NF_LOAD")
+	if len(infos) != 1 || infos[0].Samples != 2 || infos[0].Accuracy != 70 {
+		t.Fatalf("Expected 2 predictions 70%% accurate, got %+v", infos)
+	}
+
+	select {
+	case n := <-received:
+		data := n.Data.(map[string]interface{})
+		if n.SubscriptionId != "sub-1" || data["accuracyDegraded"] != true {
+			t.Errorf("Expected an accuracy notification for sub-1, got %+v", n)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected subscribers to be notified of the degraded accuracy")
+	}
+
+	// Later responses with predictions carry the accuracy so far
+	data, err := engine.GetAnalyticsInWindow("NF_LOAD", nil, virtual.Now().Unix(), virtual.Now().Unix()+600)
+	if err != nil {
+		t.Fatalf("GetAnalyticsInWindow() error = %v", err)
+	}
+	if accuracy, ok := data.(map[string]interface{})["accuracyInfo"].([]*AccuracyInfo); !ok || len(accuracy) != 1 {
+		t.Errorf("Expected accuracyInfo in the response, got %v", data)
+	}
+}
@@ -0,0 +1,221 @@
+package analytics
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/free5gc/nwdaf/internal/logger"
+	"github.com/free5gc/nwdaf/pkg/adrf"
+	nwdafContext "github.com/free5gc/nwdaf/pkg/context"
+	"github.com/free5gc/nwdaf/pkg/factory"
+)
+
+// maxPendingRecords caps the analytics records waiting for the next storage
+// run, oldest dropped first
+const maxPendingRecords = 1000
+
+// adrfState tracks the storage of analytics and collected data at an ADRF
+type adrfState struct {
+	repo adrf.Repository
+	// run serializes storage runs; mu guards the fields below
+	run sync.Mutex
+	mu  sync.Mutex
+	// pending are the analytics generated since the last storage run
+	pending []*adrf.DataStoreRecord
+	// storedSeq is the sequence number of the last sample stored
+	storedSeq uint64
+	// retainedFrom is the start of the collected data kept locally
+	retainedFrom int64
+}
+
+// SetADRF stores analytics and collected data in an ADRF and retrieves the
+// history older than the local retention from it, including what an earlier
+// run of this NWDAF stored. It must be called after SetClock and before Start.
+func (e *AnalyticsEngine) SetADRF(repo adrf.Repository) {
+	retainedFrom := e.clock.Now().Unix() - int64(factory.NwdafConfig.Configuration.GetAdrf().Retention)
+	e.adrf = &adrfState{repo: repo, retainedFrom: retainedFrom}
+}
+
+// ADRF returns the ADRF in use, nil if none
+func (e *AnalyticsEngine) ADRF() adrf.Repository {
+	if e.adrf == nil {
+		return nil
+	}
+	return e.adrf.repo
+}
+
+// StartStorage stores to the ADRF periodically
+func (e *AnalyticsEngine) StartStorage(ctx context.Context) {
+	config := factory.NwdafConfig.Configuration.GetAdrf()
+	ticker := e.clock.NewTicker(time.Duration(config.StoreInterval) * time.Second)
+	defer ticker.Stop()
+	logger.AnalyticsLog.Infof("Storing to the ADRF every %ds, keeping %ds locally", config.StoreInterval, config.Retention)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			if err := e.StoreToADRF(ctx); err != nil {
+				logger.AnalyticsLog.Warnf("ADRF storage failed: %v", err)
+			}
+		}
+	}
+}
+
+// StoreToADRF stores the analytics generated and the data collected since the
+// last run, then drops the stored data older than the retention. Data is
+// followed in the order it was stored, so late, imported and transferred
+// samples are stored too. Data not stored yet is kept whatever its age, so an
+// unreachable ADRF loses nothing.
+func (e *AnalyticsEngine) StoreToADRF(ctx context.Context) error {
+	if e.adrf == nil {
+		return nil
+	}
+	s := e.adrf
+	s.run.Lock()
+	defer s.run.Unlock()
+
+	s.mu.Lock()
+	pending, storedSeq := s.pending, s.storedSeq
+	s.pending = nil
+	s.mu.Unlock()
+	for i, record := range pending {
+		if _, err := s.repo.Store(ctx, record); err != nil {
+			ADRFRecords.WithLabelValues(adrf.RecordAnalytics, "error").Inc()
+			s.requeue(pending[i:])
+			return err
+		}
+		ADRFRecords.WithLabelValues(adrf.RecordAnalytics, "ok").Inc()
+	}
+
+	history, lastSeq := e.context.ExportHistorySince(storedSeq)
+	if samples := history.Samples(); samples > 0 {
+		data, err := json.Marshal(history)
+		if err != nil {
+			return err
+		}
+		startTs, endTs := history.Window()
+		record := &adrf.DataStoreRecord{
+			NfInstanceId: e.context.NfId,
+			RecordType:   adrf.RecordData,
+			StartTs:      startTs,
+			EndTs:        endTs,
+			Data:         data,
+		}
+		if _, err := s.repo.Store(ctx, record); err != nil {
+			ADRFRecords.WithLabelValues(adrf.RecordData, "error").Inc()
+			return err
+		}
+		ADRFRecords.WithLabelValues(adrf.RecordData, "ok").Inc()
+		logger.AnalyticsLog.Debugf("Stored %d samples within [%d, %d] at the ADRF", samples, startTs, endTs)
+	}
+
+	retainFrom := e.clock.Now().Unix() - int64(factory.NwdafConfig.Configuration.GetAdrf().Retention)
+	if dropped := e.context.PruneStoredHistory(retainFrom, lastSeq); dropped > 0 {
+		logger.AnalyticsLog.Debugf("Dropped %d stored samples older than %d", dropped, retainFrom)
+	}
+	s.mu.Lock()
+	s.storedSeq = lastSeq
+	s.retainedFrom = max(s.retainedFrom, retainFrom)
+	s.mu.Unlock()
+	return nil
+}
+
+// requeue puts back records a storage run could not store
+func (s *adrfState) requeue(records []*adrf.DataStoreRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending = append(append([]*adrf.DataStoreRecord{}, records...), s.pending...)
+	if excess := len(s.pending) - maxPendingRecords; excess > 0 {
+		s.pending = s.pending[excess:]
+	}
+}
+
+// storeAnalytics queues generated analytics for the next storage run
+func (e *AnalyticsEngine) storeAnalytics(eventType string, f *EventFilter, result interface{}) {
+	if e.adrf == nil || result == nil {
+		return
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		logger.AnalyticsLog.Warnf("%s analytics not stored: %v", eventType, err)
+		return
+	}
+	filter, _ := json.Marshal(f)
+	record := &adrf.DataStoreRecord{
+		NfInstanceId: e.context.NfId,
+		RecordType:   adrf.RecordAnalytics,
+		EventType:    eventType,
+		Filter:       filter,
+		Data:         data,
+	}
+	// Results without a window are stamped with the time they were computed
+	record.StartTs, record.EndTs = e.clock.Now().Unix(), e.clock.Now().Unix()
+	if r, ok := result.(map[string]interface{}); ok {
+		if startTs, endTs := resultWindow(r); endTs != 0 {
+			record.StartTs, record.EndTs = startTs, endTs
+		}
+	}
+
+	s := e.adrf
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending = append(s.pending, record)
+	if excess := len(s.pending) - maxPendingRecords; excess > 0 {
+		s.pending = s.pending[excess:]
+	}
+}
+
+// historySource returns the history [startTs, endTs] is computed over: the
+// local one, completed with the data stored at the ADRF when the window
+// starts before the local retention
+func (e *AnalyticsEngine) historySource(ctx context.Context, startTs, endTs int64) nwdafContext.HistorySource {
+	if archived := e.archivedHistory(ctx, startTs, endTs); archived != nil {
+		return nwdafContext.WithArchive(e.context, archived)
+	}
+	return e.context
+}
+
+// archivedHistory retrieves from the ADRF the data of [startTs, endTs] older
+// than the local retention. It returns nil when the window is within the
+// retention, without an ADRF, or if the retrieval fails, the local history
+// then being used alone.
+func (e *AnalyticsEngine) archivedHistory(ctx context.Context, startTs, endTs int64) *nwdafContext.HistoryData {
+	if e.adrf == nil {
+		return nil
+	}
+	e.adrf.mu.Lock()
+	retainedFrom := e.adrf.retainedFrom
+	e.adrf.mu.Unlock()
+	if startTs >= retainedFrom {
+		return nil
+	}
+
+	timeout := time.Duration(factory.NwdafConfig.Configuration.GetAdrf().Timeout) * time.Second
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	query := &adrf.Query{NfInstanceId: e.context.NfId, RecordType: adrf.RecordData, StartTs: startTs, EndTs: retainedFrom - 1}
+	if endTs != 0 {
+		query.EndTs = min(endTs, query.EndTs)
+	}
+	records, err := e.adrf.repo.Retrieve(ctx, query)
+	if err != nil {
+		logger.AnalyticsLog.Warnf("ADRF retrieval failed, using the local history: %v", err)
+		return nil
+	}
+
+	archived := &nwdafContext.HistoryData{}
+	for _, record := range records {
+		var history nwdafContext.HistoryData
+		if err := json.Unmarshal(record.Data, &history); err != nil {
+			logger.AnalyticsLog.Warnf("ADRF record %s skipped: %v", record.RecordId, err)
+			continue
+		}
+		archived.Add(history.InWindow(query.StartTs, query.EndTs))
+	}
+	logger.AnalyticsLog.Debugf("Retrieved %d samples from %d ADRF records", archived.Samples(), len(records))
+	return archived
+}
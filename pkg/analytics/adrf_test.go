@@ -0,0 +1,127 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/free5gc/nwdaf/pkg/adrf"
+	"github.com/free5gc/nwdaf/pkg/clock"
+	nwdafContext "github.com/free5gc/nwdaf/pkg/context"
+	"github.com/free5gc/nwdaf/pkg/factory"
+)
+
+// unreachableADRF fails every request
+type unreachableADRF struct{}
+
+func (unreachableADRF) Store(context.Context, *adrf.DataStoreRecord) (string, error) {
+	return "", errors.New("connection refused")
+}
+
+func (unreachableADRF) Retrieve(context.Context, *adrf.Query) ([]*adrf.DataStoreRecord, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestStoreToADRF(t *testing.T) {
+	factory.NwdafConfig.Configuration.Adrf = &factory.AdrfConfig{Enabled: true, Retention: 600}
+	defer func() { factory.NwdafConfig.Configuration.Adrf = nil }()
+
+	const now = int64(1700000000)
+	newEngine := func(repo adrf.Repository) *AnalyticsEngine {
+		engine := NewAnalyticsEngine(&nwdafContext.NWDAFContext{NfId: "nwdaf-1", DataStore: nwdafContext.NewDataStore()})
+		engine.SetClock(clock.NewVirtual(time.Unix(now, 0), 1))
+		engine.SetADRF(repo)
+		for ts := now - 1200; ts <= now; ts += 100 {
+			engine.context.UpdateNFStatistics("amf-1", &nwdafContext.NFStatistics{NFInstanceId: "amf-1", NFType: "AMF", Load: 0.5, Timestamp: ts})
+		}
+		return engine
+	}
+
+	stub := adrf.NewStub(0)
+	engine := newEngine(stub)
+	if _, err := engine.GetAnalytics("NF_LOAD", nil); err != nil {
+		t.Fatalf("GetAnalytics() error = %v", err)
+	}
+	if err := engine.StoreToADRF(context.Background()); err != nil {
+		t.Fatalf("StoreToADRF() error = %v", err)
+	}
+
+	analytics, _ := stub.Retrieve(context.Background(), &adrf.Query{RecordType: adrf.RecordAnalytics})
+	if len(analytics) != 1 || analytics[0].EventType != "NF_LOAD" || analytics[0].NfInstanceId != "nwdaf-1" {
+		t.Errorf("Expected the generated NF_LOAD analytics stored, got %+v", analytics)
+	}
+	data, _ := stub.Retrieve(context.Background(), &adrf.Query{RecordType: adrf.RecordData})
+	if len(data) != 1 || data[0].EndTs != now {
+		t.Fatalf("Expected the collected data stored up to now, got %+v", data)
+	}
+	if local := engine.context.GetNFStatisticsInWindow(0, 0)["amf-1"]; len(local) != 7 {
+		t.Errorf("Expected the last 600s kept locally, got %d samples", len(local))
+	}
+
+	// A window beyond the local retention is served from the ADRF
+	result, err := engine.GetAnalyticsInWindow("NF_LOAD", nil, now-1200, now-700)
+	if err != nil {
+		t.Fatalf("GetAnalyticsInWindow() error = %v", err)
+	}
+	infos := result.(map[string]interface{})["nfLoadLevelInfos"].([]*NfLoadLevelInformation)
+	if len(infos) != 1 || infos[0].Samples != 6 {
+		t.Errorf("Expected the 6 archived samples of amf-1, got %+v", infos)
+	}
+	if local := engine.context.GetNFStatisticsInWindow(0, 0)["amf-1"]; len(local) != 7 {
+		t.Errorf("Expected retrieved data not to be kept locally, got %d samples", len(local))
+	}
+
+	// Samples imported after a run are stored by the next one whatever their
+	// age, and dropped locally only then
+	engine.context.ImportHistory(&nwdafContext.HistoryData{NF: map[string][]*nwdafContext.NFStatistics{
+		"amf-2": {{NFInstanceId: "amf-2", NFType: "AMF", Load: 0.9, Timestamp: now - 1150}},
+	}})
+	if err := engine.StoreToADRF(context.Background()); err != nil {
+		t.Fatalf("StoreToADRF() error = %v", err)
+	}
+	data, _ = stub.Retrieve(context.Background(), &adrf.Query{RecordType: adrf.RecordData})
+	if len(data) != 2 || data[1].StartTs != now-1150 || data[1].EndTs != now-1150 {
+		t.Fatalf("Expected the imported sample stored on its own, got %+v", data)
+	}
+	if local := engine.context.GetNFStatisticsInWindow(0, 0)["amf-2"]; len(local) != 0 {
+		t.Errorf("Expected the imported sample dropped once stored, got %d samples", len(local))
+	}
+	result, err = engine.GetAnalyticsInWindow("NF_LOAD", map[string]interface{}{"nfInstanceIds": "amf-2"}, now-1200, now-700)
+	if err != nil {
+		t.Fatalf("GetAnalyticsInWindow() error = %v", err)
+	}
+	infos = result.(map[string]interface{})["nfLoadLevelInfos"].([]*NfLoadLevelInformation)
+	if len(infos) != 1 || infos[0].Samples != 1 {
+		t.Errorf("Expected the imported sample served from the ADRF, got %+v", infos)
+	}
+
+	// Restarted under the same NF instance ID, the NWDAF serves what it stored
+	// before its first storage run
+	restarted := NewAnalyticsEngine(&nwdafContext.NWDAFContext{NfId: "nwdaf-1", DataStore: nwdafContext.NewDataStore()})
+	restarted.SetClock(clock.NewVirtual(time.Unix(now, 0), 1))
+	restarted.SetADRF(stub)
+	result, err = restarted.GetAnalyticsInWindow("NF_LOAD", map[string]interface{}{"nfInstanceIds": "amf-1"}, now-1200, now-700)
+	if err != nil {
+		t.Fatalf("GetAnalyticsInWindow() error = %v", err)
+	}
+	infos = result.(map[string]interface{})["nfLoadLevelInfos"].([]*NfLoadLevelInformation)
+	if len(infos) != 1 || infos[0].Samples != 6 {
+		t.Errorf("Expected the 6 archived samples of amf-1 after a restart, got %+v", infos)
+	}
+
+	// Nothing is dropped while the ADRF is unreachable
+	unreachable := newEngine(unreachableADRF{})
+	if _, err := unreachable.GetAnalytics("NF_LOAD", nil); err != nil {
+		t.Fatalf("GetAnalytics() error = %v", err)
+	}
+	if err := unreachable.StoreToADRF(context.Background()); err == nil {
+		t.Error("Expected the storage to fail")
+	}
+	if local := unreachable.context.GetNFStatisticsInWindow(0, 0)["amf-1"]; len(local) != 13 {
+		t.Errorf("Expected all samples kept, got %d", len(local))
+	}
+	if len(unreachable.adrf.pending) != 1 {
+		t.Errorf("Expected the analytics kept for the next run, got %d records", len(unreachable.adrf.pending))
+	}
+}
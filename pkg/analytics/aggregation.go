@@ -0,0 +1,542 @@
+package analytics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/free5gc/nwdaf/internal/logger"
+	nwdafContext "github.com/free5gc/nwdaf/pkg/context"
+	"github.com/free5gc/nwdaf/pkg/factory"
+)
+
+// Paths of the peer services an aggregator uses and of the callback their
+// notifications are sent to
+const (
+	AnalyticsInfoPath      = "/nnwdaf-analyticsinfo/v1"
+	EventsSubscriptionPath = "/nnwdaf-eventssubscription/v1"
+	AggregationNotifyPath  = "/aggregation/notify"
+)
+
+// AggregatorHeader carries the NF instance of the aggregator on the requests
+// it forwards. Peers answer them from their own data, so aggregators never
+// forward to each other in a loop.
+const AggregatorHeader = "X-Nwdaf-Aggregator"
+
+// Peer is an NWDAF whose analytics an aggregator federates
+type Peer struct {
+	NfInstanceId string
+	// Uri is the API root of the peer
+	Uri string
+	// Tais served by the peer; none means every area
+	Tais []string
+}
+
+func (p *Peer) name() string {
+	if p.NfInstanceId != "" {
+		return p.NfInstanceId
+	}
+	return p.Uri
+}
+
+// serves reports whether the peer serves any of the given TAIs
+func (p *Peer) serves(tais []string) bool {
+	if len(p.Tais) == 0 || len(tais) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(tais, func(tai string) bool { return slices.Contains(p.Tais, tai) })
+}
+
+// peerState holds the peers discovered through the NRF and the subscriptions
+// made at peers on behalf of local subscriptions
+type peerState struct {
+	mu         sync.Mutex
+	discovered []*Peer
+	// subs are the peer subscriptions of each local subscription
+	subs map[string][]*peerSubscription
+}
+
+type peerSubscription struct {
+	peer           *Peer
+	subscriptionId string
+	// data is the latest analytics notified by the peer, received at
+	// receivedAt
+	data       map[string]interface{}
+	receivedAt int64
+}
+
+// peerStaleCycles is how many reporting periods the analytics notified by a
+// peer are merged for; a peer that stops notifying drops out after that
+const peerStaleCycles = 3
+
+func newPeerState() *peerState {
+	return &peerState{subs: make(map[string][]*peerSubscription)}
+}
+
+// peerResult is the answer of one peer
+type peerResult struct {
+	peer *Peer
+	data map[string]interface{}
+}
+
+// SetDiscoveredPeers replaces the peers discovered through the NRF
+func (e *AnalyticsEngine) SetDiscoveredPeers(peers []*Peer) {
+	e.peers.mu.Lock()
+	defer e.peers.mu.Unlock()
+	e.peers.discovered = peers
+}
+
+// Peers returns the configured peers followed by the discovered ones not
+// configured with the same URI
+func (e *AnalyticsEngine) Peers() []*Peer {
+	var peers []*Peer
+	seen := make(map[string]bool)
+	for _, p := range factory.NwdafConfig.Configuration.GetAggregation().Peers {
+		if p == nil || p.Uri == "" || seen[p.Uri] {
+			continue
+		}
+		seen[p.Uri] = true
+		peers = append(peers, &Peer{NfInstanceId: p.NfInstanceId, Uri: strings.TrimRight(p.Uri, "/"), Tais: p.Tais})
+	}
+
+	e.peers.mu.Lock()
+	defer e.peers.mu.Unlock()
+	for _, p := range e.peers.discovered {
+		if !seen[p.Uri] {
+			seen[p.Uri] = true
+			peers = append(peers, p)
+		}
+	}
+	return peers
+}
+
+// peersFor returns the peers serving the area of a filter: its TAIs and
+// those of its areas of interest. Without an area every peer is selected.
+func (e *AnalyticsEngine) peersFor(f *EventFilter) []*Peer {
+	tais := slices.Clone(f.Tais)
+	for _, name := range f.AreasOfInterest {
+		area, _ := factory.NwdafConfig.Configuration.GetAreaOfInterest(name)
+		tais = append(tais, area...)
+	}
+
+	var peers []*Peer
+	for _, p := range e.Peers() {
+		if p.serves(tais) {
+			peers = append(peers, p)
+		}
+	}
+	return peers
+}
+
+// peerAnalyticsRequest is the analytics request forwarded to peers
+type peerAnalyticsRequest struct {
+	EventType       string                                  `json:"eventType"`
+	AnalyticsFilter map[string]interface{}                  `json:"analyticsFilter,omitempty"`
+	EvtReq          *nwdafContext.EventReportingRequirement `json:"evtReq,omitempty"`
+}
+
+// peerSubscriptionRequest is the subscription made at peers
+type peerSubscriptionRequest struct {
+	EventType       string                                  `json:"eventType"`
+	ConsumerNfId    string                                  `json:"consumerNfId"`
+	NotificationUri string                                  `json:"notificationUri"`
+	AnalyticsFilter map[string]interface{}                  `json:"analyticsFilter,omitempty"`
+	ReportingPeriod int                                     `json:"reportingPeriod,omitempty"`
+	EvtReq          *nwdafContext.EventReportingRequirement `json:"evtReq,omitempty"`
+}
+
+// GetAggregatedAnalytics retrieves analytics like GetAnalyticsWithRequirement
+// and, on an aggregator, merges them with those of the peers serving the
+// requested area. Peers that fail are left out of the answer.
+func (e *AnalyticsEngine) GetAggregatedAnalytics(ctx context.Context, eventType string, filter map[string]interface{}, req *nwdafContext.EventReportingRequirement) (interface{}, error) {
+	local, err := e.GetAnalyticsWithRequirement(ctx, eventType, filter, req)
+	if err != nil || !factory.NwdafConfig.Configuration.GetAggregation().Enabled {
+		return local, err
+	}
+	f, err := ParseFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	peers := e.peersFor(f)
+	if len(peers) == 0 {
+		return local, nil
+	}
+
+	body := &peerAnalyticsRequest{EventType: eventType, AnalyticsFilter: filter, EvtReq: req}
+	var mu sync.Mutex
+	var results []peerResult
+	e.fanOut(peers, func(p *Peer) error {
+		var resp struct {
+			Data map[string]interface{} `json:"data"`
+		}
+		if err := e.peerRequest(http.MethodPost, p.Uri+AnalyticsInfoPath+"/analytics", body, &resp); err != nil {
+			return err
+		}
+		mu.Lock()
+		results = append(results, peerResult{peer: p, data: resp.Data})
+		mu.Unlock()
+		return nil
+	})
+	m, _ := LookupModule(eventType)
+	return mergeResults(m, local, results), nil
+}
+
+// SubscribePeers subscribes, on an aggregator, at the peers serving the area
+// of a local subscription. Their notifications are merged into the
+// notifications of the local subscription.
+func (e *AnalyticsEngine) SubscribePeers(sub *nwdafContext.AnalyticsSubscription) {
+	if !factory.NwdafConfig.Configuration.GetAggregation().Enabled {
+		return
+	}
+	f, err := ParseFilter(sub.AnalyticsFilter)
+	if err != nil {
+		return
+	}
+	peers := e.peersFor(f)
+	if len(peers) == 0 {
+		return
+	}
+
+	body := &peerSubscriptionRequest{
+		EventType:       sub.EventType,
+		ConsumerNfId:    e.context.NfId,
+		NotificationUri: factory.NwdafConfig.Configuration.GetSbiUri() + AggregationNotifyPath + "/" + sub.SubscriptionId,
+		AnalyticsFilter: sub.AnalyticsFilter,
+		ReportingPeriod: sub.ReportingPeriod,
+		EvtReq:          sub.EvtReq,
+	}
+	var mu sync.Mutex
+	var subs []*peerSubscription
+	e.fanOut(peers, func(p *Peer) error {
+		var resp struct {
+			SubscriptionId string `json:"subscriptionId"`
+		}
+		if err := e.peerRequest(http.MethodPost, p.Uri+EventsSubscriptionPath+"/subscriptions", body, &resp); err != nil {
+			return err
+		}
+		mu.Lock()
+		subs = append(subs, &peerSubscription{peer: p, subscriptionId: resp.SubscriptionId})
+		mu.Unlock()
+		return nil
+	})
+
+	e.peers.mu.Lock()
+	e.peers.subs[sub.SubscriptionId] = subs
+	e.peers.mu.Unlock()
+	logger.AnalyticsLog.Infof("Subscription %s federated to %d of %d peers", sub.SubscriptionId, len(subs), len(peers))
+}
+
+// UnsubscribePeers removes the peer subscriptions of a local subscription
+func (e *AnalyticsEngine) UnsubscribePeers(subscriptionId string) {
+	e.peers.mu.Lock()
+	subs := e.peers.subs[subscriptionId]
+	delete(e.peers.subs, subscriptionId)
+	e.peers.mu.Unlock()
+	if len(subs) == 0 {
+		return
+	}
+
+	peers := make([]*Peer, len(subs))
+	ids := make(map[*Peer]string, len(subs))
+	for i, s := range subs {
+		peers[i] = s.peer
+		ids[s.peer] = s.subscriptionId
+	}
+	e.fanOut(peers, func(p *Peer) error {
+		return e.peerRequest(http.MethodDelete, p.Uri+EventsSubscriptionPath+"/subscriptions/"+ids[p], nil, nil)
+	})
+}
+
+// HandlePeerNotification keeps the analytics a peer notified for a local
+// subscription until they are merged into its next notification. It returns
+// false when the notification matches no peer subscription.
+func (e *AnalyticsEngine) HandlePeerNotification(subscriptionId string, n *EventNotification) bool {
+	data, _ := n.Data.(map[string]interface{})
+
+	e.peers.mu.Lock()
+	defer e.peers.mu.Unlock()
+	for _, s := range e.peers.subs[subscriptionId] {
+		if s.subscriptionId == n.SubscriptionId {
+			s.data = data
+			s.receivedAt = e.clock.Now().Unix()
+			return true
+		}
+	}
+	return false
+}
+
+// withPeerResults merges the analytics last notified by the peers of a
+// subscription into its own. Analytics not renewed for peerStaleCycles
+// reporting periods are dropped.
+func (e *AnalyticsEngine) withPeerResults(m Module, sub *nwdafContext.AnalyticsSubscription, analytics interface{}) interface{} {
+	period := max(sub.ReportingPeriod, factory.NwdafConfig.Configuration.AnalyticsDelay, 1)
+	staleBefore := e.clock.Now().Unix() - int64(peerStaleCycles*period)
+
+	e.peers.mu.Lock()
+	var results []peerResult
+	for _, s := range e.peers.subs[sub.SubscriptionId] {
+		if s.data != nil && s.receivedAt < staleBefore {
+			logger.AnalyticsLog.Debugf("Dropping stale analytics of peer %s for subscription %s", s.peer.name(), sub.SubscriptionId)
+			s.data = nil
+		}
+		if s.data != nil {
+			results = append(results, peerResult{peer: s.peer, data: s.data})
+		}
+	}
+	e.peers.mu.Unlock()
+
+	if len(results) == 0 || analytics == nil {
+		return analytics
+	}
+	return mergeResults(m, analytics, results)
+}
+
+// fanOut calls every peer in parallel, counting and logging the failures
+func (e *AnalyticsEngine) fanOut(peers []*Peer, call func(*Peer) error) {
+	var wg sync.WaitGroup
+	for _, p := range peers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := call(p); err != nil {
+				PeerRequests.WithLabelValues(p.name(), "error").Inc()
+				logger.AnalyticsLog.Warnf("Peer NWDAF %s: %v", p.name(), err)
+				return
+			}
+			PeerRequests.WithLabelValues(p.name(), "ok").Inc()
+		}()
+	}
+	wg.Wait()
+}
+
+// peerRequest sends a request marked as forwarded by this aggregator and
+// decodes the reply into out unless it is nil
+func (e *AnalyticsEngine) peerRequest(method, uri string, body, out interface{}) error {
+	timeout := time.Duration(factory.NwdafConfig.Configuration.GetAggregation().Timeout) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, uri, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(AggregatorHeader, e.context.NfId)
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("peer replied %s", resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// mergeRules tell how the output objects of a module are merged across
+// NWDAFs. Numbers not listed are averaged, weighted by the data behind them;
+// other values come from the NWDAF with more data behind them.
+type mergeRules struct {
+	// identity fields identify what an output object describes. Objects of
+	// two NWDAFs carrying the same identity fields with equal values are
+	// merged; others are listed side by side.
+	identity []string
+	// weight fields give the data behind an object, in order of preference
+	weight []string
+	// sum fields are counters summed across NWDAFs
+	sum []string
+	// lowest and highest fields keep the lowest or highest value, e.g. the
+	// earliest start, the latest end, a peak or the least confidence
+	lowest, highest []string
+}
+
+// Merge fields shared by every module: result windows and timestamps, sample
+// counts, and the confidence and accuracy of predictions, of which the
+// merged result claims the least
+var (
+	baseLowest  = []string{"startTs", "confidence", "accuracy"}
+	baseHighest = []string{"endTs", "timestamp"}
+	baseSum     = []string{"samples"}
+)
+
+// mergeResults merges the results of peers into a local result with the
+// rules of the module. The answer lists the peers it was aggregated from.
+func mergeResults(m Module, local interface{}, results []peerResult) map[string]interface{} {
+	sort.Slice(results, func(i, j int) bool { return results[i].peer.name() < results[j].peer.name() })
+
+	all := make([]map[string]interface{}, 0, len(results)+1)
+	all = append(all, genericResult(local))
+	from := make([]string, 0, len(results))
+	for _, r := range results {
+		all = append(all, r.data)
+		from = append(from, r.peer.name())
+	}
+	merged := m.Merge(all)
+	merged["aggregatedFrom"] = from
+	return merged
+}
+
+// merge merges results in order, each weighted by the data behind it like
+// the objects within; results without a weight field count as one
+func (r *mergeRules) merge(results []map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{})
+	total := 0.0
+	for _, result := range results {
+		weight := r.objectWeight(result, 1)
+		merged = r.objects(merged, result, total, weight)
+		total += weight
+	}
+	return merged
+}
+
+// genericResult converts a result to its JSON form, as peers return it
+func genericResult(result interface{}) map[string]interface{} {
+	generic := make(map[string]interface{})
+	data, err := json.Marshal(result)
+	if err != nil {
+		return generic
+	}
+	if err := json.Unmarshal(data, &generic); err != nil || generic == nil {
+		return make(map[string]interface{})
+	}
+	return generic
+}
+
+// objects merges two output objects with the weights of the data behind them
+func (r *mergeRules) objects(a, b map[string]interface{}, wa, wb float64) map[string]interface{} {
+	merged := make(map[string]interface{}, len(a)+len(b))
+	for key, value := range a {
+		merged[key] = value
+	}
+	for key, vb := range b {
+		if va, ok := merged[key]; ok && va != nil {
+			merged[key] = r.field(key, va, vb, wa, wb)
+		} else {
+			merged[key] = vb
+		}
+	}
+	return merged
+}
+
+func (r *mergeRules) field(key string, va, vb interface{}, wa, wb float64) interface{} {
+	switch y := vb.(type) {
+	case float64:
+		if x, ok := va.(float64); ok {
+			return r.number(key, x, y, wa, wb)
+		}
+	case map[string]interface{}:
+		if x, ok := va.(map[string]interface{}); ok {
+			return r.objects(x, y, r.objectWeight(x, wa), r.objectWeight(y, wb))
+		}
+	case []interface{}:
+		if x, ok := va.([]interface{}); ok {
+			return r.lists(x, y, wa, wb)
+		}
+	}
+	// Other values come from the NWDAF with more data behind them
+	if wb > wa {
+		return vb
+	}
+	return va
+}
+
+// number applies the rule of a numeric field, averaging by default
+func (r *mergeRules) number(key string, x, y, wa, wb float64) float64 {
+	switch {
+	case slices.Contains(r.sum, key):
+		return x + y
+	case slices.Contains(r.lowest, key):
+		return math.Min(x, y)
+	case slices.Contains(r.highest, key):
+		return math.Max(x, y)
+	}
+
+	if wa+wb <= 0 {
+		wa, wb = 1, 1
+	}
+	avg := (x*wa + y*wb) / (wa + wb)
+	if x == math.Trunc(x) && y == math.Trunc(y) {
+		return math.Round(avg)
+	}
+	return avg
+}
+
+// lists merges the objects describing the same subject and takes the union
+// of the others, such as UE lists
+func (r *mergeRules) lists(a, b []interface{}, wa, wb float64) []interface{} {
+	merged := slices.Clone(a)
+	index := make(map[string]int)
+	for i, v := range merged {
+		if obj, ok := v.(map[string]interface{}); ok {
+			if id := r.identityOf(obj); id != "" {
+				index[id] = i
+			}
+		}
+	}
+
+	for _, v := range b {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			if !slices.Contains(merged, v) {
+				merged = append(merged, v)
+			}
+			continue
+		}
+		id := r.identityOf(obj)
+		if i, ok := index[id]; ok && id != "" {
+			other := merged[i].(map[string]interface{})
+			merged[i] = r.objects(other, obj, r.objectWeight(other, wa), r.objectWeight(obj, wb))
+			continue
+		}
+		if id != "" {
+			index[id] = len(merged)
+		}
+		merged = append(merged, obj)
+	}
+	return merged
+}
+
+// identityOf returns the identity fields of an object, "" when it has none
+func (r *mergeRules) identityOf(obj map[string]interface{}) string {
+	var parts []string
+	for _, field := range r.identity {
+		if value, ok := obj[field]; ok {
+			data, _ := json.Marshal(value)
+			parts = append(parts, field+"="+string(data))
+		}
+	}
+	return strings.Join(parts, "|")
+}
+
+// objectWeight returns the data behind an object, or the weight it inherits
+// from its parent
+func (r *mergeRules) objectWeight(obj map[string]interface{}, inherited float64) float64 {
+	for _, field := range r.weight {
+		if w, ok := obj[field].(float64); ok && w > 0 {
+			return w
+		}
+	}
+	return inherited
+}
@@ -0,0 +1,229 @@
+package analytics
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/free5gc/nwdaf/pkg/clock"
+	nwdafContext "github.com/free5gc/nwdaf/pkg/context"
+	"github.com/free5gc/nwdaf/pkg/factory"
+)
+
+func TestMergeResults(t *testing.T) {
+	local := map[string]interface{}{
+		"timestamp": 100,
+		"samples":   10,
+		"window":    windowInfo(0, 100),
+		"networkPerfInfos": []*NetworkPerfInfo{
+			{Tai: "tai-1", Samples: 30, UeCount: 3, AverageLatency: 10, PacketLoss: 0.01},
+		},
+		"predictions": []*NetworkPerfInfo{
+			{Tai: "tai-1", AverageLatency: 10, Confidence: 80},
+		},
+	}
+	peer := map[string]interface{}{
+		"timestamp": 120.0,
+		"samples":   20.0,
+		"window":    map[string]interface{}{"startTs": 50.0, "endTs": 120.0},
+		"networkPerfInfos": []interface{}{
+			map[string]interface{}{"tai": "tai-1", "samples": 10.0, "ueCount": 1.0, "averageLatency": 30.0, "packetLoss": 0.05},
+			map[string]interface{}{"tai": "tai-2", "samples": 5.0, "ueCount": 2.0, "averageLatency": 5.0},
+		},
+		"predictions": []interface{}{
+			map[string]interface{}{"tai": "tai-1", "averageLatency": 20.0, "confidence": 40.0},
+		},
+	}
+
+	m, _ := LookupModule("NETWORK_PERFORMANCE")
+	merged := mergeResults(m, local, []peerResult{
+		{peer: &Peer{NfInstanceId: "nwdaf-b"}, data: map[string]interface{}{}},
+		{peer: &Peer{NfInstanceId: "nwdaf-a"}, data: peer},
+	})
+
+	if merged["timestamp"] != 120.0 || merged["samples"] != 30.0 {
+		t.Errorf("Expected the latest timestamp and summed samples, got %v and %v", merged["timestamp"], merged["samples"])
+	}
+	if window := merged["window"].(map[string]interface{}); window["startTs"] != 0.0 || window["endTs"] != 120.0 {
+		t.Errorf("Expected the union of the windows, got %v", window)
+	}
+
+	infos := merged["networkPerfInfos"].([]interface{})
+	if len(infos) != 2 {
+		t.Fatalf("Expected tai-1 merged and tai-2 added, got %v", infos)
+	}
+	tai1 := infos[0].(map[string]interface{})
+	// Weighted by samples: (10*30 + 30*10) / 40
+	if tai1["averageLatency"] != 15.0 || tai1["samples"] != 40.0 || tai1["ueCount"] != 4.0 {
+		t.Errorf("Expected a sample-weighted average over 40 samples and 4 UEs, got %v", tai1)
+	}
+	if loss := tai1["packetLoss"].(float64); loss < 0.0199 || loss > 0.0201 {
+		t.Errorf("Expected packet loss 0.02, got %v", loss)
+	}
+	// Predictions inherit the samples of their result: (10*10 + 20*20) / 30
+	prediction := merged["predictions"].([]interface{})[0].(map[string]interface{})
+	if prediction["confidence"] != 40.0 || prediction["averageLatency"] != 17.0 {
+		t.Errorf("Expected the averaged latency with the least confidence, got %v", prediction)
+	}
+	if from := merged["aggregatedFrom"].([]string); len(from) != 2 || from[0] != "nwdaf-a" {
+		t.Errorf("Expected the peers listed by name, got %v", from)
+	}
+
+	m, _ = LookupModule("ABNORMAL_BEHAVIOUR")
+	merged = mergeResults(m, map[string]interface{}{}, []peerResult{
+		{peer: &Peer{NfInstanceId: "nwdaf-a"}, data: map[string]interface{}{
+			"abnormalBehaviours": []interface{}{
+				map[string]interface{}{"excep": map[string]interface{}{"excepId": "UNEXPECTED_UE_LOCATION"}, "supis": []interface{}{"imsi-2", "imsi-3"}},
+			},
+		}},
+		{peer: &Peer{NfInstanceId: "nwdaf-b"}, data: map[string]interface{}{
+			"abnormalBehaviours": []interface{}{
+				map[string]interface{}{"excep": map[string]interface{}{"excepId": "UNEXPECTED_UE_LOCATION"}, "supis": []interface{}{"imsi-1", "imsi-2"}},
+			},
+		}},
+	})
+	behaviours := merged["abnormalBehaviours"].([]interface{})
+	if len(behaviours) != 1 {
+		t.Fatalf("Expected one exception, got %v", behaviours)
+	}
+	if supis := behaviours[0].(map[string]interface{})["supis"].([]interface{}); len(supis) != 3 {
+		t.Errorf("Expected the union of the UE lists, got %v", supis)
+	}
+}
+
+func TestMergeResultsWeighted(t *testing.T) {
+	m, _ := LookupModule("NETWORK_PERFORMANCE")
+	merged := mergeResults(m, map[string]interface{}{"samples": 10, "averageLatency": 10}, []peerResult{
+		{peer: &Peer{NfInstanceId: "nwdaf-a"}, data: map[string]interface{}{"samples": 30.0, "averageLatency": 30.0}},
+		{peer: &Peer{NfInstanceId: "nwdaf-b"}, data: map[string]interface{}{"samples": 60.0, "averageLatency": 60.0}},
+	})
+
+	// Weighted by samples: (10*10 + 30*30 + 60*60) / 100
+	if merged["averageLatency"] != 46.0 || merged["samples"] != 100.0 {
+		t.Errorf("Expected a sample-weighted average over 100 samples, got %v over %v", merged["averageLatency"], merged["samples"])
+	}
+}
+
+// newPeer starts a peer answering analytics requests with data and counting
+// the forwarded requests it receives
+func newPeer(t *testing.T, data map[string]interface{}, requests *int) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(AggregatorHeader) != "aggregator" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		*requests++
+		switch {
+		case r.URL.Path == AnalyticsInfoPath+"/analytics":
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"eventType": "NETWORK_PERFORMANCE", "data": data})
+		case r.URL.Path == EventsSubscriptionPath+"/subscriptions" && r.Method == http.MethodPost:
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"subscriptionId": "peer-sub"})
+		case r.Method == http.MethodDelete:
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestGetAggregatedAnalytics(t *testing.T) {
+	var eastRequests, westRequests int
+	east := newPeer(t, map[string]interface{}{
+		"networkPerfInfos": []interface{}{map[string]interface{}{"tai": "tai-1", "samples": 4.0, "averageLatency": 20.0}},
+	}, &eastRequests)
+	west := newPeer(t, map[string]interface{}{}, &westRequests)
+
+	factory.NwdafConfig.Configuration.Aggregation = &factory.AggregationConfig{
+		Enabled: true,
+		Peers: []*factory.PeerNwdaf{
+			{NfInstanceId: "east", Uri: east.URL, Tais: []string{"tai-1"}},
+			{NfInstanceId: "west", Uri: west.URL, Tais: []string{"tai-9"}},
+		},
+	}
+	defer func() { factory.NwdafConfig.Configuration.Aggregation = nil }()
+
+	ctx := &nwdafContext.NWDAFContext{NfId: "aggregator", DataStore: nwdafContext.NewDataStore()}
+	engine := NewAnalyticsEngine(ctx)
+	engine.SetClock(clock.NewVirtual(time.Unix(1700003600, 0), 1))
+
+	data, err := engine.GetAggregatedAnalytics(context.Background(), "NETWORK_PERFORMANCE", map[string]interface{}{"tais": []interface{}{"tai-1"}}, nil)
+	if err != nil {
+		t.Fatalf("GetAggregatedAnalytics() error = %v", err)
+	}
+	if eastRequests != 1 || westRequests != 0 {
+		t.Errorf("Expected only the peer serving tai-1 to be asked, got east %d and west %d", eastRequests, westRequests)
+	}
+	result := data.(map[string]interface{})
+	if infos, ok := result["networkPerfInfos"].([]interface{}); !ok || len(infos) != 1 {
+		t.Errorf("Expected the peer's tai-1 statistics, got %v", result["networkPerfInfos"])
+	}
+	if from := result["aggregatedFrom"].([]string); len(from) != 1 || from[0] != "east" {
+		t.Errorf("Expected an answer aggregated from east, got %v", from)
+	}
+
+	// Without an area every peer is asked
+	if _, err := engine.GetAggregatedAnalytics(context.Background(), "NETWORK_PERFORMANCE", nil, nil); err != nil {
+		t.Fatalf("GetAggregatedAnalytics() error = %v", err)
+	}
+	if eastRequests != 2 || westRequests != 1 {
+		t.Errorf("Expected both peers to be asked, got east %d and west %d", eastRequests, westRequests)
+	}
+}
+
+func TestSubscribePeers(t *testing.T) {
+	var requests int
+	peer := newPeer(t, nil, &requests)
+	factory.NwdafConfig.Configuration.Aggregation = &factory.AggregationConfig{
+		Enabled: true,
+		Peers:   []*factory.PeerNwdaf{{NfInstanceId: "east", Uri: peer.URL}},
+	}
+	defer func() { factory.NwdafConfig.Configuration.Aggregation = nil }()
+
+	ctx := &nwdafContext.NWDAFContext{NfId: "aggregator", DataStore: nwdafContext.NewDataStore()}
+	engine := NewAnalyticsEngine(ctx)
+	clk := clock.NewVirtual(time.Unix(1000, 0), 1)
+	engine.SetClock(clk)
+	sub := &nwdafContext.AnalyticsSubscription{SubscriptionId: "sub-1", EventType: "NETWORK_PERFORMANCE"}
+	engine.SubscribePeers(sub)
+	if requests != 1 {
+		t.Fatalf("Expected a subscription at the peer, got %d requests", requests)
+	}
+
+	if engine.HandlePeerNotification("sub-1", &EventNotification{SubscriptionId: "other"}) {
+		t.Error("Expected a notification of an unknown peer subscription to be rejected")
+	}
+	notification := &EventNotification{
+		SubscriptionId: "peer-sub",
+		Data:           map[string]interface{}{"samples": 5.0, "ueMobilityInfos": []interface{}{map[string]interface{}{"supi": "imsi-2"}}},
+	}
+	if !engine.HandlePeerNotification("sub-1", notification) {
+		t.Fatal("Expected the peer notification to be kept")
+	}
+
+	m, _ := LookupModule("UE_MOBILITY")
+	local := map[string]interface{}{"samples": 3, "ueMobilityInfos": []*UeMobilityInfo{{Supi: "imsi-1"}}}
+	merged := engine.withPeerResults(m, sub, local).(map[string]interface{})
+	if merged["samples"] != 8.0 || len(merged["ueMobilityInfos"].([]interface{})) != 2 {
+		t.Errorf("Expected the peer's UEs merged into the notification, got %v", merged)
+	}
+
+	// A peer that stops notifying drops out
+	clk.Advance(time.Duration(peerStaleCycles*factory.NwdafConfig.Configuration.AnalyticsDelay+1) * time.Second)
+	if result := engine.withPeerResults(m, sub, local); len(result.(map[string]interface{})) != 2 {
+		t.Errorf("Expected stale peer analytics to be dropped, got %v", result)
+	}
+
+	engine.UnsubscribePeers("sub-1")
+	if requests != 2 {
+		t.Errorf("Expected the peer subscription to be deleted, got %d requests", requests)
+	}
+	if result := engine.withPeerResults(m, sub, local); result == nil || len(result.(map[string]interface{})) != 2 {
+		t.Errorf("Expected the local result alone once unsubscribed, got %v", result)
+	}
+}
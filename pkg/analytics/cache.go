@@ -0,0 +1,110 @@
+package analytics
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/free5gc/nwdaf/pkg/factory"
+	"golang.org/x/sync/singleflight"
+)
+
+// resultCache keeps computed analytics for a TTL so that subscription groups
+// and GetAnalytics requests for the same event, filter and window share them.
+// Cached results must not be modified; use copyResult first.
+type resultCache struct {
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	hits    int
+	lookups int
+
+	// computing lets concurrent misses of a key share a single computation
+	computing singleflight.Group
+}
+
+type cacheEntry struct {
+	result  interface{}
+	expires time.Time
+}
+
+func newResultCache() *resultCache {
+	return &resultCache{entries: make(map[string]cacheEntry)}
+}
+
+func (c *resultCache) get(key string, now time.Time) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	hit := ok && now.Before(entry.expires)
+
+	c.lookups++
+	if hit {
+		c.hits++
+		CacheLookups.WithLabelValues("hit").Inc()
+	} else {
+		CacheLookups.WithLabelValues("miss").Inc()
+	}
+	CacheHitRatio.Set(float64(c.hits) / float64(c.lookups))
+	return entry.result, hit
+}
+
+func (c *resultCache) put(key string, result interface{}, expires time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = cacheEntry{result: result, expires: expires}
+}
+
+// sweep drops the expired entries
+func (c *resultCache) sweep(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// reportKey identifies the periodic report of a subscription group
+func reportKey(eventType string, f *EventFilter) string {
+	return fmt.Sprintf("report|%s|%s", eventType, f.key())
+}
+
+// analyticsKey identifies the analytics of an event, filter and window
+func analyticsKey(eventType string, f *EventFilter, startTs, endTs int64) string {
+	return fmt.Sprintf("analytics|%s|%s|%d|%d", eventType, f.key(), startTs, endTs)
+}
+
+// cachedResult returns the cached result of key or computes and caches it.
+// Concurrent misses of the same key wait for a single computation.
+// Predictions are recorded for accuracy monitoring when computed.
+func (e *AnalyticsEngine) cachedResult(key, eventType string, f *EventFilter, compute func() interface{}) interface{} {
+	now := e.clock.Now()
+	if result, ok := e.cache.get(key, now); ok {
+		return result
+	}
+	result, _, _ := e.cache.computing.Do(key, func() (interface{}, error) {
+		result := compute()
+		e.recordPredictions(eventType, f, result)
+		e.storeAnalytics(eventType, f, result)
+		if ttl := factory.NwdafConfig.Configuration.GetAnalyticsCacheTTL(); ttl > 0 {
+			e.cache.put(key, result, now.Add(time.Duration(ttl)*time.Second))
+		}
+		return result, nil
+	})
+	return result
+}
+
+// copyResult copies the maps of a result so it can be limited and annotated
+// for one consumer without altering the shared result
+func copyResult(result interface{}) interface{} {
+	r, ok := result.(map[string]interface{})
+	if !ok {
+		return result
+	}
+	copied := make(map[string]interface{}, len(r))
+	for key, value := range r {
+		copied[key] = copyResult(value)
+	}
+	return copied
+}
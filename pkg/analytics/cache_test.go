@@ -0,0 +1,161 @@
+package analytics
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/free5gc/nwdaf/pkg/clock"
+	nwdafContext "github.com/free5gc/nwdaf/pkg/context"
+)
+
+func TestFilterKey(t *testing.T) {
+	a := mustParseFilter(t, map[string]interface{}{"nfInstanceIds": []interface{}{"amf-2", "amf-1"}, "nfType": "AMF"})
+	b := mustParseFilter(t, map[string]interface{}{"nfTypes": []interface{}{"AMF"}, "nfInstanceIds": []interface{}{"amf-1", "amf-2"}})
+	c := mustParseFilter(t, map[string]interface{}{"nfInstanceIds": []interface{}{"amf-1"}})
+
+	if a.key() != b.key() {
+		t.Errorf("Expected equivalent filters to share a key, got %s and %s", a.key(), b.key())
+	}
+	if a.key() == c.key() {
+		t.Errorf("Expected different filters to have different keys, got %s", a.key())
+	}
+	if a.NfInstanceIds[0] != "amf-2" {
+		t.Errorf("Expected key() to leave the filter unchanged, got %v", a.NfInstanceIds)
+	}
+}
+
+func TestResultCache(t *testing.T) {
+	ctx := &nwdafContext.NWDAFContext{DataStore: nwdafContext.NewDataStore()}
+	engine := NewAnalyticsEngine(ctx)
+	now := time.Unix(1700003600, 0)
+	virtual := clock.NewVirtual(now, 1)
+	engine.SetClock(virtual)
+	ctx.UpdateNFStatistics("amf-1", &nwdafContext.NFStatistics{NFInstanceId: "amf-1", NFType: "AMF", Load: 0.5, Timestamp: now.Unix() - 60})
+
+	get := func() map[string]interface{} {
+		data, err := engine.GetAnalyticsInWindow("NF_LOAD", nil, now.Unix()-600, now.Unix())
+		if err != nil {
+			t.Fatalf("GetAnalyticsInWindow() error = %v", err)
+		}
+		return data.(map[string]interface{})
+	}
+
+	first := get()
+	first["nfLoadLevelInfos"] = nil
+	if second := get(); second["nfLoadLevelInfos"] == nil {
+		t.Error("Expected the cached result to be unaffected by changes to a response")
+	}
+	if engine.cache.lookups != 2 || engine.cache.hits != 1 {
+		t.Errorf("Expected 1 hit in 2 lookups, got %d in %d", engine.cache.hits, engine.cache.lookups)
+	}
+
+	// Results expire after the TTL
+	virtual.Advance(10 * time.Second)
+	get()
+	if engine.cache.hits != 1 {
+		t.Errorf("Expected an expired entry to miss, got %d hits", engine.cache.hits)
+	}
+	virtual.Advance(10 * time.Second)
+	engine.cache.sweep(virtual.Now())
+	if len(engine.cache.entries) != 0 {
+		t.Errorf("Expected sweep to drop expired entries, got %d", len(engine.cache.entries))
+	}
+}
+
+func TestCachedResultComputedOnce(t *testing.T) {
+	engine := NewAnalyticsEngine(&nwdafContext.NWDAFContext{DataStore: nwdafContext.NewDataStore()})
+	engine.SetClock(clock.NewVirtual(time.Unix(1700003600, 0), 1))
+
+	var computed atomic.Int32
+	started, release := make(chan struct{}), make(chan struct{})
+	compute := func() interface{} {
+		if computed.Add(1) == 1 {
+			close(started)
+		}
+		<-release
+		return map[string]interface{}{"samples": 1}
+	}
+
+	var wg sync.WaitGroup
+	results := make([]interface{}, 5)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = engine.cachedResult("key", "NF_LOAD", &EventFilter{}, compute)
+		}()
+		if i == 0 {
+			<-started
+		}
+	}
+	// Let the other requests reach the computation in progress
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := computed.Load(); n != 1 {
+		t.Errorf("Expected concurrent misses to share one computation, got %d", n)
+	}
+	for i, result := range results {
+		if result == nil {
+			t.Errorf("Expected request %d to get the shared result", i)
+		}
+	}
+}
+
+func TestSubscriptionGroups(t *testing.T) {
+	received := make(chan EventNotification, 8)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n EventNotification
+		if err := json.NewDecoder(r.Body).Decode(&n); err == nil {
+			received <- n
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	ctx := &nwdafContext.NWDAFContext{
+		Subscriptions: make(map[string]*nwdafContext.AnalyticsSubscription),
+		DataStore:     nwdafContext.NewDataStore(),
+	}
+	engine := NewAnalyticsEngine(ctx)
+	now := time.Unix(1700003600, 0)
+	engine.SetClock(clock.NewVirtual(now, 1))
+	ctx.UpdateNFStatistics("amf-1", &nwdafContext.NFStatistics{NFInstanceId: "amf-1", NFType: "AMF", Load: 0.5, Timestamp: now.Unix() - 60})
+
+	// Three subscriptions share a filter written differently, a fourth differs
+	filters := []map[string]interface{}{
+		{"nfType": "AMF"},
+		{"nfTypes": []interface{}{"AMF"}},
+		{"nfTypes": []interface{}{"AMF"}},
+		{"nfTypes": []interface{}{"SMF"}},
+	}
+	for i, filter := range filters {
+		ctx.AddSubscription(&nwdafContext.AnalyticsSubscription{
+			SubscriptionId:  string(rune('a' + i)),
+			EventType:       "NF_LOAD",
+			AnalyticsFilter: filter,
+			NotificationUri: server.URL,
+		})
+	}
+
+	engine.processSubscriptions()
+	if engine.cache.lookups != 2 {
+		t.Errorf("Expected one computation per group, got %d lookups", engine.cache.lookups)
+	}
+
+	notified := make(map[string]bool)
+	for len(notified) < len(filters) {
+		select {
+		case n := <-received:
+			notified[n.SubscriptionId] = true
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Expected every subscription to be notified, got %v", notified)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package analytics
+
+import (
+	"math"
+	"sort"
+
+	nwdafContext "github.com/free5gc/nwdaf/pkg/context"
+	"github.com/free5gc/nwdaf/pkg/factory"
+)
+
+// Congestion types (TS 29.520 CongestionType)
+const (
+	CongestionUserPlane    = "USER_PLANE"
+	CongestionControlPlane = "CONTROL_PLANE"
+)
+
+// MetricSignallingRate is the signalling load (messages/sec) AMFs and SMFs
+// report in NFStatistics.Metrics
+const MetricSignallingRate = "signallingRate"
+
+// UserDataCongestionInfo is the congestion of one plane in one TAI, cell or
+// area of interest (TS 23.288 §6.8). Utilization is the traffic relative to
+// the configured capacity, in percent; the congestion level classifies the
+// peak utilization.
+type UserDataCongestionInfo struct {
+	Tai                string   `json:"tai,omitempty"`
+	AreaOfInterest     string   `json:"areaOfInterest,omitempty"`
+	Tais               []string `json:"tais,omitempty"`
+	CongType           string   `json:"congType"`
+	AverageRate        float64  `json:"averageRate"`
+	PeakRate           float64  `json:"peakRate"`
+	Capacity           float64  `json:"capacity"`
+	AverageUtilization int      `json:"averageUtilization"`
+	PeakUtilization    int      `json:"peakUtilization"`
+	CongestionLevel    string   `json:"congestionLevel"`
+	Confidence         int      `json:"confidence,omitempty"`
+}
+
+// bucketSum averages each source's points per bucket of step seconds, then
+// sums the sources per bucket
+func bucketSum(sources map[string][]Point, step int64) []Point {
+	totals := make(map[int64]float64)
+	for _, points := range sources {
+		sums := make(map[int64]float64)
+		counts := make(map[int64]int)
+		for _, p := range points {
+			b := p.Ts / step * step
+			sums[b] += p.Value
+			counts[b]++
+		}
+		for b, sum := range sums {
+			totals[b] += sum / float64(counts[b])
+		}
+	}
+
+	result := make([]Point, 0, len(totals))
+	for b, v := range totals {
+		result = append(result, Point{b, v})
+	}
+	sortPoints(result)
+	return result
+}
+
+type congestionKey struct {
+	area, congType string
+}
+
+// congestionSeries builds, per area and plane, the total traffic per bucket.
+// UPF rates (rx + tx) make up the user plane and AMF/SMF signalling rates the
+// control plane. A UPF or NF serving several areas is split evenly over them.
+// The filter's NF types and instances select the UPFs, AMFs and SMFs counted.
+func (e *AnalyticsEngine) congestionSeries(src nwdafContext.HistorySource, f *EventFilter, scope areaScope, startTs, endTs, step int64) map[congestionKey][]Point {
+	sources := make(map[congestionKey]map[string][]Point)
+	add := func(area, congType, source string, p Point) {
+		key := congestionKey{area, congType}
+		if sources[key] == nil {
+			sources[key] = make(map[string][]Point)
+		}
+		sources[key][source] = append(sources[key][source], p)
+	}
+
+	for upfId, samples := range src.GetUPFStatisticsInWindow(startTs, endTs) {
+		if !matchesAny(f.NfTypes, "UPF") || !matchesAny(f.NfInstanceIds, upfId) {
+			continue
+		}
+		for _, s := range samples {
+			if len(s.Tais) == 0 {
+				continue
+			}
+			share := (s.RxRate + s.TxRate) / float64(len(s.Tais))
+			for _, tai := range s.Tais {
+				for _, area := range scope.groups(tai) {
+					// Keep the TAIs apart so an area sums them rather than averaging
+					add(area, CongestionUserPlane, upfId+"/"+tai, Point{s.Timestamp, share})
+				}
+			}
+		}
+	}
+
+	for nfId, samples := range src.GetNFStatisticsInWindow(startTs, endTs) {
+		for _, s := range samples {
+			rate, ok := s.Metrics[MetricSignallingRate]
+			if !ok || len(s.Tais) == 0 || (s.NFType != "AMF" && s.NFType != "SMF") || !f.matchesNF(nfId, s) {
+				continue
+			}
+			share := rate / float64(len(s.Tais))
+			for _, tai := range s.Tais {
+				for _, area := range scope.groups(tai) {
+					add(area, CongestionControlPlane, nfId+"/"+tai, Point{s.Timestamp, share})
+				}
+			}
+		}
+	}
+
+	result := make(map[congestionKey][]Point, len(sources))
+	for key, bySource := range sources {
+		result[key] = bucketSum(bySource, step)
+	}
+	return result
+}
+
+// congestionCapacity returns the capacity of an area; areas of interest add
+// up the capacity of their TAIs
+func congestionCapacity(scope areaScope, area, congType string) float64 {
+	config := factory.NwdafConfig.Configuration
+	capacity := config.GetUserPlaneCapacity
+	if congType == CongestionControlPlane {
+		capacity = config.GetControlPlaneCapacity
+	}
+	if scope.areas == nil {
+		return capacity(area)
+	}
+	var total float64
+	for _, tai := range scope.areas[area] {
+		total += capacity(tai)
+	}
+	return total
+}
+
+func newCongestionInfo(scope areaScope, key congestionKey, average, peak float64) *UserDataCongestionInfo {
+	area := scope.newInfo(key.area)
+	info := &UserDataCongestionInfo{
+		Tai:            area.Tai,
+		AreaOfInterest: area.AreaOfInterest,
+		Tais:           area.Tais,
+		CongType:       key.congType,
+		AverageRate:    average,
+		PeakRate:       peak,
+		Capacity:       congestionCapacity(scope, key.area, key.congType),
+	}
+	if info.Capacity > 0 {
+		info.AverageUtilization = int(math.Round(average / info.Capacity * 100))
+		info.PeakUtilization = int(math.Round(peak / info.Capacity * 100))
+		info.CongestionLevel = classifyLoad(peak/info.Capacity, factory.NwdafConfig.Configuration.GetCongestionThresholds())
+	}
+	return info
+}
+
+func sortCongestionInfos(infos []*UserDataCongestionInfo) {
+	sort.Slice(infos, func(i, j int) bool {
+		a, b := infos[i].AreaOfInterest+infos[i].Tai, infos[j].AreaOfInterest+infos[j].Tai
+		if a != b {
+			return a < b
+		}
+		return infos[i].CongType < infos[j].CongType
+	})
+}
+
+// computeUserDataCongestion reports, per area and plane, the traffic over
+// [startTs, endTs] against capacity. Results can be narrowed by TAI, area of
+// interest, congestion type and NF.
+func (e *AnalyticsEngine) computeUserDataCongestion(src nwdafContext.HistorySource, f *EventFilter, startTs, endTs int64) []*UserDataCongestionInfo {
+	step := int64(factory.NwdafConfig.Configuration.GetForecast().Step)
+	scope := newAreaScope(f)
+
+	var infos []*UserDataCongestionInfo
+	for key, series := range e.congestionSeries(src, f, scope, startTs, endTs, step) {
+		if !matchesAny(f.CongTypes, key.congType) {
+			continue
+		}
+		var sum, peak float64
+		for _, p := range series {
+			sum += p.Value
+			peak = math.Max(peak, p.Value)
+		}
+		infos = append(infos, newCongestionInfo(scope, key, sum/float64(len(series)), peak))
+	}
+	sortCongestionInfos(infos)
+	return infos
+}
+
+// predictUserDataCongestion forecasts, per area and plane, the traffic over
+// the future window [startTs, endTs] from the training history
+func (e *AnalyticsEngine) predictUserDataCongestion(f *EventFilter, startTs, endTs int64) []*UserDataCongestionInfo {
+	forecast := factory.NwdafConfig.Configuration.GetForecast()
+	params := forecastParams(forecast)
+	step := int64(forecast.Step)
+	scope := newAreaScope(f)
+
+	now := e.clock.Now().Unix()
+	var infos []*UserDataCongestionInfo
+	for key, series := range e.congestionSeries(e.context, f, scope, now-int64(forecast.History), now, step) {
+		if !matchesAny(f.CongTypes, key.congType) {
+			continue
+		}
+		result, ok := forecastWindow(series, forecast.DefaultModel, step, startTs, endTs, params)
+		if !ok {
+			continue
+		}
+		info := newCongestionInfo(scope, key, math.Max(0, result.Average), math.Max(0, result.Peak))
+		info.Confidence = result.Confidence
+		infos = append(infos, info)
+	}
+	sortCongestionInfos(infos)
+	return infos
+}
@@ -0,0 +1,54 @@
+package analytics
+
+import (
+	"testing"
+
+	nwdafContext "github.com/free5gc/nwdaf/pkg/context"
+	"github.com/free5gc/nwdaf/pkg/factory"
+)
+
+func TestUserDataCongestion(t *testing.T) {
+	factory.NwdafConfig.Configuration.UserDataCongestion = &factory.UserDataCongestionConfig{
+		UserPlaneCapacity:           map[string]float64{"tai-1": 1000, "tai-2": 1000},
+		DefaultControlPlaneCapacity: 100,
+	}
+	defer func() { factory.NwdafConfig.Configuration.UserDataCongestion = nil }()
+
+	ctx := &nwdafContext.NWDAFContext{DataStore: nwdafContext.NewDataStore()}
+	engine := NewAnalyticsEngine(ctx)
+
+	// upf-1 serves both TAIs and carries 1800 B/s; upf-2 adds 500 B/s in tai-2
+	ctx.UpdateUPFStatistics("upf-1", &nwdafContext.UPFStatistics{UPFId: "upf-1", Tais: []string{"tai-1", "tai-2"}, RxRate: 1000, TxRate: 800, Timestamp: 1000})
+	ctx.UpdateUPFStatistics("upf-2", &nwdafContext.UPFStatistics{UPFId: "upf-2", Tais: []string{"tai-2"}, RxRate: 500, Timestamp: 1000})
+	ctx.UpdateNFStatistics("amf-1", &nwdafContext.NFStatistics{
+		NFInstanceId: "amf-1",
+		NFType:       "AMF",
+		Tais:         []string{"tai-1"},
+		Metrics:      map[string]float64{MetricSignallingRate: 40},
+		Timestamp:    1000,
+	})
+
+	infos := engine.computeUserDataCongestion(engine.context, &EventFilter{}, 900, 1100)
+	if len(infos) != 3 {
+		t.Fatalf("Expected control and user plane for tai-1 and user plane for tai-2, got %d entries", len(infos))
+	}
+
+	levels := map[string]*UserDataCongestionInfo{}
+	for _, info := range infos {
+		levels[info.Tai+"/"+info.CongType] = info
+	}
+	if info := levels["tai-1/"+CongestionUserPlane]; info.PeakUtilization != 90 || info.CongestionLevel != LoadLevelHigh {
+		t.Errorf("Expected tai-1 user plane at 90%% (HIGH), got %+v", info)
+	}
+	if info := levels["tai-2/"+CongestionUserPlane]; info.PeakUtilization != 140 || info.CongestionLevel != LoadLevelOverload {
+		t.Errorf("Expected tai-2 user plane at 140%% (OVERLOAD), got %+v", info)
+	}
+	if info := levels["tai-1/"+CongestionControlPlane]; info.PeakUtilization != 40 || info.CongestionLevel != LoadLevelNormal {
+		t.Errorf("Expected tai-1 control plane at 40%% (NORMAL), got %+v", info)
+	}
+
+	controlPlane := engine.computeUserDataCongestion(engine.context, mustParseFilter(t, map[string]interface{}{"congTypes": CongestionControlPlane}), 900, 1100)
+	if len(controlPlane) != 1 {
+		t.Errorf("Expected only the control plane entry, got %d", len(controlPlane))
+	}
+}
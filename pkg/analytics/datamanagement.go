@@ -0,0 +1,381 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/free5gc/nwdaf/internal/logger"
+	nwdafContext "github.com/free5gc/nwdaf/pkg/context"
+	"github.com/free5gc/nwdaf/pkg/factory"
+)
+
+// DataManagementPath is the API root path of Nnwdaf_DataManagement
+const DataManagementPath = "/nnwdaf-datamanagement/v1"
+
+// Data types served by Nnwdaf_DataManagement
+const (
+	// DataNfStatistics is the load reported by each NF instance
+	DataNfStatistics = "NF_STATISTICS"
+	// DataUeEvents is the location and QoS reported for each UE
+	DataUeEvents = "UE_EVENTS"
+	// DataUpfUsage is the user plane traffic observed on each UPF
+	DataUpfUsage = "UPF_USAGE"
+)
+
+// DataTypes lists the data types served
+var DataTypes = []string{DataNfStatistics, DataUeEvents, DataUpfUsage}
+
+// dataFilters are the filter keys data requests accept
+var dataFilters = []string{
+	FilterNfTypes, FilterNfInstanceIds, FilterSnssais, FilterTais, FilterAreasOfInterest,
+	FilterSupis, FilterIntGroupIds, FilterDnns, FilterAppIds,
+}
+
+const (
+	// defaultDataReportingPeriod is the time (seconds) between the
+	// notifications of a subscription without a reporting period
+	defaultDataReportingPeriod = 60
+	// dataNotificationTick is how often subscriptions are checked for a due
+	// notification
+	dataNotificationTick = time.Second
+	// dataNotifyWorkers is how many data notifications are sent at once
+	dataNotifyWorkers = 4
+)
+
+// ErrInvalidDataRequest is returned for data requests and subscriptions
+// that do not validate
+var ErrInvalidDataRequest = errors.New("invalid data request")
+
+// DataRequest fetches the data collected over a window (TS 29.574
+// Nnwdaf_DataManagement_Fetch). Without a window the analytics window ending
+// now is used.
+type DataRequest struct {
+	DataTypes  []string               `json:"dataTypes" binding:"required"`
+	DataFilter map[string]interface{} `json:"dataFilter,omitempty"`
+	StartTs    int64                  `json:"startTs,omitempty"`
+	EndTs      int64                  `json:"endTs,omitempty"`
+}
+
+// CollectedData is the data of the requested types, each list in timestamp
+// order
+type CollectedData struct {
+	StartTs      int64                         `json:"startTs"`
+	EndTs        int64                         `json:"endTs"`
+	NfStatistics []*nwdafContext.NFStatistics  `json:"nfStatistics,omitempty"`
+	UeEvents     []*nwdafContext.UEStatistics  `json:"ueEvents,omitempty"`
+	UpfUsage     []*nwdafContext.UPFStatistics `json:"upfUsage,omitempty"`
+}
+
+// empty reports whether no sample was collected
+func (d *CollectedData) empty() bool {
+	return len(d.NfStatistics) == 0 && len(d.UeEvents) == 0 && len(d.UpfUsage) == 0
+}
+
+// span narrows the window to the timestamps of the samples collected
+func (d *CollectedData) span() {
+	d.StartTs, d.EndTs = 0, 0
+	extend := func(first, last int64) {
+		if d.StartTs == 0 || first < d.StartTs {
+			d.StartTs = first
+		}
+		d.EndTs = max(d.EndTs, last)
+	}
+	if n := len(d.NfStatistics); n > 0 {
+		extend(d.NfStatistics[0].Timestamp, d.NfStatistics[n-1].Timestamp)
+	}
+	if n := len(d.UeEvents); n > 0 {
+		extend(d.UeEvents[0].Timestamp, d.UeEvents[n-1].Timestamp)
+	}
+	if n := len(d.UpfUsage); n > 0 {
+		extend(d.UpfUsage[0].Timestamp, d.UpfUsage[n-1].Timestamp)
+	}
+}
+
+// DataNotification is POSTed to the consumer of a data subscription (TS
+// 29.574 NnwdafDataManagementNotif)
+type DataNotification struct {
+	SubscriptionId string         `json:"subscriptionId"`
+	Timestamp      int64          `json:"timestamp"`
+	Data           *CollectedData `json:"data"`
+}
+
+// ValidateDataRequest checks the data types and filter of a data request or
+// subscription
+func ValidateDataRequest(dataTypes []string, filter map[string]interface{}) error {
+	if len(dataTypes) == 0 {
+		return fmt.Errorf("%w: no dataTypes", ErrInvalidDataRequest)
+	}
+	for _, t := range dataTypes {
+		if !matchesAny(DataTypes, t) {
+			return fmt.Errorf("%w: unknown data type %q, expected one of %s", ErrInvalidDataRequest, t, strings.Join(DataTypes, ", "))
+		}
+	}
+	f, err := ParseFilter(filter)
+	if err != nil {
+		return err
+	}
+	for _, key := range f.keys {
+		if !matchesAny(dataFilters, key) {
+			return fmt.Errorf("%w: data requests do not support %q", ErrInvalidFilter, key)
+		}
+	}
+	return nil
+}
+
+// dataScope selects the samples of a data filter
+type dataScope struct {
+	filter *EventFilter
+	ues    ueScope
+	// tais are the TAIs of the filter and of its areas of interest
+	tais []string
+}
+
+func newDataScope(f *EventFilter) *dataScope {
+	scope := &dataScope{filter: f, ues: newUEScope(f), tais: append([]string(nil), f.Tais...)}
+	for _, name := range f.AreasOfInterest {
+		area, _ := factory.NwdafConfig.Configuration.GetAreaOfInterest(name)
+		scope.tais = append(scope.tais, area...)
+		// An unknown area must not widen the scope to every TAI
+		if len(area) == 0 {
+			scope.tais = append(scope.tais, "")
+		}
+	}
+	return scope
+}
+
+func (s *dataScope) matchesNF(nfId string, stats *nwdafContext.NFStatistics) bool {
+	f := s.filter
+	return matchesAny(f.NfTypes, stats.NFType) && matchesAny(f.NfInstanceIds, nfId) &&
+		intersects(f.Snssais, stats.Snssais) && intersects(s.tais, stats.Tais)
+}
+
+func (s *dataScope) matchesUE(supi string, stats *nwdafContext.UEStatistics) bool {
+	return s.ues.matches(supi) && s.filter.matchesFlow(stats) && matchesAny(s.tais, stats.Location)
+}
+
+// matchesUPF selects UPFs by instance ID and served TAIs
+func (s *dataScope) matchesUPF(upfId string, stats *nwdafContext.UPFStatistics) bool {
+	f := s.filter
+	return matchesAny(f.NfTypes, "UPF") && matchesAny(f.NfInstanceIds, upfId) && intersects(s.tais, stats.Tais)
+}
+
+// FetchData returns the data of some types collected within [startTs, endTs]
+// that the filter selects. Windows starting before the local retention are
+// completed from the ADRF.
+func (e *AnalyticsEngine) FetchData(ctx context.Context, req *DataRequest) (*CollectedData, error) {
+	if err := ValidateDataRequest(req.DataTypes, req.DataFilter); err != nil {
+		return nil, err
+	}
+	f, _ := ParseFilter(req.DataFilter)
+	startTs, endTs := e.resolveWindow(req.StartTs, req.EndTs, factory.NwdafConfig.Configuration.GetAnalyticsWindow())
+	return e.collectData(e.historySource(ctx, startTs, endTs), req.DataTypes, newDataScope(f), startTs, endTs), nil
+}
+
+// collectData gathers the samples of some types within [startTs, endTs]
+func (e *AnalyticsEngine) collectData(src nwdafContext.HistorySource, dataTypes []string, scope *dataScope, startTs, endTs int64) *CollectedData {
+	data := &CollectedData{StartTs: startTs, EndTs: endTs}
+	if matchesAny(dataTypes, DataNfStatistics) {
+		for nfId, samples := range src.GetNFStatisticsInWindow(startTs, endTs) {
+			for _, s := range samples {
+				if scope.matchesNF(nfId, s) {
+					data.NfStatistics = append(data.NfStatistics, s)
+				}
+			}
+		}
+		sort.SliceStable(data.NfStatistics, func(i, j int) bool {
+			a, b := data.NfStatistics[i], data.NfStatistics[j]
+			return a.Timestamp < b.Timestamp || (a.Timestamp == b.Timestamp && a.NFInstanceId < b.NFInstanceId)
+		})
+	}
+	if matchesAny(dataTypes, DataUeEvents) {
+		for supi, samples := range src.GetUEStatisticsInWindow(startTs, endTs) {
+			for _, s := range samples {
+				if scope.matchesUE(supi, s) {
+					data.UeEvents = append(data.UeEvents, s)
+				}
+			}
+		}
+		sort.SliceStable(data.UeEvents, func(i, j int) bool {
+			a, b := data.UeEvents[i], data.UeEvents[j]
+			return a.Timestamp < b.Timestamp || (a.Timestamp == b.Timestamp && a.SUPI < b.SUPI)
+		})
+	}
+	if matchesAny(dataTypes, DataUpfUsage) {
+		for upfId, samples := range src.GetUPFStatisticsInWindow(startTs, endTs) {
+			for _, s := range samples {
+				if scope.matchesUPF(upfId, s) {
+					data.UpfUsage = append(data.UpfUsage, s)
+				}
+			}
+		}
+		sort.SliceStable(data.UpfUsage, func(i, j int) bool {
+			a, b := data.UpfUsage[i], data.UpfUsage[j]
+			return a.Timestamp < b.Timestamp || (a.Timestamp == b.Timestamp && a.UPFId < b.UPFId)
+		})
+	}
+	return data
+}
+
+// NewDataSubscription checks a data subscription and fills in its defaults:
+// the data window starts when the subscription is made unless given
+func (e *AnalyticsEngine) NewDataSubscription(sub *nwdafContext.DataSubscription) error {
+	if sub.NotificationUri == "" {
+		return fmt.Errorf("%w: no notificationUri", ErrInvalidDataRequest)
+	}
+	if err := ValidateDataRequest(sub.DataTypes, sub.DataFilter); err != nil {
+		return err
+	}
+	if sub.ReportingPeriod < 0 || (sub.EndTs != 0 && sub.EndTs < sub.StartTs) {
+		return fmt.Errorf("%w: invalid reporting period or window", ErrInvalidDataRequest)
+	}
+	if sub.ReportingPeriod == 0 {
+		sub.ReportingPeriod = defaultDataReportingPeriod
+	}
+	if sub.StartTs == 0 {
+		sub.StartTs = e.clock.Now().Unix()
+	}
+	return nil
+}
+
+// dataCursor is how far a data subscription was notified
+type dataCursor struct {
+	// seq is the sequence number of the last sample notified; samples are
+	// followed in the order they were stored, so late ones are not missed
+	seq uint64
+	// notified is set once the data collected before the subscription,
+	// possibly at the ADRF, was delivered
+	notified bool
+	// attemptedAt is the time of the last notification attempt
+	attemptedAt int64
+}
+
+// dataSubState tracks the notifications of the data subscriptions
+type dataSubState struct {
+	mu      sync.Mutex
+	cursors map[string]*dataCursor
+}
+
+func newDataSubState() *dataSubState {
+	return &dataSubState{cursors: make(map[string]*dataCursor)}
+}
+
+// dataJob is a notification due for a subscription, taken from its cursor
+type dataJob struct {
+	sub      *nwdafContext.DataSubscription
+	seq      uint64
+	notified bool
+}
+
+// StartDataNotifications notifies the data subscriptions as their reporting
+// period elapses
+func (e *AnalyticsEngine) StartDataNotifications(ctx context.Context) {
+	ticker := e.clock.NewTicker(dataNotificationTick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			e.notifyDataSubscriptions()
+		}
+	}
+}
+
+// notifyDataSubscriptions sends each due subscription the data stored since
+// its last notification, on a bounded pool of workers. Failed notifications
+// are retried with the same data on the next period; empty ones are not
+// sent. Subscriptions whose window has ended are removed once notified.
+func (e *AnalyticsEngine) notifyDataSubscriptions() {
+	now := e.clock.Now().Unix()
+	subs := e.context.GetDataSubscriptions()
+
+	// Take the due notifications under the lock, send them outside it
+	var due []*dataJob
+	e.dataSubs.mu.Lock()
+	active := make(map[string]bool, len(subs))
+	for _, sub := range subs {
+		active[sub.SubscriptionId] = true
+		cursor, ok := e.dataSubs.cursors[sub.SubscriptionId]
+		if !ok {
+			cursor = &dataCursor{}
+			e.dataSubs.cursors[sub.SubscriptionId] = cursor
+		}
+		if now-cursor.attemptedAt < int64(sub.ReportingPeriod) {
+			continue
+		}
+		cursor.attemptedAt = now
+		due = append(due, &dataJob{sub: sub, seq: cursor.seq, notified: cursor.notified})
+	}
+	for id := range e.dataSubs.cursors {
+		if !active[id] {
+			delete(e.dataSubs.cursors, id)
+		}
+	}
+	e.dataSubs.mu.Unlock()
+
+	jobs := make(chan *dataJob)
+	var wg sync.WaitGroup
+	for i := 0; i < min(dataNotifyWorkers, len(due)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				e.notifyData(job, now)
+			}
+		}()
+	}
+	for _, job := range due {
+		jobs <- job
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// notifyData sends a subscription the data in its window stored since its
+// cursor and advances the cursor once delivered
+func (e *AnalyticsEngine) notifyData(job *dataJob, now int64) {
+	sub := job.sub
+	f, err := ParseFilter(sub.DataFilter)
+	if err != nil {
+		return
+	}
+	history, seq := e.context.ExportHistorySince(job.seq)
+	var src nwdafContext.HistorySource = history
+	if !job.notified {
+		// The first notification also delivers what the local history no
+		// longer holds
+		if archived := e.archivedHistory(context.Background(), sub.StartTs, sub.EndTs); archived != nil {
+			src = nwdafContext.WithArchive(history, archived)
+		}
+	}
+	data := e.collectData(src, sub.DataTypes, newDataScope(f), sub.StartTs, sub.EndTs)
+	if !data.empty() {
+		data.span()
+		notification := &DataNotification{SubscriptionId: sub.SubscriptionId, Timestamp: now, Data: data}
+		if err := e.postJSON(sub.NotificationUri, notification, nil); err != nil {
+			logger.AnalyticsLog.Warnf("Data notification for subscription %s failed: %v", sub.SubscriptionId, err)
+			return
+		}
+	}
+
+	complete := sub.EndTs != 0 && now > sub.EndTs
+	e.dataSubs.mu.Lock()
+	if cursor, ok := e.dataSubs.cursors[sub.SubscriptionId]; ok {
+		cursor.seq = max(cursor.seq, seq)
+		cursor.notified = true
+		if complete {
+			delete(e.dataSubs.cursors, sub.SubscriptionId)
+		}
+	}
+	e.dataSubs.mu.Unlock()
+	if complete {
+		e.context.RemoveDataSubscription(sub.SubscriptionId)
+		logger.AnalyticsLog.Infof("Data subscription %s ended at %d", sub.SubscriptionId, sub.EndTs)
+	}
+}
@@ -0,0 +1,165 @@
+package analytics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/free5gc/nwdaf/pkg/clock"
+	nwdafContext "github.com/free5gc/nwdaf/pkg/context"
+)
+
+// newDataEngine returns an engine holding NF, UE and UPF samples at now-100
+// and now-50 in tai-1 and tai-2
+func newDataEngine(now int64) (*AnalyticsEngine, *clock.Virtual) {
+	c := clock.NewVirtual(time.Unix(now, 0), 1)
+	engine := NewAnalyticsEngine(&nwdafContext.NWDAFContext{NfId: "nwdaf-1", DataStore: nwdafContext.NewDataStore()})
+	engine.SetClock(c)
+	for _, ts := range []int64{now - 100, now - 50} {
+		engine.context.UpdateNFStatistics("amf-1", &nwdafContext.NFStatistics{NFInstanceId: "amf-1", NFType: "AMF", Tais: []string{"tai-1"}, Load: 0.4, Timestamp: ts})
+		engine.context.UpdateNFStatistics("smf-1", &nwdafContext.NFStatistics{NFInstanceId: "smf-1", NFType: "SMF", Tais: []string{"tai-2"}, Load: 0.2, Timestamp: ts})
+		engine.context.UpdateUEStatistics("imsi-1", &nwdafContext.UEStatistics{SUPI: "imsi-1", Location: "tai-1", Timestamp: ts})
+		engine.context.UpdateUEStatistics("imsi-2", &nwdafContext.UEStatistics{SUPI: "imsi-2", Location: "tai-2", Timestamp: ts})
+		engine.context.UpdateUPFStatistics("upf-1", &nwdafContext.UPFStatistics{UPFId: "upf-1", Tais: []string{"tai-1"}, RxRate: 100, Timestamp: ts})
+	}
+	return engine, c
+}
+
+func TestFetchData(t *testing.T) {
+	const now = int64(1700000000)
+	engine, _ := newDataEngine(now)
+
+	data, err := engine.FetchData(context.Background(), &DataRequest{
+		DataTypes:  DataTypes,
+		DataFilter: map[string]interface{}{"tais": []interface{}{"tai-1"}},
+		StartTs:    now - 200,
+		EndTs:      now,
+	})
+	if err != nil {
+		t.Fatalf("FetchData() error = %v", err)
+	}
+	if len(data.NfStatistics) != 2 || data.NfStatistics[0].NFInstanceId != "amf-1" {
+		t.Errorf("Expected the 2 samples of amf-1, got %+v", data.NfStatistics)
+	}
+	if len(data.UeEvents) != 2 || data.UeEvents[1].SUPI != "imsi-1" {
+		t.Errorf("Expected the 2 events of imsi-1, got %+v", data.UeEvents)
+	}
+	if len(data.UpfUsage) != 2 {
+		t.Errorf("Expected the 2 samples of upf-1, got %+v", data.UpfUsage)
+	}
+
+	// The window and the data types narrow the data
+	data, _ = engine.FetchData(context.Background(), &DataRequest{DataTypes: []string{DataUeEvents}, DataFilter: map[string]interface{}{"supi": "imsi-2"}, StartTs: now - 60, EndTs: now})
+	if len(data.UeEvents) != 1 || data.UeEvents[0].SUPI != "imsi-2" || len(data.NfStatistics) != 0 {
+		t.Errorf("Expected the last event of imsi-2 alone, got %+v", data)
+	}
+	data, _ = engine.FetchData(context.Background(), &DataRequest{DataTypes: []string{DataNfStatistics, DataUpfUsage}, DataFilter: map[string]interface{}{"nfTypes": "SMF"}})
+	if len(data.NfStatistics) != 2 || len(data.UpfUsage) != 0 {
+		t.Errorf("Expected the SMF samples alone, got %+v", data)
+	}
+
+	if _, err := engine.FetchData(context.Background(), &DataRequest{DataTypes: []string{"SESSIONS"}}); !errors.Is(err, ErrInvalidDataRequest) {
+		t.Errorf("Expected ErrInvalidDataRequest for an unknown data type, got %v", err)
+	}
+	if _, err := engine.FetchData(context.Background(), &DataRequest{DataTypes: DataTypes, DataFilter: map[string]interface{}{"excepIds": "X"}}); !errors.Is(err, ErrInvalidFilter) {
+		t.Errorf("Expected ErrInvalidFilter for an unsupported key, got %v", err)
+	}
+}
+
+func TestDataNotifications(t *testing.T) {
+	var mu sync.Mutex
+	var notifications []*DataNotification
+	failing := false
+	consumer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var n DataNotification
+		_ = json.NewDecoder(r.Body).Decode(&n)
+		mu.Lock()
+		notifications = append(notifications, &n)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer consumer.Close()
+
+	const now = int64(1700000000)
+	engine, c := newDataEngine(now)
+	sub := &nwdafContext.DataSubscription{
+		SubscriptionId:  "data-1",
+		NotificationUri: consumer.URL,
+		DataTypes:       []string{DataUeEvents},
+		DataFilter:      map[string]interface{}{"supis": "imsi-1"},
+		ReportingPeriod: 30,
+		StartTs:         now - 60,
+	}
+	if err := engine.NewDataSubscription(sub); err != nil {
+		t.Fatalf("NewDataSubscription() error = %v", err)
+	}
+	engine.context.AddDataSubscription(sub)
+
+	// The first notification delivers the data collected since the start
+	engine.notifyDataSubscriptions()
+	if len(notifications) != 1 || len(notifications[0].Data.UeEvents) != 1 || notifications[0].Data.UeEvents[0].Timestamp != now-50 {
+		t.Fatalf("Expected the event at now-50, got %+v", notifications)
+	}
+
+	// Nothing is sent before the reporting period elapses
+	engine.context.UpdateUEStatistics("imsi-1", &nwdafContext.UEStatistics{SUPI: "imsi-1", Location: "tai-2", Timestamp: now + 10})
+	engine.notifyDataSubscriptions()
+	if len(notifications) != 1 {
+		t.Fatalf("Expected no notification within the period, got %d", len(notifications))
+	}
+
+	// A failed notification is sent again on the next period
+	c.Advance(30 * time.Second)
+	failing = true
+	engine.notifyDataSubscriptions()
+	failing = false
+	c.Advance(30 * time.Second)
+	engine.notifyDataSubscriptions()
+	if len(notifications) != 2 || len(notifications[1].Data.UeEvents) != 1 || notifications[1].Data.UeEvents[0].Location != "tai-2" {
+		t.Errorf("Expected the new event delivered once, got %+v", notifications[1:])
+	}
+
+	// Samples stored late are delivered whatever their timestamp
+	engine.context.UpdateUEStatistics("imsi-1", &nwdafContext.UEStatistics{SUPI: "imsi-1", Location: "tai-3", Timestamp: now - 40})
+	c.Advance(30 * time.Second)
+	engine.notifyDataSubscriptions()
+	if len(notifications) != 3 || len(notifications[2].Data.UeEvents) != 1 || notifications[2].Data.StartTs != now-40 {
+		t.Fatalf("Expected the late event at now-40 delivered, got %+v", notifications[2:])
+	}
+
+	// A subscription is removed once its window has been notified
+	ended := &nwdafContext.DataSubscription{
+		SubscriptionId:  "data-2",
+		NotificationUri: consumer.URL,
+		DataTypes:       []string{DataNfStatistics},
+		ReportingPeriod: 30,
+		StartTs:         now - 200,
+		EndTs:           now - 60,
+	}
+	if err := engine.NewDataSubscription(ended); err != nil {
+		t.Fatalf("NewDataSubscription() error = %v", err)
+	}
+	engine.context.AddDataSubscription(ended)
+	engine.notifyDataSubscriptions()
+	if len(notifications) != 4 || len(notifications[3].Data.NfStatistics) != 2 || notifications[3].Data.EndTs != now-100 {
+		t.Fatalf("Expected the 2 NF samples at now-100, got %+v", notifications[3:])
+	}
+	if _, ok := engine.context.GetDataSubscription("data-2"); ok {
+		t.Error("Expected the ended subscription to be removed")
+	}
+
+	engine.context.RemoveDataSubscription("data-1")
+	engine.notifyDataSubscriptions()
+	if len(engine.dataSubs.cursors) != 0 {
+		t.Error("Expected the state of a deleted subscription to be dropped")
+	}
+}
@@ -0,0 +1,311 @@
+package analytics
+
+import (
+	"math"
+	"sort"
+
+	nwdafContext "github.com/free5gc/nwdaf/pkg/context"
+	"github.com/free5gc/nwdaf/pkg/factory"
+)
+
+// PerfData is the user plane performance towards an application server
+// (TS 29.520 PerfData). Traffic rates are in bytes/sec, packet delays in ms
+// and the packet loss rate is a ratio.
+type PerfData struct {
+	AvgTrafficRate    float64 `json:"avgTrafficRate"`
+	MaxTrafficRate    float64 `json:"maxTrafficRate"`
+	AvgPacketDelay    float64 `json:"avgPacketDelay"`
+	MaxPacketDelay    float64 `json:"maxPacketDelay"`
+	AvgPacketLossRate float64 `json:"avgPacketLossRate"`
+}
+
+// UpfInformation is an anchor UPF and its load (percent), omitted when the
+// UPF reported no NF statistics
+type UpfInformation struct {
+	UpfId            string `json:"upfId"`
+	LoadLevelAverage *int   `json:"loadLevelAverage,omitempty"`
+	LoadLevelPeak    *int   `json:"loadLevelPeak,omitempty"`
+}
+
+// DnPerformance is the performance of one application server reached
+// through one DNAI (TS 23.288 §6.14)
+type DnPerformance struct {
+	Dnai             string          `json:"dnai"`
+	AppServerInsAddr string          `json:"appServerInsAddr"`
+	AppId            string          `json:"appId,omitempty"`
+	UpfInfo          *UpfInformation `json:"upfInfo,omitempty"`
+	PerfData         PerfData        `json:"perfData"`
+	Samples          int             `json:"samples"`
+	Confidence       int             `json:"confidence,omitempty"`
+}
+
+// DnaiPerformance summarises a DNAI over its application servers so edge
+// sites can be compared: traffic rates add up, delay and loss are averaged
+// over every sample.
+type DnaiPerformance struct {
+	Dnai       string            `json:"dnai"`
+	AppServers int               `json:"appServers"`
+	UpfInfos   []*UpfInformation `json:"upfInfos,omitempty"`
+	PerfData   PerfData          `json:"perfData"`
+	Samples    int               `json:"samples"`
+	Confidence int               `json:"confidence,omitempty"`
+}
+
+// dnGroup collects the samples of one DNAI and application server
+type dnGroup struct {
+	dnai, server, appId, upfId string
+	delay, rate, loss          []Point
+}
+
+// dnSeries gathers, per DNAI and application server, the samples over
+// [startTs, endTs] selected by DNAI, application server, application, DNN
+// and anchor UPF, and the load of their anchor UPFs
+func (e *AnalyticsEngine) dnSeries(src nwdafContext.HistorySource, f *EventFilter, startTs, endTs int64) ([]*dnGroup, map[string][]Point) {
+	var groups []*dnGroup
+	anchors := make(map[string]bool)
+	for _, samples := range src.GetDNStatisticsInWindow(startTs, endTs) {
+		first := samples[0]
+		if !matchesAny(f.Dnais, first.Dnai) || !matchesAny(f.AppServerAddrs, first.AppServerAddr) {
+			continue
+		}
+		g := &dnGroup{dnai: first.Dnai, server: first.AppServerAddr}
+		for _, s := range samples {
+			if !matchesAny(f.AppIds, s.AppId) || !matchesAny(f.Dnns, s.Dnn) || !matchesAny(f.NfInstanceIds, s.UPFId) {
+				continue
+			}
+			// The latest sample names the current application and anchor
+			if s.AppId != "" {
+				g.appId = s.AppId
+			}
+			if s.UPFId != "" {
+				g.upfId = s.UPFId
+			}
+			g.delay = append(g.delay, Point{s.Timestamp, s.Latency})
+			g.rate = append(g.rate, Point{s.Timestamp, s.Throughput})
+			g.loss = append(g.loss, Point{s.Timestamp, s.PacketLoss})
+		}
+		if len(g.delay) == 0 {
+			continue
+		}
+		if g.upfId != "" {
+			anchors[g.upfId] = true
+		}
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].dnai != groups[j].dnai {
+			return groups[i].dnai < groups[j].dnai
+		}
+		return groups[i].server < groups[j].server
+	})
+
+	load := make(map[string][]Point)
+	for nfId, samples := range src.GetNFStatisticsInWindow(startTs, endTs) {
+		if !anchors[nfId] {
+			continue
+		}
+		for _, s := range samples {
+			load[nfId] = append(load[nfId], Point{s.Timestamp, s.Load})
+		}
+	}
+	return groups, load
+}
+
+// byDnai splits the groups per DNAI, keeping their order
+func byDnai(groups []*dnGroup) ([]string, map[string][]*dnGroup) {
+	var dnais []string
+	result := make(map[string][]*dnGroup)
+	for _, g := range groups {
+		if _, ok := result[g.dnai]; !ok {
+			dnais = append(dnais, g.dnai)
+		}
+		result[g.dnai] = append(result[g.dnai], g)
+	}
+	return dnais, result
+}
+
+// dnaiSeries merges the samples of a DNAI's servers: delays and losses are
+// pooled, traffic rates summed per bucket
+func dnaiSeries(groups []*dnGroup, step int64) (delay, rate, loss []Point, upfIds []string) {
+	rates := make(map[string][]Point, len(groups))
+	seen := make(map[string]bool)
+	for _, g := range groups {
+		delay = append(delay, g.delay...)
+		loss = append(loss, g.loss...)
+		rates[g.server] = g.rate
+		if g.upfId != "" && !seen[g.upfId] {
+			seen[g.upfId] = true
+			upfIds = append(upfIds, g.upfId)
+		}
+	}
+	sortPoints(delay)
+	sortPoints(loss)
+	sort.Strings(upfIds)
+	return delay, bucketSum(rates, step), loss, upfIds
+}
+
+// observedPerf summarises observed samples
+func observedPerf(delay, rate, loss []Point) PerfData {
+	var perf PerfData
+	perf.AvgPacketDelay, perf.MaxPacketDelay = averageAndPeak(delay)
+	perf.AvgTrafficRate, perf.MaxTrafficRate = averageAndPeak(rate)
+	perf.AvgPacketLossRate, _ = averageAndPeak(loss)
+	return perf
+}
+
+func averageAndPeak(points []Point) (float64, float64) {
+	if len(points) == 0 {
+		return 0, 0
+	}
+	var sum, peak float64
+	for _, p := range points {
+		sum += p.Value
+		peak = math.Max(peak, p.Value)
+	}
+	return sum / float64(len(points)), peak
+}
+
+// observedUpf reports the load of an anchor UPF over the window
+func observedUpf(upfId string, load map[string][]Point) *UpfInformation {
+	info := &UpfInformation{UpfId: upfId}
+	if points := load[upfId]; len(points) > 0 {
+		average, peak := averageAndPeak(points)
+		avgLevel, peakLevel := percent(average), percent(peak)
+		info.LoadLevelAverage, info.LoadLevelPeak = &avgLevel, &peakLevel
+	}
+	return info
+}
+
+// computeDNPerformance reports, over [startTs, endTs], the performance of
+// every application server per DNAI along with per-DNAI summaries and the
+// load of their anchor UPFs
+func (e *AnalyticsEngine) computeDNPerformance(src nwdafContext.HistorySource, f *EventFilter, startTs, endTs int64) ([]*DnPerformance, []*DnaiPerformance) {
+	step := int64(factory.NwdafConfig.Configuration.GetForecast().Step)
+	groups, load := e.dnSeries(src, f, startTs, endTs)
+
+	servers := make([]*DnPerformance, 0, len(groups))
+	for _, g := range groups {
+		info := &DnPerformance{
+			Dnai:             g.dnai,
+			AppServerInsAddr: g.server,
+			AppId:            g.appId,
+			PerfData:         observedPerf(g.delay, g.rate, g.loss),
+			Samples:          len(g.delay),
+		}
+		if g.upfId != "" {
+			info.UpfInfo = observedUpf(g.upfId, load)
+		}
+		servers = append(servers, info)
+	}
+
+	names, perDnai := byDnai(groups)
+	dnais := make([]*DnaiPerformance, 0, len(names))
+	for _, dnai := range names {
+		delay, rate, loss, upfIds := dnaiSeries(perDnai[dnai], step)
+		info := &DnaiPerformance{
+			Dnai:       dnai,
+			AppServers: len(perDnai[dnai]),
+			PerfData:   observedPerf(delay, rate, loss),
+			Samples:    len(delay),
+		}
+		for _, upfId := range upfIds {
+			info.UpfInfos = append(info.UpfInfos, observedUpf(upfId, load))
+		}
+		dnais = append(dnais, info)
+	}
+	return servers, dnais
+}
+
+// dnForecaster predicts the series of one entry over a future window and
+// tracks the confidence of its least certain metric
+type dnForecaster struct {
+	forecast   factory.ForecastConfig
+	params     ForecastParams
+	startTs    int64
+	endTs      int64
+	confidence int
+}
+
+func (f *dnForecaster) predict(points []Point) (*ForecastResult, bool) {
+	if len(points) == 0 {
+		return nil, false
+	}
+	result, ok := forecastWindow(points, f.forecast.DefaultModel, int64(f.forecast.Step), f.startTs, f.endTs, f.params)
+	if !ok {
+		return nil, false
+	}
+	f.confidence = min(f.confidence, result.Confidence)
+	return result, true
+}
+
+func (f *dnForecaster) perf(delay, rate, loss []Point) (PerfData, bool) {
+	var perf PerfData
+	d, ok := f.predict(delay)
+	if !ok {
+		return perf, false
+	}
+	perf.AvgPacketDelay, perf.MaxPacketDelay = math.Max(0, d.Average), math.Max(0, d.Peak)
+	if r, ok := f.predict(rate); ok {
+		perf.AvgTrafficRate, perf.MaxTrafficRate = math.Max(0, r.Average), math.Max(0, r.Peak)
+	}
+	if l, ok := f.predict(loss); ok {
+		perf.AvgPacketLossRate = clampLoad(l.Average)
+	}
+	return perf, true
+}
+
+func (f *dnForecaster) upf(upfId string, load map[string][]Point) *UpfInformation {
+	info := &UpfInformation{UpfId: upfId}
+	if l, ok := f.predict(load[upfId]); ok {
+		avgLevel, peakLevel := percent(clampLoad(l.Average)), percent(clampLoad(l.Peak))
+		info.LoadLevelAverage, info.LoadLevelPeak = &avgLevel, &peakLevel
+	}
+	return info
+}
+
+// predictDNPerformance forecasts, from the training history, the performance
+// of every application server and DNAI over the future window [startTs,
+// endTs]
+func (e *AnalyticsEngine) predictDNPerformance(filter *EventFilter, startTs, endTs int64) ([]*DnPerformance, []*DnaiPerformance) {
+	forecast := factory.NwdafConfig.Configuration.GetForecast()
+	params := forecastParams(forecast)
+	now := e.clock.Now().Unix()
+	groups, load := e.dnSeries(e.context, filter, now-int64(forecast.History), now)
+
+	newForecaster := func() *dnForecaster {
+		return &dnForecaster{forecast: forecast, params: params, startTs: startTs, endTs: endTs, confidence: math.MaxInt}
+	}
+
+	servers := make([]*DnPerformance, 0, len(groups))
+	for _, g := range groups {
+		f := newForecaster()
+		perf, ok := f.perf(g.delay, g.rate, g.loss)
+		if !ok {
+			continue
+		}
+		info := &DnPerformance{Dnai: g.dnai, AppServerInsAddr: g.server, AppId: g.appId, PerfData: perf}
+		if g.upfId != "" {
+			info.UpfInfo = f.upf(g.upfId, load)
+		}
+		info.Confidence = f.confidence
+		servers = append(servers, info)
+	}
+
+	names, perDnai := byDnai(groups)
+	dnais := make([]*DnaiPerformance, 0, len(names))
+	for _, dnai := range names {
+		delay, rate, loss, upfIds := dnaiSeries(perDnai[dnai], int64(forecast.Step))
+		f := newForecaster()
+		perf, ok := f.perf(delay, rate, loss)
+		if !ok {
+			continue
+		}
+		info := &DnaiPerformance{Dnai: dnai, AppServers: len(perDnai[dnai]), PerfData: perf}
+		for _, upfId := range upfIds {
+			info.UpfInfos = append(info.UpfInfos, f.upf(upfId, load))
+		}
+		info.Confidence = f.confidence
+		dnais = append(dnais, info)
+	}
+	return servers, dnais
+}
@@ -0,0 +1,95 @@
+package analytics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/free5gc/nwdaf/pkg/clock"
+	nwdafContext "github.com/free5gc/nwdaf/pkg/context"
+)
+
+func TestDNPerformance(t *testing.T) {
+	ctx := &nwdafContext.NWDAFContext{DataStore: nwdafContext.NewDataStore()}
+	engine := NewAnalyticsEngine(ctx)
+
+	samples := []*nwdafContext.DNStatistics{
+		{Dnai: "edge1", AppServerAddr: "10.1.0.10", AppId: "video", UPFId: "upf-1", Latency: 10, Throughput: 100, PacketLoss: 0.01, Timestamp: 1000},
+		{Dnai: "edge1", AppServerAddr: "10.1.0.10", AppId: "video", UPFId: "upf-1", Latency: 20, Throughput: 300, PacketLoss: 0.03, Timestamp: 1010},
+		{Dnai: "edge1", AppServerAddr: "10.1.0.11", AppId: "game", UPFId: "upf-1", Latency: 30, Throughput: 200, PacketLoss: 0.02, Timestamp: 1000},
+		{Dnai: "edge2", AppServerAddr: "10.1.128.10", AppId: "video", UPFId: "upf-2", Latency: 5, Throughput: 50, Timestamp: 1000},
+	}
+	for _, s := range samples {
+		ctx.UpdateDNStatistics(s)
+	}
+	ctx.UpdateNFStatistics("upf-1", &nwdafContext.NFStatistics{NFInstanceId: "upf-1", NFType: "UPF", Load: 0.4, Timestamp: 1000})
+	ctx.UpdateNFStatistics("upf-1", &nwdafContext.NFStatistics{NFInstanceId: "upf-1", NFType: "UPF", Load: 0.8, Timestamp: 1010})
+
+	servers, dnais := engine.computeDNPerformance(engine.context, &EventFilter{}, 900, 1100)
+	if len(servers) != 3 || len(dnais) != 2 {
+		t.Fatalf("Expected 3 application servers over 2 DNAIs, got %d and %d", len(servers), len(dnais))
+	}
+
+	video := servers[0]
+	if video.AppServerInsAddr != "10.1.0.10" || video.PerfData.AvgPacketDelay != 15 || video.PerfData.MaxPacketDelay != 20 {
+		t.Errorf("Expected 10.1.0.10 first with 15 ms average and 20 ms peak delay, got %+v", video)
+	}
+	if video.UpfInfo == nil || video.UpfInfo.UpfId != "upf-1" || *video.UpfInfo.LoadLevelAverage != 60 || *video.UpfInfo.LoadLevelPeak != 80 {
+		t.Errorf("Expected anchor upf-1 at 60%% average and 80%% peak load, got %+v", video.UpfInfo)
+	}
+	if servers[2].UpfInfo == nil || servers[2].UpfInfo.LoadLevelAverage != nil {
+		t.Errorf("Expected upf-2 without load, got %+v", servers[2].UpfInfo)
+	}
+
+	// Traffic adds up across the servers of a DNAI within a step
+	edge1 := dnais[0]
+	if edge1.Dnai != "edge1" || edge1.AppServers != 2 || edge1.PerfData.AvgTrafficRate != 400 || edge1.PerfData.AvgPacketDelay != 20 {
+		t.Errorf("Expected edge1 with 2 servers, 400 B/s and 20 ms, got %+v", edge1)
+	}
+
+	servers, dnais = engine.computeDNPerformance(engine.context, mustParseFilter(t, map[string]interface{}{"appIds": []interface{}{"video"}}), 900, 1100)
+	if len(servers) != 2 || len(dnais) != 2 || dnais[0].AppServers != 1 {
+		t.Errorf("Expected the video servers of both DNAIs, got %d servers", len(servers))
+	}
+	servers, _ = engine.computeDNPerformance(engine.context, mustParseFilter(t, map[string]interface{}{"dnais": "edge2"}), 900, 1100)
+	if len(servers) != 1 || servers[0].Dnai != "edge2" {
+		t.Errorf("Expected only edge2, got %+v", servers)
+	}
+}
+
+func TestDNPerformancePrediction(t *testing.T) {
+	ctx := &nwdafContext.NWDAFContext{DataStore: nwdafContext.NewDataStore()}
+	engine := NewAnalyticsEngine(ctx)
+	engine.SetClock(clock.NewVirtual(time.Unix(3600, 0), 1))
+
+	for ts := int64(0); ts <= 3600; ts += 60 {
+		ctx.UpdateDNStatistics(&nwdafContext.DNStatistics{
+			Dnai: "edge1", AppServerAddr: "10.1.0.10", UPFId: "upf-1",
+			Latency: 10, Throughput: 1000, Timestamp: ts,
+		})
+		ctx.UpdateNFStatistics("upf-1", &nwdafContext.NFStatistics{NFInstanceId: "upf-1", NFType: "UPF", Load: 0.5, Timestamp: ts})
+	}
+
+	m, _ := LookupModule("DN_PERFORMANCE")
+	result := m.Analytics(context.Background(), engine, &EventFilter{}, 3000, 4200).(map[string]interface{})
+	if _, ok := result["dnPerfInfos"]; !ok {
+		t.Error("Expected statistics for the past part of the window")
+	}
+	predictions, ok := result["predictions"].(map[string]interface{})
+	if !ok {
+		t.Fatal("Expected predictions for the future part of the window")
+	}
+	servers := predictions["dnPerfInfos"].([]*DnPerformance)
+	if len(servers) != 1 {
+		t.Fatalf("Expected 1 predicted server, got %d", len(servers))
+	}
+	if delay := servers[0].PerfData.AvgPacketDelay; delay < 9 || delay > 11 {
+		t.Errorf("Expected a predicted delay near 10 ms, got %f", delay)
+	}
+	if upf := servers[0].UpfInfo; upf == nil || upf.LoadLevelAverage == nil || *upf.LoadLevelAverage != 50 {
+		t.Errorf("Expected a predicted anchor load of 50%%, got %+v", upf)
+	}
+	if servers[0].Confidence == 0 {
+		t.Error("Expected a confidence on the prediction")
+	}
+}
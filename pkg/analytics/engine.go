@@ -2,28 +2,66 @@ package analytics
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"sync"
 	"time"
 
 	"github.com/free5gc/nwdaf/internal/logger"
+	"github.com/free5gc/nwdaf/pkg/clock"
 	nwdafContext "github.com/free5gc/nwdaf/pkg/context"
 	"github.com/free5gc/nwdaf/pkg/factory"
 )
 
 type AnalyticsEngine struct {
-	context *nwdafContext.NWDAFContext
+	context  *nwdafContext.NWDAFContext
+	clock    clock.Clock
+	client   *http.Client
+	abnormal *abnormalState
+	accuracy *accuracyState
+	cache    *resultCache
+	models   *modelSet
+	peers    *peerState
+	adrf     *adrfState
+	dataSubs *dataSubState
+	provider *providerState
 }
 
 func NewAnalyticsEngine(ctx *nwdafContext.NWDAFContext) *AnalyticsEngine {
 	return &AnalyticsEngine{
-		context: ctx,
+		context:  ctx,
+		clock:    clock.Real,
+		client:   &http.Client{Timeout: notificationTimeout},
+		abnormal: newAbnormalState(),
+		accuracy: newAccuracyState(),
+		cache:    newResultCache(),
+		models:   newModelSet(),
+		peers:    newPeerState(),
+		dataSubs: newDataSubState(),
+		provider: &providerState{},
 	}
 }
 
+// SetClock replaces the wall clock, e.g. with a virtual clock for trace replay.
+// It must be called before Start.
+func (e *AnalyticsEngine) SetClock(c clock.Clock) {
+	e.clock = c
+}
+
+// Clock returns the clock the engine runs on
+func (e *AnalyticsEngine) Clock() clock.Clock {
+	return e.clock
+}
+
 func (e *AnalyticsEngine) Start(ctx context.Context) {
 	config := factory.NwdafConfig.Configuration
-	ticker := time.NewTicker(time.Duration(config.AnalyticsDelay) * time.Second)
+	ticker := e.clock.NewTicker(time.Duration(config.AnalyticsDelay) * time.Second)
 	defer ticker.Stop()
 
+	// Abnormal behaviour is checked as UE samples arrive rather than on the tick
+	removeListener := e.context.AddUEStatisticsListener(e.onUEStatistics)
+	defer removeListener()
+
 	logger.AnalyticsLog.Infoln("Analytics engine started")
 
 	for {
@@ -31,7 +69,7 @@ func (e *AnalyticsEngine) Start(ctx context.Context) {
 		case <-ctx.Done():
 			logger.AnalyticsLog.Infoln("Analytics engine stopped")
 			return
-		case <-ticker.C:
+		case <-ticker.C():
 			e.runAnalytics()
 		}
 	}
@@ -39,24 +77,39 @@ func (e *AnalyticsEngine) Start(ctx context.Context) {
 
 func (e *AnalyticsEngine) runAnalytics() {
 	logger.AnalyticsLog.Debugln("Running analytics cycle...")
+	start := time.Now()
+	defer func() { CycleDuration.Observe(time.Since(start).Seconds()) }()
+	e.cache.sweep(e.clock.Now())
+	e.pruneHistory()
+	e.abnormal.expire(e.clock.Now().Unix() - int64(factory.NwdafConfig.Configuration.GetAbnormalBehaviour().Suppress))
+
+	// Pick up models trained since the last cycle, here or by another MTLF
+	e.ReloadModels()
 
 	// Perform various analytics
 	e.analyzeNFLoad()
 	e.analyzeNetworkPerformance()
 	e.analyzeSlicePerformance()
 
+	// Check the predictions whose window has elapsed
+	e.checkPredictions()
+
 	// Process subscriptions and send notifications
 	e.processSubscriptions()
 }
 
 func (e *AnalyticsEngine) analyzeNFLoad() {
+	config := factory.NwdafConfig.Configuration
 	stats := e.context.GetAllNFStatistics()
-	
+
 	for nfId, nfStats := range stats {
 		logger.AnalyticsLog.Debugf("NF %s load: %.2f", nfId, nfStats.Load)
-		
+
 		// Detect overload conditions
-		if nfStats.Load > 0.8 {
+		switch classifyLoad(nfStats.Load, config.GetNfLoadThresholds(nfStats.NFType)) {
+		case LoadLevelOverload:
+			logger.AnalyticsLog.Warnf("NF %s (%s) is overloaded: %.2f", nfId, nfStats.NFType, nfStats.Load)
+		case LoadLevelHigh:
 			logger.AnalyticsLog.Warnf("NF %s is experiencing high load: %.2f", nfId, nfStats.Load)
 		}
 	}
@@ -65,7 +118,7 @@ func (e *AnalyticsEngine) analyzeNFLoad() {
 func (e *AnalyticsEngine) analyzeNetworkPerformance() {
 	// Analyze network-wide performance metrics
 	logger.AnalyticsLog.Debugln("Analyzing network performance...")
-	
+
 	// This is a placeholder for actual analytics implementation
 	// In a real implementation, you would:
 	// 1. Aggregate data from multiple sources
@@ -76,22 +129,72 @@ func (e *AnalyticsEngine) analyzeNetworkPerformance() {
 func (e *AnalyticsEngine) analyzeSlicePerformance() {
 	// Analyze network slice performance
 	logger.AnalyticsLog.Debugln("Analyzing network slice performance...")
-	
+
 	// Placeholder for slice analytics
 }
 
+// subscriptionGroup is the subscriptions sharing an event, normalized filter
+// and window, whose analytics are computed once per cycle
+type subscriptionGroup struct {
+	key    string
+	module Module
+	filter *EventFilter
+	subs   []*nwdafContext.AnalyticsSubscription
+}
+
 func (e *AnalyticsEngine) processSubscriptions() {
 	e.context.SubMutex.RLock()
 	subs := make([]*nwdafContext.AnalyticsSubscription, 0, len(e.context.Subscriptions))
 	for _, sub := range e.context.Subscriptions {
-		subs = append(subs, sub)
+		copied := *sub
+		subs = append(subs, &copied)
 	}
 	e.context.SubMutex.RUnlock()
 
+	groups := make(map[string]*subscriptionGroup)
 	for _, sub := range subs {
-		// Generate analytics for this subscription
-		analytics := e.generateAnalytics(sub)
-		
+		m, f, ok := subscriptionModule(sub)
+		if !ok {
+			continue
+		}
+		key := subscriptionKey(sub, f)
+		g, ok := groups[key]
+		if !ok {
+			g = &subscriptionGroup{key: key, module: m, filter: f}
+			groups[key] = g
+		}
+		g.subs = append(g.subs, sub)
+	}
+
+	// Compute each group on a bounded pool of workers
+	jobs := make(chan *subscriptionGroup)
+	var wg sync.WaitGroup
+	for i := 0; i < factory.NwdafConfig.Configuration.GetAnalyticsWorkers(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for g := range jobs {
+				e.processGroup(g)
+			}
+		}()
+	}
+	for _, g := range groups {
+		jobs <- g
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// processGroup computes the analytics of a subscription group once and
+// notifies each of its subscriptions
+func (e *AnalyticsEngine) processGroup(g *subscriptionGroup) {
+	rep := g.subs[0]
+	shared := e.cachedResult(g.key, rep.EventType, g.filter, func() interface{} {
+		return g.module.Report(e, rep, g.filter)
+	})
+	for _, sub := range g.subs {
+		analytics := e.withPeerResults(g.module, sub, e.subscriptionResult(sub, shared))
+
 		// Send notification to consumer
 		if analytics != nil {
 			e.sendNotification(sub, analytics)
@@ -102,97 +205,84 @@ func (e *AnalyticsEngine) processSubscriptions() {
 func (e *AnalyticsEngine) generateAnalytics(sub *nwdafContext.AnalyticsSubscription) interface{} {
 	// Generate analytics based on subscription type
 	logger.AnalyticsLog.Debugf("Generating analytics for subscription %s", sub.SubscriptionId)
-	
-	switch sub.EventType {
-	case "NF_LOAD":
-		return e.generateNFLoadAnalytics(sub)
-	case "NETWORK_PERFORMANCE":
-		return e.generateNetworkPerformanceAnalytics(sub)
-	case "SLICE_LOAD":
-		return e.generateSliceLoadAnalytics(sub)
-	default:
-		logger.AnalyticsLog.Warnf("Unknown event type: %s", sub.EventType)
+
+	m, f, ok := subscriptionModule(sub)
+	if !ok {
 		return nil
 	}
+	shared := e.cachedResult(subscriptionKey(sub, f), sub.EventType, f, func() interface{} {
+		return m.Report(e, sub, f)
+	})
+	return e.subscriptionResult(sub, shared)
 }
 
-func (e *AnalyticsEngine) generateNFLoadAnalytics(sub *nwdafContext.AnalyticsSubscription) interface{} {
-	// Generate NF load analytics
-	return map[string]interface{}{
-		"eventType":   sub.EventType,
-		"timestamp":   time.Now().Unix(),
-		"nfLoadLevel": "NORMAL",
-		"predictions": "STABLE",
+// subscriptionModule returns the module and parsed filter of a subscription
+func subscriptionModule(sub *nwdafContext.AnalyticsSubscription) (Module, *EventFilter, bool) {
+	m, ok := LookupModule(sub.EventType)
+	if !ok {
+		logger.AnalyticsLog.Warnf("Unknown event type: %s", sub.EventType)
+		return nil, nil, false
 	}
-}
-
-func (e *AnalyticsEngine) generateNetworkPerformanceAnalytics(sub *nwdafContext.AnalyticsSubscription) interface{} {
-	// Generate network performance analytics
-	return map[string]interface{}{
-		"eventType":   sub.EventType,
-		"timestamp":   time.Now().Unix(),
-		"latency":     10.5,
-		"throughput":  1000.0,
-		"packetLoss":  0.01,
+	f, err := ParseFilter(sub.AnalyticsFilter)
+	if err != nil {
+		logger.AnalyticsLog.Warnf("Subscription %s: %v", sub.SubscriptionId, err)
+		return nil, nil, false
 	}
+	return m, f, true
 }
 
-func (e *AnalyticsEngine) generateSliceLoadAnalytics(sub *nwdafContext.AnalyticsSubscription) interface{} {
-	// Generate slice load analytics
-	return map[string]interface{}{
-		"eventType":    sub.EventType,
-		"timestamp":    time.Now().Unix(),
-		"sliceLoadLevel": "NORMAL",
-		"resourceUsage":  0.45,
+// subscriptionKey groups subscriptions by event, filter and, when they set
+// one, reporting window
+func subscriptionKey(sub *nwdafContext.AnalyticsSubscription, f *EventFilter) string {
+	if r := sub.EvtReq; r != nil && (r.StartTs != 0 || r.EndTs != 0) {
+		return fmt.Sprintf("%s|%d|%d", reportKey(sub.EventType, f), r.StartTs, r.EndTs)
 	}
+	return reportKey(sub.EventType, f)
 }
 
-func (e *AnalyticsEngine) sendNotification(sub *nwdafContext.AnalyticsSubscription, analytics interface{}) {
-	// Send notification to consumer
-	logger.AnalyticsLog.Debugf("Sending notification to %s for subscription %s", 
-		sub.NotificationUri, sub.SubscriptionId)
-	
-	// In a real implementation, you would make an HTTP POST request to the notification URI
-	// For now, we just log it
+// subscriptionResult applies the reporting requirement of one subscription to
+// a copy of its group's result
+func (e *AnalyticsEngine) subscriptionResult(sub *nwdafContext.AnalyticsSubscription, shared interface{}) interface{} {
+	return e.addAccuracyInfo(sub.EventType, applyReportingRequirement(copyResult(shared), sub.EvtReq))
 }
 
 // GetAnalytics retrieves analytics for a specific request
 func (e *AnalyticsEngine) GetAnalytics(eventType string, filter map[string]interface{}) (interface{}, error) {
-	logger.AnalyticsLog.Infof("Getting analytics for event type: %s", eventType)
-	
-	switch eventType {
-	case "NF_LOAD":
-		return e.getNFLoadAnalytics(filter), nil
-	case "NETWORK_PERFORMANCE":
-		return e.getNetworkPerformanceAnalytics(filter), nil
-	case "SLICE_LOAD":
-		return e.getSliceLoadAnalytics(filter), nil
-	default:
-		return nil, nil
-	}
+	return e.GetAnalyticsInWindow(eventType, filter, 0, 0)
 }
 
-func (e *AnalyticsEngine) getNFLoadAnalytics(filter map[string]interface{}) interface{} {
-	stats := e.context.GetAllNFStatistics()
-	return map[string]interface{}{
-		"nfStatistics": stats,
-		"timestamp":    time.Now().Unix(),
-	}
+// GetAnalyticsInWindow retrieves analytics computed over the history collected
+// between startTs and endTs (Unix seconds). With both bounds zero the latest
+// statistics are used.
+func (e *AnalyticsEngine) GetAnalyticsInWindow(eventType string, filter map[string]interface{}, startTs, endTs int64) (interface{}, error) {
+	return e.GetAnalyticsWithRequirement(context.Background(), eventType, filter, &nwdafContext.EventReportingRequirement{StartTs: startTs, EndTs: endTs})
 }
 
-func (e *AnalyticsEngine) getNetworkPerformanceAnalytics(filter map[string]interface{}) interface{} {
-	return map[string]interface{}{
-		"averageLatency":    10.5,
-		"averageThroughput": 1000.0,
-		"packetLoss":        0.01,
-		"timestamp":         time.Now().Unix(),
-	}
-}
+// GetAnalyticsWithRequirement retrieves analytics honoring an event reporting
+// requirement: statistics for the past part of its window, predictions for
+// the future part, predictions at the requested accuracy and at most its
+// maximum number of objects per output list. Event types without a
+// registered module return ErrUnknownEvent. Windows reaching back beyond the
+// local retention are completed from the ADRF within ctx.
+func (e *AnalyticsEngine) GetAnalyticsWithRequirement(ctx context.Context, eventType string, filter map[string]interface{}, req *nwdafContext.EventReportingRequirement) (interface{}, error) {
+	logger.AnalyticsLog.Infof("Getting analytics for event type: %s", eventType)
 
-func (e *AnalyticsEngine) getSliceLoadAnalytics(filter map[string]interface{}) interface{} {
-	return map[string]interface{}{
-		"sliceLoad":     "NORMAL",
-		"resourceUsage": 0.45,
-		"timestamp":     time.Now().Unix(),
+	m, ok := LookupModule(eventType)
+	if !ok {
+		return nil, unknownEvent(eventType)
+	}
+	f, err := ParseFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	if err := ValidateReportingRequirement(req); err != nil {
+		return nil, err
+	}
+	if req == nil {
+		req = &nwdafContext.EventReportingRequirement{}
 	}
+	shared := e.cachedResult(analyticsKey(eventType, f, req.StartTs, req.EndTs), eventType, f, func() interface{} {
+		return m.Analytics(ctx, e, f, req.StartTs, req.EndTs)
+	})
+	return e.addAccuracyInfo(eventType, applyReportingRequirement(copyResult(shared), req)), nil
 }
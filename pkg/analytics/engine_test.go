@@ -3,11 +3,25 @@ package analytics
 import (
 	"testing"
 	"context"
+	"os"
 	"time"
 
+	"github.com/free5gc/nwdaf/pkg/clock"
 	nwdafContext "github.com/free5gc/nwdaf/pkg/context"
+	"github.com/free5gc/nwdaf/pkg/factory"
 )
 
+func TestMain(m *testing.M) {
+	factory.NwdafConfig = &factory.Config{
+		Configuration: &factory.Configuration{
+			NwdafName:      "NWDAF",
+			Sbi:            &factory.Sbi{Scheme: "http", Port: 8000},
+			AnalyticsDelay: 1,
+		},
+	}
+	os.Exit(m.Run())
+}
+
 func TestNewAnalyticsEngine(t *testing.T) {
 	ctx := &nwdafContext.NWDAFContext{}
 	engine := NewAnalyticsEngine(ctx)
@@ -35,7 +49,7 @@ func TestGetAnalytics(t *testing.T) {
 		{"NF Load", "NF_LOAD", false},
 		{"Network Performance", "NETWORK_PERFORMANCE", false},
 		{"Slice Load", "SLICE_LOAD", false},
-		{"Unknown Type", "UNKNOWN", false},
+		{"Unknown Type", "UNKNOWN", true},
 	}
 	
 	for _, tt := range tests {
@@ -76,3 +90,148 @@ func TestAnalyticsEngineStart(t *testing.T) {
 		t.Error("Engine did not stop within timeout")
 	}
 }
+
+func TestGetAnalyticsInWindow(t *testing.T) {
+	ctx := &nwdafContext.NWDAFContext{DataStore: nwdafContext.NewDataStore()}
+	engine := NewAnalyticsEngine(ctx)
+
+	for i, load := range []float64{0.2, 0.4, 0.9} {
+		ctx.UpdateNFStatistics("amf-1", &nwdafContext.NFStatistics{
+			NFInstanceId: "amf-1",
+			NFType:       "AMF",
+			Load:         load,
+			Timestamp:    int64(1000 + i*60),
+		})
+	}
+
+	result, err := engine.GetAnalyticsInWindow("NF_LOAD", nil, 1000, 1060)
+	if err != nil {
+		t.Fatalf("GetAnalyticsInWindow() error = %v", err)
+	}
+
+	infos := result.(map[string]interface{})["nfLoadLevelInfos"].([]*NfLoadLevelInformation)
+	if len(infos) != 1 {
+		t.Fatalf("Expected load information for amf-1, got %d entries", len(infos))
+	}
+	if infos[0].Samples != 2 || infos[0].NfLoadLevelpeak != 40 || infos[0].NfLoadLevelAverage != 30 {
+		t.Errorf("Expected 2 samples averaging 30%% and peaking at 40%%, got %+v", infos[0])
+	}
+}
+
+func TestHistoryRetention(t *testing.T) {
+	factory.NwdafConfig.Configuration.DataCollectionConfig = &factory.DataCollectionConfig{Retention: 600}
+	defer func() { factory.NwdafConfig.Configuration.DataCollectionConfig = nil }()
+
+	now := time.Unix(1700000000, 0)
+	ctx := &nwdafContext.NWDAFContext{DataStore: nwdafContext.NewDataStore()}
+	engine := NewAnalyticsEngine(ctx)
+	engine.SetClock(clock.NewVirtual(now, 1))
+	for _, age := range []int64{900, 700, 300, 0} {
+		ctx.UpdateNFStatistics("amf-1", &nwdafContext.NFStatistics{NFInstanceId: "amf-1", Load: 0.5, Timestamp: now.Unix() - age})
+	}
+
+	engine.pruneHistory()
+	if samples := ctx.GetNFStatisticsInWindow(0, 0)["amf-1"]; len(samples) != 2 {
+		t.Errorf("Expected the 2 samples within the retention, got %d", len(samples))
+	}
+}
+
+func TestNFLoadLevelAndFilter(t *testing.T) {
+	factory.NwdafConfig.Configuration.NfLoad = &factory.NfLoadConfig{
+		Thresholds: map[string]*factory.LoadThresholds{
+			"UPF": {Low: 0.1, High: 0.5, Overload: 0.7},
+		},
+	}
+	defer func() { factory.NwdafConfig.Configuration.NfLoad = nil }()
+
+	ctx := &nwdafContext.NWDAFContext{DataStore: nwdafContext.NewDataStore()}
+	engine := NewAnalyticsEngine(ctx)
+
+	for _, nf := range []struct {
+		id, nfType, snssai string
+	}{
+		{"upf-1", "UPF", "1-010203"},
+		{"smf-1", "SMF", "1-010203"},
+		{"upf-2", "UPF", "2-000001"},
+	} {
+		ctx.UpdateNFStatistics(nf.id, &nwdafContext.NFStatistics{
+			NFInstanceId: nf.id,
+			NFType:       nf.nfType,
+			Snssais:      []string{nf.snssai},
+			Load:         0.6,
+			Timestamp:    2000,
+		})
+	}
+
+	infos := engine.computeNFLoad(engine.context, &EventFilter{
+		NfTypes: []string{"UPF", "SMF"},
+		Snssais: []string{"1-010203"},
+	}, 1900, 2100)
+
+	if len(infos) != 2 {
+		t.Fatalf("Expected 2 NF instances on slice 1-010203, got %d", len(infos))
+	}
+	levels := map[string]string{}
+	for _, info := range infos {
+		levels[info.NfInstanceId] = info.NfLoadLevel
+	}
+	// The same load is HIGH for a UPF but NORMAL under the default thresholds
+	if levels["upf-1"] != LoadLevelHigh || levels["smf-1"] != LoadLevelNormal {
+		t.Errorf("Unexpected load levels: %v", levels)
+	}
+}
+
+func TestNetworkPerformancePerArea(t *testing.T) {
+	factory.NwdafConfig.Configuration.AreasOfInterest = map[string][]string{
+		"downtown": {"tai-1", "tai-2"},
+	}
+	defer func() { factory.NwdafConfig.Configuration.AreasOfInterest = nil }()
+
+	ctx := &nwdafContext.NWDAFContext{DataStore: nwdafContext.NewDataStore()}
+	engine := NewAnalyticsEngine(ctx)
+
+	for _, ue := range []struct {
+		supi, tai string
+		latency   float64
+	}{
+		{"imsi-1", "tai-1", 10},
+		{"imsi-2", "tai-2", 30},
+		{"imsi-3", "tai-3", 50},
+	} {
+		ctx.UpdateUEStatistics(ue.supi, &nwdafContext.UEStatistics{
+			SUPI:      ue.supi,
+			Location:  ue.tai,
+			Latency:   ue.latency,
+			Timestamp: 3000,
+		})
+	}
+	ctx.UpdateNFStatistics("smf-1", &nwdafContext.NFStatistics{
+		NFInstanceId: "smf-1",
+		NFType:       "SMF",
+		Tais:         []string{"tai-1", "tai-2"},
+		Metrics: map[string]float64{
+			MetricPduSessionAttempts:  10,
+			MetricPduSessionSuccesses: 9,
+		},
+		Timestamp: 3000,
+	})
+
+	perTai := engine.computeNetworkPerformance(engine.context, &EventFilter{}, 2900, 3100)["networkPerfInfos"].([]*NetworkPerfInfo)
+	if len(perTai) != 3 || perTai[2].Tai != "tai-3" || perTai[2].PduSessionSuccessRatio != nil {
+		t.Fatalf("Expected one entry per TAI with no PDU session ratio for tai-3, got %+v", perTai)
+	}
+
+	area := engine.computeNetworkPerformance(engine.context, &EventFilter{
+		AreasOfInterest: []string{"downtown"},
+	}, 2900, 3100)["networkPerfInfos"].([]*NetworkPerfInfo)
+	if len(area) != 1 {
+		t.Fatalf("Expected a single entry for downtown, got %d", len(area))
+	}
+	info := area[0]
+	if info.UeCount != 2 || info.AverageLatency != 20 {
+		t.Errorf("Expected 2 UEs averaging 20ms, got %+v", info)
+	}
+	if info.PduSessionSuccessRatio == nil || *info.PduSessionSuccessRatio != 0.9 {
+		t.Errorf("Expected a PDU session success ratio of 0.9, got %v", info.PduSessionSuccessRatio)
+	}
+}
@@ -0,0 +1,358 @@
+package analytics
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	nwdafContext "github.com/free5gc/nwdaf/pkg/context"
+)
+
+// ErrInvalidFilter is returned for analytics filters that do not parse or
+// that the event type does not support
+var ErrInvalidFilter = errors.New("invalid analytics filter")
+
+// Analytics filter keys. Each list key also accepts its singular form.
+const (
+	FilterNfTypes         = "nfTypes"
+	FilterNfInstanceIds   = "nfInstanceIds"
+	FilterSnssais         = "snssais"
+	FilterTais            = "tais"
+	FilterAreasOfInterest = "areasOfInterest"
+	FilterSupis           = "supis"
+	FilterIntGroupIds     = "intGroupIds"
+	FilterDnns            = "dnns"
+	FilterAppIds          = "appIds"
+	FilterDnais           = "dnais"
+	FilterAppServerAddrs  = "appServerAddrs"
+	FilterExcepIds        = "excepIds"
+	FilterCongTypes       = "congTypes"
+	FilterFiveQis         = "fiveQis"
+	FilterRanUeThrouThd   = "ranUeThrouThd"
+	FilterQosRequ         = "qosRequ"
+)
+
+// EventFilter is the typed analytics filter (TS 29.520 EventFilter). An empty
+// list does not restrict its dimension; values of a list are alternatives
+// and dimensions combine.
+type EventFilter struct {
+	NfTypes         []string
+	NfInstanceIds   []string
+	Snssais         []string
+	Tais            []string
+	AreasOfInterest []string
+	Supis           []string
+	IntGroupIds     []string
+	Dnns            []string
+	AppIds          []string
+
+	// Event-specific selections
+	Dnais          []string
+	AppServerAddrs []string
+	ExcepIds       []string
+	CongTypes      []string
+	FiveQis        []int
+	// RanUeThrouThd is the per-UE throughput to sustain, from "ranUeThrouThd"
+	// or the guaranteed downlink bitrate of "qosRequ"
+	RanUeThrouThd *float64
+
+	// keys are the filter keys present, in their plural form
+	keys []string
+}
+
+// listFilter is a string list key and the field it fills
+type listFilter struct {
+	key   string
+	field func(f *EventFilter) *[]string
+}
+
+// listFilters maps each string list key, plural or singular, onto its field
+var listFilters = make(map[string]listFilter)
+
+func init() {
+	for singular, l := range map[string]listFilter{
+		"nfType":         {FilterNfTypes, func(f *EventFilter) *[]string { return &f.NfTypes }},
+		"nfInstanceId":   {FilterNfInstanceIds, func(f *EventFilter) *[]string { return &f.NfInstanceIds }},
+		"snssai":         {FilterSnssais, func(f *EventFilter) *[]string { return &f.Snssais }},
+		"tai":            {FilterTais, func(f *EventFilter) *[]string { return &f.Tais }},
+		"areaOfInterest": {FilterAreasOfInterest, func(f *EventFilter) *[]string { return &f.AreasOfInterest }},
+		"supi":           {FilterSupis, func(f *EventFilter) *[]string { return &f.Supis }},
+		"intGroupId":     {FilterIntGroupIds, func(f *EventFilter) *[]string { return &f.IntGroupIds }},
+		"dnn":            {FilterDnns, func(f *EventFilter) *[]string { return &f.Dnns }},
+		"appId":          {FilterAppIds, func(f *EventFilter) *[]string { return &f.AppIds }},
+		"dnai":           {FilterDnais, func(f *EventFilter) *[]string { return &f.Dnais }},
+		"appServerAddr":  {FilterAppServerAddrs, func(f *EventFilter) *[]string { return &f.AppServerAddrs }},
+		"excepId":        {FilterExcepIds, func(f *EventFilter) *[]string { return &f.ExcepIds }},
+		"congType":       {FilterCongTypes, func(f *EventFilter) *[]string { return &f.CongTypes }},
+	} {
+		listFilters[singular] = l
+		listFilters[l.key] = l
+	}
+}
+
+// ParseFilter converts a JSON analytics filter into an EventFilter. Unknown
+// keys and values of the wrong type are rejected.
+func ParseFilter(filter map[string]interface{}) (*EventFilter, error) {
+	f := &EventFilter{}
+	for key, value := range filter {
+		var err error
+		switch key {
+		case FilterFiveQis, "5qi":
+			key = FilterFiveQis
+			var values []int
+			values, err = parseInts(value)
+			f.FiveQis = append(f.FiveQis, values...)
+		case FilterRanUeThrouThd:
+			v, ok := number(value)
+			if !ok {
+				err = errors.New("must be a number")
+				break
+			}
+			f.RanUeThrouThd = &v
+		case FilterQosRequ:
+			err = f.parseQosRequ(value)
+		default:
+			l, ok := listFilters[key]
+			if !ok {
+				return nil, fmt.Errorf("%w: unknown key %q", ErrInvalidFilter, key)
+			}
+			key = l.key
+			var values []string
+			if key == FilterSnssais {
+				values, err = parseSnssais(value)
+			} else {
+				values, err = parseStrings(value)
+			}
+			field := l.field(f)
+			*field = append(*field, values...)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q %v", ErrInvalidFilter, key, err)
+		}
+		f.keys = append(f.keys, key)
+	}
+	sort.Strings(f.keys)
+	return f, nil
+}
+
+// key returns a canonical form of the filter: filters that only differ in
+// the order of their values, or in singular and plural keys, share a key
+func (f *EventFilter) key() string {
+	n := *f
+	n.keys = nil
+	for _, list := range []*[]string{
+		&n.NfTypes, &n.NfInstanceIds, &n.Snssais, &n.Tais, &n.AreasOfInterest, &n.Supis, &n.IntGroupIds,
+		&n.Dnns, &n.AppIds, &n.Dnais, &n.AppServerAddrs, &n.ExcepIds, &n.CongTypes,
+	} {
+		sorted := append([]string(nil), *list...)
+		sort.Strings(sorted)
+		*list = sorted
+	}
+	n.FiveQis = append([]int(nil), f.FiveQis...)
+	sort.Ints(n.FiveQis)
+
+	key, _ := json.Marshal(n)
+	return string(key)
+}
+
+// parseQosRequ reads the 5QI and guaranteed downlink bitrate of a QoS
+// requirement (TS 29.520 QosRequirement)
+func (f *EventFilter) parseQosRequ(value interface{}) error {
+	requ, ok := value.(map[string]interface{})
+	if !ok {
+		return errors.New("must be an object")
+	}
+	if v, ok := requ["5qi"]; ok {
+		fiveQi, ok := integer(v)
+		if !ok {
+			return errors.New("5qi must be an integer")
+		}
+		f.FiveQis = append(f.FiveQis, fiveQi)
+	}
+	if v, ok := requ["gfbrDl"]; ok && f.RanUeThrouThd == nil {
+		gfbr, ok := number(v)
+		if !ok {
+			return errors.New("gfbrDl must be a number")
+		}
+		f.RanUeThrouThd = &gfbr
+	}
+	return nil
+}
+
+// parseStrings accepts a string or a list of strings
+func parseStrings(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case string:
+		if v == "" {
+			return nil, nil
+		}
+		return []string{v}, nil
+	case []string:
+		return v, nil
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, errors.New("must be a string or a list of strings")
+			}
+			values = append(values, s)
+		}
+		return values, nil
+	}
+	return nil, errors.New("must be a string or a list of strings")
+}
+
+// parseSnssais accepts S-NSSAIs as strings ("1-010203") or as objects with
+// "sst" and optional "sd", alone or in a list
+func parseSnssais(value interface{}) ([]string, error) {
+	items, ok := value.([]interface{})
+	if !ok {
+		items = []interface{}{value}
+	}
+	var values []string
+	for _, item := range items {
+		switch v := item.(type) {
+		case map[string]interface{}:
+			sst, ok := integer(v["sst"])
+			if !ok {
+				return nil, errors.New("sst must be an integer")
+			}
+			snssai := fmt.Sprint(sst)
+			if sd, ok := v["sd"].(string); ok && sd != "" {
+				snssai += "-" + sd
+			}
+			values = append(values, snssai)
+		default:
+			s, err := parseStrings(v)
+			if err != nil {
+				return nil, errors.New("must be an S-NSSAI or a list of S-NSSAIs")
+			}
+			values = append(values, s...)
+		}
+	}
+	return values, nil
+}
+
+// parseInts accepts an integer or a list of integers
+func parseInts(value interface{}) ([]int, error) {
+	items, ok := value.([]interface{})
+	if !ok {
+		items = []interface{}{value}
+	}
+	values := make([]int, 0, len(items))
+	for _, item := range items {
+		v, ok := integer(item)
+		if !ok {
+			return nil, errors.New("must be an integer or a list of integers")
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+func number(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+func integer(value interface{}) (int, bool) {
+	v, ok := number(value)
+	if !ok || v != math.Trunc(v) {
+		return 0, false
+	}
+	return int(v), true
+}
+
+// ValidateFilter checks that an event type is served, that its analytics
+// filter parses and only uses keys the module supports, and that it carries
+// what the module needs
+func ValidateFilter(eventType string, filter map[string]interface{}) error {
+	m, ok := LookupModule(eventType)
+	if !ok {
+		return unknownEvent(eventType)
+	}
+	f, err := ParseFilter(filter)
+	if err != nil {
+		return err
+	}
+	supported := m.Filters()
+	for _, key := range f.keys {
+		if len(supported) == 0 || !matchesAny(supported, key) {
+			return fmt.Errorf("%w: %s does not support %q", ErrInvalidFilter, eventType, key)
+		}
+	}
+	if err := m.Validate(f); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidFilter, err)
+	}
+	return nil
+}
+
+// validateUEMobilityFilter requires a target: TS 23.288 §6.7.2 targets one or
+// more SUPIs or a UE group
+func validateUEMobilityFilter(f *EventFilter) error {
+	if len(f.Supis) == 0 && len(f.IntGroupIds) == 0 {
+		return fmt.Errorf("UE_MOBILITY requires supis or intGroupIds")
+	}
+	return nil
+}
+
+// validateQosSustainabilityFilter requires the QoS threshold to sustain
+// (TS 23.288 §6.9)
+func validateQosSustainabilityFilter(f *EventFilter) error {
+	if f.RanUeThrouThd == nil {
+		return fmt.Errorf("QOS_SUSTAINABILITY requires ranUeThrouThd or qosRequ.gfbrDl")
+	}
+	return nil
+}
+
+// matchesNF reports whether an NF is in scope: its type, instance, slices
+// and served TAIs
+func (f *EventFilter) matchesNF(nfId string, s *nwdafContext.NFStatistics) bool {
+	return matchesAny(f.NfTypes, s.NFType) && matchesAny(f.NfInstanceIds, nfId) &&
+		intersects(f.Snssais, s.Snssais) && intersects(f.Tais, s.Tais)
+}
+
+// matchesFlow reports whether a UE sample is in scope by slice, DNN and
+// application. SUPIs and groups are resolved by a ueScope.
+func (f *EventFilter) matchesFlow(s *nwdafContext.UEStatistics) bool {
+	return matchesAny(f.Snssais, s.Snssai) && matchesAny(f.Dnns, s.Dnn) && matchesAny(f.AppIds, s.AppId)
+}
+
+// matchesAny reports whether value equals one of the allowed values, ignoring
+// case. An empty allow-list matches everything.
+func matchesAny(allowed []string, value string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, a := range allowed {
+		if strings.EqualFold(a, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// intersects reports whether any of values is allowed. An empty allow-list
+// matches everything.
+func intersects(allowed []string, values []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if matchesAny(allowed, v) {
+			return true
+		}
+	}
+	return false
+}
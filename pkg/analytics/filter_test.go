@@ -0,0 +1,95 @@
+package analytics
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/free5gc/nwdaf/pkg/clock"
+	nwdafContext "github.com/free5gc/nwdaf/pkg/context"
+)
+
+// mustParseFilter parses a JSON analytics filter or fails the test
+func mustParseFilter(t *testing.T, filter map[string]interface{}) *EventFilter {
+	t.Helper()
+	f, err := ParseFilter(filter)
+	if err != nil {
+		t.Fatalf("ParseFilter() error = %v", err)
+	}
+	return f
+}
+
+func TestParseFilter(t *testing.T) {
+	gfbr := 40.0
+	tests := []struct {
+		name      string
+		filter    map[string]interface{}
+		want      *EventFilter
+		wantError bool
+	}{
+		{"Empty filter", nil, &EventFilter{}, false},
+		{"Singular key", map[string]interface{}{"nfType": "AMF"}, &EventFilter{NfTypes: []string{"AMF"}, keys: []string{FilterNfTypes}}, false},
+		{"List of strings", map[string]interface{}{"dnns": []interface{}{"internet", "ims"}}, &EventFilter{Dnns: []string{"internet", "ims"}, keys: []string{FilterDnns}}, false},
+		{"S-NSSAI object", map[string]interface{}{"snssais": []interface{}{map[string]interface{}{"sst": 1.0, "sd": "010203"}, "2"}}, &EventFilter{Snssais: []string{"1-010203", "2"}, keys: []string{FilterSnssais}}, false},
+		{"5QI alias", map[string]interface{}{"5qi": 9.0}, &EventFilter{FiveQis: []int{9}, keys: []string{FilterFiveQis}}, false},
+		{"QoS requirement", map[string]interface{}{"qosRequ": map[string]interface{}{"5qi": 2.0, "gfbrDl": 40.0}}, &EventFilter{FiveQis: []int{2}, RanUeThrouThd: &gfbr, keys: []string{FilterQosRequ}}, false},
+		{"Unknown key", map[string]interface{}{"colour": "blue"}, nil, true},
+		{"String list of numbers", map[string]interface{}{"supis": []interface{}{1.0}}, nil, true},
+		{"Fractional 5QI", map[string]interface{}{"fiveQis": 2.5}, nil, true},
+		{"Threshold as string", map[string]interface{}{"ranUeThrouThd": "40"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := ParseFilter(tt.filter)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("ParseFilter() error = %v, wantError %v", err, tt.wantError)
+			}
+			if tt.wantError {
+				if !errors.Is(err, ErrInvalidFilter) {
+					t.Errorf("Expected ErrInvalidFilter, got %v", err)
+				}
+				return
+			}
+			if !reflect.DeepEqual(f, tt.want) {
+				t.Errorf("ParseFilter() = %+v, want %+v", f, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterScope(t *testing.T) {
+	ctx := &nwdafContext.NWDAFContext{DataStore: nwdafContext.NewDataStore()}
+	engine := NewAnalyticsEngine(ctx)
+	engine.SetClock(clock.NewVirtual(time.Unix(2000, 0), 1))
+
+	for _, id := range []string{"amf-1", "amf-2"} {
+		ctx.UpdateNFStatistics(id, &nwdafContext.NFStatistics{NFInstanceId: id, NFType: "AMF", Load: 0.3, Timestamp: 1990})
+	}
+	for _, snssai := range []string{"1-010203", "2-000001"} {
+		ctx.UpdateSliceStatistics(snssai, &nwdafContext.SliceStatistics{SNSSAI: snssai, ActiveUEs: 10, Timestamp: 1990})
+	}
+
+	result, err := engine.GetAnalyticsInWindow("NF_LOAD", map[string]interface{}{"nfInstanceId": "amf-2"}, 1900, 2000)
+	if err != nil {
+		t.Fatalf("GetAnalyticsInWindow() error = %v", err)
+	}
+	infos := result.(map[string]interface{})["nfLoadLevelInfos"].([]*NfLoadLevelInformation)
+	if len(infos) != 1 || infos[0].NfInstanceId != "amf-2" {
+		t.Errorf("Expected only amf-2, got %+v", infos)
+	}
+
+	result, err = engine.GetAnalyticsInWindow("SLICE_LOAD", map[string]interface{}{"snssai": map[string]interface{}{"sst": 2.0, "sd": "000001"}}, 1900, 2000)
+	if err != nil {
+		t.Fatalf("GetAnalyticsInWindow() error = %v", err)
+	}
+	slices := result.(map[string]interface{})["sliceStatistics"].(map[string]*SliceLoadSummary)
+	if len(slices) != 1 || slices["2-000001"] == nil {
+		t.Errorf("Expected only slice 2-000001, got %v", slices)
+	}
+
+	if _, err := engine.GetAnalyticsInWindow("NF_LOAD", map[string]interface{}{"nfTypes": 1.0}, 0, 0); !errors.Is(err, ErrInvalidFilter) {
+		t.Errorf("Expected ErrInvalidFilter, got %v", err)
+	}
+}
@@ -0,0 +1,315 @@
+package analytics
+
+import (
+	"math"
+	"sort"
+
+	"github.com/free5gc/nwdaf/pkg/factory"
+)
+
+// Forecast models
+const (
+	ModelAuto        = "auto"
+	ModelEWMA        = "ewma"
+	ModelHoltWinters = "holt-winters"
+	ModelLinear      = "linear"
+)
+
+const secondsPerDay = 86400
+
+// Point is one observation of a time series
+type Point struct {
+	Ts    int64
+	Value float64
+}
+
+// sortPoints orders a series gathered from several sources by time
+func sortPoints(points []Point) {
+	sort.SliceStable(points, func(i, j int) bool { return points[i].Ts < points[j].Ts })
+}
+
+// Forecaster predicts the next values of an evenly spaced series
+type Forecaster interface {
+	Name() string
+	// MinSamples is the shortest series the model can be fitted on
+	MinSamples() int
+	// Fit trains the model and returns its one-step-ahead RMSE, each sample
+	// predicted from those before it
+	Fit(series []float64) float64
+	// Predict returns the value h steps after the end of the fitted series
+	Predict(h int) float64
+}
+
+// resample averages the points into buckets of step seconds, starting at the
+// first point. Empty buckets repeat the previous value. It returns the series
+// and the timestamp of its last bucket.
+func resample(points []Point, step int64) ([]float64, int64) {
+	if len(points) == 0 || step <= 0 {
+		return nil, 0
+	}
+	start := points[0].Ts
+	n := int((points[len(points)-1].Ts-start)/step) + 1
+
+	sums := make([]float64, n)
+	counts := make([]int, n)
+	for _, p := range points {
+		i := int((p.Ts - start) / step)
+		sums[i] += p.Value
+		counts[i]++
+	}
+
+	series := make([]float64, n)
+	for i := range series {
+		switch {
+		case counts[i] > 0:
+			series[i] = sums[i] / float64(counts[i])
+		case i > 0:
+			series[i] = series[i-1]
+		}
+	}
+	return series, start + int64(n-1)*step
+}
+
+// EWMA is simple exponential smoothing; its forecast is flat
+type EWMA struct {
+	Alpha float64
+	level float64
+}
+
+func (m *EWMA) Name() string    { return ModelEWMA }
+func (m *EWMA) MinSamples() int { return 1 }
+
+func (m *EWMA) Fit(series []float64) float64 {
+	m.level = series[0]
+	var sse float64
+	for _, x := range series[1:] {
+		sse += (x - m.level) * (x - m.level)
+		m.level = m.Alpha*x + (1-m.Alpha)*m.level
+	}
+	return rmse(sse, len(series)-1)
+}
+
+func (m *EWMA) Predict(h int) float64 {
+	return m.level
+}
+
+// LinearRegression fits a least-squares line over the sample index
+type LinearRegression struct {
+	slope, intercept float64
+	n                int
+}
+
+func (m *LinearRegression) Name() string    { return ModelLinear }
+func (m *LinearRegression) MinSamples() int { return 3 }
+
+// Fit keeps a running least-squares line so that, like the smoothing
+// models, each sample from the third on is scored against the line fitted on
+// the samples before it
+func (m *LinearRegression) Fit(series []float64) float64 {
+	m.n = len(series)
+	var sumX, sumY, sumXY, sumXX, sse float64
+	for i, y := range series {
+		x := float64(i)
+		if i >= 2 {
+			slope, intercept := fitLine(float64(i), sumX, sumY, sumXY, sumXX)
+			d := y - (intercept + slope*x)
+			sse += d * d
+		}
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+	m.slope, m.intercept = fitLine(float64(m.n), sumX, sumY, sumXY, sumXX)
+	return rmse(sse, m.n-2)
+}
+
+// fitLine returns the least-squares line through n points from their sums
+func fitLine(n, sumX, sumY, sumXY, sumXX float64) (slope, intercept float64) {
+	if denom := n*sumXX - sumX*sumX; denom != 0 {
+		slope = (n*sumXY - sumX*sumY) / denom
+	}
+	return slope, (sumY - slope*sumX) / n
+}
+
+func (m *LinearRegression) Predict(h int) float64 {
+	return m.intercept + m.slope*float64(m.n-1+h)
+}
+
+// HoltWinters is additive triple exponential smoothing with a fixed season
+// length, e.g. one day of buckets
+type HoltWinters struct {
+	Alpha, Beta, Gamma float64
+	SeasonLength       int
+
+	level, trend float64
+	seasonal     []float64
+	n            int
+}
+
+func (m *HoltWinters) Name() string    { return ModelHoltWinters }
+func (m *HoltWinters) MinSamples() int { return 2 * m.SeasonLength }
+
+func (m *HoltWinters) Fit(series []float64) float64 {
+	L := m.SeasonLength
+	m.n = len(series)
+
+	// Initialise from the first two seasons
+	first, second := mean(series[:L]), mean(series[L:2*L])
+	m.level = first
+	m.trend = (second - first) / float64(L)
+	m.seasonal = make([]float64, L)
+	for i := 0; i < L; i++ {
+		m.seasonal[i] = series[i] - first
+	}
+
+	var sse float64
+	for t := L; t < m.n; t++ {
+		x := series[t]
+		s := m.seasonal[t%L]
+		predicted := m.level + m.trend + s
+		sse += (x - predicted) * (x - predicted)
+
+		lastLevel := m.level
+		m.level = m.Alpha*(x-s) + (1-m.Alpha)*(m.level+m.trend)
+		m.trend = m.Beta*(m.level-lastLevel) + (1-m.Beta)*m.trend
+		m.seasonal[t%L] = m.Gamma*(x-m.level) + (1-m.Gamma)*s
+	}
+	return rmse(sse, m.n-L)
+}
+
+func (m *HoltWinters) Predict(h int) float64 {
+	return m.level + float64(h)*m.trend + m.seasonal[(m.n-1+h)%m.SeasonLength]
+}
+
+// ForecastResult is the prediction of a series over a future window
+type ForecastResult struct {
+	Model      string
+	Average    float64
+	Peak       float64
+	Min        float64
+	Last       float64
+	Confidence int
+}
+
+// forecastWindow fits the requested model (or, for "auto", the applicable
+// model with the lowest one-step-ahead error) on points and predicts the values
+// between startTs and endTs. It returns false when there is not enough
+// history for any model.
+func forecastWindow(points []Point, model string, step, startTs, endTs int64, params ForecastParams) (*ForecastResult, bool) {
+	series, lastTs := resample(points, step)
+	if len(series) == 0 {
+		return nil, false
+	}
+
+	// Explicit models are tried in order of preference; "auto" keeps the
+	// applicable model with the lowest one-step-ahead error
+	var best Forecaster
+	bestErr := math.Inf(1)
+	for _, f := range params.candidates(model, step) {
+		if len(series) < f.MinSamples() {
+			continue
+		}
+		if err := f.Fit(series); err < bestErr {
+			best, bestErr = f, err
+		}
+		if model != ModelAuto {
+			break
+		}
+	}
+	if best == nil {
+		return nil, false
+	}
+
+	first := int((startTs - lastTs + step - 1) / step)
+	if first < 1 {
+		first = 1
+	}
+	last := int((endTs - lastTs + step - 1) / step)
+	if last < first {
+		last = first
+	}
+
+	result := &ForecastResult{Model: best.Name(), Last: series[len(series)-1], Peak: math.Inf(-1), Min: math.Inf(1)}
+	for h := first; h <= last; h++ {
+		v := best.Predict(h)
+		result.Average += v
+		result.Peak = math.Max(result.Peak, v)
+		result.Min = math.Min(result.Min, v)
+	}
+	result.Average /= float64(last - first + 1)
+	result.Confidence = confidence(bestErr, mean(series), (first+last)/2, len(series), best.MinSamples())
+	return result, true
+}
+
+// confidence turns the model error into a 0..100 score. It drops as the
+// relative error grows, as the horizon gets longer and when the model has
+// barely enough history.
+func confidence(modelErr, level float64, horizon, samples, minSamples int) int {
+	scale := math.Max(math.Abs(level), 1e-6)
+	relErr := modelErr / scale * math.Sqrt(float64(horizon))
+	c := 1 / (1 + relErr)
+
+	// Full weight once the model has three times its minimum history
+	if needed := 3 * math.Max(float64(minSamples), 3); float64(samples) < needed {
+		c *= float64(samples) / needed
+	}
+	return int(math.Round(c * 100))
+}
+
+// ForecastParams holds the smoothing factors of the built-in models
+type ForecastParams struct {
+	EwmaAlpha float64 `json:"ewmaAlpha"`
+	HwAlpha   float64 `json:"hwAlpha"`
+	HwBeta    float64 `json:"hwBeta"`
+	HwGamma   float64 `json:"hwGamma"`
+}
+
+func forecastParams(f factory.ForecastConfig) ForecastParams {
+	return ForecastParams{
+		EwmaAlpha: f.EwmaAlpha,
+		HwAlpha:   f.HoltWinters.Alpha,
+		HwBeta:    f.HoltWinters.Beta,
+		HwGamma:   f.HoltWinters.Gamma,
+	}
+}
+
+func (p ForecastParams) candidates(model string, step int64) []Forecaster {
+	ewma := &EWMA{Alpha: p.EwmaAlpha}
+	linear := &LinearRegression{}
+
+	var seasonal []Forecaster
+	if seasonLength := int(secondsPerDay / step); seasonLength >= 2 {
+		seasonal = append(seasonal, &HoltWinters{Alpha: p.HwAlpha, Beta: p.HwBeta, Gamma: p.HwGamma, SeasonLength: seasonLength})
+	}
+
+	switch model {
+	case ModelEWMA:
+		return []Forecaster{ewma}
+	case ModelLinear:
+		return []Forecaster{linear}
+	case ModelHoltWinters:
+		// Fall back to a trend model until two days of history exist
+		return append(seasonal, linear)
+	default:
+		return append(seasonal, linear, ewma)
+	}
+}
+
+func mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+func rmse(sse float64, n int) float64 {
+	if n <= 0 {
+		return 0
+	}
+	return math.Sqrt(sse / float64(n))
+}
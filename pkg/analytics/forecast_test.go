@@ -0,0 +1,138 @@
+package analytics
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/free5gc/nwdaf/pkg/clock"
+	nwdafContext "github.com/free5gc/nwdaf/pkg/context"
+)
+
+var testParams = ForecastParams{EwmaAlpha: 0.3, HwAlpha: 0.3, HwBeta: 0.05, HwGamma: 0.2}
+
+func TestLinearForecast(t *testing.T) {
+	var points []Point
+	for i := 0; i < 10; i++ {
+		points = append(points, Point{Ts: int64(i * 60), Value: 0.1 + 0.05*float64(i)})
+	}
+
+	// Next step after the last sample (ts 540) is ts 600
+	result, ok := forecastWindow(points, ModelLinear, 60, 600, 600, testParams)
+	if !ok {
+		t.Fatal("Expected a forecast")
+	}
+	if math.Abs(result.Average-0.6) > 1e-9 {
+		t.Errorf("Expected 0.6, got %f", result.Average)
+	}
+	if result.Confidence < 90 {
+		t.Errorf("Expected high confidence for a perfect fit, got %d", result.Confidence)
+	}
+}
+
+func TestLinearOneStepError(t *testing.T) {
+	// A line fitted on the whole series passes close to the final jump; the
+	// samples before it predicted a flat series
+	m := &LinearRegression{}
+	if err := m.Fit([]float64{0, 0, 0, 0, 10}); math.Abs(err-math.Sqrt(100.0/3)) > 1e-9 {
+		t.Errorf("Expected the one-step-ahead error of the jump, got %f", err)
+	}
+	if err := m.Fit([]float64{1, 2, 3, 4, 5}); err > 1e-9 {
+		t.Errorf("Expected no error on a line, got %f", err)
+	}
+}
+
+func TestHoltWintersDailySeasonality(t *testing.T) {
+	// Three days of hourly samples peaking at noon
+	var points []Point
+	for h := 0; h < 72; h++ {
+		value := 0.5 + 0.3*math.Sin(2*math.Pi*float64(h%24-6)/24)
+		points = append(points, Point{Ts: int64(h * 3600), Value: value})
+	}
+
+	last := points[len(points)-1].Ts
+	noon := last + 13*3600
+	result, ok := forecastWindow(points, ModelHoltWinters, 3600, noon, noon, testParams)
+	if !ok {
+		t.Fatal("Expected a forecast")
+	}
+	if result.Model != ModelHoltWinters {
+		t.Fatalf("Expected holt-winters, got %s", result.Model)
+	}
+	if math.Abs(result.Average-0.8) > 0.05 {
+		t.Errorf("Expected the noon peak near 0.8, got %f", result.Average)
+	}
+}
+
+func TestForecastFallback(t *testing.T) {
+	points := []Point{{Ts: 0, Value: 0.4}, {Ts: 60, Value: 0.5}}
+
+	// Not enough history for holt-winters or linear regression
+	if _, ok := forecastWindow(points, ModelHoltWinters, 60, 120, 120, testParams); ok {
+		t.Error("Expected no holt-winters forecast from two samples")
+	}
+
+	result, ok := forecastWindow(points, ModelAuto, 60, 120, 120, testParams)
+	if !ok || result.Model != ModelEWMA {
+		t.Fatalf("Expected auto to fall back to ewma, got %+v", result)
+	}
+}
+
+func TestPredictNFLoad(t *testing.T) {
+	ctx := &nwdafContext.NWDAFContext{DataStore: nwdafContext.NewDataStore()}
+	engine := NewAnalyticsEngine(ctx)
+
+	now := time.Unix(1700003600, 0)
+	engine.SetClock(clock.NewVirtual(now, 1))
+
+	// Load rising steadily over the last hour
+	for i := 0; i <= 12; i++ {
+		ctx.UpdateNFStatistics("smf-1", &nwdafContext.NFStatistics{
+			NFInstanceId: "smf-1",
+			NFType:       "SMF",
+			Load:         0.2 + 0.05*float64(i),
+			Timestamp:    now.Unix() - 3600 + int64(i*300),
+		})
+	}
+
+	predictions := engine.predictNFLoad(&EventFilter{}, now.Unix(), now.Unix()+900)
+	if len(predictions) != 1 {
+		t.Fatalf("Expected one prediction, got %d", len(predictions))
+	}
+	if p := predictions[0]; p.Trend != TrendIncreasing || p.NfLoadLevelAverage <= 80 {
+		t.Errorf("Expected an increasing load above 80%%, got %+v", p)
+	}
+}
+
+func TestPredictNetworkPerformance(t *testing.T) {
+	ctx := &nwdafContext.NWDAFContext{DataStore: nwdafContext.NewDataStore()}
+	engine := NewAnalyticsEngine(ctx)
+
+	now := time.Unix(1700003600, 0)
+	engine.SetClock(clock.NewVirtual(now, 1))
+
+	// Throughput rising steadily over the last hour
+	for i := 0; i <= 12; i++ {
+		ctx.UpdateUEStatistics("imsi-1", &nwdafContext.UEStatistics{
+			SUPI:       "imsi-1",
+			Location:   "tai-1",
+			Latency:    10,
+			Throughput: 100 + 10*float64(i),
+			Timestamp:  now.Unix() - 3600 + int64(i*300),
+		})
+	}
+
+	predictions := engine.predictNetworkPerformance(&EventFilter{}, now.Unix(), now.Unix()+900)
+	if len(predictions) != 1 || predictions[0].AverageThroughput <= 220 {
+		t.Fatalf("Expected the throughput trend extrapolated above 220, got %+v", predictions)
+	}
+
+	// A trained model of the metric takes over from the configured one
+	engine.models.set(&ModelFile{EventId: "NETWORK_PERFORMANCE", Version: 1, Models: map[string]*TrainedModel{
+		"tai-1/throughput": {Model: ModelEWMA, Params: ForecastParams{EwmaAlpha: 0.1}},
+	}})
+	predictions = engine.predictNetworkPerformance(&EventFilter{}, now.Unix(), now.Unix()+900)
+	if len(predictions) != 1 || predictions[0].AverageThroughput >= 220 {
+		t.Errorf("Expected the smoothed throughput of the trained model below 220, got %+v", predictions)
+	}
+}
@@ -0,0 +1,208 @@
+package analytics
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/free5gc/nwdaf/internal/logger"
+	nwdafContext "github.com/free5gc/nwdaf/pkg/context"
+	"github.com/free5gc/nwdaf/pkg/factory"
+)
+
+// PrevSubInfo identifies the subscription a transferred subscription
+// replaces (TS 29.520 PrevSubInfo)
+type PrevSubInfo struct {
+	ProducerId     string `json:"producerId,omitempty"`
+	SubscriptionId string `json:"subscriptionId"`
+}
+
+// SubscriptionTransferNotification tells a consumer that its subscription
+// moved to another NWDAF (TS 29.520 NnwdafEventsSubscriptionNotification with
+// subsTransInd)
+type SubscriptionTransferNotification struct {
+	SubscriptionId    string `json:"subscriptionId"`
+	OldSubscriptionId string `json:"oldSubscriptionId"`
+	// ResourceUri is the subscription at the new NWDAF
+	ResourceUri  string `json:"resourceUri"`
+	SubsTransInd bool   `json:"subsTransInd"`
+	EventType    string `json:"eventType"`
+	Timestamp    int64  `json:"timestamp"`
+}
+
+// SubscriptionTransferResult is the outcome of moving one subscription
+type SubscriptionTransferResult struct {
+	SubscriptionId       string `json:"subscriptionId"`
+	TargetSubscriptionId string `json:"targetSubscriptionId,omitempty"`
+	// ConsumerNotified is false when the consumer could not be told; the
+	// subscription is moved all the same
+	ConsumerNotified bool   `json:"consumerNotified"`
+	Error            string `json:"error,omitempty"`
+}
+
+// SubscriptionTransferSummary reports a subscription transfer
+type SubscriptionTransferSummary struct {
+	TargetUri string                        `json:"targetUri"`
+	Results   []*SubscriptionTransferResult `json:"results"`
+	// Context is what the target imported of the UEs the moved subscriptions
+	// target, or ContextError why it could not
+	Context      *ContextImportSummary `json:"context,omitempty"`
+	ContextError string                `json:"contextError,omitempty"`
+}
+
+// ErrUnknownPeer is returned when a transfer names no known target NWDAF
+var ErrUnknownPeer = errors.New("unknown target NWDAF")
+
+// ResolvePeerUri returns the API root of a target NWDAF given by URI or by
+// the NF instance ID of a known peer
+func (e *AnalyticsEngine) ResolvePeerUri(uri, nfInstanceId string) (string, error) {
+	if uri != "" {
+		return strings.TrimRight(uri, "/"), nil
+	}
+	for _, p := range e.Peers() {
+		if nfInstanceId != "" && p.NfInstanceId == nfInstanceId {
+			return p.Uri, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %q", ErrUnknownPeer, nfInstanceId)
+}
+
+// TransferSubscriptions moves subscriptions to the NWDAF at targetUri, e.g.
+// to drain this instance (TS 23.288 §6.1B analytics subscription transfer).
+// With no IDs every subscription is moved. The context of the UEs the
+// subscriptions target is transferred first, so that they keep their history
+// at the target; when that fails they stay here. Each subscription is then
+// created at the target, which keeps its ID when free; only once the target
+// accepted it is the consumer notified of the new subscription and the local
+// one removed. The subscriptions the target imported with the context are
+// already handed over when it acknowledges the import.
+func (e *AnalyticsEngine) TransferSubscriptions(targetUri string, ids []string) *SubscriptionTransferSummary {
+	summary := &SubscriptionTransferSummary{TargetUri: targetUri, Results: make([]*SubscriptionTransferResult, 0)}
+
+	e.context.SubMutex.RLock()
+	var subs []*nwdafContext.AnalyticsSubscription
+	for id, sub := range e.context.Subscriptions {
+		if len(ids) == 0 || slices.Contains(ids, id) {
+			copied := *sub
+			subs = append(subs, &copied)
+		}
+	}
+	e.context.SubMutex.RUnlock()
+	slices.SortFunc(subs, func(a, b *nwdafContext.AnalyticsSubscription) int {
+		return strings.Compare(a.SubscriptionId, b.SubscriptionId)
+	})
+	for _, id := range ids {
+		if !slices.ContainsFunc(subs, func(s *nwdafContext.AnalyticsSubscription) bool { return s.SubscriptionId == id }) {
+			summary.Results = append(summary.Results, &SubscriptionTransferResult{SubscriptionId: id, Error: "subscription not found"})
+		}
+	}
+
+	var supis []string
+	for _, sub := range subs {
+		for _, supi := range subscriptionSupis(sub) {
+			if !slices.Contains(supis, supi) {
+				supis = append(supis, supi)
+			}
+		}
+	}
+	if len(supis) > 0 {
+		req := map[string]interface{}{
+			"sourceUri": factory.NwdafConfig.Configuration.GetSbiUri(),
+			"supis":     supis,
+		}
+		var imported ContextImportSummary
+		if err := e.postJSON(targetUri+AnalyticsInfoPath+"/context-transfer", req, &imported); err != nil {
+			logger.AnalyticsLog.Warnf("Context transfer to %s failed, keeping the UE subscriptions: %v", targetUri, err)
+			summary.ContextError = err.Error()
+		} else {
+			summary.Context = &imported
+		}
+	}
+
+	// The subscriptions imported with the context were handed over as the
+	// target acknowledged them
+	handedOver := make(map[string]*SubscriptionTransferResult)
+	if summary.Context != nil {
+		for _, result := range summary.Context.Transferred {
+			if result != nil && result.Error == "" {
+				handedOver[result.SubscriptionId] = result
+			}
+		}
+	}
+	for _, sub := range subs {
+		if result, ok := handedOver[sub.SubscriptionId]; ok {
+			summary.Results = append(summary.Results, result)
+			continue
+		}
+		if summary.ContextError != "" && len(subscriptionSupis(sub)) > 0 {
+			summary.Results = append(summary.Results, &SubscriptionTransferResult{
+				SubscriptionId: sub.SubscriptionId,
+				Error:          "context transfer failed: " + summary.ContextError,
+			})
+			continue
+		}
+		summary.Results = append(summary.Results, e.transferSubscription(targetUri, sub))
+	}
+	return summary
+}
+
+// subscriptionSupis returns the UEs a subscription targets
+func subscriptionSupis(sub *nwdafContext.AnalyticsSubscription) []string {
+	f, err := ParseFilter(sub.AnalyticsFilter)
+	if err != nil {
+		return nil
+	}
+	return f.Supis
+}
+
+// transferSubscription creates one subscription at the target, then notifies
+// its consumer and removes it locally
+func (e *AnalyticsEngine) transferSubscription(targetUri string, sub *nwdafContext.AnalyticsSubscription) *SubscriptionTransferResult {
+	result := &SubscriptionTransferResult{SubscriptionId: sub.SubscriptionId}
+	req := map[string]interface{}{
+		"eventType":       sub.EventType,
+		"consumerNfId":    sub.ConsumerNfId,
+		"notificationUri": sub.NotificationUri,
+		"analyticsFilter": sub.AnalyticsFilter,
+		"reportingPeriod": sub.ReportingPeriod,
+		"evtReq":          sub.EvtReq,
+		"prevSub":         &PrevSubInfo{ProducerId: e.context.NfId, SubscriptionId: sub.SubscriptionId},
+	}
+	var resp struct {
+		SubscriptionId string `json:"subscriptionId"`
+	}
+	if err := e.postJSON(targetUri+EventsSubscriptionPath+"/subscriptions", req, &resp); err != nil || resp.SubscriptionId == "" {
+		if err == nil {
+			err = errors.New("no subscriptionId in the reply")
+		}
+		result.Error = err.Error()
+		logger.AnalyticsLog.Warnf("Target %s refused subscription %s, keeping it: %v", targetUri, sub.SubscriptionId, err)
+		return result
+	}
+	return e.handOver(targetUri, sub, resp.SubscriptionId)
+}
+
+// handOver tells the consumer of a subscription the target now serves it as
+// targetId, then removes it locally
+func (e *AnalyticsEngine) handOver(targetUri string, sub *nwdafContext.AnalyticsSubscription, targetId string) *SubscriptionTransferResult {
+	result := &SubscriptionTransferResult{SubscriptionId: sub.SubscriptionId, TargetSubscriptionId: targetId}
+	notification := &SubscriptionTransferNotification{
+		SubscriptionId:    targetId,
+		OldSubscriptionId: sub.SubscriptionId,
+		ResourceUri:       targetUri + EventsSubscriptionPath + "/subscriptions/" + targetId,
+		SubsTransInd:      true,
+		EventType:         sub.EventType,
+		Timestamp:         e.clock.Now().Unix(),
+	}
+	if err := e.postJSON(sub.NotificationUri, notification, nil); err != nil {
+		logger.AnalyticsLog.Warnf("Consumer of subscription %s not told of the transfer: %v", sub.SubscriptionId, err)
+	} else {
+		result.ConsumerNotified = true
+	}
+
+	e.context.RemoveSubscription(sub.SubscriptionId)
+	e.UnsubscribePeers(sub.SubscriptionId)
+	logger.AnalyticsLog.Infof("Subscription %s moved to %s as %s", sub.SubscriptionId, targetUri, targetId)
+	return result
+}
@@ -0,0 +1,155 @@
+package analytics
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	nwdafContext "github.com/free5gc/nwdaf/pkg/context"
+	"github.com/free5gc/nwdaf/pkg/factory"
+)
+
+func TestTransferSubscriptions(t *testing.T) {
+	var notifications []*SubscriptionTransferNotification
+	consumer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n SubscriptionTransferNotification
+		_ = json.NewDecoder(r.Body).Decode(&n)
+		notifications = append(notifications, &n)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer consumer.Close()
+
+	// The target refuses NF_LOAD subscriptions
+	var transferred []string
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case EventsSubscriptionPath + "/subscriptions":
+			var req struct {
+				EventType string       `json:"eventType"`
+				PrevSub   *PrevSubInfo `json:"prevSub"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			if req.EventType == "NF_LOAD" || req.PrevSub == nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"subscriptionId": req.PrevSub.SubscriptionId})
+		case AnalyticsInfoPath + "/context-transfer":
+			var req struct {
+				Supis []string `json:"supis"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			transferred = req.Supis
+			_ = json.NewEncoder(w).Encode(&ContextImportSummary{Ues: len(req.Supis)})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer target.Close()
+
+	factory.NwdafConfig.Configuration.Aggregation = &factory.AggregationConfig{
+		Enabled: true,
+		Peers:   []*factory.PeerNwdaf{{NfInstanceId: "nwdaf-b", Uri: target.URL}},
+	}
+	defer func() { factory.NwdafConfig.Configuration.Aggregation = nil }()
+
+	engine := NewAnalyticsEngine(&nwdafContext.NWDAFContext{
+		NfId:          "nwdaf-a",
+		Subscriptions: make(map[string]*nwdafContext.AnalyticsSubscription),
+		DataStore:     nwdafContext.NewDataStore(),
+	})
+	engine.context.AddSubscription(&nwdafContext.AnalyticsSubscription{
+		SubscriptionId:  "ue",
+		EventType:       "UE_MOBILITY",
+		NotificationUri: consumer.URL,
+		AnalyticsFilter: map[string]interface{}{"supis": []interface{}{"imsi-1"}},
+	})
+	engine.context.AddSubscription(&nwdafContext.AnalyticsSubscription{SubscriptionId: "nf", EventType: "NF_LOAD", NotificationUri: consumer.URL})
+
+	targetUri, err := engine.ResolvePeerUri("", "nwdaf-b")
+	if err != nil || targetUri != target.URL {
+		t.Fatalf("Expected nwdaf-b resolved to %s, got %q (%v)", target.URL, targetUri, err)
+	}
+	if _, err := engine.ResolvePeerUri("", "nwdaf-x"); !errors.Is(err, ErrUnknownPeer) {
+		t.Errorf("Expected ErrUnknownPeer for an unknown NWDAF, got %v", err)
+	}
+
+	summary := engine.TransferSubscriptions(targetUri, nil)
+	if len(summary.Results) != 2 {
+		t.Fatalf("Expected 2 results, got %d", len(summary.Results))
+	}
+	// Results are ordered by subscription ID
+	refused, moved := summary.Results[0], summary.Results[1]
+	if moved.SubscriptionId != "ue" || moved.TargetSubscriptionId != "ue" || !moved.ConsumerNotified || moved.Error != "" {
+		t.Errorf("Expected the UE subscription moved under its ID and its consumer notified, got %+v", moved)
+	}
+	if refused.SubscriptionId != "nf" || refused.Error == "" {
+		t.Errorf("Expected the NF_LOAD subscription refused, got %+v", refused)
+	}
+
+	if _, ok := engine.context.GetSubscription("ue"); ok {
+		t.Error("Expected the moved subscription removed locally")
+	}
+	if _, ok := engine.context.GetSubscription("nf"); !ok {
+		t.Error("Expected the refused subscription kept locally")
+	}
+	if len(notifications) != 1 || !notifications[0].SubsTransInd || notifications[0].OldSubscriptionId != "ue" ||
+		notifications[0].ResourceUri != target.URL+EventsSubscriptionPath+"/subscriptions/ue" {
+		t.Errorf("Expected one transfer notification pointing at the target, got %+v", notifications)
+	}
+	if len(transferred) != 1 || transferred[0] != "imsi-1" || summary.Context == nil || summary.Context.Ues != 1 {
+		t.Errorf("Expected the context of imsi-1 transferred, got %v and %+v", transferred, summary.Context)
+	}
+
+	// Unknown IDs are reported
+	summary = engine.TransferSubscriptions(targetUri, []string{"gone"})
+	if len(summary.Results) != 1 || summary.Results[0].Error != "subscription not found" {
+		t.Errorf("Expected an unknown subscription reported, got %+v", summary.Results)
+	}
+}
+
+func TestTransferSubscriptionsContextFailure(t *testing.T) {
+	var created []string
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != EventsSubscriptionPath+"/subscriptions" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var req struct {
+			PrevSub *PrevSubInfo `json:"prevSub"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		created = append(created, req.PrevSub.SubscriptionId)
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"subscriptionId": req.PrevSub.SubscriptionId})
+	}))
+	defer target.Close()
+
+	engine := NewAnalyticsEngine(&nwdafContext.NWDAFContext{
+		Subscriptions: make(map[string]*nwdafContext.AnalyticsSubscription),
+		DataStore:     nwdafContext.NewDataStore(),
+	})
+	engine.context.AddSubscription(&nwdafContext.AnalyticsSubscription{
+		SubscriptionId:  "ue",
+		EventType:       "UE_MOBILITY",
+		AnalyticsFilter: map[string]interface{}{"supis": []interface{}{"imsi-1"}},
+	})
+	engine.context.AddSubscription(&nwdafContext.AnalyticsSubscription{SubscriptionId: "nf", EventType: "NF_LOAD"})
+
+	summary := engine.TransferSubscriptions(target.URL, nil)
+	if summary.ContextError == "" || summary.Context != nil {
+		t.Errorf("Expected the context transfer failure reported, got %+v", summary)
+	}
+	if len(created) != 1 || created[0] != "nf" {
+		t.Errorf("Expected only the NF subscription created at the target, got %v", created)
+	}
+	if _, ok := engine.context.GetSubscription("ue"); !ok {
+		t.Error("Expected the UE subscription kept without its context at the target")
+	}
+	if result := summary.Results[1]; result.SubscriptionId != "ue" || result.Error == "" {
+		t.Errorf("Expected the UE subscription reported as not moved, got %+v", result)
+	}
+}
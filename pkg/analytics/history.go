@@ -0,0 +1,44 @@
+package analytics
+
+import (
+	"github.com/free5gc/nwdaf/internal/logger"
+	"github.com/free5gc/nwdaf/pkg/factory"
+)
+
+func windowInfo(startTs, endTs int64) map[string]int64 {
+	return map[string]int64{"startTs": startTs, "endTs": endTs}
+}
+
+// resolveWindow returns the history window of a request. Without explicit
+// bounds the given number of seconds ending now is used. An open end is now,
+// or the default window past a start in the future; an open start is the
+// default window before the end.
+func (e *AnalyticsEngine) resolveWindow(startTs, endTs int64, defaultWindow int) (int64, int64) {
+	now := e.clock.Now().Unix()
+	switch {
+	case startTs == 0 && endTs == 0:
+		endTs = now
+		startTs = endTs - int64(defaultWindow)
+	case endTs == 0:
+		endTs = now
+		if startTs >= now {
+			endTs = startTs + int64(defaultWindow)
+		}
+	case startTs == 0:
+		startTs = endTs - int64(defaultWindow)
+	}
+	return startTs, endTs
+}
+
+// pruneHistory drops the samples older than the local retention so that the
+// history does not grow for the life of the process. Imported samples are
+// kept. With an ADRF the storage runs drop the samples once stored instead.
+func (e *AnalyticsEngine) pruneHistory() {
+	if e.adrf != nil {
+		return
+	}
+	before := e.clock.Now().Unix() - int64(factory.NwdafConfig.Configuration.GetDataRetention())
+	if dropped := e.context.PruneHistory(before); dropped > 0 {
+		logger.AnalyticsLog.Debugf("Dropped %d samples older than %d", dropped, before)
+	}
+}
@@ -0,0 +1,82 @@
+package analytics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Prometheus metrics
+var (
+	// Rolling accuracy (0..1) of the predictions of each event type and model
+	PredictionAccuracy = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "nwdaf_prediction_accuracy",
+			Help: "Rolling accuracy of checked predictions (0..1)",
+		},
+		[]string{"event_type", "model"},
+	)
+
+	// Predictions checked against observed values
+	PredictionsChecked = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "nwdaf_predictions_checked_total",
+			Help: "Total predictions checked against observed values",
+		},
+		[]string{"event_type", "model"},
+	)
+
+	// Duration of each analytics cycle, subscriptions included
+	CycleDuration = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "nwdaf_analytics_cycle_duration_seconds",
+			Help:    "Analytics cycle duration in seconds",
+			Buckets: []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1.0, 2.5, 5.0, 10.0},
+		},
+	)
+
+	// Result cache lookups by result (hit or miss)
+	CacheLookups = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "nwdaf_analytics_cache_lookups_total",
+			Help: "Total analytics result cache lookups",
+		},
+		[]string{"result"},
+	)
+
+	// Share of result cache lookups served from the cache
+	CacheHitRatio = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "nwdaf_analytics_cache_hit_ratio",
+			Help: "Analytics result cache hit ratio (0..1)",
+		},
+	)
+
+	// Version of the trained models in use for each event type
+	ModelVersion = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "nwdaf_model_version",
+			Help: "Version of the trained models in use",
+		},
+		[]string{"event_type"},
+	)
+
+	// Requests forwarded to peer NWDAFs by an aggregator, by peer and result
+	// (ok or error)
+	PeerRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "nwdaf_aggregation_peer_requests_total",
+			Help: "Total requests forwarded to peer NWDAFs",
+		},
+		[]string{"peer", "result"},
+	)
+
+	// Records stored at the ADRF, by record type (ANALYTICS or DATA) and
+	// result (ok or error)
+	ADRFRecords = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "nwdaf_adrf_records_total",
+			Help: "Total records stored at the ADRF",
+		},
+		[]string{"type", "result"},
+	)
+)
@@ -0,0 +1,377 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	nwdafContext "github.com/free5gc/nwdaf/pkg/context"
+	"github.com/free5gc/nwdaf/pkg/factory"
+)
+
+// Input data analytics modules are computed from
+const (
+	InputNFStatistics      = "NF_STATISTICS"
+	InputUEStatistics      = "UE_STATISTICS"
+	InputSliceStatistics   = "SLICE_STATISTICS"
+	InputUPFStatistics     = "UPF_STATISTICS"
+	InputDNStatistics      = "DN_STATISTICS"
+	InputServiceExperience = "AF_SERVICE_EXPERIENCE"
+)
+
+// ErrUnknownEvent is returned for event types no module is registered for
+var ErrUnknownEvent = errors.New("unsupported event type")
+
+// Module provides the analytics of one event type. Modules are registered
+// with RegisterModule; the engine, filter validation and the NRF profile are
+// driven from the registered modules.
+type Module interface {
+	// EventId is the event type served, e.g. "NF_LOAD"
+	EventId() string
+	// Filters lists the analytics filter keys the module understands
+	Filters() []string
+	// InputData lists the data the module is computed from
+	InputData() []string
+	// Validate checks that a filter carries what the module requires
+	Validate(f *EventFilter) error
+	// Analytics returns statistics for the part of [startTs, endTs] in the
+	// past and predictions for the part in the future, labelled as such. With
+	// both bounds zero the module's default window ending now is used.
+	// Windows starting before the local retention are completed from the
+	// ADRF within ctx.
+	Analytics(ctx context.Context, e *AnalyticsEngine, f *EventFilter, startTs, endTs int64) interface{}
+	// Report builds the periodic notification of a subscription, or returns
+	// nil when the module pushes its notifications itself. Subscriptions
+	// with a reporting window get the analytics of that window.
+	Report(e *AnalyticsEngine, sub *nwdafContext.AnalyticsSubscription, f *EventFilter) interface{}
+	// Merge combines the results of several NWDAFs, in their JSON form and
+	// the local one first, into one
+	Merge(results []map[string]interface{}) map[string]interface{}
+}
+
+// module implements Module with plain functions. The window handling is
+// shared: compute covers a past window, over the history it is given, and
+// predict a future one.
+type module struct {
+	eventId   string
+	filters   []string
+	inputData []string
+	validate  func(f *EventFilter) error
+	// window is the default window (seconds) ending now, the analytics
+	// window when nil
+	window  func() int
+	compute func(e *AnalyticsEngine, src nwdafContext.HistorySource, f *EventFilter, startTs, endTs int64) map[string]interface{}
+	// predict is nil for events that are not predicted
+	predict func(e *AnalyticsEngine, f *EventFilter, startTs, endTs int64) interface{}
+	// pushed modules send their notifications themselves
+	pushed bool
+	// merge tells how the results of several NWDAFs are merged
+	merge mergeRules
+}
+
+func (m *module) EventId() string     { return m.eventId }
+func (m *module) Filters() []string   { return m.filters }
+func (m *module) InputData() []string { return m.inputData }
+
+func (m *module) Validate(f *EventFilter) error {
+	if m.validate == nil {
+		return nil
+	}
+	return m.validate(f)
+}
+
+func (m *module) defaultWindow() int {
+	if m.window == nil {
+		return factory.NwdafConfig.Configuration.GetAnalyticsWindow()
+	}
+	return m.window()
+}
+
+func (m *module) Analytics(ctx context.Context, e *AnalyticsEngine, f *EventFilter, startTs, endTs int64) interface{} {
+	now := e.clock.Now().Unix()
+	startTs, endTs = e.resolveWindow(startTs, endTs, m.defaultWindow())
+
+	src := e.historySource(ctx, startTs, min(endTs, now))
+	result := m.output(e, src, f, startTs, min(endTs, now), max(startTs, now), endTs)
+	result["window"] = windowInfo(startTs, endTs)
+	result["timestamp"] = now
+	return result
+}
+
+func (m *module) Report(e *AnalyticsEngine, sub *nwdafContext.AnalyticsSubscription, f *EventFilter) interface{} {
+	if m.pushed || m.compute == nil {
+		return nil
+	}
+	if req := sub.EvtReq; req != nil && (req.StartTs != 0 || req.EndTs != 0) {
+		result := m.Analytics(context.Background(), e, f, req.StartTs, req.EndTs)
+		if r, ok := result.(map[string]interface{}); ok {
+			r["eventType"] = sub.EventType
+		}
+		return result
+	}
+
+	// Reports cover the window ending now and predict over the horizon
+	startTs, endTs := e.resolveWindow(0, 0, m.defaultWindow())
+	horizon := int64(factory.NwdafConfig.Configuration.GetForecast().Horizon)
+	result := m.output(e, e.context, f, startTs, endTs, endTs, endTs+horizon)
+	result["eventType"] = sub.EventType
+	result["window"] = windowInfo(startTs, endTs)
+	result["timestamp"] = endTs
+	return result
+}
+
+func (m *module) Merge(results []map[string]interface{}) map[string]interface{} {
+	return m.merge.merge(results)
+}
+
+// output computes the statistics over [statsStart, statsEnd] from src and the
+// predictions over [predStart, predEnd], skipping empty windows, and labels
+// the result accordingly
+func (m *module) output(e *AnalyticsEngine, src nwdafContext.HistorySource, f *EventFilter, statsStart, statsEnd, predStart, predEnd int64) map[string]interface{} {
+	result := make(map[string]interface{})
+	if statsEnd > statsStart && m.compute != nil {
+		for key, value := range m.compute(e, src, f, statsStart, statsEnd) {
+			result[key] = value
+		}
+	}
+	if predEnd > predStart && m.predict != nil {
+		result["predictions"] = m.predict(e, f, predStart, predEnd)
+	}
+	labelOutput(result, statsStart, statsEnd, predStart, predEnd)
+	return result
+}
+
+var (
+	modulesMu sync.RWMutex
+	modules   = make(map[string]Module)
+)
+
+// RegisterModule makes a module available for its event type. It panics if
+// the event type is already registered.
+func RegisterModule(m Module) {
+	modulesMu.Lock()
+	defer modulesMu.Unlock()
+	if _, ok := modules[m.EventId()]; ok {
+		panic("analytics: module registered twice for " + m.EventId())
+	}
+	modules[m.EventId()] = m
+}
+
+// LookupModule returns the module serving an event type
+func LookupModule(eventId string) (Module, bool) {
+	modulesMu.RLock()
+	defer modulesMu.RUnlock()
+	m, ok := modules[eventId]
+	return m, ok
+}
+
+// Modules returns the registered modules ordered by event type
+func Modules() []Module {
+	modulesMu.RLock()
+	defer modulesMu.RUnlock()
+	result := make([]Module, 0, len(modules))
+	for _, m := range modules {
+		result = append(result, m)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].EventId() < result[j].EventId() })
+	return result
+}
+
+// EventIds returns the registered event types in order
+func EventIds() []string {
+	ids := make([]string, 0)
+	for _, m := range Modules() {
+		ids = append(ids, m.EventId())
+	}
+	return ids
+}
+
+// Filter keys shared by several modules
+var (
+	nfFilters   = []string{FilterNfTypes, FilterNfInstanceIds}
+	areaFilters = []string{FilterTais, FilterAreasOfInterest}
+	ueFilters   = []string{FilterSupis, FilterIntGroupIds}
+	flowFilters = []string{FilterSnssais, FilterDnns, FilterAppIds}
+)
+
+func init() {
+	for _, m := range []*module{
+		{
+			eventId:   "NF_LOAD",
+			filters:   append([]string{FilterSnssais, FilterTais}, nfFilters...),
+			inputData: []string{InputNFStatistics},
+			window:    func() int { return factory.NwdafConfig.Configuration.GetNfLoadWindow() },
+			compute: func(e *AnalyticsEngine, src nwdafContext.HistorySource, f *EventFilter, startTs, endTs int64) map[string]interface{} {
+				return map[string]interface{}{"nfLoadLevelInfos": e.computeNFLoad(src, f, startTs, endTs)}
+			},
+			predict: func(e *AnalyticsEngine, f *EventFilter, startTs, endTs int64) interface{} {
+				return e.predictNFLoad(f, startTs, endTs)
+			},
+			merge: mergeRules{
+				identity: []string{"nfInstanceId"},
+				weight:   []string{"samples"},
+				sum:      baseSum,
+				lowest:   baseLowest,
+				highest:  join(baseHighest, []string{"nfLoadLevelpeak"}),
+			},
+		},
+		{
+			eventId:   "NETWORK_PERFORMANCE",
+			filters:   join(areaFilters, ueFilters, flowFilters, nfFilters),
+			inputData: []string{InputUEStatistics, InputNFStatistics},
+			compute:   (*AnalyticsEngine).computeNetworkPerformance,
+			predict: func(e *AnalyticsEngine, f *EventFilter, startTs, endTs int64) interface{} {
+				return e.predictNetworkPerformance(f, startTs, endTs)
+			},
+			merge: mergeRules{
+				identity: []string{"tai", "areaOfInterest"},
+				weight:   []string{"samples", "ueCount"},
+				sum:      join(baseSum, []string{"ueCount"}),
+				lowest:   baseLowest,
+				highest:  baseHighest,
+			},
+		},
+		{
+			eventId:   "SLICE_LOAD",
+			filters:   []string{FilterSnssais},
+			inputData: []string{InputSliceStatistics},
+			compute: func(e *AnalyticsEngine, src nwdafContext.HistorySource, f *EventFilter, startTs, endTs int64) map[string]interface{} {
+				return map[string]interface{}{"sliceStatistics": e.computeSliceLoad(src, f, startTs, endTs)}
+			},
+			predict: func(e *AnalyticsEngine, f *EventFilter, startTs, endTs int64) interface{} {
+				return e.predictSliceLoad(f, startTs, endTs)
+			},
+			merge: mergeRules{
+				identity: []string{"snssai"},
+				weight:   []string{"samples"},
+				sum:      baseSum,
+				lowest:   baseLowest,
+				highest:  join(baseHighest, []string{"peakResourceUsage"}),
+			},
+		},
+		{
+			eventId:   "UE_MOBILITY",
+			filters:   ueFilters,
+			inputData: []string{InputUEStatistics},
+			validate:  validateUEMobilityFilter,
+			compute:   (*AnalyticsEngine).computeUEMobility,
+			predict: func(e *AnalyticsEngine, f *EventFilter, startTs, endTs int64) interface{} {
+				return e.predictUEMobility(f, startTs, endTs)
+			},
+			merge: mergeRules{
+				identity: []string{"supi", "intGroupId", "tai", "enterTs"},
+				weight:   []string{"visits", "ueCount"},
+				sum:      join(baseSum, []string{"ueCount", "visits", "dwellTime"}),
+				lowest:   join(baseLowest, []string{"enterTs"}),
+				highest:  join(baseHighest, []string{"exitTs"}),
+			},
+		},
+		{
+			eventId:   "ABNORMAL_BEHAVIOUR",
+			filters:   append([]string{FilterExcepIds}, ueFilters...),
+			inputData: []string{InputUEStatistics},
+			compute:   (*AnalyticsEngine).computeAbnormalBehaviour,
+			// Abnormal behaviour is not predicted, and detections are pushed
+			// as they happen by onUEStatistics
+			pushed: true,
+			merge: mergeRules{
+				identity: []string{"intGroupId", "excep"},
+				weight:   []string{"ueCount"},
+				sum:      join(baseSum, []string{"ueCount"}),
+				lowest:   baseLowest,
+				highest:  baseHighest,
+			},
+		},
+		{
+			eventId:   "QOS_SUSTAINABILITY",
+			filters:   join([]string{FilterFiveQis, FilterRanUeThrouThd, FilterQosRequ}, areaFilters, ueFilters, flowFilters, nfFilters),
+			inputData: []string{InputUEStatistics, InputNFStatistics},
+			validate:  validateQosSustainabilityFilter,
+			compute: func(e *AnalyticsEngine, src nwdafContext.HistorySource, f *EventFilter, startTs, endTs int64) map[string]interface{} {
+				return map[string]interface{}{"qosSustainInfos": e.computeQosSustainability(src, f, startTs, endTs)}
+			},
+			predict: func(e *AnalyticsEngine, f *EventFilter, startTs, endTs int64) interface{} {
+				return e.predictQosSustainability(f, startTs, endTs)
+			},
+			merge: mergeRules{
+				identity: []string{"5qi", "tai", "areaOfInterest"},
+				sum:      baseSum,
+				lowest:   join(baseLowest, []string{"minThroughput"}),
+				highest:  join(baseHighest, []string{"nfLoadLevelpeak"}),
+			},
+		},
+		{
+			eventId:   "SERVICE_EXPERIENCE",
+			filters:   join([]string{FilterTais}, ueFilters, flowFilters),
+			inputData: []string{InputUEStatistics, InputServiceExperience},
+			compute: func(e *AnalyticsEngine, src nwdafContext.HistorySource, f *EventFilter, startTs, endTs int64) map[string]interface{} {
+				return map[string]interface{}{"serviceExperienceInfos": e.computeServiceExperience(src, f, startTs, endTs)}
+			},
+			predict: func(e *AnalyticsEngine, f *EventFilter, startTs, endTs int64) interface{} {
+				return e.predictServiceExperience(f, startTs, endTs)
+			},
+			merge: mergeRules{
+				identity: []string{"appId", "snssai"},
+				weight:   []string{"samples", "ueCount"},
+				sum:      join(baseSum, []string{"ueCount", "calibrationSamples"}),
+				lowest:   join(baseLowest, []string{"lowerRange"}),
+				highest:  join(baseHighest, []string{"upperRange"}),
+			},
+		},
+		{
+			eventId:   "USER_DATA_CONGESTION",
+			filters:   join([]string{FilterCongTypes}, areaFilters, nfFilters),
+			inputData: []string{InputUPFStatistics, InputNFStatistics},
+			compute: func(e *AnalyticsEngine, src nwdafContext.HistorySource, f *EventFilter, startTs, endTs int64) map[string]interface{} {
+				return map[string]interface{}{"userDataCongestionInfos": e.computeUserDataCongestion(src, f, startTs, endTs)}
+			},
+			predict: func(e *AnalyticsEngine, f *EventFilter, startTs, endTs int64) interface{} {
+				return e.predictUserDataCongestion(f, startTs, endTs)
+			},
+			merge: mergeRules{
+				identity: []string{"tai", "areaOfInterest", "congType"},
+				sum:      baseSum,
+				lowest:   baseLowest,
+				highest:  join(baseHighest, []string{"peakRate", "peakUtilization"}),
+			},
+		},
+		{
+			eventId:   "DN_PERFORMANCE",
+			filters:   []string{FilterDnais, FilterAppServerAddrs, FilterAppIds, FilterDnns, FilterNfInstanceIds},
+			inputData: []string{InputDNStatistics, InputNFStatistics},
+			compute: func(e *AnalyticsEngine, src nwdafContext.HistorySource, f *EventFilter, startTs, endTs int64) map[string]interface{} {
+				servers, dnais := e.computeDNPerformance(src, f, startTs, endTs)
+				return map[string]interface{}{"dnPerfInfos": servers, "dnaiPerfInfos": dnais}
+			},
+			predict: func(e *AnalyticsEngine, f *EventFilter, startTs, endTs int64) interface{} {
+				servers, dnais := e.predictDNPerformance(f, startTs, endTs)
+				return map[string]interface{}{"dnPerfInfos": servers, "dnaiPerfInfos": dnais}
+			},
+			merge: mergeRules{
+				identity: []string{"dnai", "appServerInsAddr", "appId", "upfId"},
+				weight:   []string{"samples"},
+				sum:      join(baseSum, []string{"appServers"}),
+				lowest:   baseLowest,
+				highest:  join(baseHighest, []string{"maxTrafficRate", "maxPacketDelay", "loadLevelPeak"}),
+			},
+		},
+	} {
+		RegisterModule(m)
+	}
+}
+
+// join concatenates filter key lists
+func join(lists ...[]string) []string {
+	var keys []string
+	for _, l := range lists {
+		keys = append(keys, l...)
+	}
+	return keys
+}
+
+// unknownEvent wraps ErrUnknownEvent with the event type
+func unknownEvent(eventType string) error {
+	return fmt.Errorf("%w: %q", ErrUnknownEvent, eventType)
+}
@@ -0,0 +1,72 @@
+package analytics
+
+import (
+	"errors"
+	"testing"
+
+	nwdafContext "github.com/free5gc/nwdaf/pkg/context"
+)
+
+func TestModuleRegistry(t *testing.T) {
+	ids := EventIds()
+	for _, want := range []string{"NF_LOAD", "NETWORK_PERFORMANCE", "UE_MOBILITY", "ABNORMAL_BEHAVIOUR", "DN_PERFORMANCE"} {
+		if !matchesAny(ids, want) {
+			t.Errorf("Expected %s to be registered, got %v", want, ids)
+		}
+	}
+	for i := 1; i < len(ids); i++ {
+		if ids[i-1] >= ids[i] {
+			t.Errorf("Expected event types in order, got %v", ids)
+		}
+	}
+
+	m, ok := LookupModule("NF_LOAD")
+	if !ok || len(m.InputData()) == 0 || m.InputData()[0] != InputNFStatistics {
+		t.Errorf("Expected NF_LOAD to be computed from NF statistics")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected registering NF_LOAD twice to panic")
+		}
+	}()
+	RegisterModule(&module{eventId: "NF_LOAD"})
+}
+
+func TestValidateFilter(t *testing.T) {
+	tests := []struct {
+		name      string
+		eventType string
+		filter    map[string]interface{}
+		wantError bool
+	}{
+		{"Known event without filter", "NF_LOAD", nil, false},
+		{"Supported filter", "NF_LOAD", map[string]interface{}{"nfType": "AMF"}, false},
+		{"Unknown event", "UNKNOWN", nil, true},
+		{"Unsupported filter", "NF_LOAD", map[string]interface{}{"supis": "imsi-1"}, true},
+		{"Missing required target", "UE_MOBILITY", map[string]interface{}{}, true},
+		{"Slice filter", "SLICE_LOAD", map[string]interface{}{"snssai": "1-010203"}, false},
+		{"Unsupported slice filter", "SLICE_LOAD", map[string]interface{}{"tais": "tai-1"}, true},
+		{"Malformed filter", "NF_LOAD", map[string]interface{}{"nfTypes": 1.0}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateFilter(tt.eventType, tt.filter)
+			if (err != nil) != tt.wantError {
+				t.Errorf("ValidateFilter() error = %v, wantError %v", err, tt.wantError)
+			}
+		})
+	}
+
+	if err := ValidateFilter("UNKNOWN", nil); !errors.Is(err, ErrUnknownEvent) {
+		t.Errorf("Expected ErrUnknownEvent, got %v", err)
+	}
+}
+
+func TestGetAnalyticsUnknownEvent(t *testing.T) {
+	engine := NewAnalyticsEngine(&nwdafContext.NWDAFContext{DataStore: nwdafContext.NewDataStore()})
+	if _, err := engine.GetAnalyticsInWindow("UNKNOWN", nil, 0, 0); !errors.Is(err, ErrUnknownEvent) {
+		t.Errorf("Expected ErrUnknownEvent, got %v", err)
+	}
+}
@@ -0,0 +1,293 @@
+package analytics
+
+import (
+	"math"
+	"sort"
+
+	nwdafContext "github.com/free5gc/nwdaf/pkg/context"
+	"github.com/free5gc/nwdaf/pkg/factory"
+)
+
+// NF metrics feeding the success ratios of network performance analytics.
+// Samples carry the counts observed during their collection interval.
+const (
+	MetricPduSessionAttempts    = "pduSessionAttempts"
+	MetricPduSessionSuccesses   = "pduSessionSuccesses"
+	MetricRegistrationAttempts  = "registrationAttempts"
+	MetricRegistrationSuccesses = "registrationSuccesses"
+)
+
+// NetworkPerfInfo is the network performance of one TAI or area of interest
+// (TS 23.288 §6.6.3). Success ratios are omitted when no NF serving the area
+// reported the corresponding counters.
+type NetworkPerfInfo struct {
+	Tai                      string   `json:"tai,omitempty"`
+	AreaOfInterest           string   `json:"areaOfInterest,omitempty"`
+	Tais                     []string `json:"tais,omitempty"`
+	UeCount                  int      `json:"ueCount"`
+	Samples                  int      `json:"samples"`
+	AverageLatency           float64  `json:"averageLatency"`
+	AverageThroughput        float64  `json:"averageThroughput"`
+	PacketLoss               float64  `json:"packetLoss"`
+	PduSessionSuccessRatio   *float64 `json:"pduSessionSuccessRatio,omitempty"`
+	RegistrationSuccessRatio *float64 `json:"registrationSuccessRatio,omitempty"`
+	// Confidence (0..100) is only set on predictions
+	Confidence int `json:"confidence,omitempty"`
+}
+
+// areaScope groups TAIs for area-based analytics: per named area of interest
+// when the filter lists areas of interest, otherwise per TAI, optionally
+// limited to the filter's TAIs.
+type areaScope struct {
+	tais  []string
+	areas map[string][]string
+}
+
+func newAreaScope(f *EventFilter) areaScope {
+	scope := areaScope{tais: f.Tais}
+	if len(f.AreasOfInterest) > 0 {
+		config := factory.NwdafConfig.Configuration
+		scope.areas = make(map[string][]string, len(f.AreasOfInterest))
+		for _, name := range f.AreasOfInterest {
+			// Unknown areas stay in scope with no TAIs and produce no output
+			tais, _ := config.GetAreaOfInterest(name)
+			scope.areas[name] = tais
+		}
+	}
+	return scope
+}
+
+// groups returns the output groups a TAI contributes to
+func (s areaScope) groups(tai string) []string {
+	if tai == "" {
+		return nil
+	}
+	if s.areas == nil {
+		if matchesAny(s.tais, tai) {
+			return []string{tai}
+		}
+		return nil
+	}
+	var groups []string
+	for name, tais := range s.areas {
+		if matchesAny(tais, tai) && len(tais) > 0 {
+			groups = append(groups, name)
+		}
+	}
+	return groups
+}
+
+// perfAccumulator collects the samples of one group
+type perfAccumulator struct {
+	ues                       map[string]bool
+	samples                   int
+	latency, throughput, loss float64
+	pduAttempts, pduSuccesses float64
+	regAttempts, regSuccesses float64
+
+	latencyPoints, throughputPoints, lossPoints []Point
+	pduRatioPoints, regRatioPoints              []Point
+}
+
+// accumulateNetworkPerformance collects, per area, the UE samples in scope
+// and the success counters of the NFs in scope
+func (e *AnalyticsEngine) accumulateNetworkPerformance(src nwdafContext.HistorySource, f *EventFilter, startTs, endTs int64) (areaScope, map[string]*perfAccumulator) {
+	scope := newAreaScope(f)
+	ues := newUEScope(f)
+	groups := make(map[string]*perfAccumulator)
+	get := func(name string) *perfAccumulator {
+		acc, ok := groups[name]
+		if !ok {
+			acc = &perfAccumulator{ues: make(map[string]bool)}
+			groups[name] = acc
+		}
+		return acc
+	}
+
+	for supi, samples := range src.GetUEStatisticsInWindow(startTs, endTs) {
+		if !ues.matches(supi) {
+			continue
+		}
+		for _, s := range samples {
+			if !f.matchesFlow(s) {
+				continue
+			}
+			for _, name := range scope.groups(s.Location) {
+				acc := get(name)
+				acc.ues[supi] = true
+				acc.samples++
+				acc.latency += s.Latency
+				acc.throughput += s.Throughput
+				acc.loss += s.PacketLoss
+				acc.latencyPoints = append(acc.latencyPoints, Point{s.Timestamp, s.Latency})
+				acc.throughputPoints = append(acc.throughputPoints, Point{s.Timestamp, s.Throughput})
+				acc.lossPoints = append(acc.lossPoints, Point{s.Timestamp, s.PacketLoss})
+			}
+		}
+	}
+
+	for nfId, samples := range src.GetNFStatisticsInWindow(startTs, endTs) {
+		for _, s := range samples {
+			if !f.matchesNF(nfId, s) {
+				continue
+			}
+			pduAttempts, pduSuccesses := s.Metrics[MetricPduSessionAttempts], s.Metrics[MetricPduSessionSuccesses]
+			regAttempts, regSuccesses := s.Metrics[MetricRegistrationAttempts], s.Metrics[MetricRegistrationSuccesses]
+			if pduAttempts == 0 && regAttempts == 0 {
+				continue
+			}
+			// An NF counts towards every area it serves
+			seen := make(map[string]bool)
+			for _, tai := range s.Tais {
+				for _, name := range scope.groups(tai) {
+					if seen[name] {
+						continue
+					}
+					seen[name] = true
+					acc := get(name)
+					if pduAttempts > 0 {
+						acc.pduAttempts += pduAttempts
+						acc.pduSuccesses += pduSuccesses
+						acc.pduRatioPoints = append(acc.pduRatioPoints, Point{s.Timestamp, pduSuccesses / pduAttempts})
+					}
+					if regAttempts > 0 {
+						acc.regAttempts += regAttempts
+						acc.regSuccesses += regSuccesses
+						acc.regRatioPoints = append(acc.regRatioPoints, Point{s.Timestamp, regSuccesses / regAttempts})
+					}
+				}
+			}
+		}
+	}
+
+	for _, acc := range groups {
+		for _, points := range [][]Point{acc.latencyPoints, acc.throughputPoints, acc.lossPoints, acc.pduRatioPoints, acc.regRatioPoints} {
+			sortPoints(points)
+		}
+	}
+	return scope, groups
+}
+
+func (s areaScope) newInfo(name string) *NetworkPerfInfo {
+	if s.areas != nil {
+		return &NetworkPerfInfo{AreaOfInterest: name, Tais: s.areas[name]}
+	}
+	return &NetworkPerfInfo{Tai: name}
+}
+
+func sortPerfInfos(infos []*NetworkPerfInfo) {
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].AreaOfInterest+infos[i].Tai < infos[j].AreaOfInterest+infos[j].Tai
+	})
+}
+
+// computeNetworkPerformance aggregates latency, throughput, packet loss and
+// the PDU session and registration success ratios per TAI or area of
+// interest over [startTs, endTs]. Network-wide averages are included too.
+func (e *AnalyticsEngine) computeNetworkPerformance(src nwdafContext.HistorySource, f *EventFilter, startTs, endTs int64) map[string]interface{} {
+	scope, groups := e.accumulateNetworkPerformance(src, f, startTs, endTs)
+
+	infos := make([]*NetworkPerfInfo, 0, len(groups))
+	var latency, throughput, loss float64
+	samples := 0
+	for name, acc := range groups {
+		info := scope.newInfo(name)
+		info.UeCount = len(acc.ues)
+		info.Samples = acc.samples
+		if acc.samples > 0 {
+			n := float64(acc.samples)
+			info.AverageLatency = acc.latency / n
+			info.AverageThroughput = acc.throughput / n
+			info.PacketLoss = acc.loss / n
+		}
+		if acc.pduAttempts > 0 {
+			ratio := acc.pduSuccesses / acc.pduAttempts
+			info.PduSessionSuccessRatio = &ratio
+		}
+		if acc.regAttempts > 0 {
+			ratio := acc.regSuccesses / acc.regAttempts
+			info.RegistrationSuccessRatio = &ratio
+		}
+		infos = append(infos, info)
+
+		latency += acc.latency
+		throughput += acc.throughput
+		loss += acc.loss
+		samples += acc.samples
+	}
+	sortPerfInfos(infos)
+
+	result := map[string]interface{}{
+		"networkPerfInfos": infos,
+		"samples":          samples,
+		"window":           windowInfo(startTs, endTs),
+	}
+	if samples > 0 {
+		n := float64(samples)
+		result["averageLatency"] = latency / n
+		result["averageThroughput"] = throughput / n
+		result["packetLoss"] = loss / n
+	}
+	return result
+}
+
+// predictNetworkPerformance forecasts each metric per TAI or area of interest
+// over the future window [startTs, endTs] from the training history, with the
+// trained model of the metric if there is one. The confidence of an entry is
+// that of its least certain metric.
+func (e *AnalyticsEngine) predictNetworkPerformance(f *EventFilter, startTs, endTs int64) []*NetworkPerfInfo {
+	forecast := factory.NwdafConfig.Configuration.GetForecast()
+	params := forecastParams(forecast)
+	step := int64(forecast.Step)
+
+	now := e.clock.Now().Unix()
+	scope, groups := e.accumulateNetworkPerformance(e.context, f, now-int64(forecast.History), now)
+
+	infos := make([]*NetworkPerfInfo, 0, len(groups))
+	for name, acc := range groups {
+		info := scope.newInfo(name)
+		info.UeCount = len(acc.ues)
+		confidence := math.MaxInt
+
+		ok := false
+		predict := func(metric string, points []Point) (float64, bool) {
+			if len(points) == 0 {
+				return 0, false
+			}
+			model, params := e.seriesModel("NETWORK_PERFORMANCE", name+"/"+metric, forecast.DefaultModel, params)
+			result, predicted := forecastWindow(points, model, step, startTs, endTs, params)
+			if !predicted {
+				return 0, false
+			}
+			confidence = min(confidence, result.Confidence)
+			ok = true
+			return result.Average, true
+		}
+
+		if v, predicted := predict("latency", acc.latencyPoints); predicted {
+			info.AverageLatency = math.Max(0, v)
+		}
+		if v, predicted := predict("throughput", acc.throughputPoints); predicted {
+			info.AverageThroughput = math.Max(0, v)
+		}
+		if v, predicted := predict("packetLoss", acc.lossPoints); predicted {
+			info.PacketLoss = clampLoad(v)
+		}
+		if v, predicted := predict("pduSessionSuccessRatio", acc.pduRatioPoints); predicted {
+			ratio := clampLoad(v)
+			info.PduSessionSuccessRatio = &ratio
+		}
+		if v, predicted := predict("registrationSuccessRatio", acc.regRatioPoints); predicted {
+			ratio := clampLoad(v)
+			info.RegistrationSuccessRatio = &ratio
+		}
+		if !ok {
+			continue
+		}
+		info.Confidence = confidence
+		infos = append(infos, info)
+	}
+
+	sortPerfInfos(infos)
+	return infos
+}
@@ -0,0 +1,175 @@
+package analytics
+
+import (
+	"math"
+	"sort"
+
+	nwdafContext "github.com/free5gc/nwdaf/pkg/context"
+	"github.com/free5gc/nwdaf/pkg/factory"
+)
+
+// NF load levels
+const (
+	LoadLevelLow      = "LOW"
+	LoadLevelNormal   = "NORMAL"
+	LoadLevelHigh     = "HIGH"
+	LoadLevelOverload = "OVERLOAD"
+)
+
+// NfLoadLevelInformation is the per-NF-instance output of NF load analytics
+// (TS 23.288 §6.5.3, TS 29.520 NfLoadLevelInformation). Load levels are
+// percentages.
+type NfLoadLevelInformation struct {
+	NfType             string   `json:"nfType"`
+	NfInstanceId       string   `json:"nfInstanceId"`
+	Snssais            []string `json:"snssais,omitempty"`
+	NfLoadLevelAverage int      `json:"nfLoadLevelAverage"`
+	NfLoadLevelpeak    int      `json:"nfLoadLevelpeak"`
+	NfLoadLevelStdDev  float64  `json:"nfLoadLevelStdDev"`
+	NfLoadVariance     float64  `json:"nfLoadVariance"`
+	NfLoadLevel        string   `json:"nfLoadLevel"`
+	Samples            int      `json:"samples"`
+}
+
+// Load trends of a prediction relative to the last observed load
+const (
+	TrendIncreasing = "INCREASING"
+	TrendDecreasing = "DECREASING"
+	TrendStable     = "STABLE"
+)
+
+// trendMargin is the load change (0..1) below which a trend is STABLE
+const trendMargin = 0.05
+
+// NfLoadPrediction is the predicted load of one NF instance over a future
+// window. Confidence is 0..100.
+type NfLoadPrediction struct {
+	NfType             string   `json:"nfType"`
+	NfInstanceId       string   `json:"nfInstanceId"`
+	Snssais            []string `json:"snssais,omitempty"`
+	NfLoadLevelAverage int      `json:"nfLoadLevelAverage"`
+	NfLoadLevelpeak    int      `json:"nfLoadLevelpeak"`
+	NfLoadLevel        string   `json:"nfLoadLevel"`
+	Trend              string   `json:"trend"`
+	Model              string   `json:"model"`
+	Confidence         int      `json:"confidence"`
+}
+
+// classifyLoad maps a load (0..1) onto a load level
+func classifyLoad(load float64, t factory.LoadThresholds) string {
+	switch {
+	case load >= t.Overload:
+		return LoadLevelOverload
+	case load >= t.High:
+		return LoadLevelHigh
+	case load < t.Low:
+		return LoadLevelLow
+	default:
+		return LoadLevelNormal
+	}
+}
+
+// computeNFLoad computes load average, peak and variance per NF instance over
+// [startTs, endTs], restricted to the NFs in scope of the filter.
+func (e *AnalyticsEngine) computeNFLoad(src nwdafContext.HistorySource, f *EventFilter, startTs, endTs int64) []*NfLoadLevelInformation {
+	config := factory.NwdafConfig.Configuration
+
+	infos := make([]*NfLoadLevelInformation, 0)
+	for nfId, samples := range src.GetNFStatisticsInWindow(startTs, endTs) {
+		latest := samples[len(samples)-1]
+		if !f.matchesNF(nfId, latest) {
+			continue
+		}
+
+		mean, peak, variance := loadStatistics(samples)
+		infos = append(infos, &NfLoadLevelInformation{
+			NfType:             latest.NFType,
+			NfInstanceId:       nfId,
+			Snssais:            latest.Snssais,
+			NfLoadLevelAverage: percent(mean),
+			NfLoadLevelpeak:    percent(peak),
+			NfLoadLevelStdDev:  math.Sqrt(variance) * 100,
+			NfLoadVariance:     variance,
+			NfLoadLevel:        classifyLoad(mean, config.GetNfLoadThresholds(latest.NFType)),
+			Samples:            len(samples),
+		})
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].NfInstanceId < infos[j].NfInstanceId })
+	return infos
+}
+
+// predictNFLoad forecasts the load of each NF instance in scope over the
+// future window [startTs, endTs], using its trained model or else the model
+// configured for its NF type. NF instances without enough history are left
+// out.
+func (e *AnalyticsEngine) predictNFLoad(f *EventFilter, startTs, endTs int64) []*NfLoadPrediction {
+	config := factory.NwdafConfig.Configuration
+	forecast := config.GetForecast()
+	params := forecastParams(forecast)
+
+	now := e.clock.Now().Unix()
+	predictions := make([]*NfLoadPrediction, 0)
+	for nfId, samples := range e.context.GetNFStatisticsInWindow(now-int64(forecast.History), now) {
+		latest := samples[len(samples)-1]
+		if !f.matchesNF(nfId, latest) {
+			continue
+		}
+
+		points := make([]Point, len(samples))
+		for i, s := range samples {
+			points[i] = Point{Ts: s.Timestamp, Value: s.Load}
+		}
+		model, params := e.seriesModel("NF_LOAD", nfId, config.GetForecastModel(latest.NFType), params)
+		result, ok := forecastWindow(points, model, int64(forecast.Step), startTs, endTs, params)
+		if !ok {
+			continue
+		}
+
+		average := clampLoad(result.Average)
+		trend := TrendStable
+		if average-result.Last > trendMargin {
+			trend = TrendIncreasing
+		} else if result.Last-average > trendMargin {
+			trend = TrendDecreasing
+		}
+
+		predictions = append(predictions, &NfLoadPrediction{
+			NfType:             latest.NFType,
+			NfInstanceId:       nfId,
+			Snssais:            latest.Snssais,
+			NfLoadLevelAverage: percent(average),
+			NfLoadLevelpeak:    percent(clampLoad(result.Peak)),
+			NfLoadLevel:        classifyLoad(average, config.GetNfLoadThresholds(latest.NFType)),
+			Trend:              trend,
+			Model:              result.Model,
+			Confidence:         result.Confidence,
+		})
+	}
+
+	sort.Slice(predictions, func(i, j int) bool { return predictions[i].NfInstanceId < predictions[j].NfInstanceId })
+	return predictions
+}
+
+func clampLoad(load float64) float64 {
+	return math.Max(0, math.Min(1, load))
+}
+
+func loadStatistics(samples []*nwdafContext.NFStatistics) (mean, peak, variance float64) {
+	for _, s := range samples {
+		mean += s.Load
+		if s.Load > peak {
+			peak = s.Load
+		}
+	}
+	mean /= float64(len(samples))
+	for _, s := range samples {
+		variance += (s.Load - mean) * (s.Load - mean)
+	}
+	variance /= float64(len(samples))
+	return mean, peak, variance
+}
+
+func percent(load float64) int {
+	return int(math.Round(load * 100))
+}
@@ -0,0 +1,58 @@
+package analytics
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/free5gc/nwdaf/internal/logger"
+	nwdafContext "github.com/free5gc/nwdaf/pkg/context"
+)
+
+// notificationTimeout bounds each notification POST
+const notificationTimeout = 5 * time.Second
+
+// EventNotification is the body POSTed to a subscription's notification URI
+type EventNotification struct {
+	SubscriptionId string      `json:"subscriptionId"`
+	EventType      string      `json:"eventType"`
+	Timestamp      int64       `json:"timestamp"`
+	Data           interface{} `json:"data"`
+}
+
+func (e *AnalyticsEngine) sendNotification(sub *nwdafContext.AnalyticsSubscription, analytics interface{}) {
+	logger.AnalyticsLog.Debugf("Sending notification to %s for subscription %s",
+		sub.NotificationUri, sub.SubscriptionId)
+
+	if err := e.postNotification(sub, analytics); err != nil {
+		logger.AnalyticsLog.Warnf("Notification for subscription %s failed: %v", sub.SubscriptionId, err)
+	}
+}
+
+func (e *AnalyticsEngine) postNotification(sub *nwdafContext.AnalyticsSubscription, analytics interface{}) error {
+	if sub.NotificationUri == "" {
+		return fmt.Errorf("no notification URI")
+	}
+
+	body, err := json.Marshal(EventNotification{
+		SubscriptionId: sub.SubscriptionId,
+		EventType:      sub.EventType,
+		Timestamp:      e.clock.Now().Unix(),
+		Data:           analytics,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+
+	resp, err := e.client.Post(sub.NotificationUri, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("consumer replied %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,357 @@
+package analytics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/free5gc/nwdaf/internal/logger"
+	nwdafContext "github.com/free5gc/nwdaf/pkg/context"
+	"github.com/free5gc/nwdaf/pkg/factory"
+)
+
+// Paths of the Nnwdaf_MLModelProvision service and of the notification
+// callback of its consumers
+const (
+	MLModelProvisionPath = "/nnwdaf-mlmodelprovision/v1"
+	MLModelNotifyPath    = "/mlmodel/notify"
+)
+
+const (
+	// modelRetryDelay is the first delay before a failed model subscription
+	// is tried again, and how often the subscription is checked
+	modelRetryDelay = 5 * time.Second
+	// maxModelRetryDelay bounds the delay between failed attempts
+	maxModelRetryDelay = 5 * time.Minute
+)
+
+// errModelSubscriptionGone is returned when the MTLF no longer knows the
+// model subscription, e.g. after a restart
+var errModelSubscriptionGone = errors.New("model subscription unknown to the provider")
+
+// providerState is the subscription of this NWDAF to the models of an MTLF
+type providerState struct {
+	mu             sync.Mutex
+	subscriptionId string
+	// heardAt is when the MTLF last notified models or confirmed the
+	// subscription
+	heardAt time.Time
+}
+
+// MLModelAddr is where a model file can be fetched
+type MLModelAddr struct {
+	MLModelUrl string `json:"mLModelUrl"`
+}
+
+// MLEventNotif describes the model version in use for an event type (TS
+// 29.520 MLEventNotif) with its version and accuracy metadata
+type MLEventNotif struct {
+	Event        string      `json:"event"`
+	MLFileAddr   MLModelAddr `json:"mLFileAddr"`
+	ModelVersion int         `json:"modelVersion"`
+	// Accuracy (0..100) on held-out history
+	Accuracy  int   `json:"accuracy"`
+	TrainedAt int64 `json:"trainedAt"`
+}
+
+// MLModelNotification is POSTed to the consumers subscribed to an event type
+// when a new model version is in use (TS 29.520 NnwdafMLModelProvNotif)
+type MLModelNotification struct {
+	SubscriptionId string          `json:"subscriptionId"`
+	NotifCorreId   string          `json:"notifCorreId,omitempty"`
+	EventNotifs    []*MLEventNotif `json:"eventNotifs"`
+}
+
+// MLEventSubscription is one event type a consumer subscribes models for
+type MLEventSubscription struct {
+	MLEvent string `json:"mLEvent"`
+}
+
+// MLModelSubscriptionRequest subscribes to the models of some event types
+// (TS 29.520 NnwdafMLModelProvSubsc)
+type MLModelSubscriptionRequest struct {
+	MLEventSubscs []MLEventSubscription `json:"mLEventSubscs" binding:"required"`
+	NotifUri      string                `json:"notifUri" binding:"required"`
+	NotifCorreId  string                `json:"notifCorreId,omitempty"`
+}
+
+// MLModelSubscriptionResponse echoes a subscription with the models already
+// available for its event types
+type MLModelSubscriptionResponse struct {
+	SubscriptionId string                `json:"subscriptionId"`
+	MLEventSubscs  []MLEventSubscription `json:"mLEventSubscs"`
+	NotifUri       string                `json:"notifUri"`
+	NotifCorreId   string                `json:"notifCorreId,omitempty"`
+	MLEventNotifs  []*MLEventNotif       `json:"mLEventNotifs,omitempty"`
+}
+
+// ModelUrl returns the URL a model version is served at
+func ModelUrl(eventId string, version int) string {
+	return fmt.Sprintf("%s%s/models/%s/%d", factory.NwdafConfig.Configuration.GetSbiUri(),
+		MLModelProvisionPath, eventId, version)
+}
+
+func modelNotif(file *ModelFile) *MLEventNotif {
+	return &MLEventNotif{
+		Event:        file.EventId,
+		MLFileAddr:   MLModelAddr{MLModelUrl: ModelUrl(file.EventId, file.Version)},
+		ModelVersion: file.Version,
+		Accuracy:     percent(file.Accuracy),
+		TrainedAt:    file.TrainedAt,
+	}
+}
+
+// ModelInfos returns the model versions in use for the given event types
+func (e *AnalyticsEngine) ModelInfos(eventIds []string) []*MLEventNotif {
+	infos := make([]*MLEventNotif, 0, len(eventIds))
+	for _, eventId := range eventIds {
+		if file := e.models.get(eventId); file != nil {
+			infos = append(infos, modelNotif(file))
+		}
+	}
+	return infos
+}
+
+// ModelFile returns a model version of an event type: the one in use or one
+// still kept in the model directory
+func (e *AnalyticsEngine) ModelFile(eventId string, version int) (*ModelFile, error) {
+	if file := e.models.get(eventId); file != nil && file.Version == version {
+		return file, nil
+	}
+	dir := factory.NwdafConfig.Configuration.GetTraining().ModelDir
+	return LoadModelFile(filepath.Join(dir, modelFileName(eventId, version)))
+}
+
+// notifyModelSubscribers tells the consumers subscribed to the event type of
+// a model file that a new version is in use
+func (e *AnalyticsEngine) notifyModelSubscribers(file *ModelFile) {
+	for _, sub := range e.context.GetMLModelSubscriptions(file.EventId) {
+		notification := &MLModelNotification{
+			SubscriptionId: sub.SubscriptionId,
+			NotifCorreId:   sub.NotifCorreId,
+			EventNotifs:    []*MLEventNotif{modelNotif(file)},
+		}
+		if err := e.postJSON(sub.NotificationUri, notification, nil); err != nil {
+			logger.AnalyticsLog.Warnf("Model notification for subscription %s failed: %v", sub.SubscriptionId, err)
+		}
+	}
+}
+
+// SubscribeModels subscribes to the models an MTLF trains for the given event
+// types. Models already available are fetched at once; later versions are
+// fetched as the MTLF notifies them.
+func (e *AnalyticsEngine) SubscribeModels(ctx context.Context, providerUri string, eventIds []string) error {
+	req := &MLModelSubscriptionRequest{NotifUri: factory.NwdafConfig.Configuration.GetSbiUri() + MLModelNotifyPath}
+	for _, eventId := range eventIds {
+		req.MLEventSubscs = append(req.MLEventSubscs, MLEventSubscription{MLEvent: eventId})
+	}
+
+	var resp MLModelSubscriptionResponse
+	uri := strings.TrimRight(providerUri, "/") + MLModelProvisionPath + "/subscriptions"
+	if err := e.postJSON(uri, req, &resp); err != nil {
+		return fmt.Errorf("model subscription: %w", err)
+	}
+	e.provider.mu.Lock()
+	e.provider.subscriptionId = resp.SubscriptionId
+	e.provider.mu.Unlock()
+	logger.AnalyticsLog.Infof("Subscribed to %v models at %s as %s", eventIds, providerUri, resp.SubscriptionId)
+	return e.FetchModels(ctx, resp.MLEventNotifs)
+}
+
+// StartModelSubscription keeps a subscription to the models of an MTLF until
+// ctx is done. Failed attempts are retried with a doubling delay. Once
+// subscribed, the subscription is renewed when the MTLF has not been heard of
+// for two training intervals, and made anew when the MTLF no longer knows it.
+func (e *AnalyticsEngine) StartModelSubscription(ctx context.Context, providerUri string, eventIds []string) {
+	stale := 2 * time.Duration(factory.NwdafConfig.Configuration.GetTraining().Interval) * time.Second
+	ticker := e.clock.NewTicker(modelRetryDelay)
+	defer ticker.Stop()
+
+	delay, next := modelRetryDelay, e.clock.Now()
+	for {
+		if now := e.clock.Now(); !now.Before(next) {
+			if err := e.keepModelSubscription(ctx, providerUri, eventIds, stale); err != nil {
+				logger.AnalyticsLog.Warnf("ML model subscription at %s failed, retrying in %s: %v", providerUri, delay, err)
+				next = now.Add(delay)
+				delay = min(2*delay, maxModelRetryDelay)
+			} else {
+				delay = modelRetryDelay
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+	}
+}
+
+// keepModelSubscription subscribes to the models of an MTLF, or renews the
+// subscription once the MTLF has not been heard of for the stale time
+func (e *AnalyticsEngine) keepModelSubscription(ctx context.Context, providerUri string, eventIds []string, stale time.Duration) error {
+	e.provider.mu.Lock()
+	subscriptionId, heardAt := e.provider.subscriptionId, e.provider.heardAt
+	e.provider.mu.Unlock()
+	if subscriptionId == "" {
+		return e.SubscribeModels(ctx, providerUri, eventIds)
+	}
+	if e.clock.Since(heardAt) < stale {
+		return nil
+	}
+
+	err := e.renewModelSubscription(ctx, providerUri, subscriptionId, eventIds)
+	if errors.Is(err, errModelSubscriptionGone) {
+		logger.AnalyticsLog.Infof("ML model subscription %s lost at %s, subscribing again", subscriptionId, providerUri)
+		e.provider.mu.Lock()
+		e.provider.subscriptionId = ""
+		e.provider.mu.Unlock()
+		return e.SubscribeModels(ctx, providerUri, eventIds)
+	}
+	return err
+}
+
+// renewModelSubscription updates a model subscription at the MTLF and fetches
+// the model versions it lists, those notified in vain included
+func (e *AnalyticsEngine) renewModelSubscription(ctx context.Context, providerUri, subscriptionId string, eventIds []string) error {
+	body := &MLModelSubscriptionRequest{NotifUri: factory.NwdafConfig.Configuration.GetSbiUri() + MLModelNotifyPath}
+	for _, eventId := range eventIds {
+		body.MLEventSubscs = append(body.MLEventSubscs, MLEventSubscription{MLEvent: eventId})
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	uri := strings.TrimRight(providerUri, "/") + MLModelProvisionPath + "/subscriptions/" + subscriptionId
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, uri, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return errModelSubscriptionGone
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("model subscription renewal: provider replied %s", resp.Status)
+	}
+	var renewed MLModelSubscriptionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&renewed); err != nil {
+		return fmt.Errorf("model subscription renewal: %w", err)
+	}
+	return e.FetchModels(ctx, renewed.MLEventNotifs)
+}
+
+// FetchModels downloads the notified model versions into the model directory
+// and puts them in use
+func (e *AnalyticsEngine) FetchModels(ctx context.Context, notifs []*MLEventNotif) error {
+	dir := factory.NwdafConfig.Configuration.GetTraining().ModelDir
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	for _, notif := range notifs {
+		if current := e.models.get(notif.Event); current != nil && current.Version >= notif.ModelVersion {
+			continue
+		}
+		file, err := e.fetchModelFile(ctx, notif.MLFileAddr.MLModelUrl)
+		if err != nil {
+			return fmt.Errorf("fetching %s models v%d: %w", notif.Event, notif.ModelVersion, err)
+		}
+		if _, err := SaveModelFile(dir, file); err != nil {
+			return err
+		}
+		if e.useModels(file) {
+			logger.AnalyticsLog.Infof("Fetched %s models v%d", file.EventId, file.Version)
+		}
+	}
+
+	e.provider.mu.Lock()
+	e.provider.heardAt = e.clock.Now()
+	e.provider.mu.Unlock()
+	return nil
+}
+
+func (e *AnalyticsEngine) fetchModelFile(ctx context.Context, url string) (*ModelFile, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("provider replied %s", resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return parseModelFile(data)
+}
+
+// postJSON POSTs a body and decodes the reply into out unless it is nil
+func (e *AnalyticsEngine) postJSON(uri string, body, out interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	resp, err := e.client.Post(uri, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("peer replied %s", resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// ValidateMLModelSubscription checks that models are trained for every event
+// type of a subscription
+func ValidateMLModelSubscription(req *MLModelSubscriptionRequest) error {
+	if len(req.MLEventSubscs) == 0 {
+		return fmt.Errorf("%w: no mLEventSubscs", ErrUnknownEvent)
+	}
+	for _, s := range req.MLEventSubscs {
+		if !slices.Contains(TrainedEvents(), s.MLEvent) {
+			return fmt.Errorf("%w: no models are trained for %q", ErrUnknownEvent, s.MLEvent)
+		}
+	}
+	return nil
+}
+
+// NewMLModelSubscription builds the subscription stored for a request
+func NewMLModelSubscription(subscriptionId string, req *MLModelSubscriptionRequest) *nwdafContext.MLModelSubscription {
+	sub := &nwdafContext.MLModelSubscription{
+		SubscriptionId:  subscriptionId,
+		NotificationUri: req.NotifUri,
+		NotifCorreId:    req.NotifCorreId,
+	}
+	for _, s := range req.MLEventSubscs {
+		sub.EventIds = append(sub.EventIds, s.MLEvent)
+	}
+	return sub
+}
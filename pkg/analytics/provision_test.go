@@ -0,0 +1,188 @@
+package analytics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/free5gc/nwdaf/pkg/clock"
+	nwdafContext "github.com/free5gc/nwdaf/pkg/context"
+	"github.com/free5gc/nwdaf/pkg/factory"
+)
+
+func TestMLModelProvision(t *testing.T) {
+	providerDir, consumerDir := t.TempDir(), t.TempDir()
+	factory.NwdafConfig.Configuration.Training = &factory.TrainingConfig{ModelDir: providerDir}
+	sbi := factory.NwdafConfig.Configuration.Sbi
+	defer func() {
+		factory.NwdafConfig.Configuration.Training = nil
+		factory.NwdafConfig.Configuration.Sbi = sbi
+	}()
+
+	ctx := &nwdafContext.NWDAFContext{DataStore: nwdafContext.NewDataStore()}
+	provider := NewAnalyticsEngine(ctx)
+	now := time.Unix(1700003600, 0)
+	provider.SetClock(clock.NewVirtual(now, 1))
+	for i := 0; i <= 24; i++ {
+		ctx.UpdateNFStatistics("amf-1", &nwdafContext.NFStatistics{NFInstanceId: "amf-1", NFType: "AMF", Load: 0.3, Timestamp: now.Unix() - 7200 + int64(i*300)})
+	}
+
+	// The provider serves its models and the consumer receives notifications
+	received := make(chan MLModelNotification, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/notify" {
+			var n MLModelNotification
+			if err := json.NewDecoder(r.Body).Decode(&n); err == nil {
+				received <- n
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, MLModelProvisionPath+"/models/"), "/")
+		version, _ := strconv.Atoi(parts[len(parts)-1])
+		file, err := provider.ModelFile(parts[0], version)
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(file)
+	}))
+	defer server.Close()
+	host, port, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	portNumber, _ := strconv.Atoi(port)
+	factory.NwdafConfig.Configuration.Sbi = &factory.Sbi{Scheme: "http", RegisterIPv4: host, Port: portNumber}
+
+	ctx.AddMLModelSubscription(&nwdafContext.MLModelSubscription{
+		SubscriptionId:  "ml-1",
+		EventIds:        []string{"NF_LOAD"},
+		NotificationUri: server.URL + "/notify",
+		NotifCorreId:    "corr-1",
+	})
+	if _, err := provider.TrainModels(context.Background()); err != nil {
+		t.Fatalf("TrainModels() error = %v", err)
+	}
+
+	var n MLModelNotification
+	select {
+	case n = <-received:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected a notification of the trained models")
+	}
+	if n.SubscriptionId != "ml-1" || n.NotifCorreId != "corr-1" || len(n.EventNotifs) != 1 {
+		t.Fatalf("Expected one model for ml-1, got %+v", n)
+	}
+	notif := n.EventNotifs[0]
+	if notif.Event != "NF_LOAD" || notif.ModelVersion != 1 || notif.MLFileAddr.MLModelUrl != server.URL+MLModelProvisionPath+"/models/NF_LOAD/1" {
+		t.Errorf("Expected NF_LOAD v1 served by the provider, got %+v", notif)
+	}
+
+	// The consumer fetches the notified version into its own model directory
+	factory.NwdafConfig.Configuration.Training.ModelDir = consumerDir
+	consumer := NewAnalyticsEngine(&nwdafContext.NWDAFContext{DataStore: nwdafContext.NewDataStore()})
+	if err := consumer.FetchModels(context.Background(), n.EventNotifs); err != nil {
+		t.Fatalf("FetchModels() error = %v", err)
+	}
+	if file := consumer.models.get("NF_LOAD"); file == nil || file.Version != 1 || file.Models["amf-1"] == nil {
+		t.Errorf("Expected the consumer to use NF_LOAD v1, got %+v", file)
+	}
+	if _, err := os.Stat(filepath.Join(consumerDir, "NF_LOAD-v1.json")); err != nil {
+		t.Errorf("Expected the model stored by the consumer, got %v", err)
+	}
+}
+
+func TestModelSubscriptionRetry(t *testing.T) {
+	factory.NwdafConfig.Configuration.Training = &factory.TrainingConfig{Interval: 60, ModelDir: t.TempDir()}
+	defer func() { factory.NwdafConfig.Configuration.Training = nil }()
+
+	// The MTLF is down at first, then restarts and forgets the subscription
+	var mu sync.Mutex
+	var created []string
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == http.MethodPost && len(created) < 2:
+			created = append(created, "")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case r.Method == http.MethodPost:
+			id := "ml-" + strconv.Itoa(len(created))
+			created = append(created, id)
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(&MLModelSubscriptionResponse{SubscriptionId: id})
+		case r.Method == http.MethodPut && strings.HasSuffix(r.URL.Path, "/ml-2"):
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			_ = json.NewEncoder(w).Encode(&MLModelSubscriptionResponse{SubscriptionId: "ml-3"})
+		}
+	}))
+	defer provider.Close()
+
+	engine := NewAnalyticsEngine(&nwdafContext.NWDAFContext{DataStore: nwdafContext.NewDataStore()})
+	engine.SetClock(clock.NewVirtual(time.Unix(1700000000, 0), 1000))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		engine.StartModelSubscription(ctx, provider.URL, TrainedEvents())
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		attempts := len(created)
+		mu.Unlock()
+		if attempts >= 4 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(created) != 4 || created[2] != "ml-2" || created[3] != "ml-3" {
+		t.Errorf("Expected 2 failed attempts, a subscription and a new one once it was lost, got %q", created)
+	}
+	if engine.provider.subscriptionId != "ml-3" {
+		t.Errorf("Expected the new subscription kept, got %q", engine.provider.subscriptionId)
+	}
+}
+
+func TestValidateMLModelSubscription(t *testing.T) {
+	tests := []struct {
+		name      string
+		events    []string
+		wantError bool
+	}{
+		{"Trained events", []string{"NF_LOAD", "SLICE_LOAD"}, false},
+		{"No events", nil, true},
+		{"Untrained event", []string{"UE_MOBILITY"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &MLModelSubscriptionRequest{NotifUri: "http://consumer/notify"}
+			for _, event := range tt.events {
+				req.MLEventSubscs = append(req.MLEventSubscs, MLEventSubscription{MLEvent: event})
+			}
+			err := ValidateMLModelSubscription(req)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("ValidateMLModelSubscription() error = %v, wantError %v", err, tt.wantError)
+			}
+			if err != nil && !errors.Is(err, ErrUnknownEvent) {
+				t.Errorf("Expected ErrUnknownEvent, got %v", err)
+			}
+		})
+	}
+}
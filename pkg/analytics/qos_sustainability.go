@@ -0,0 +1,220 @@
+package analytics
+
+import (
+	"math"
+	"sort"
+
+	nwdafContext "github.com/free5gc/nwdaf/pkg/context"
+	"github.com/free5gc/nwdaf/pkg/factory"
+)
+
+// QosSustainabilityInfo tells whether the per-UE throughput of one 5QI in one
+// TAI or area of interest stays at or above the requested threshold over a
+// window (TS 23.288 §6.9). Statistics report the share of intervals that met
+// it; predictions carry a confidence.
+type QosSustainabilityInfo struct {
+	FiveQi            int      `json:"5qi"`
+	Tai               string   `json:"tai,omitempty"`
+	AreaOfInterest    string   `json:"areaOfInterest,omitempty"`
+	Tais              []string `json:"tais,omitempty"`
+	StartTs           int64    `json:"startTs"`
+	EndTs             int64    `json:"endTs"`
+	RanUeThrouThd     float64  `json:"ranUeThrouThd"`
+	AverageThroughput float64  `json:"averageThroughput"`
+	MinThroughput     float64  `json:"minThroughput"`
+	SustainedRatio    *float64 `json:"sustainedRatio,omitempty"`
+	// NfLoadLevelpeak is the peak load (percent) of the NFs serving the area
+	NfLoadLevelpeak *int `json:"nfLoadLevelpeak,omitempty"`
+	Sustainable     bool `json:"sustainable"`
+	Confidence      int  `json:"confidence,omitempty"`
+}
+
+// qosThreshold returns the per-UE throughput to sustain
+func qosThreshold(f *EventFilter) float64 {
+	if f.RanUeThrouThd == nil {
+		return 0
+	}
+	return *f.RanUeThrouThd
+}
+
+type qosKey struct {
+	area   string
+	fiveQi int
+}
+
+// qosGroup collects the samples of one 5QI in one area
+type qosGroup struct {
+	fiveQi     int
+	area       string
+	throughput []Point
+}
+
+// qosSeries gathers per-UE throughput by 5QI and area for the flows in
+// scope, and the load of the NFs in scope serving each area, over [startTs,
+// endTs]
+func (e *AnalyticsEngine) qosSeries(src nwdafContext.HistorySource, f *EventFilter, scope areaScope, startTs, endTs int64) (map[qosKey]*qosGroup, map[string][]Point) {
+	ues := newUEScope(f)
+	groups := make(map[qosKey]*qosGroup)
+	for supi, samples := range src.GetUEStatisticsInWindow(startTs, endTs) {
+		if !ues.matches(supi) {
+			continue
+		}
+		for _, s := range samples {
+			if (len(f.FiveQis) > 0 && !containsInt(f.FiveQis, s.FiveQi)) || !f.matchesFlow(s) {
+				continue
+			}
+			for _, area := range scope.groups(s.Location) {
+				key := qosKey{area: area, fiveQi: s.FiveQi}
+				g, ok := groups[key]
+				if !ok {
+					g = &qosGroup{fiveQi: s.FiveQi, area: area}
+					groups[key] = g
+				}
+				g.throughput = append(g.throughput, Point{s.Timestamp, s.Throughput})
+			}
+		}
+	}
+
+	load := make(map[string][]Point)
+	for nfId, samples := range src.GetNFStatisticsInWindow(startTs, endTs) {
+		for _, s := range samples {
+			if !f.matchesNF(nfId, s) {
+				continue
+			}
+			seen := make(map[string]bool)
+			for _, tai := range s.Tais {
+				for _, area := range scope.groups(tai) {
+					if !seen[area] {
+						seen[area] = true
+						load[area] = append(load[area], Point{s.Timestamp, s.Load})
+					}
+				}
+			}
+		}
+	}
+
+	for _, g := range groups {
+		sortPoints(g.throughput)
+	}
+	for _, points := range load {
+		sortPoints(points)
+	}
+	return groups, load
+}
+
+// computeQosSustainability reports, per 5QI and area, how the average per-UE
+// throughput compared with the threshold in each interval of [startTs,
+// endTs]. The QoS was sustained when no interval fell below it.
+func (e *AnalyticsEngine) computeQosSustainability(src nwdafContext.HistorySource, f *EventFilter, startTs, endTs int64) []*QosSustainabilityInfo {
+	threshold := qosThreshold(f)
+	step := int64(factory.NwdafConfig.Configuration.GetForecast().Step)
+	scope := newAreaScope(f)
+	groups, load := e.qosSeries(src, f, scope, startTs, endTs)
+
+	infos := make([]*QosSustainabilityInfo, 0, len(groups))
+	for _, g := range groups {
+		series, _ := resample(g.throughput, step)
+		info := newQosInfo(scope, g, threshold, startTs, endTs)
+
+		met := 0
+		info.MinThroughput = math.Inf(1)
+		for _, v := range series {
+			info.MinThroughput = math.Min(info.MinThroughput, v)
+			if v >= threshold {
+				met++
+			}
+		}
+		info.AverageThroughput = mean(series)
+		ratio := float64(met) / float64(len(series))
+		info.SustainedRatio = &ratio
+		info.Sustainable = met == len(series)
+
+		if points := load[g.area]; len(points) > 0 {
+			peak := 0.0
+			for _, p := range points {
+				peak = math.Max(peak, p.Value)
+			}
+			level := percent(peak)
+			info.NfLoadLevelpeak = &level
+		}
+		infos = append(infos, info)
+	}
+	sortQosInfos(infos)
+	return infos
+}
+
+// predictQosSustainability forecasts, per 5QI and area, the per-UE throughput
+// and the load of the serving NFs over the future window [startTs, endTs].
+// The QoS is expected to be sustained when the lowest predicted throughput
+// meets the threshold and the serving NFs are not expected to overload.
+func (e *AnalyticsEngine) predictQosSustainability(f *EventFilter, startTs, endTs int64) []*QosSustainabilityInfo {
+	config := factory.NwdafConfig.Configuration
+	threshold := qosThreshold(f)
+	forecast := config.GetForecast()
+	params := forecastParams(forecast)
+	step := int64(forecast.Step)
+	overload := config.GetNfLoadThresholds("").Overload
+
+	now := e.clock.Now().Unix()
+	scope := newAreaScope(f)
+	groups, load := e.qosSeries(e.context, f, scope, now-int64(forecast.History), now)
+
+	infos := make([]*QosSustainabilityInfo, 0, len(groups))
+	for _, g := range groups {
+		throughput, ok := forecastWindow(g.throughput, forecast.DefaultModel, step, startTs, endTs, params)
+		if !ok {
+			continue
+		}
+		info := newQosInfo(scope, g, threshold, startTs, endTs)
+		info.AverageThroughput = math.Max(0, throughput.Average)
+		info.MinThroughput = math.Max(0, throughput.Min)
+		info.Sustainable = info.MinThroughput >= threshold
+		info.Confidence = throughput.Confidence
+
+		if points := load[g.area]; len(points) > 0 {
+			if l, ok := forecastWindow(points, forecast.DefaultModel, step, startTs, endTs, params); ok {
+				peak := clampLoad(l.Peak)
+				level := percent(peak)
+				info.NfLoadLevelpeak = &level
+				if peak >= overload {
+					info.Sustainable = false
+				}
+				info.Confidence = min(info.Confidence, l.Confidence)
+			}
+		}
+		infos = append(infos, info)
+	}
+	sortQosInfos(infos)
+	return infos
+}
+
+func newQosInfo(scope areaScope, g *qosGroup, threshold float64, startTs, endTs int64) *QosSustainabilityInfo {
+	area := scope.newInfo(g.area)
+	return &QosSustainabilityInfo{
+		FiveQi:         g.fiveQi,
+		Tai:            area.Tai,
+		AreaOfInterest: area.AreaOfInterest,
+		Tais:           area.Tais,
+		StartTs:        startTs,
+		EndTs:          endTs,
+		RanUeThrouThd:  threshold,
+	}
+}
+
+func sortQosInfos(infos []*QosSustainabilityInfo) {
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].FiveQi != infos[j].FiveQi {
+			return infos[i].FiveQi < infos[j].FiveQi
+		}
+		return infos[i].AreaOfInterest+infos[i].Tai < infos[j].AreaOfInterest+infos[j].Tai
+	})
+}
+
+func containsInt(values []int, v int) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/free5gc/nwdaf/pkg/clock"
+	nwdafContext "github.com/free5gc/nwdaf/pkg/context"
+)
+
+func TestQosSustainability(t *testing.T) {
+	ctx := &nwdafContext.NWDAFContext{DataStore: nwdafContext.NewDataStore()}
+	engine := NewAnalyticsEngine(ctx)
+
+	now := time.Unix(1700003600, 0)
+	engine.SetClock(clock.NewVirtual(now, 1))
+
+	// Over the last hour, 5QI 2 throughput holds in tai-1 and decays in tai-2
+	for i := 0; i <= 12; i++ {
+		ts := now.Unix() - 3600 + int64(i*300)
+		ctx.UpdateUEStatistics("imsi-1", &nwdafContext.UEStatistics{SUPI: "imsi-1", Location: "tai-1", FiveQi: 2, Throughput: 50, Timestamp: ts})
+		ctx.UpdateUEStatistics("imsi-2", &nwdafContext.UEStatistics{SUPI: "imsi-2", Location: "tai-2", FiveQi: 2, Throughput: 60 - 2*float64(i), Timestamp: ts})
+		ctx.UpdateUEStatistics("imsi-3", &nwdafContext.UEStatistics{SUPI: "imsi-3", Location: "tai-1", FiveQi: 9, Throughput: 1, Timestamp: ts})
+	}
+
+	filter := mustParseFilter(t, map[string]interface{}{
+		"qosRequ": map[string]interface{}{"5qi": float64(2), "gfbrDl": float64(40)},
+	})
+	if err := ValidateFilter("QOS_SUSTAINABILITY", map[string]interface{}{"fiveQis": []interface{}{2.0}}); err == nil {
+		t.Error("Expected a request without threshold to be rejected")
+	}
+
+	stats := engine.computeQosSustainability(engine.context, filter, now.Unix()-3600, now.Unix())
+	if len(stats) != 2 {
+		t.Fatalf("Expected 5QI 2 in two TAIs, got %d entries", len(stats))
+	}
+	if !stats[0].Sustainable || stats[1].Sustainable || *stats[1].SustainedRatio >= 1 {
+		t.Errorf("Expected the QoS to hold in tai-1 only, got %+v and %+v", stats[0], stats[1])
+	}
+
+	predictions := engine.predictQosSustainability(filter, now.Unix(), now.Unix()+1800)
+	if len(predictions) != 2 {
+		t.Fatalf("Expected two predictions, got %d", len(predictions))
+	}
+	if p := predictions[0]; p.Tai != "tai-1" || !p.Sustainable {
+		t.Errorf("Expected the QoS to be sustained in tai-1, got %+v", p)
+	}
+	if p := predictions[1]; p.Sustainable || p.MinThroughput >= 40 {
+		t.Errorf("Expected the decaying throughput in tai-2 to miss 40, got %+v", p)
+	}
+}
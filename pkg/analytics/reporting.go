@@ -0,0 +1,197 @@
+package analytics
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+
+	nwdafContext "github.com/free5gc/nwdaf/pkg/context"
+)
+
+// ErrInvalidReportingRequirement is returned for event reporting requirements
+// that cannot be honored
+var ErrInvalidReportingRequirement = errors.New("invalid event reporting requirement")
+
+// Accuracy levels of an event reporting requirement (TS 29.520 Accuracy)
+const (
+	AccuracyLow     = "LOW"
+	AccuracyMedium  = "MEDIUM"
+	AccuracyHigh    = "HIGH"
+	AccuracyHighest = "HIGHEST"
+)
+
+// accuracyConfidence is the minimum confidence (0..100) a prediction needs to
+// be reported at each accuracy level
+var accuracyConfidence = map[string]int{
+	AccuracyLow:     0,
+	AccuracyMedium:  40,
+	AccuracyHigh:    60,
+	AccuracyHighest: 80,
+}
+
+// Output types labelling the parts of a result
+const (
+	OutputStatistics  = "STATISTICS"
+	OutputPredictions = "PREDICTIONS"
+)
+
+// ValidateReportingRequirement checks the window, accuracy and maximum number
+// of objects of a request. A nil requirement is valid.
+func ValidateReportingRequirement(req *nwdafContext.EventReportingRequirement) error {
+	if req == nil {
+		return nil
+	}
+	if req.EndTs != 0 && req.EndTs < req.StartTs {
+		return fmt.Errorf("%w: endTs must not be before startTs", ErrInvalidReportingRequirement)
+	}
+	if _, ok := accuracyConfidence[req.Accuracy]; req.Accuracy != "" && !ok {
+		return fmt.Errorf("%w: unknown accuracy %q", ErrInvalidReportingRequirement, req.Accuracy)
+	}
+	if req.MaxObjectNbr < 0 {
+		return fmt.Errorf("%w: maxObjectNbr must not be negative", ErrInvalidReportingRequirement)
+	}
+	return nil
+}
+
+// resultWindow returns the window a result was computed over
+func resultWindow(result map[string]interface{}) (int64, int64) {
+	window, _ := result["window"].(map[string]int64)
+	return window["startTs"], window["endTs"]
+}
+
+// labelOutput records whether a result holds statistics, predictions or both
+// and the window each covers. Empty windows are left out.
+func labelOutput(result map[string]interface{}, statsStart, statsEnd, predStart, predEnd int64) {
+	outputTypes := make([]string, 0, 2)
+	if statsEnd > statsStart {
+		outputTypes = append(outputTypes, OutputStatistics)
+		result["statisticsWindow"] = windowInfo(statsStart, statsEnd)
+	}
+	if _, ok := result["predictions"]; ok && predEnd > predStart {
+		outputTypes = append(outputTypes, OutputPredictions)
+		result["predictionWindow"] = windowInfo(predStart, predEnd)
+	}
+	result["outputTypes"] = outputTypes
+}
+
+// applyReportingRequirement drops the predictions less confident than the
+// requested accuracy and keeps the most relevant objects of each output list
+func applyReportingRequirement(result interface{}, req *nwdafContext.EventReportingRequirement) interface{} {
+	r, ok := result.(map[string]interface{})
+	if !ok || req == nil {
+		return result
+	}
+	for key, value := range r {
+		minConfidence := 0
+		if key == "predictions" {
+			minConfidence = accuracyConfidence[req.Accuracy]
+		}
+		r[key] = limitObjects(value, req.MaxObjectNbr, minConfidence)
+	}
+	return r
+}
+
+// ranked is an output object that can be ordered by relevance, highest first
+type ranked interface {
+	relevance() float64
+}
+
+// predicted is a prediction carrying a confidence (0..100)
+type predicted interface {
+	predictionConfidence() int
+}
+
+var (
+	rankedType    = reflect.TypeOf((*ranked)(nil)).Elem()
+	predictedType = reflect.TypeOf((*predicted)(nil)).Elem()
+)
+
+// limitObjects drops the objects of a list or map below minConfidence and
+// keeps the max most relevant (all with max 0). A limited map becomes a list,
+// most relevant first, since a map cannot keep that order. Nested results are
+// limited in turn; other values are returned unchanged.
+func limitObjects(value interface{}, max, minConfidence int) interface{} {
+	if nested, ok := value.(map[string]interface{}); ok {
+		for key, v := range nested {
+			nested[key] = limitObjects(v, max, minConfidence)
+		}
+		return nested
+	}
+
+	v := reflect.ValueOf(value)
+	if (v.Kind() != reflect.Slice && v.Kind() != reflect.Map) || !v.Type().Elem().Implements(rankedType) {
+		return value
+	}
+	checkConfidence := minConfidence > 0 && v.Type().Elem().Implements(predictedType)
+
+	type entry struct{ key, item reflect.Value }
+	var entries []entry
+	if v.Kind() == reflect.Map {
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		for _, k := range keys {
+			entries = append(entries, entry{k, v.MapIndex(k)})
+		}
+	} else {
+		for i := 0; i < v.Len(); i++ {
+			entries = append(entries, entry{item: v.Index(i)})
+		}
+	}
+
+	kept := entries[:0]
+	for _, en := range entries {
+		if checkConfidence && en.item.Interface().(predicted).predictionConfidence() < minConfidence {
+			continue
+		}
+		kept = append(kept, en)
+	}
+	toList := v.Kind() == reflect.Map && max > 0
+	if max > 0 && (len(kept) > max || toList) {
+		sort.SliceStable(kept, func(i, j int) bool {
+			return kept[i].item.Interface().(ranked).relevance() > kept[j].item.Interface().(ranked).relevance()
+		})
+		kept = kept[:min(max, len(kept))]
+	}
+
+	if v.Kind() == reflect.Map && !toList {
+		limited := reflect.MakeMapWithSize(v.Type(), len(kept))
+		for _, en := range kept {
+			limited.SetMapIndex(en.key, en.item)
+		}
+		return limited.Interface()
+	}
+	limited := reflect.MakeSlice(reflect.SliceOf(v.Type().Elem()), 0, len(kept))
+	for _, en := range kept {
+		limited = reflect.Append(limited, en.item)
+	}
+	return limited.Interface()
+}
+
+// Relevance of each output object: the most loaded, congested, degraded or
+// populated first
+
+func (i *NfLoadLevelInformation) relevance() float64 { return float64(i.NfLoadLevelpeak) }
+func (p *NfLoadPrediction) relevance() float64       { return float64(p.NfLoadLevelpeak) }
+func (i *NetworkPerfInfo) relevance() float64        { return float64(i.UeCount) }
+func (s *SliceLoadSummary) relevance() float64       { return s.PeakResourceUsage }
+func (p *SliceLoadPrediction) relevance() float64    { return p.PeakResourceUsage }
+func (i *UeMobilityInfo) relevance() float64         { return float64(len(i.Trajectory)) }
+func (i *UeGroupMobilityInfo) relevance() float64    { return float64(i.UeCount) }
+func (p *UeMobilityPrediction) relevance() float64   { return float64(p.Confidence) }
+func (b *AbnormalBehaviour) relevance() float64      { return float64(b.Excep.ExcepLevel * b.Ratio) }
+func (i *QosSustainabilityInfo) relevance() float64  { return i.RanUeThrouThd - i.MinThroughput }
+func (i *ServiceExperienceInfo) relevance() float64  { return mosMax - i.SvcExprc.Mos }
+func (i *UserDataCongestionInfo) relevance() float64 { return float64(i.PeakUtilization) }
+func (p *DnPerformance) relevance() float64          { return p.PerfData.AvgTrafficRate }
+func (p *DnaiPerformance) relevance() float64        { return p.PerfData.AvgTrafficRate }
+
+func (p *NfLoadPrediction) predictionConfidence() int       { return p.Confidence }
+func (i *NetworkPerfInfo) predictionConfidence() int        { return i.Confidence }
+func (p *SliceLoadPrediction) predictionConfidence() int    { return p.Confidence }
+func (p *UeMobilityPrediction) predictionConfidence() int   { return p.Confidence }
+func (i *QosSustainabilityInfo) predictionConfidence() int  { return i.Confidence }
+func (i *ServiceExperienceInfo) predictionConfidence() int  { return i.Confidence }
+func (i *UserDataCongestionInfo) predictionConfidence() int { return i.Confidence }
+func (p *DnPerformance) predictionConfidence() int          { return p.Confidence }
+func (p *DnaiPerformance) predictionConfidence() int        { return p.Confidence }
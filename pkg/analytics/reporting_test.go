@@ -0,0 +1,135 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/free5gc/nwdaf/pkg/clock"
+	nwdafContext "github.com/free5gc/nwdaf/pkg/context"
+)
+
+func TestValidateReportingRequirement(t *testing.T) {
+	tests := []struct {
+		name      string
+		req       *nwdafContext.EventReportingRequirement
+		wantError bool
+	}{
+		{"No requirement", nil, false},
+		{"Window", &nwdafContext.EventReportingRequirement{StartTs: 100, EndTs: 200}, false},
+		{"Open-ended window", &nwdafContext.EventReportingRequirement{StartTs: 100}, false},
+		{"Reversed window", &nwdafContext.EventReportingRequirement{StartTs: 200, EndTs: 100}, true},
+		{"Known accuracy", &nwdafContext.EventReportingRequirement{Accuracy: AccuracyHigh}, false},
+		{"Unknown accuracy", &nwdafContext.EventReportingRequirement{Accuracy: "BEST"}, true},
+		{"Negative max objects", &nwdafContext.EventReportingRequirement{MaxObjectNbr: -1}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateReportingRequirement(tt.req)
+			if (err != nil) != tt.wantError {
+				t.Errorf("ValidateReportingRequirement() error = %v, wantError %v", err, tt.wantError)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidReportingRequirement) {
+				t.Errorf("Expected ErrInvalidReportingRequirement, got %v", err)
+			}
+		})
+	}
+}
+
+func TestReportingWindow(t *testing.T) {
+	ctx := &nwdafContext.NWDAFContext{DataStore: nwdafContext.NewDataStore()}
+	engine := NewAnalyticsEngine(ctx)
+	now := time.Unix(1700003600, 0)
+	engine.SetClock(clock.NewVirtual(now, 1))
+
+	for i := 0; i <= 12; i++ {
+		for nf, load := range map[string]float64{"amf-1": 0.2, "amf-2": 0.9, "amf-3": 0.5} {
+			ctx.UpdateNFStatistics(nf, &nwdafContext.NFStatistics{NFInstanceId: nf, NFType: "AMF", Load: load, Timestamp: now.Unix() - 3600 + int64(i*300)})
+		}
+	}
+
+	tests := []struct {
+		name            string
+		startTs, endTs  int64
+		wantOutputTypes []string
+	}{
+		{"Past window", now.Unix() - 3600, now.Unix() - 600, []string{OutputStatistics}},
+		{"Future window", now.Unix() + 600, now.Unix() + 1800, []string{OutputPredictions}},
+		{"Window straddling now", now.Unix() - 1800, now.Unix() + 1800, []string{OutputStatistics, OutputPredictions}},
+		{"Open-ended window", now.Unix() - 1800, 0, []string{OutputStatistics}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := engine.GetAnalyticsInWindow("NF_LOAD", nil, tt.startTs, tt.endTs)
+			if err != nil {
+				t.Fatalf("GetAnalyticsInWindow() error = %v", err)
+			}
+			result := data.(map[string]interface{})
+			if !reflect.DeepEqual(result["outputTypes"], tt.wantOutputTypes) {
+				t.Errorf("Expected output types %v, got %v", tt.wantOutputTypes, result["outputTypes"])
+			}
+			_, hasStatistics := result["nfLoadLevelInfos"]
+			_, hasPredictions := result["predictions"]
+			if hasStatistics != matchesAny(tt.wantOutputTypes, OutputStatistics) || hasPredictions != matchesAny(tt.wantOutputTypes, OutputPredictions) {
+				t.Errorf("Expected statistics %v and predictions %v, got %v", hasStatistics, hasPredictions, result)
+			}
+		})
+	}
+
+	// The two most loaded AMFs, most loaded first
+	data, err := engine.GetAnalyticsWithRequirement(context.Background(), "NF_LOAD", nil, &nwdafContext.EventReportingRequirement{
+		StartTs:      now.Unix() - 1800,
+		EndTs:        now.Unix() + 1800,
+		MaxObjectNbr: 2,
+	})
+	if err != nil {
+		t.Fatalf("GetAnalyticsWithRequirement() error = %v", err)
+	}
+	result := data.(map[string]interface{})
+	infos := result["nfLoadLevelInfos"].([]*NfLoadLevelInformation)
+	if len(infos) != 2 || infos[0].NfInstanceId != "amf-2" || infos[1].NfInstanceId != "amf-3" {
+		t.Errorf("Expected amf-2 then amf-3, got %+v", infos)
+	}
+	if predictions := result["predictions"].([]*NfLoadPrediction); len(predictions) != 2 || predictions[0].NfInstanceId != "amf-2" {
+		t.Errorf("Expected the 2 most loaded predictions, got %+v", predictions)
+	}
+}
+
+func TestLimitObjects(t *testing.T) {
+	predictions := []*NfLoadPrediction{
+		{NfInstanceId: "nf-1", NfLoadLevelpeak: 30, Confidence: 90},
+		{NfInstanceId: "nf-2", NfLoadLevelpeak: 80, Confidence: 20},
+		{NfInstanceId: "nf-3", NfLoadLevelpeak: 60, Confidence: 70},
+	}
+	limited := limitObjects(predictions, 0, accuracyConfidence[AccuracyHigh]).([]*NfLoadPrediction)
+	if len(limited) != 2 || limited[0].NfInstanceId != "nf-1" || limited[1].NfInstanceId != "nf-3" {
+		t.Errorf("Expected the confident predictions in their order, got %+v", limited)
+	}
+	limited = limitObjects(predictions, 1, 0).([]*NfLoadPrediction)
+	if len(limited) != 1 || limited[0].NfInstanceId != "nf-2" {
+		t.Errorf("Expected the most loaded NF, got %+v", limited)
+	}
+
+	slices := map[string]*SliceLoadSummary{
+		"1-010203": {SNSSAI: "1-010203", PeakResourceUsage: 0.4},
+		"2-000001": {SNSSAI: "2-000001", PeakResourceUsage: 0.9},
+	}
+	if limited := limitObjects(slices, 1, 0).([]*SliceLoadSummary); len(limited) != 1 || limited[0].SNSSAI != "2-000001" {
+		t.Errorf("Expected the busiest slice, got %v", limited)
+	}
+	if limited := limitObjects(slices, 5, 0).([]*SliceLoadSummary); len(limited) != 2 || limited[0].SNSSAI != "2-000001" {
+		t.Errorf("Expected the slices busiest first, got %v", limited)
+	}
+	if limited := limitObjects(slices, 0, 0).(map[string]*SliceLoadSummary); len(limited) != 2 {
+		t.Errorf("Expected an unlimited map to be kept, got %v", limited)
+	}
+
+	window := windowInfo(100, 200)
+	if limited := limitObjects(window, 1, 0); !reflect.DeepEqual(limited, window) {
+		t.Errorf("Expected values without relevance to be kept, got %v", limited)
+	}
+}
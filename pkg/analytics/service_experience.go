@@ -0,0 +1,286 @@
+package analytics
+
+import (
+	"math"
+	"sort"
+
+	nwdafContext "github.com/free5gc/nwdaf/pkg/context"
+	"github.com/free5gc/nwdaf/pkg/factory"
+)
+
+// MOS bounds
+const (
+	mosMin = 1.0
+	mosMax = 5.0
+)
+
+// SvcExperience is a MOS with the range around it (TS 29.520 SvcExperience)
+type SvcExperience struct {
+	Mos        float64 `json:"mos"`
+	LowerRange float64 `json:"lowerRange"`
+	UpperRange float64 `json:"upperRange"`
+}
+
+// ServiceExperienceInfo is the service experience of one application on one
+// slice (TS 23.288 §6.4). Spread is the standard deviation of the per-sample
+// MOS, which also sets the range.
+type ServiceExperienceInfo struct {
+	AppId              string        `json:"appId"`
+	Snssai             string        `json:"snssai,omitempty"`
+	SvcExprc           SvcExperience `json:"svcExprc"`
+	Spread             float64       `json:"spread"`
+	UeCount            int           `json:"ueCount"`
+	Samples            int           `json:"samples"`
+	Calibrated         bool          `json:"calibrated"`
+	CalibrationSamples int           `json:"calibrationSamples,omitempty"`
+	Confidence         int           `json:"confidence,omitempty"`
+}
+
+// rangeScore maps a metric to 0..1: 1 at or beyond Good, 0 at or beyond Bad
+func rangeScore(r factory.MetricRange, x float64) float64 {
+	if r.Good == r.Bad {
+		return 1
+	}
+	return math.Max(0, math.Min(1, (r.Bad-x)/(r.Bad-r.Good)))
+}
+
+// scoreMOS estimates the MOS of one QoS flow sample with a scoring model
+func scoreMOS(m factory.ScoringModel, s *nwdafContext.UEStatistics) float64 {
+	w := m.Weights
+	total := w.Latency + w.PacketLoss + w.Throughput
+	if total <= 0 {
+		w = factory.ScoringWeights{Latency: 1, PacketLoss: 1, Throughput: 1}
+		total = 3
+	}
+	score := (w.Latency*rangeScore(m.Latency, s.Latency) +
+		w.PacketLoss*rangeScore(m.PacketLoss, s.PacketLoss) +
+		w.Throughput*rangeScore(m.Throughput, s.Throughput)) / total
+	return mosMin + (mosMax-mosMin)*score
+}
+
+func clampMOS(v float64) float64 {
+	return math.Max(mosMin, math.Min(mosMax, v))
+}
+
+// calibration maps an estimated MOS onto the AF-reported one: a least-squares
+// line when the estimates vary enough, a constant offset otherwise
+type calibration struct {
+	offset, slope float64
+	samples       int
+}
+
+func fitCalibration(estimated, reported []float64) calibration {
+	c := calibration{slope: 1, samples: len(estimated)}
+	if c.samples == 0 {
+		return c
+	}
+
+	mx, my := mean(estimated), mean(reported)
+	var sxx, sxy float64
+	for i := range estimated {
+		sxx += (estimated[i] - mx) * (estimated[i] - mx)
+		sxy += (estimated[i] - mx) * (reported[i] - my)
+	}
+	// A line needs spread in the estimates and must keep better flows better
+	if c.samples >= 2 && sxx > 1e-6 && sxy > 0 {
+		c.slope = sxy / sxx
+		c.offset = my - c.slope*mx
+		return c
+	}
+	c.offset = my - mx
+	return c
+}
+
+func (c calibration) apply(mos float64) float64 {
+	return clampMOS(c.offset + c.slope*mos)
+}
+
+// experienceGroup collects the scored samples of one application on one slice
+type experienceGroup struct {
+	appId, snssai string
+	ues           map[string]bool
+	points        []Point
+}
+
+// experienceScope selects the flows of an application in scope of a filter
+// by SUPI or UE group, slice, DNN, application and TAI
+type experienceScope struct {
+	filter *EventFilter
+	ues    ueScope
+}
+
+func newExperienceScope(f *EventFilter) experienceScope {
+	return experienceScope{filter: f, ues: newUEScope(f)}
+}
+
+func (s experienceScope) matches(ue *nwdafContext.UEStatistics) bool {
+	return ue.AppId != "" && s.ues.matches(ue.SUPI) && s.filter.matchesFlow(ue) &&
+		matchesAny(s.filter.Tais, ue.Location)
+}
+
+// calibrations fits, per application, the estimated MOS against the AF
+// samples of the calibration window ending at endTs. An AF sample is paired
+// with the estimated MOS of the flows it reports on, i.e. of its UE (or of
+// every UE of the application when it names none) over the analytics window
+// before it.
+func (e *AnalyticsEngine) calibrations(src nwdafContext.HistorySource, appIds []string, endTs int64) map[string]calibration {
+	config := factory.NwdafConfig.Configuration
+	window := int64(config.GetAnalyticsWindow())
+	startTs := endTs - int64(config.GetCalibrationWindow())
+
+	afSamples := src.GetServiceExperienceInWindow(startTs, endTs)
+	if len(afSamples) == 0 {
+		return nil
+	}
+	ueSamples := src.GetUEStatisticsInWindow(startTs-window, endTs)
+
+	result := make(map[string]calibration)
+	for appId, samples := range afSamples {
+		if !matchesAny(appIds, appId) {
+			continue
+		}
+		model := config.GetScoringModel(appId)
+		var estimated, reported []float64
+		for _, af := range samples {
+			var sum float64
+			n := 0
+			for supi, flows := range ueSamples {
+				if af.Supi != "" && supi != af.Supi {
+					continue
+				}
+				for _, s := range flows {
+					if s.AppId != appId || s.Timestamp < af.Timestamp-window || s.Timestamp > af.Timestamp {
+						continue
+					}
+					if af.Snssai != "" && s.Snssai != af.Snssai {
+						continue
+					}
+					sum += scoreMOS(model, s)
+					n++
+				}
+			}
+			if n > 0 {
+				estimated = append(estimated, sum/float64(n))
+				reported = append(reported, af.Mos)
+			}
+		}
+		if len(estimated) > 0 {
+			result[appId] = fitCalibration(estimated, reported)
+		}
+	}
+	return result
+}
+
+// scoreExperience scores, with the application's model and calibration,
+// every flow in scope over [startTs, endTs]
+func (e *AnalyticsEngine) scoreExperience(src nwdafContext.HistorySource, f *EventFilter, startTs, endTs int64, calibrations map[string]calibration) map[[2]string]*experienceGroup {
+	config := factory.NwdafConfig.Configuration
+	scope := newExperienceScope(f)
+	groups := make(map[[2]string]*experienceGroup)
+
+	for supi, samples := range src.GetUEStatisticsInWindow(startTs, endTs) {
+		for _, s := range samples {
+			if !scope.matches(s) {
+				continue
+			}
+			key := [2]string{s.AppId, s.Snssai}
+			g, ok := groups[key]
+			if !ok {
+				g = &experienceGroup{appId: s.AppId, snssai: s.Snssai, ues: make(map[string]bool)}
+				groups[key] = g
+			}
+			mos := scoreMOS(config.GetScoringModel(s.AppId), s)
+			if c, ok := calibrations[s.AppId]; ok {
+				mos = c.apply(mos)
+			}
+			g.ues[supi] = true
+			g.points = append(g.points, Point{s.Timestamp, mos})
+		}
+	}
+	for _, g := range groups {
+		sortPoints(g.points)
+	}
+	return groups
+}
+
+func newExperienceInfo(g *experienceGroup, calibrations map[string]calibration) *ServiceExperienceInfo {
+	info := &ServiceExperienceInfo{
+		AppId:   g.appId,
+		Snssai:  g.snssai,
+		UeCount: len(g.ues),
+		Samples: len(g.points),
+	}
+	if c, ok := calibrations[g.appId]; ok {
+		info.Calibrated = true
+		info.CalibrationSamples = c.samples
+	}
+
+	values := make([]float64, len(g.points))
+	for i, p := range g.points {
+		values[i] = p.Value
+	}
+	info.Spread = newBaseline(values, 1).std
+	return info
+}
+
+func (info *ServiceExperienceInfo) setMOS(mos float64) {
+	info.SvcExprc = SvcExperience{
+		Mos:        clampMOS(mos),
+		LowerRange: clampMOS(mos - info.Spread),
+		UpperRange: clampMOS(mos + info.Spread),
+	}
+}
+
+func sortExperienceInfos(infos []*ServiceExperienceInfo) {
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].AppId != infos[j].AppId {
+			return infos[i].AppId < infos[j].AppId
+		}
+		return infos[i].Snssai < infos[j].Snssai
+	})
+}
+
+// computeServiceExperience estimates the MOS, per application and slice, of
+// the flows reported over [startTs, endTs]
+func (e *AnalyticsEngine) computeServiceExperience(src nwdafContext.HistorySource, f *EventFilter, startTs, endTs int64) []*ServiceExperienceInfo {
+	calibrations := e.calibrations(src, f.AppIds, endTs)
+	groups := e.scoreExperience(src, f, startTs, endTs, calibrations)
+
+	infos := make([]*ServiceExperienceInfo, 0, len(groups))
+	for _, g := range groups {
+		info := newExperienceInfo(g, calibrations)
+		var sum float64
+		for _, p := range g.points {
+			sum += p.Value
+		}
+		info.setMOS(sum / float64(len(g.points)))
+		infos = append(infos, info)
+	}
+	sortExperienceInfos(infos)
+	return infos
+}
+
+// predictServiceExperience forecasts the MOS, per application and slice,
+// over the future window [startTs, endTs] from the training history
+func (e *AnalyticsEngine) predictServiceExperience(f *EventFilter, startTs, endTs int64) []*ServiceExperienceInfo {
+	forecast := factory.NwdafConfig.Configuration.GetForecast()
+	params := forecastParams(forecast)
+	now := e.clock.Now().Unix()
+
+	calibrations := e.calibrations(e.context, f.AppIds, now)
+	groups := e.scoreExperience(e.context, f, now-int64(forecast.History), now, calibrations)
+
+	infos := make([]*ServiceExperienceInfo, 0, len(groups))
+	for _, g := range groups {
+		result, ok := forecastWindow(g.points, forecast.DefaultModel, int64(forecast.Step), startTs, endTs, params)
+		if !ok {
+			continue
+		}
+		info := newExperienceInfo(g, calibrations)
+		info.setMOS(result.Average)
+		info.Confidence = result.Confidence
+		infos = append(infos, info)
+	}
+	sortExperienceInfos(infos)
+	return infos
+}
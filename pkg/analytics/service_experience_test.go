@@ -0,0 +1,79 @@
+package analytics
+
+import (
+	"math"
+	"testing"
+
+	nwdafContext "github.com/free5gc/nwdaf/pkg/context"
+	"github.com/free5gc/nwdaf/pkg/factory"
+)
+
+func TestScoreMOS(t *testing.T) {
+	model := factory.NwdafConfig.Configuration.GetScoringModel("video")
+
+	tests := []struct {
+		name                            string
+		latency, packetLoss, throughput float64
+		want                            float64
+	}{
+		{"Excellent", 10, 0, 20, 5},
+		{"Unusable", 500, 0.2, 0.1, 1},
+		{"Latency only", 500, 0, 20, 3.4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := scoreMOS(model, &nwdafContext.UEStatistics{Latency: tt.latency, PacketLoss: tt.packetLoss, Throughput: tt.throughput})
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("Expected MOS %.2f, got %.2f", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestServiceExperienceCalibration(t *testing.T) {
+	factory.NwdafConfig.Configuration.ServiceExperience = &factory.ServiceExperienceConfig{
+		Applications: map[string]*factory.ScoringModel{
+			"gaming": {
+				Latency: factory.MetricRange{Good: 10, Bad: 110},
+				Weights: factory.ScoringWeights{Latency: 1},
+			},
+		},
+	}
+	defer func() { factory.NwdafConfig.Configuration.ServiceExperience = nil }()
+
+	ctx := &nwdafContext.NWDAFContext{DataStore: nwdafContext.NewDataStore()}
+	engine := NewAnalyticsEngine(ctx)
+
+	// 60ms scores 3.0 under the gaming model; 35ms and 85ms score 4.0 and 2.0
+	for i, latency := range []float64{35, 85, 35, 85} {
+		supi := []string{"imsi-1", "imsi-2"}[i%2]
+		ctx.UpdateUEStatistics(supi, &nwdafContext.UEStatistics{
+			SUPI:      supi,
+			AppId:     "gaming",
+			Snssai:    "1-000001",
+			Latency:   latency,
+			Timestamp: int64(1000 + i*10),
+		})
+	}
+
+	infos := engine.computeServiceExperience(engine.context, mustParseFilter(t, map[string]interface{}{"appIds": "gaming"}), 900, 1100)
+	if len(infos) != 1 || infos[0].Calibrated {
+		t.Fatalf("Expected one uncalibrated entry, got %+v", infos)
+	}
+	if got := infos[0].SvcExprc; got.Mos != 3 || got.LowerRange != 2 || got.UpperRange != 4 {
+		t.Errorf("Expected MOS 3 ranging 2..4, got %+v", got)
+	}
+
+	// The AF reports users are half a point happier than estimated
+	ctx.AddServiceExperienceSample(&nwdafContext.ServiceExperienceSample{AppId: "gaming", Supi: "imsi-1", Mos: 4.5, Timestamp: 1030})
+	ctx.AddServiceExperienceSample(&nwdafContext.ServiceExperienceSample{AppId: "gaming", Supi: "imsi-2", Mos: 2.5, Timestamp: 1030})
+
+	infos = engine.computeServiceExperience(engine.context, mustParseFilter(t, map[string]interface{}{"appIds": "gaming"}), 900, 1100)
+	if !infos[0].Calibrated || infos[0].CalibrationSamples != 2 {
+		t.Fatalf("Expected calibration from 2 AF samples, got %+v", infos[0])
+	}
+	if got := infos[0].SvcExprc.Mos; math.Abs(got-3.5) > 1e-9 {
+		t.Errorf("Expected the calibrated MOS to be 3.5, got %.2f", got)
+	}
+}
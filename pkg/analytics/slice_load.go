@@ -0,0 +1,98 @@
+package analytics
+
+import (
+	nwdafContext "github.com/free5gc/nwdaf/pkg/context"
+	"github.com/free5gc/nwdaf/pkg/factory"
+)
+
+// SliceLoadSummary aggregates the samples of one slice over a window
+type SliceLoadSummary struct {
+	SNSSAI               string  `json:"snssai"`
+	Samples              int     `json:"samples"`
+	AverageActiveUEs     float64 `json:"averageActiveUes"`
+	AverageThroughput    float64 `json:"averageThroughput"`
+	AverageResourceUsage float64 `json:"averageResourceUsage"`
+	PeakResourceUsage    float64 `json:"peakResourceUsage"`
+}
+
+// SliceLoadPrediction is the predicted resource usage (0..1) of one slice
+// over a future window. Confidence is 0..100.
+type SliceLoadPrediction struct {
+	SNSSAI               string  `json:"snssai"`
+	AverageResourceUsage float64 `json:"averageResourceUsage"`
+	PeakResourceUsage    float64 `json:"peakResourceUsage"`
+	Trend                string  `json:"trend"`
+	Model                string  `json:"model"`
+	Confidence           int     `json:"confidence"`
+}
+
+// computeSliceLoad summarises the samples of each slice in scope
+func (e *AnalyticsEngine) computeSliceLoad(src nwdafContext.HistorySource, f *EventFilter, startTs, endTs int64) map[string]*SliceLoadSummary {
+	history := src.GetSliceStatisticsInWindow(startTs, endTs)
+
+	summaries := make(map[string]*SliceLoadSummary, len(history))
+	for snssai, samples := range history {
+		if !matchesAny(f.Snssais, snssai) {
+			continue
+		}
+		summary := &SliceLoadSummary{SNSSAI: snssai, Samples: len(samples)}
+		for _, s := range samples {
+			summary.AverageActiveUEs += float64(s.ActiveUEs)
+			summary.AverageThroughput += s.Throughput
+			summary.AverageResourceUsage += s.ResourceUsage
+			if s.ResourceUsage > summary.PeakResourceUsage {
+				summary.PeakResourceUsage = s.ResourceUsage
+			}
+		}
+		n := float64(len(samples))
+		summary.AverageActiveUEs /= n
+		summary.AverageThroughput /= n
+		summary.AverageResourceUsage /= n
+		summaries[snssai] = summary
+	}
+	return summaries
+}
+
+// predictSliceLoad forecasts the resource usage of each slice in scope from
+// its recent history, using its trained model if there is one
+func (e *AnalyticsEngine) predictSliceLoad(f *EventFilter, startTs, endTs int64) map[string]*SliceLoadPrediction {
+	config := factory.NwdafConfig.Configuration
+	forecast := config.GetForecast()
+	params := forecastParams(forecast)
+
+	now := e.clock.Now().Unix()
+	predictions := make(map[string]*SliceLoadPrediction)
+	for snssai, samples := range e.context.GetSliceStatisticsInWindow(now-int64(forecast.History), now) {
+		if !matchesAny(f.Snssais, snssai) {
+			continue
+		}
+
+		points := make([]Point, len(samples))
+		for i, s := range samples {
+			points[i] = Point{Ts: s.Timestamp, Value: s.ResourceUsage}
+		}
+		model, params := e.seriesModel("SLICE_LOAD", snssai, forecast.DefaultModel, params)
+		result, ok := forecastWindow(points, model, int64(forecast.Step), startTs, endTs, params)
+		if !ok {
+			continue
+		}
+
+		average := clampLoad(result.Average)
+		trend := TrendStable
+		if average-result.Last > trendMargin {
+			trend = TrendIncreasing
+		} else if result.Last-average > trendMargin {
+			trend = TrendDecreasing
+		}
+
+		predictions[snssai] = &SliceLoadPrediction{
+			SNSSAI:               snssai,
+			AverageResourceUsage: average,
+			PeakResourceUsage:    clampLoad(result.Peak),
+			Trend:                trend,
+			Model:                result.Model,
+			Confidence:           result.Confidence,
+		}
+	}
+	return predictions
+}
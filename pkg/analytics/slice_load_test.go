@@ -0,0 +1,36 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/free5gc/nwdaf/pkg/clock"
+	nwdafContext "github.com/free5gc/nwdaf/pkg/context"
+)
+
+func TestSliceLoad(t *testing.T) {
+	ctx := &nwdafContext.NWDAFContext{DataStore: nwdafContext.NewDataStore()}
+	engine := NewAnalyticsEngine(ctx)
+	now := time.Unix(1700003600, 0)
+	engine.SetClock(clock.NewVirtual(now, 1))
+
+	// Usage of the first slice rising steadily over the last hour
+	for i := 0; i <= 12; i++ {
+		ts := now.Unix() - 3600 + int64(i*300)
+		ctx.UpdateSliceStatistics("1-010203", &nwdafContext.SliceStatistics{SNSSAI: "1-010203", ActiveUEs: 10, ResourceUsage: 0.2 + 0.05*float64(i), Timestamp: ts})
+		ctx.UpdateSliceStatistics("2-000001", &nwdafContext.SliceStatistics{SNSSAI: "2-000001", ActiveUEs: 4, ResourceUsage: 0.3, Timestamp: ts})
+	}
+
+	summaries := engine.computeSliceLoad(engine.context, &EventFilter{}, now.Unix()-3600, now.Unix())
+	if s := summaries["2-000001"]; len(summaries) != 2 || s.Samples != 13 || s.AverageActiveUEs != 4 {
+		t.Errorf("Expected 13 samples of 4 UEs for 2-000001, got %+v", s)
+	}
+
+	predictions := engine.predictSliceLoad(&EventFilter{Snssais: []string{"1-010203"}}, now.Unix(), now.Unix()+900)
+	if len(predictions) != 1 {
+		t.Fatalf("Expected one prediction, got %d", len(predictions))
+	}
+	if p := predictions["1-010203"]; p.Trend != TrendIncreasing || p.AverageResourceUsage <= 0.8 {
+		t.Errorf("Expected an increasing usage above 0.8, got %+v", p)
+	}
+}
@@ -0,0 +1,409 @@
+package analytics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/free5gc/nwdaf/internal/logger"
+	nwdafContext "github.com/free5gc/nwdaf/pkg/context"
+	"github.com/free5gc/nwdaf/pkg/factory"
+)
+
+// ModelFormatVersion is the version of the model file format. Files of other
+// format versions are not loaded.
+const ModelFormatVersion = 1
+
+// ErrModelFormat is returned for model files that cannot be loaded
+var ErrModelFormat = errors.New("invalid model file")
+
+// ModelFile is the set of models trained for one event type, one per series
+// (e.g. per NF instance), as stored on disk. Each training run writes a new
+// version.
+type ModelFile struct {
+	FormatVersion int    `json:"formatVersion"`
+	EventId       string `json:"eventId"`
+	Version       int    `json:"version"`
+	// Features are the input values the series are made of
+	Features       []string         `json:"features"`
+	TrainedAt      int64            `json:"trainedAt"`
+	TrainingWindow map[string]int64 `json:"trainingWindow"`
+	// Step is the resampling interval (seconds) the models were trained at
+	Step int64 `json:"step"`
+	// Accuracy (0..1) is the mean accuracy of the models on held-out history
+	Accuracy float64                  `json:"accuracy"`
+	Models   map[string]*TrainedModel `json:"models"`
+}
+
+// TrainedModel is the model and smoothing factors selected for one series.
+// Predictions fit it on the latest history of the series.
+type TrainedModel struct {
+	Model    string         `json:"model"`
+	Params   ForecastParams `json:"params"`
+	Samples  int            `json:"samples"`
+	Accuracy float64        `json:"accuracy"`
+}
+
+// trainingSet is an event type whose models are trained, with the series
+// its predictions are made from
+type trainingSet struct {
+	eventId  string
+	features []string
+	series   func(src nwdafContext.HistorySource, startTs, endTs int64) map[string][]Point
+}
+
+// TrainedEvents returns the event types models are trained for
+func TrainedEvents() []string {
+	events := make([]string, len(trainingSets))
+	for i, set := range trainingSets {
+		events[i] = set.eventId
+	}
+	return events
+}
+
+var trainingSets = []trainingSet{
+	{"NF_LOAD", []string{"load"}, nfLoadSeries},
+	{"SLICE_LOAD", []string{"resourceUsage"}, sliceLoadSeries},
+}
+
+// Smoothing factors tried when training
+var smoothingGrid = []float64{0.1, 0.3, 0.5, 0.8}
+
+// modelSet holds the models in use, swapped as new versions are trained or
+// loaded
+type modelSet struct {
+	mu    sync.RWMutex
+	files map[string]*ModelFile
+}
+
+func newModelSet() *modelSet {
+	return &modelSet{files: make(map[string]*ModelFile)}
+}
+
+func (s *modelSet) get(eventId string) *ModelFile {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.files[eventId]
+}
+
+// set puts a model file in use unless a newer version already is
+func (s *modelSet) set(file *ModelFile) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if current, ok := s.files[file.EventId]; ok && current.Version >= file.Version {
+		return false
+	}
+	s.files[file.EventId] = file
+	ModelVersion.WithLabelValues(file.EventId).Set(float64(file.Version))
+	return true
+}
+
+// useModels puts a model file in use unless a newer version already is, and
+// notifies the consumers subscribed to its event type
+func (e *AnalyticsEngine) useModels(file *ModelFile) bool {
+	if !e.models.set(file) {
+		return false
+	}
+	e.notifyModelSubscribers(file)
+	return true
+}
+
+// seriesModel returns the model and smoothing factors to predict a series
+// with: the trained model of the series if there is one, else the configured
+// model
+func (e *AnalyticsEngine) seriesModel(eventId, key, model string, params ForecastParams) (string, ForecastParams) {
+	if file := e.models.get(eventId); file != nil {
+		if m, ok := file.Models[key]; ok {
+			return m.Model, m.Params
+		}
+	}
+	return model, params
+}
+
+// StartTraining trains the models every configured interval until ctx is
+// done. Models already in the model directory are loaded first.
+func (e *AnalyticsEngine) StartTraining(ctx context.Context) {
+	config := factory.NwdafConfig.Configuration.GetTraining()
+	e.ReloadModels()
+
+	ticker := e.clock.NewTicker(time.Duration(config.Interval) * time.Second)
+	defer ticker.Stop()
+	logger.AnalyticsLog.Infof("Model training every %ds into %s", config.Interval, config.ModelDir)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			if _, err := e.TrainModels(ctx); err != nil {
+				logger.AnalyticsLog.Errorf("Model training failed: %v", err)
+			}
+		}
+	}
+}
+
+// TrainModels trains the models of each event type on the forecast history,
+// writes them as new versions to the model directory and puts them in use.
+// Event types without history are skipped. History older than the local
+// retention is retrieved from the ADRF within ctx.
+func (e *AnalyticsEngine) TrainModels(ctx context.Context) ([]*ModelFile, error) {
+	config := factory.NwdafConfig.Configuration.GetTraining()
+	forecast := factory.NwdafConfig.Configuration.GetForecast()
+	if err := os.MkdirAll(config.ModelDir, 0o755); err != nil {
+		return nil, err
+	}
+	versions, err := modelVersions(config.ModelDir)
+	if err != nil {
+		return nil, err
+	}
+
+	now := e.clock.Now().Unix()
+	startTs := now - int64(forecast.History)
+	step := int64(forecast.Step)
+	defaults := forecastParams(forecast)
+
+	src := e.historySource(ctx, startTs, now)
+	files := make([]*ModelFile, 0, len(trainingSets))
+	for _, set := range trainingSets {
+		file := &ModelFile{
+			FormatVersion:  ModelFormatVersion,
+			EventId:        set.eventId,
+			Features:       set.features,
+			TrainedAt:      now,
+			TrainingWindow: windowInfo(startTs, now),
+			Step:           step,
+			Models:         make(map[string]*TrainedModel),
+		}
+		for key, points := range set.series(src, startTs, now) {
+			if m, ok := trainSeries(points, step, config.Holdout, defaults); ok {
+				file.Models[key] = m
+				file.Accuracy += m.Accuracy
+			}
+		}
+		if len(file.Models) == 0 {
+			continue
+		}
+		file.Accuracy /= float64(len(file.Models))
+
+		file.Version = latestVersion(versions[set.eventId]) + 1
+		if current := e.models.get(set.eventId); current != nil && current.Version >= file.Version {
+			file.Version = current.Version + 1
+		}
+		if _, err := SaveModelFile(config.ModelDir, file); err != nil {
+			return files, err
+		}
+		e.useModels(file)
+		served := file.Version
+		if current := e.models.get(set.eventId); current != nil {
+			served = current.Version
+		}
+		pruneModelFiles(config.ModelDir, set.eventId, append(versions[set.eventId], file.Version), config.Keep, served)
+		logger.AnalyticsLog.Infof("Trained %s models v%d for %d series, %d%% accurate",
+			file.EventId, file.Version, len(file.Models), percent(file.Accuracy))
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// ReloadModels puts in use the latest model version of each event type found
+// in the model directory, if newer than the one in use
+func (e *AnalyticsEngine) ReloadModels() {
+	dir := factory.NwdafConfig.Configuration.GetTraining().ModelDir
+	versions, err := modelVersions(dir)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			logger.AnalyticsLog.Warnf("Reading models: %v", err)
+		}
+		return
+	}
+
+	for eventId, available := range versions {
+		version := latestVersion(available)
+		if current := e.models.get(eventId); current != nil && current.Version >= version {
+			continue
+		}
+		file, err := LoadModelFile(filepath.Join(dir, modelFileName(eventId, version)))
+		if err != nil {
+			logger.AnalyticsLog.Warnf("Loading %s models v%d: %v", eventId, version, err)
+			continue
+		}
+		if e.useModels(file) {
+			logger.AnalyticsLog.Infof("Loaded %s models v%d", eventId, file.Version)
+		}
+	}
+}
+
+// trainSeries selects the model and smoothing factors that best predict the
+// held-out end of a series from the rest of it
+func trainSeries(points []Point, step int64, holdout float64, defaults ForecastParams) (*TrainedModel, bool) {
+	series, _ := resample(points, step)
+	test := int(math.Round(float64(len(series)) * holdout))
+	if test < 1 {
+		test = 1
+	}
+	train := len(series) - test
+
+	var best *TrainedModel
+	for _, c := range trainingCandidates(defaults) {
+		forecasters := c.params.candidates(c.model, step)
+		if len(forecasters) == 0 || forecasters[0].Name() != c.model || train < forecasters[0].MinSamples() {
+			continue
+		}
+		f := forecasters[0]
+		f.Fit(series[:train])
+		var score float64
+		for h := 1; h <= test; h++ {
+			score += predictionAccuracy(f.Predict(h), series[train+h-1])
+		}
+		score /= float64(test)
+		if best == nil || score > best.Accuracy {
+			best = &TrainedModel{Model: c.model, Params: c.params, Samples: len(series), Accuracy: score}
+		}
+	}
+	return best, best != nil
+}
+
+type trainingCandidate struct {
+	model  string
+	params ForecastParams
+}
+
+// trainingCandidates lists each model with each smoothing factor of the grid,
+// simplest models first so that they win ties
+func trainingCandidates(defaults ForecastParams) []trainingCandidate {
+	candidates := []trainingCandidate{{ModelLinear, defaults}}
+	for _, alpha := range smoothingGrid {
+		p := defaults
+		p.EwmaAlpha = alpha
+		candidates = append(candidates, trainingCandidate{ModelEWMA, p})
+	}
+	for _, alpha := range smoothingGrid {
+		for _, gamma := range smoothingGrid {
+			p := defaults
+			p.HwAlpha, p.HwGamma = alpha, gamma
+			candidates = append(candidates, trainingCandidate{ModelHoltWinters, p})
+		}
+	}
+	return candidates
+}
+
+// nfLoadSeries returns the load of each NF instance
+func nfLoadSeries(src nwdafContext.HistorySource, startTs, endTs int64) map[string][]Point {
+	series := make(map[string][]Point)
+	for nfId, samples := range src.GetNFStatisticsInWindow(startTs, endTs) {
+		for _, s := range samples {
+			series[nfId] = append(series[nfId], Point{Ts: s.Timestamp, Value: s.Load})
+		}
+	}
+	return series
+}
+
+// sliceLoadSeries returns the resource usage of each slice
+func sliceLoadSeries(src nwdafContext.HistorySource, startTs, endTs int64) map[string][]Point {
+	series := make(map[string][]Point)
+	for snssai, samples := range src.GetSliceStatisticsInWindow(startTs, endTs) {
+		for _, s := range samples {
+			series[snssai] = append(series[snssai], Point{Ts: s.Timestamp, Value: s.ResourceUsage})
+		}
+	}
+	return series
+}
+
+var modelFilePattern = regexp.MustCompile(`^(.+)-v(\d+)\.json$`)
+
+func modelFileName(eventId string, version int) string {
+	return fmt.Sprintf("%s-v%d.json", eventId, version)
+}
+
+// SaveModelFile writes a model file to dir and returns its path. The file is
+// renamed into place so that readers never see it partly written.
+func SaveModelFile(dir string, file *ModelFile) (string, error) {
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, modelFileName(file.EventId, file.Version))
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return "", err
+	}
+	return path, os.Rename(tmp, path)
+}
+
+// LoadModelFile reads a model file, rejecting other format versions
+func LoadModelFile(path string) (*ModelFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseModelFile(data)
+}
+
+// parseModelFile decodes a model file, rejecting other format versions
+func parseModelFile(data []byte) (*ModelFile, error) {
+	file := &ModelFile{}
+	if err := json.Unmarshal(data, file); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrModelFormat, err)
+	}
+	if file.FormatVersion != ModelFormatVersion {
+		return nil, fmt.Errorf("%w: format version %d, expected %d", ErrModelFormat, file.FormatVersion, ModelFormatVersion)
+	}
+	if file.EventId == "" || file.Version <= 0 {
+		return nil, fmt.Errorf("%w: missing event type or version", ErrModelFormat)
+	}
+	return file, nil
+}
+
+// modelVersions lists the model versions in dir by event type, in order
+func modelVersions(dir string) (map[string][]int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	versions := make(map[string][]int)
+	for _, entry := range entries {
+		match := modelFilePattern.FindStringSubmatch(entry.Name())
+		if match == nil || entry.IsDir() {
+			continue
+		}
+		version, err := strconv.Atoi(match[2])
+		if err != nil {
+			continue
+		}
+		versions[match[1]] = append(versions[match[1]], version)
+	}
+	for _, v := range versions {
+		sort.Ints(v)
+	}
+	return versions, nil
+}
+
+func latestVersion(versions []int) int {
+	if len(versions) == 0 {
+		return 0
+	}
+	return versions[len(versions)-1]
+}
+
+// pruneModelFiles removes all but the latest keep versions, at least one,
+// and never the version served
+func pruneModelFiles(dir, eventId string, versions []int, keep, served int) {
+	keep = max(keep, 1)
+	for i := 0; i < len(versions)-keep; i++ {
+		if versions[i] == served {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, modelFileName(eventId, versions[i]))); err != nil {
+			logger.AnalyticsLog.Warnf("Removing %s models v%d: %v", eventId, versions[i], err)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/free5gc/nwdaf/pkg/clock"
+	nwdafContext "github.com/free5gc/nwdaf/pkg/context"
+	"github.com/free5gc/nwdaf/pkg/factory"
+)
+
+func TestTrainSeries(t *testing.T) {
+	// A steady rise is best predicted by a trend model
+	points := make([]Point, 48)
+	for i := range points {
+		points[i] = Point{Ts: int64(i * 300), Value: 0.1 + 0.01*float64(i)}
+	}
+	m, ok := trainSeries(points, 300, 0.2, forecastParams(factory.ForecastConfig{HoltWinters: &factory.HoltWintersParams{}}))
+	if !ok {
+		t.Fatal("Expected a trained model")
+	}
+	if m.Model != ModelLinear || m.Accuracy < 0.99 || m.Samples != 48 {
+		t.Errorf("Expected an accurate linear model over 48 samples, got %+v", m)
+	}
+
+	if _, ok := trainSeries(points[:1], 300, 0.2, ForecastParams{}); ok {
+		t.Error("Expected no model from a single sample")
+	}
+}
+
+func TestTrainModels(t *testing.T) {
+	dir := t.TempDir()
+	factory.NwdafConfig.Configuration.Training = &factory.TrainingConfig{ModelDir: dir, Keep: 2}
+	defer func() { factory.NwdafConfig.Configuration.Training = nil }()
+
+	ctx := &nwdafContext.NWDAFContext{DataStore: nwdafContext.NewDataStore()}
+	engine := NewAnalyticsEngine(ctx)
+	now := time.Unix(1700003600, 0)
+	virtual := clock.NewVirtual(now, 1)
+	engine.SetClock(virtual)
+	for i := 0; i <= 24; i++ {
+		ts := now.Unix() - 7200 + int64(i*300)
+		ctx.UpdateNFStatistics("amf-1", &nwdafContext.NFStatistics{NFInstanceId: "amf-1", NFType: "AMF", Load: 0.2 + 0.02*float64(i), Timestamp: ts})
+		ctx.UpdateNFStatistics("smf-1", &nwdafContext.NFStatistics{NFInstanceId: "smf-1", NFType: "SMF", Load: 0.4, Timestamp: ts})
+	}
+
+	files, err := engine.TrainModels(context.Background())
+	if err != nil {
+		t.Fatalf("TrainModels() error = %v", err)
+	}
+	if len(files) != 1 || files[0].EventId != "NF_LOAD" {
+		t.Fatalf("Expected NF_LOAD models only, got %+v", files)
+	}
+	file, err := LoadModelFile(filepath.Join(dir, "NF_LOAD-v1.json"))
+	if err != nil {
+		t.Fatalf("LoadModelFile() error = %v", err)
+	}
+	if file.FormatVersion != ModelFormatVersion || len(file.Models) != 2 || file.Features[0] != "load" || file.TrainingWindow["endTs"] != now.Unix() {
+		t.Errorf("Expected metadata and models for 2 NFs, got %+v", file)
+	}
+
+	// Predictions use the trained model
+	model := file.Models["amf-1"].Model
+	for _, p := range engine.predictNFLoad(&EventFilter{NfInstanceIds: []string{"amf-1"}}, now.Unix(), now.Unix()+900) {
+		if p.Model != model {
+			t.Errorf("Expected predictions with the trained %s model, got %s", model, p.Model)
+		}
+	}
+
+	// Later runs add versions and keep the configured number
+	for i := 0; i < 2; i++ {
+		virtual.Advance(time.Hour)
+		if _, err := engine.TrainModels(context.Background()); err != nil {
+			t.Fatalf("TrainModels() error = %v", err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "NF_LOAD-v1.json")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected v1 to be pruned, got %v", err)
+	}
+
+	// Another engine hot-loads the latest version, skipping unknown formats
+	if err := os.WriteFile(filepath.Join(dir, "SLICE_LOAD-v1.json"), []byte(`{"formatVersion": 99, "eventId": "SLICE_LOAD", "version": 1}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	other := NewAnalyticsEngine(ctx)
+	other.ReloadModels()
+	if file := other.models.get("NF_LOAD"); file == nil || file.Version != 3 {
+		t.Errorf("Expected NF_LOAD models v3 to be loaded, got %+v", file)
+	}
+	if file := other.models.get("SLICE_LOAD"); file != nil {
+		t.Errorf("Expected an unknown format version to be skipped, got %+v", file)
+	}
+
+	// Keeping a single version never removes the one in use
+	factory.NwdafConfig.Configuration.Training.Keep = 1
+	virtual.Advance(time.Hour)
+	if _, err := engine.TrainModels(context.Background()); err != nil {
+		t.Fatalf("TrainModels() error = %v", err)
+	}
+	served := engine.models.get("NF_LOAD")
+	if _, err := os.Stat(filepath.Join(dir, modelFileName("NF_LOAD", served.Version))); err != nil {
+		t.Errorf("Expected the served v%d to be kept, got %v", served.Version, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "NF_LOAD-v3.json")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected v3 to be pruned, got %v", err)
+	}
+}
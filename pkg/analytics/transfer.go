@@ -0,0 +1,245 @@
+package analytics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/free5gc/nwdaf/internal/logger"
+	nwdafContext "github.com/free5gc/nwdaf/pkg/context"
+	"github.com/free5gc/nwdaf/pkg/factory"
+)
+
+// ContextData is the analytics context of some UEs handed over to another
+// NWDAF instance (TS 29.520 Nnwdaf_AnalyticsInfo context transfer)
+type ContextData struct {
+	// SourceNfId is the NWDAF the context was exported from
+	SourceNfId string                    `json:"sourceNfId,omitempty"`
+	UeContexts []*nwdafContext.UEContext `json:"ueContexts"`
+	// Subscriptions are the analytics subscriptions targeting only the UEs
+	Subscriptions []*nwdafContext.AnalyticsSubscription `json:"subscriptions,omitempty"`
+	// PendingOutputs are the predictions issued for the UEs whose window has
+	// not elapsed yet; the importing NWDAF checks their accuracy
+	PendingOutputs []*PendingOutput `json:"pendingOutputs,omitempty"`
+	// ReportedExceptions are the last report times (Unix seconds) of the
+	// abnormal behaviours of the UEs, keyed "<supi>/<excepId>", so that the
+	// importing NWDAF does not report them again within the suppress time
+	ReportedExceptions map[string]int64 `json:"reportedExceptions,omitempty"`
+}
+
+// PendingOutput is a prediction output waiting for its window to elapse
+type PendingOutput struct {
+	EventType   string             `json:"eventType"`
+	Filter      *EventFilter       `json:"filter"`
+	StartTs     int64              `json:"startTs"`
+	EndTs       int64              `json:"endTs"`
+	Predictions []PendingPredicted `json:"predictions"`
+}
+
+// PendingPredicted is one predicted value of a pending output
+type PendingPredicted struct {
+	Key   string  `json:"key"`
+	Model string  `json:"model"`
+	Value float64 `json:"value"`
+}
+
+// ContextImportSummary counts what an import added
+type ContextImportSummary struct {
+	SourceNfId     string `json:"sourceNfId,omitempty"`
+	Ues            int    `json:"ues"`
+	Samples        int    `json:"samples"`
+	Subscriptions  int    `json:"subscriptions"`
+	PendingOutputs int    `json:"pendingOutputs"`
+	// SubscriptionIds are the subscriptions imported
+	SubscriptionIds []string `json:"subscriptionIds,omitempty"`
+	// Transferred is how the source handed the imported subscriptions over,
+	// or AcknowledgeError why it could not be told of the import
+	Transferred      []*SubscriptionTransferResult `json:"transferred,omitempty"`
+	AcknowledgeError string                        `json:"acknowledgeError,omitempty"`
+}
+
+// ContextAcknowledgement tells the source NWDAF which of its subscriptions
+// the target imported with a context, so that it stops serving them
+type ContextAcknowledgement struct {
+	// TargetUri is the API root of the importing NWDAF
+	TargetUri       string   `json:"targetUri"`
+	SubscriptionIds []string `json:"subscriptionIds"`
+}
+
+// targetsOnly reports whether a filter targets some UEs, all of them among
+// the given SUPIs
+func targetsOnly(f *EventFilter, supis []string) bool {
+	if len(f.Supis) == 0 || len(f.IntGroupIds) > 0 {
+		return false
+	}
+	for _, supi := range f.Supis {
+		if !slices.Contains(supis, supi) {
+			return false
+		}
+	}
+	return true
+}
+
+// ExportContext returns the analytics context of some UEs: their history,
+// the subscriptions and pending outputs targeting them alone and their
+// recently reported abnormal behaviours. The local context is left as is;
+// the subscriptions are only handed over once the importing NWDAF
+// acknowledges them.
+func (e *AnalyticsEngine) ExportContext(supis []string) *ContextData {
+	data := &ContextData{SourceNfId: e.context.NfId, ReportedExceptions: make(map[string]int64)}
+	for _, supi := range supis {
+		data.UeContexts = append(data.UeContexts, e.context.ExportUEContext(supi))
+	}
+
+	e.context.SubMutex.RLock()
+	for _, sub := range e.context.Subscriptions {
+		if f, err := ParseFilter(sub.AnalyticsFilter); err == nil && targetsOnly(f, supis) {
+			copied := *sub
+			data.Subscriptions = append(data.Subscriptions, &copied)
+		}
+	}
+	e.context.SubMutex.RUnlock()
+	slices.SortFunc(data.Subscriptions, func(a, b *nwdafContext.AnalyticsSubscription) int {
+		return strings.Compare(a.SubscriptionId, b.SubscriptionId)
+	})
+
+	e.accuracy.mu.Lock()
+	for _, p := range e.accuracy.pending {
+		if !targetsOnly(p.filter, supis) {
+			continue
+		}
+		output := &PendingOutput{EventType: p.eventType, Filter: p.filter, StartTs: p.startTs, EndTs: p.endTs}
+		for _, prediction := range p.predictions {
+			output.Predictions = append(output.Predictions, PendingPredicted{Key: prediction.key, Model: prediction.model, Value: prediction.value})
+		}
+		data.PendingOutputs = append(data.PendingOutputs, output)
+	}
+	e.accuracy.mu.Unlock()
+
+	e.abnormal.mu.Lock()
+	for key, ts := range e.abnormal.last {
+		if supi, _, ok := strings.Cut(key, "/"); ok && slices.Contains(supis, supi) {
+			data.ReportedExceptions[key] = ts
+		}
+	}
+	e.abnormal.mu.Unlock()
+	return data
+}
+
+// ImportContext adds the analytics context exported by another NWDAF.
+// Subscriptions keep their identifier so that consumers can go on using it;
+// those already known are left unchanged.
+func (e *AnalyticsEngine) ImportContext(data *ContextData) *ContextImportSummary {
+	summary := &ContextImportSummary{SourceNfId: data.SourceNfId}
+	for _, uc := range data.UeContexts {
+		if uc == nil || uc.Supi == "" {
+			continue
+		}
+		summary.Ues++
+		summary.Samples += e.context.ImportUEContext(uc)
+	}
+
+	for _, sub := range data.Subscriptions {
+		if sub == nil || sub.SubscriptionId == "" {
+			continue
+		}
+		if err := ValidateFilter(sub.EventType, sub.AnalyticsFilter); err != nil {
+			logger.AnalyticsLog.Warnf("Transferred subscription %s skipped: %v", sub.SubscriptionId, err)
+			continue
+		}
+		copied := *sub
+		if _, added := e.context.AddSubscriptionIfAbsent(&copied); !added {
+			continue
+		}
+		summary.Subscriptions++
+		summary.SubscriptionIds = append(summary.SubscriptionIds, sub.SubscriptionId)
+	}
+
+	maxPending := factory.NwdafConfig.Configuration.GetAccuracy().MaxPending
+	e.accuracy.mu.Lock()
+	for _, output := range data.PendingOutputs {
+		if output == nil || output.Filter == nil || len(output.Predictions) == 0 {
+			continue
+		}
+		p := &pendingPrediction{eventType: output.EventType, filter: output.Filter, startTs: output.StartTs, endTs: output.EndTs}
+		for _, prediction := range output.Predictions {
+			p.predictions = append(p.predictions, issuedPrediction{key: prediction.Key, model: prediction.Model, value: prediction.Value})
+		}
+		e.accuracy.pending = append(e.accuracy.pending, p)
+		summary.PendingOutputs++
+	}
+	if excess := len(e.accuracy.pending) - maxPending; excess > 0 {
+		e.accuracy.pending = e.accuracy.pending[excess:]
+	}
+	e.accuracy.mu.Unlock()
+
+	e.abnormal.mu.Lock()
+	for key, ts := range data.ReportedExceptions {
+		if ts > e.abnormal.last[key] {
+			e.abnormal.last[key] = ts
+		}
+	}
+	e.abnormal.mu.Unlock()
+
+	logger.AnalyticsLog.Infof("Imported the context of %d UEs from %s: %d samples, %d subscriptions, %d pending outputs",
+		summary.Ues, data.SourceNfId, summary.Samples, summary.Subscriptions, summary.PendingOutputs)
+	return summary
+}
+
+// TransferContext fetches the analytics context of some UEs from the NWDAF
+// serving them so far and imports it (incoming side of a handover). The
+// source is then told which subscriptions were imported, so that it hands
+// them over rather than serve them too.
+func (e *AnalyticsEngine) TransferContext(ctx context.Context, sourceUri string, supis []string) (*ContextImportSummary, error) {
+	query := url.Values{}
+	query.Set("supis", strings.Join(supis, ","))
+	uri := strings.TrimRight(sourceUri, "/") + AnalyticsInfoPath + "/context?" + query.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("source NWDAF replied %s", resp.Status)
+	}
+	var data ContextData
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, fmt.Errorf("invalid context data: %w", err)
+	}
+	summary := e.ImportContext(&data)
+	if len(summary.SubscriptionIds) == 0 {
+		return summary, nil
+	}
+
+	ack := &ContextAcknowledgement{TargetUri: factory.NwdafConfig.Configuration.GetSbiUri(), SubscriptionIds: summary.SubscriptionIds}
+	if err := e.postJSON(strings.TrimRight(sourceUri, "/")+AnalyticsInfoPath+"/context/ack", ack, &summary.Transferred); err != nil {
+		logger.AnalyticsLog.Warnf("Source %s not told of the imported subscriptions %v: %v", sourceUri, summary.SubscriptionIds, err)
+		summary.AcknowledgeError = err.Error()
+	}
+	return summary, nil
+}
+
+// AcknowledgeContext hands over the subscriptions another NWDAF imported with
+// the context of their UEs (outgoing side of a handover): their consumers are
+// notified of the new NWDAF and they are removed locally.
+func (e *AnalyticsEngine) AcknowledgeContext(ack *ContextAcknowledgement) []*SubscriptionTransferResult {
+	results := make([]*SubscriptionTransferResult, 0, len(ack.SubscriptionIds))
+	for _, id := range ack.SubscriptionIds {
+		sub, ok := e.context.GetSubscription(id)
+		if !ok {
+			results = append(results, &SubscriptionTransferResult{SubscriptionId: id, Error: "subscription not found"})
+			continue
+		}
+		results = append(results, e.handOver(strings.TrimRight(ack.TargetUri, "/"), sub, id))
+	}
+	return results
+}
@@ -0,0 +1,114 @@
+package analytics
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	nwdafContext "github.com/free5gc/nwdaf/pkg/context"
+)
+
+func TestContextTransfer(t *testing.T) {
+	source := NewAnalyticsEngine(&nwdafContext.NWDAFContext{
+		NfId:          "nwdaf-source",
+		Subscriptions: make(map[string]*nwdafContext.AnalyticsSubscription),
+		DataStore:     nwdafContext.NewDataStore(),
+	})
+	for i, tai := range []string{"tai-1", "tai-2"} {
+		source.context.UpdateUEStatistics("imsi-1", &nwdafContext.UEStatistics{SUPI: "imsi-1", Location: tai, Timestamp: int64(100 * (i + 1))})
+	}
+	source.context.UpdateUEStatistics("imsi-2", &nwdafContext.UEStatistics{SUPI: "imsi-2", Location: "tai-1", Timestamp: 100})
+
+	// Only the subscriptions and outputs targeting the transferred UEs alone follow them
+	subscriptions := map[string][]interface{}{
+		"ue":    {"imsi-1"},
+		"mixed": {"imsi-1", "imsi-2"},
+	}
+	for id, supis := range subscriptions {
+		source.context.AddSubscription(&nwdafContext.AnalyticsSubscription{
+			SubscriptionId:  id,
+			EventType:       "UE_MOBILITY",
+			NotificationUri: "http://consumer/notify",
+			AnalyticsFilter: map[string]interface{}{"supis": supis},
+		})
+	}
+	source.context.AddSubscription(&nwdafContext.AnalyticsSubscription{SubscriptionId: "nf", EventType: "NF_LOAD"})
+	source.accuracy.pending = []*pendingPrediction{
+		{eventType: "SERVICE_EXPERIENCE", filter: &EventFilter{Supis: []string{"imsi-1"}}, startTs: 200, endTs: 500,
+			predictions: []issuedPrediction{{key: "video", model: "linear", value: 3.5}}},
+		{eventType: "NF_LOAD", filter: &EventFilter{}, startTs: 200, endTs: 500,
+			predictions: []issuedPrediction{{key: "amf-1", model: "linear", value: 0.5}}},
+	}
+	source.abnormal.last["imsi-1/UNEXPECTED_UE_LOCATION"] = 150
+	source.abnormal.last["imsi-2/UNEXPECTED_UE_LOCATION"] = 150
+
+	var notified []string
+	consumer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n SubscriptionTransferNotification
+		_ = json.NewDecoder(r.Body).Decode(&n)
+		notified = append(notified, n.ResourceUri)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer consumer.Close()
+	ue, _ := source.context.GetSubscription("ue")
+	ue.NotificationUri = consumer.URL
+	source.context.ReplaceSubscription(ue)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case AnalyticsInfoPath + "/context":
+			_ = json.NewEncoder(w).Encode(source.ExportContext(strings.Split(r.URL.Query().Get("supis"), ",")))
+		case AnalyticsInfoPath + "/context/ack":
+			var ack ContextAcknowledgement
+			_ = json.NewDecoder(r.Body).Decode(&ack)
+			_ = json.NewEncoder(w).Encode(source.AcknowledgeContext(&ack))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	target := NewAnalyticsEngine(&nwdafContext.NWDAFContext{
+		Subscriptions: make(map[string]*nwdafContext.AnalyticsSubscription),
+		DataStore:     nwdafContext.NewDataStore(),
+	})
+	summary, err := target.TransferContext(context.Background(), server.URL, []string{"imsi-1"})
+	if err != nil {
+		t.Fatalf("TransferContext() error = %v", err)
+	}
+	if summary.SourceNfId != "nwdaf-source" || summary.Ues != 1 || summary.Samples != 2 || summary.Subscriptions != 1 || summary.PendingOutputs != 1 {
+		t.Errorf("Expected 1 UE with 2 samples, 1 subscription and 1 pending output, got %+v", summary)
+	}
+	if _, ok := target.context.GetSubscription("ue"); !ok {
+		t.Error("Expected the UE's subscription to keep its identifier")
+	}
+	if _, ok := target.context.GetSubscription("mixed"); ok {
+		t.Error("Expected a subscription also targeting other UEs to stay at the source")
+	}
+	if p := target.accuracy.pending[0]; p.eventType != "SERVICE_EXPERIENCE" || p.predictions[0].value != 3.5 {
+		t.Errorf("Expected the UE's pending prediction to be checked by the target, got %+v", p)
+	}
+	if target.abnormal.shouldPush("imsi-1/UNEXPECTED_UE_LOCATION", 200, 300) {
+		t.Error("Expected an exception reported by the source to stay suppressed")
+	}
+	if _, ok := target.abnormal.last["imsi-2/UNEXPECTED_UE_LOCATION"]; ok {
+		t.Error("Expected the exceptions of other UEs to stay at the source")
+	}
+
+	// The source hands the imported subscription over once acknowledged
+	if len(summary.Transferred) != 1 || summary.Transferred[0].SubscriptionId != "ue" || !summary.Transferred[0].ConsumerNotified {
+		t.Errorf("Expected the UE's subscription handed over by the source, got %+v", summary.Transferred)
+	}
+	if _, ok := source.context.GetSubscription("ue"); ok {
+		t.Error("Expected the source to stop serving the imported subscription")
+	}
+	if _, ok := source.context.GetSubscription("mixed"); !ok {
+		t.Error("Expected the source to keep the subscriptions not imported")
+	}
+	if len(notified) != 1 || !strings.HasSuffix(notified[0], EventsSubscriptionPath+"/subscriptions/ue") {
+		t.Errorf("Expected the consumer told of the new NWDAF, got %v", notified)
+	}
+}
@@ -0,0 +1,347 @@
+package analytics
+
+import (
+	"sort"
+
+	nwdafContext "github.com/free5gc/nwdaf/pkg/context"
+	"github.com/free5gc/nwdaf/pkg/factory"
+)
+
+// LocationVisit is one stay of a UE in a tracking area. Duration runs until
+// the UE is first reported elsewhere; for the latest visit it ends at the last
+// report.
+type LocationVisit struct {
+	Tai      string `json:"tai"`
+	EnterTs  int64  `json:"enterTs"`
+	ExitTs   int64  `json:"exitTs"`
+	Duration int64  `json:"duration"`
+}
+
+// LocationInfo summarises the time spent in one tracking area
+type LocationInfo struct {
+	Tai              string  `json:"tai"`
+	Visits           int     `json:"visits"`
+	DwellTime        int64   `json:"dwellTime"`
+	AverageDwellTime float64 `json:"averageDwellTime"`
+	// Ratio is the share of the observed time spent in the area
+	Ratio float64 `json:"ratio"`
+}
+
+// LocationProbability is the likelihood of a UE being in a tracking area
+type LocationProbability struct {
+	Tai         string  `json:"tai"`
+	Probability float64 `json:"probability"`
+}
+
+// UeMobilityInfo is the observed mobility of one UE (TS 23.288 §6.7.2)
+type UeMobilityInfo struct {
+	Supi              string                 `json:"supi"`
+	CurrentLocation   string                 `json:"currentLocation"`
+	Trajectory        []*LocationVisit       `json:"trajectory"`
+	FrequentLocations []*LocationInfo        `json:"frequentLocations"`
+	NextLocations     []*LocationProbability `json:"nextLocations,omitempty"`
+}
+
+// UeGroupMobilityInfo aggregates the frequent locations of a UE group
+type UeGroupMobilityInfo struct {
+	IntGroupId        string          `json:"intGroupId"`
+	UeCount           int             `json:"ueCount"`
+	FrequentLocations []*LocationInfo `json:"frequentLocations"`
+}
+
+// UeMobilityPrediction is where a UE is expected to be at the end of a future
+// window. NextLocations are the areas it moves to once it leaves its current
+// one.
+type UeMobilityPrediction struct {
+	Supi                string                 `json:"supi"`
+	CurrentLocation     string                 `json:"currentLocation"`
+	ExpectedDepartureTs int64                  `json:"expectedDepartureTs,omitempty"`
+	PredictedLocations  []*LocationProbability `json:"predictedLocations"`
+	NextLocations       []*LocationProbability `json:"nextLocations,omitempty"`
+	Confidence          int                    `json:"confidence"`
+}
+
+// ueScope selects UEs by the SUPIs and UE groups of a filter. Groups are
+// resolved from the configured ueGroups; with neither every UE is in scope.
+type ueScope struct {
+	supis  []string
+	groups map[string][]string
+}
+
+func newUEScope(f *EventFilter) ueScope {
+	scope := ueScope{supis: append([]string(nil), f.Supis...)}
+	if len(f.IntGroupIds) > 0 {
+		config := factory.NwdafConfig.Configuration
+		scope.groups = make(map[string][]string, len(f.IntGroupIds))
+		for _, id := range f.IntGroupIds {
+			members, _ := config.GetUeGroup(id)
+			scope.groups[id] = members
+			// An unknown group must not widen the scope to every UE
+			scope.supis = append(scope.supis, members...)
+			if len(members) == 0 {
+				scope.supis = append(scope.supis, "")
+			}
+		}
+	}
+	return scope
+}
+
+func (s ueScope) matches(supi string) bool {
+	return matchesAny(s.supis, supi)
+}
+
+// trajectory collapses consecutive reports from the same TAI into visits
+func trajectory(samples []*nwdafContext.UEStatistics) []*LocationVisit {
+	var visits []*LocationVisit
+	for _, s := range samples {
+		if s.Location == "" {
+			continue
+		}
+		if n := len(visits); n > 0 && visits[n-1].Tai == s.Location {
+			visits[n-1].ExitTs = s.Timestamp
+			continue
+		}
+		visits = append(visits, &LocationVisit{Tai: s.Location, EnterTs: s.Timestamp, ExitTs: s.Timestamp})
+	}
+	for i, v := range visits {
+		if i+1 < len(visits) {
+			v.Duration = visits[i+1].EnterTs - v.EnterTs
+		} else {
+			v.Duration = v.ExitTs - v.EnterTs
+		}
+	}
+	return visits
+}
+
+// frequentLocations ranks the visited TAIs by dwell time, then visit count
+func frequentLocations(visits []*LocationVisit) []*LocationInfo {
+	byTai := make(map[string]*LocationInfo)
+	var total int64
+	for _, v := range visits {
+		info, ok := byTai[v.Tai]
+		if !ok {
+			info = &LocationInfo{Tai: v.Tai}
+			byTai[v.Tai] = info
+		}
+		info.Visits++
+		info.DwellTime += v.Duration
+		total += v.Duration
+	}
+
+	infos := make([]*LocationInfo, 0, len(byTai))
+	for _, info := range byTai {
+		info.AverageDwellTime = float64(info.DwellTime) / float64(info.Visits)
+		if total > 0 {
+			info.Ratio = float64(info.DwellTime) / float64(total)
+		} else {
+			info.Ratio = float64(info.Visits) / float64(len(visits))
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].DwellTime != infos[j].DwellTime {
+			return infos[i].DwellTime > infos[j].DwellTime
+		}
+		if infos[i].Visits != infos[j].Visits {
+			return infos[i].Visits > infos[j].Visits
+		}
+		return infos[i].Tai < infos[j].Tai
+	})
+	return infos
+}
+
+// mobilityModel is a first-order Markov model of TAI transitions together
+// with the dwell times of completed visits
+type mobilityModel struct {
+	transitions map[string]map[string]int
+	dwell       map[string][]int64
+}
+
+func newMobilityModel() *mobilityModel {
+	return &mobilityModel{
+		transitions: make(map[string]map[string]int),
+		dwell:       make(map[string][]int64),
+	}
+}
+
+func (m *mobilityModel) learn(visits []*LocationVisit) {
+	for i := 0; i+1 < len(visits); i++ {
+		from, to := visits[i].Tai, visits[i+1].Tai
+		if m.transitions[from] == nil {
+			m.transitions[from] = make(map[string]int)
+		}
+		m.transitions[from][to]++
+		m.dwell[from] = append(m.dwell[from], visits[i].Duration)
+	}
+}
+
+// next returns the probabilities of the TAIs following from, most likely first
+func (m *mobilityModel) next(from string) []*LocationProbability {
+	counts := m.transitions[from]
+	total := 0
+	for _, n := range counts {
+		total += n
+	}
+	if total == 0 {
+		return nil
+	}
+	result := make([]*LocationProbability, 0, len(counts))
+	for tai, n := range counts {
+		result = append(result, &LocationProbability{Tai: tai, Probability: float64(n) / float64(total)})
+	}
+	sortProbabilities(result)
+	return result
+}
+
+func sortProbabilities(p []*LocationProbability) {
+	sort.Slice(p, func(i, j int) bool {
+		if p[i].Probability != p[j].Probability {
+			return p[i].Probability > p[j].Probability
+		}
+		return p[i].Tai < p[j].Tai
+	})
+}
+
+// ueTrajectories builds the trajectory of every UE in scope over the window
+func (e *AnalyticsEngine) ueTrajectories(src nwdafContext.HistorySource, scope ueScope, startTs, endTs int64) map[string][]*LocationVisit {
+	result := make(map[string][]*LocationVisit)
+	for supi, samples := range src.GetUEStatisticsInWindow(startTs, endTs) {
+		if !scope.matches(supi) {
+			continue
+		}
+		if visits := trajectory(samples); len(visits) > 0 {
+			result[supi] = visits
+		}
+	}
+	return result
+}
+
+// computeUEMobility returns the trajectory, frequent locations and
+// next-location probabilities of each UE in scope over [startTs, endTs], and
+// per requested group the aggregated frequent locations.
+func (e *AnalyticsEngine) computeUEMobility(src nwdafContext.HistorySource, f *EventFilter, startTs, endTs int64) map[string]interface{} {
+	scope := newUEScope(f)
+	trajectories := e.ueTrajectories(src, scope, startTs, endTs)
+
+	population := newMobilityModel()
+	for _, visits := range trajectories {
+		population.learn(visits)
+	}
+
+	infos := make([]*UeMobilityInfo, 0, len(trajectories))
+	for supi, visits := range trajectories {
+		own := newMobilityModel()
+		own.learn(visits)
+		current := visits[len(visits)-1].Tai
+
+		next := own.next(current)
+		if next == nil {
+			next = population.next(current)
+		}
+		infos = append(infos, &UeMobilityInfo{
+			Supi:              supi,
+			CurrentLocation:   current,
+			Trajectory:        visits,
+			FrequentLocations: frequentLocations(visits),
+			NextLocations:     next,
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Supi < infos[j].Supi })
+
+	result := map[string]interface{}{
+		"ueMobilityInfos": infos,
+		"window":          windowInfo(startTs, endTs),
+	}
+	if scope.groups != nil {
+		groupInfos := make([]*UeGroupMobilityInfo, 0, len(scope.groups))
+		for id, members := range scope.groups {
+			var visits []*LocationVisit
+			ues := 0
+			for _, supi := range members {
+				if t, ok := trajectories[supi]; ok {
+					visits = append(visits, t...)
+					ues++
+				}
+			}
+			groupInfos = append(groupInfos, &UeGroupMobilityInfo{
+				IntGroupId:        id,
+				UeCount:           ues,
+				FrequentLocations: frequentLocations(visits),
+			})
+		}
+		sort.Slice(groupInfos, func(i, j int) bool { return groupInfos[i].IntGroupId < groupInfos[j].IntGroupId })
+		result["ueGroupMobilityInfos"] = groupInfos
+	}
+	return result
+}
+
+// predictUEMobility predicts where each UE in scope is at endTs from the
+// training history. A UE stays in its current area with the share of past
+// visits there that lasted at least as long; otherwise it moves according to
+// its own transitions, or those of the population when it has none from the
+// current area.
+func (e *AnalyticsEngine) predictUEMobility(f *EventFilter, startTs, endTs int64) []*UeMobilityPrediction {
+	forecast := factory.NwdafConfig.Configuration.GetForecast()
+	now := e.clock.Now().Unix()
+	scope := newUEScope(f)
+	trajectories := e.ueTrajectories(e.context, scope, now-int64(forecast.History), now)
+
+	population := newMobilityModel()
+	for _, visits := range trajectories {
+		population.learn(visits)
+	}
+
+	predictions := make([]*UeMobilityPrediction, 0, len(trajectories))
+	for supi, visits := range trajectories {
+		own := newMobilityModel()
+		own.learn(visits)
+		current := visits[len(visits)-1]
+
+		model := own
+		if len(own.transitions[current.Tai]) == 0 {
+			model = population
+		}
+		next := model.next(current.Tai)
+		dwell := model.dwell[current.Tai]
+
+		prediction := &UeMobilityPrediction{
+			Supi:            supi,
+			CurrentLocation: current.Tai,
+			NextLocations:   next,
+		}
+
+		// Share of past stays in the current area that outlast the window
+		stay := 1.0
+		if len(dwell) > 0 && len(next) > 0 {
+			var sum int64
+			longer := 0
+			for _, d := range dwell {
+				sum += d
+				if d >= endTs-current.EnterTs {
+					longer++
+				}
+			}
+			stay = float64(longer) / float64(len(dwell))
+			prediction.ExpectedDepartureTs = current.EnterTs + sum/int64(len(dwell))
+		}
+
+		locations := []*LocationProbability{}
+		if stay > 0 {
+			locations = append(locations, &LocationProbability{Tai: current.Tai, Probability: stay})
+		}
+		for _, n := range next {
+			if p := n.Probability * (1 - stay); p > 0 {
+				locations = append(locations, &LocationProbability{Tai: n.Tai, Probability: p})
+			}
+		}
+		sortProbabilities(locations)
+		prediction.PredictedLocations = locations
+
+		// Confidence grows with the number of completed stays observed
+		n := float64(len(dwell))
+		prediction.Confidence = int(n / (n + 3) * 100)
+		predictions = append(predictions, prediction)
+	}
+	sort.Slice(predictions, func(i, j int) bool { return predictions[i].Supi < predictions[j].Supi })
+	return predictions
+}
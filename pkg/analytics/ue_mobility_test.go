@@ -0,0 +1,60 @@
+package analytics
+
+import (
+	"testing"
+
+	nwdafContext "github.com/free5gc/nwdaf/pkg/context"
+	"github.com/free5gc/nwdaf/pkg/factory"
+)
+
+func TestUEMobility(t *testing.T) {
+	factory.NwdafConfig.Configuration.UeGroups = map[string][]string{
+		"commuters": {"imsi-1", "imsi-2"},
+	}
+	defer func() { factory.NwdafConfig.Configuration.UeGroups = nil }()
+
+	ctx := &nwdafContext.NWDAFContext{DataStore: nwdafContext.NewDataStore()}
+	engine := NewAnalyticsEngine(ctx)
+
+	// imsi-1 alternates home -> work -> home -> shop -> home
+	for i, tai := range []string{"home", "home", "work", "home", "shop", "home"} {
+		ctx.UpdateUEStatistics("imsi-1", &nwdafContext.UEStatistics{
+			SUPI:      "imsi-1",
+			Location:  tai,
+			Timestamp: int64(1000 + i*100),
+		})
+	}
+	ctx.UpdateUEStatistics("imsi-3", &nwdafContext.UEStatistics{SUPI: "imsi-3", Location: "work", Timestamp: 1000})
+
+	result := engine.computeUEMobility(engine.context, mustParseFilter(t, map[string]interface{}{"supis": "imsi-1"}), 0, 2000)
+	infos := result["ueMobilityInfos"].([]*UeMobilityInfo)
+	if len(infos) != 1 {
+		t.Fatalf("Expected mobility of imsi-1 only, got %d entries", len(infos))
+	}
+	info := infos[0]
+	if len(info.Trajectory) != 5 || info.CurrentLocation != "home" {
+		t.Errorf("Expected 5 visits ending at home, got %d ending at %s", len(info.Trajectory), info.CurrentLocation)
+	}
+	if info.Trajectory[0].Duration != 200 {
+		t.Errorf("Expected the first stay at home to last 200s, got %d", info.Trajectory[0].Duration)
+	}
+	if top := info.FrequentLocations[0]; top.Tai != "home" || top.Visits != 3 {
+		t.Errorf("Expected home to be the most frequent location, got %+v", top)
+	}
+	if len(info.NextLocations) != 2 || info.NextLocations[0].Probability != 0.5 {
+		t.Errorf("Expected work and shop to follow home with equal probability, got %+v", info.NextLocations)
+	}
+
+	groups := engine.computeUEMobility(engine.context, mustParseFilter(t, map[string]interface{}{"intGroupIds": []interface{}{"commuters"}}), 0, 2000)
+	groupInfos := groups["ueGroupMobilityInfos"].([]*UeGroupMobilityInfo)
+	if len(groupInfos) != 1 || groupInfos[0].UeCount != 1 {
+		t.Errorf("Expected one reporting UE in group commuters, got %+v", groupInfos)
+	}
+	if n := len(groups["ueMobilityInfos"].([]*UeMobilityInfo)); n != 1 {
+		t.Errorf("Expected imsi-3 to be outside the group, got %d UEs", n)
+	}
+
+	if err := ValidateFilter("UE_MOBILITY", nil); err == nil {
+		t.Error("Expected UE_MOBILITY without a target UE to be rejected")
+	}
+}
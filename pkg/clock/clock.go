@@ -0,0 +1,132 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock abstracts time so that the analytics engine and the auto-steer
+// monitor can run against recorded traces faster than real time.
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker mirrors time.Ticker behind an interface
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// Real is the wall clock
+var Real Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                  { return time.Now() }
+func (realClock) Since(t time.Time) time.Duration { return time.Since(t) }
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return &realTicker{t: time.NewTicker(d)}
+}
+
+type realTicker struct {
+	t *time.Ticker
+}
+
+func (r *realTicker) C() <-chan time.Time { return r.t.C }
+func (r *realTicker) Stop()               { r.t.Stop() }
+
+// minRealInterval bounds how fast virtual tickers may fire in real time
+const minRealInterval = time.Millisecond
+
+// Virtual is a clock that starts at an arbitrary instant and runs Speed times
+// faster than the wall clock. Tickers fire in virtual time, so a 30s ticker
+// on a clock running at 60x fires every 500ms of real time.
+type Virtual struct {
+	mu        sync.RWMutex
+	start     time.Time
+	realStart time.Time
+	speed     float64
+}
+
+func NewVirtual(start time.Time, speed float64) *Virtual {
+	if speed <= 0 {
+		speed = 1
+	}
+	return &Virtual{
+		start:     start,
+		realStart: time.Now(),
+		speed:     speed,
+	}
+}
+
+func (v *Virtual) Speed() float64 {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.speed
+}
+
+func (v *Virtual) Now() time.Time {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	elapsed := time.Since(v.realStart)
+	return v.start.Add(time.Duration(float64(elapsed) * v.speed))
+}
+
+func (v *Virtual) Since(t time.Time) time.Duration {
+	return v.Now().Sub(t)
+}
+
+// Advance jumps the clock forward by d of virtual time
+func (v *Virtual) Advance(d time.Duration) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.start = v.start.Add(d)
+}
+
+// RealDuration converts a virtual duration to the wall-clock time it takes
+func (v *Virtual) RealDuration(d time.Duration) time.Duration {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return time.Duration(float64(d) / v.speed)
+}
+
+func (v *Virtual) NewTicker(d time.Duration) Ticker {
+	interval := v.RealDuration(d)
+	if interval < minRealInterval {
+		interval = minRealInterval
+	}
+
+	t := &virtualTicker{
+		c:    make(chan time.Time, 1),
+		done: make(chan struct{}),
+	}
+	real := time.NewTicker(interval)
+
+	go func() {
+		defer real.Stop()
+		for {
+			select {
+			case <-t.done:
+				return
+			case <-real.C:
+				// Drop the tick if the consumer is still busy, like time.Ticker
+				select {
+				case t.c <- v.Now():
+				default:
+				}
+			}
+		}
+	}()
+	return t
+}
+
+type virtualTicker struct {
+	c    chan time.Time
+	done chan struct{}
+	once sync.Once
+}
+
+func (t *virtualTicker) C() <-chan time.Time { return t.c }
+func (t *virtualTicker) Stop()               { t.once.Do(func() { close(t.done) }) }
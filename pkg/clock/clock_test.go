@@ -0,0 +1,38 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVirtualClock(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	v := NewVirtual(start, 1000)
+
+	time.Sleep(20 * time.Millisecond)
+	if elapsed := v.Since(start); elapsed < 20*time.Second {
+		t.Errorf("Expected at least 20s of virtual time, got %v", elapsed)
+	}
+
+	v.Advance(time.Hour)
+	if v.Since(start) < time.Hour {
+		t.Error("Expected Advance to move the clock forward")
+	}
+}
+
+func TestVirtualTicker(t *testing.T) {
+	v := NewVirtual(time.Unix(1700000000, 0), 1000)
+
+	// A 10s virtual ticker fires every 10ms of real time
+	ticker := v.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+
+	select {
+	case tick := <-ticker.C():
+		if tick.Before(time.Unix(1700000010, 0)) {
+			t.Errorf("Expected first tick after 10s of virtual time, got %v", tick)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Virtual ticker did not fire")
+	}
+}
@@ -0,0 +1,394 @@
+package context
+
+import (
+	"math"
+	"sort"
+)
+
+// HistoryData is the data collected over a time window, as stored at an ADRF.
+// Series are keyed like the DataStore history.
+type HistoryData struct {
+	NF         map[string][]*NFStatistics            `json:"nf,omitempty"`
+	UE         map[string][]*UEStatistics            `json:"ue,omitempty"`
+	Slice      map[string][]*SliceStatistics         `json:"slice,omitempty"`
+	UPF        map[string][]*UPFStatistics           `json:"upf,omitempty"`
+	DN         map[string][]*DNStatistics            `json:"dn,omitempty"`
+	Experience map[string][]*ServiceExperienceSample `json:"experience,omitempty"`
+}
+
+// Samples returns the number of samples held
+func (h *HistoryData) Samples() int {
+	n := 0
+	for _, series := range h.NF {
+		n += len(series)
+	}
+	for _, series := range h.UE {
+		n += len(series)
+	}
+	for _, series := range h.Slice {
+		n += len(series)
+	}
+	for _, series := range h.UPF {
+		n += len(series)
+	}
+	for _, series := range h.DN {
+		n += len(series)
+	}
+	for _, series := range h.Experience {
+		n += len(series)
+	}
+	return n
+}
+
+// Window returns the earliest and latest timestamps of the samples held, both
+// zero without samples
+func (h *HistoryData) Window() (int64, int64) {
+	var start, end int64
+	extend := func(first, last int64) {
+		if start == 0 || first < start {
+			start = first
+		}
+		end = max(end, last)
+	}
+	seriesWindow(h.NF, extend, func(s *NFStatistics) int64 { return s.Timestamp })
+	seriesWindow(h.UE, extend, func(s *UEStatistics) int64 { return s.Timestamp })
+	seriesWindow(h.Slice, extend, func(s *SliceStatistics) int64 { return s.Timestamp })
+	seriesWindow(h.UPF, extend, func(s *UPFStatistics) int64 { return s.Timestamp })
+	seriesWindow(h.DN, extend, func(s *DNStatistics) int64 { return s.Timestamp })
+	seriesWindow(h.Experience, extend, func(s *ServiceExperienceSample) int64 { return s.Timestamp })
+	return start, end
+}
+
+// InWindow returns the samples held within [start, end]. A zero end leaves
+// the window open towards the future.
+func (h *HistoryData) InWindow(start, end int64) *HistoryData {
+	return &HistoryData{
+		NF:         h.GetNFStatisticsInWindow(start, end),
+		UE:         h.GetUEStatisticsInWindow(start, end),
+		Slice:      h.GetSliceStatisticsInWindow(start, end),
+		UPF:        h.GetUPFStatisticsInWindow(start, end),
+		DN:         h.GetDNStatisticsInWindow(start, end),
+		Experience: h.GetServiceExperienceInWindow(start, end),
+	}
+}
+
+// Add merges the samples of another HistoryData, e.g. from several ADRF
+// records, keeping the series in timestamp order. Samples already held are
+// skipped as ImportHistory does.
+func (h *HistoryData) Add(other *HistoryData) {
+	h.NF = mergeHistory(h.NF, other.NF, func(s *NFStatistics) int64 { return s.Timestamp }, sameKey[*NFStatistics])
+	h.UE = mergeHistory(h.UE, other.UE, func(s *UEStatistics) int64 { return s.Timestamp }, sameKey[*UEStatistics])
+	h.Slice = mergeHistory(h.Slice, other.Slice, func(s *SliceStatistics) int64 { return s.Timestamp }, sameKey[*SliceStatistics])
+	h.UPF = mergeHistory(h.UPF, other.UPF, func(s *UPFStatistics) int64 { return s.Timestamp }, sameKey[*UPFStatistics])
+	h.DN = mergeHistory(h.DN, other.DN, func(s *DNStatistics) int64 { return s.Timestamp }, sameKey[*DNStatistics])
+	h.Experience = mergeHistory(h.Experience, other.Experience, func(s *ServiceExperienceSample) int64 { return s.Timestamp }, sameUE)
+}
+
+// HistorySource provides the samples collected over a window, per key.
+// NWDAFContext serves its local history and HistoryData the samples it holds;
+// WithArchive completes a source with archived samples.
+type HistorySource interface {
+	GetNFStatisticsInWindow(start, end int64) map[string][]*NFStatistics
+	GetUEStatisticsInWindow(start, end int64) map[string][]*UEStatistics
+	GetSliceStatisticsInWindow(start, end int64) map[string][]*SliceStatistics
+	GetUPFStatisticsInWindow(start, end int64) map[string][]*UPFStatistics
+	GetDNStatisticsInWindow(start, end int64) map[string][]*DNStatistics
+	GetServiceExperienceInWindow(start, end int64) map[string][]*ServiceExperienceSample
+}
+
+func (h *HistoryData) GetNFStatisticsInWindow(start, end int64) map[string][]*NFStatistics {
+	return seriesInWindow(h.NF, start, end, func(s *NFStatistics) int64 { return s.Timestamp })
+}
+
+func (h *HistoryData) GetUEStatisticsInWindow(start, end int64) map[string][]*UEStatistics {
+	return seriesInWindow(h.UE, start, end, func(s *UEStatistics) int64 { return s.Timestamp })
+}
+
+func (h *HistoryData) GetSliceStatisticsInWindow(start, end int64) map[string][]*SliceStatistics {
+	return seriesInWindow(h.Slice, start, end, func(s *SliceStatistics) int64 { return s.Timestamp })
+}
+
+func (h *HistoryData) GetUPFStatisticsInWindow(start, end int64) map[string][]*UPFStatistics {
+	return seriesInWindow(h.UPF, start, end, func(s *UPFStatistics) int64 { return s.Timestamp })
+}
+
+func (h *HistoryData) GetDNStatisticsInWindow(start, end int64) map[string][]*DNStatistics {
+	return seriesInWindow(h.DN, start, end, func(s *DNStatistics) int64 { return s.Timestamp })
+}
+
+func (h *HistoryData) GetServiceExperienceInWindow(start, end int64) map[string][]*ServiceExperienceSample {
+	return seriesInWindow(h.Experience, start, end, func(s *ServiceExperienceSample) int64 { return s.Timestamp })
+}
+
+// WithArchive returns a source serving the samples of local completed with
+// the archived ones. Samples held by both are returned once; neither is
+// modified.
+func WithArchive(local HistorySource, archived *HistoryData) HistorySource {
+	return &archiveSource{local: local, archived: archived}
+}
+
+type archiveSource struct {
+	local    HistorySource
+	archived *HistoryData
+}
+
+func (a *archiveSource) GetNFStatisticsInWindow(start, end int64) map[string][]*NFStatistics {
+	return mergeWindow(a.local.GetNFStatisticsInWindow(start, end), a.archived.NF, start, end,
+		func(s *NFStatistics) int64 { return s.Timestamp }, sameKey[*NFStatistics])
+}
+
+func (a *archiveSource) GetUEStatisticsInWindow(start, end int64) map[string][]*UEStatistics {
+	return mergeWindow(a.local.GetUEStatisticsInWindow(start, end), a.archived.UE, start, end,
+		func(s *UEStatistics) int64 { return s.Timestamp }, sameKey[*UEStatistics])
+}
+
+func (a *archiveSource) GetSliceStatisticsInWindow(start, end int64) map[string][]*SliceStatistics {
+	return mergeWindow(a.local.GetSliceStatisticsInWindow(start, end), a.archived.Slice, start, end,
+		func(s *SliceStatistics) int64 { return s.Timestamp }, sameKey[*SliceStatistics])
+}
+
+func (a *archiveSource) GetUPFStatisticsInWindow(start, end int64) map[string][]*UPFStatistics {
+	return mergeWindow(a.local.GetUPFStatisticsInWindow(start, end), a.archived.UPF, start, end,
+		func(s *UPFStatistics) int64 { return s.Timestamp }, sameKey[*UPFStatistics])
+}
+
+func (a *archiveSource) GetDNStatisticsInWindow(start, end int64) map[string][]*DNStatistics {
+	return mergeWindow(a.local.GetDNStatisticsInWindow(start, end), a.archived.DN, start, end,
+		func(s *DNStatistics) int64 { return s.Timestamp }, sameKey[*DNStatistics])
+}
+
+func (a *archiveSource) GetServiceExperienceInWindow(start, end int64) map[string][]*ServiceExperienceSample {
+	return mergeWindow(a.local.GetServiceExperienceInWindow(start, end), a.archived.Experience, start, end,
+		func(s *ServiceExperienceSample) int64 { return s.Timestamp }, sameUE)
+}
+
+// ExportHistory returns the samples collected within [start, end]. A zero end
+// leaves the window open towards the future.
+func (c *NWDAFContext) ExportHistory(start, end int64) *HistoryData {
+	c.DataMutex.RLock()
+	defer c.DataMutex.RUnlock()
+
+	return &HistoryData{
+		NF:         seriesInWindow(c.DataStore.NFHistory, start, end, func(s *NFStatistics) int64 { return s.Timestamp }),
+		UE:         seriesInWindow(c.DataStore.UEHistory, start, end, func(s *UEStatistics) int64 { return s.Timestamp }),
+		Slice:      seriesInWindow(c.DataStore.SliceHistory, start, end, func(s *SliceStatistics) int64 { return s.Timestamp }),
+		UPF:        seriesInWindow(c.DataStore.UPFHistory, start, end, func(s *UPFStatistics) int64 { return s.Timestamp }),
+		DN:         seriesInWindow(c.DataStore.DNHistory, start, end, func(s *DNStatistics) int64 { return s.Timestamp }),
+		Experience: seriesInWindow(c.DataStore.ExperienceHistory, start, end, func(s *ServiceExperienceSample) int64 { return s.Timestamp }),
+	}
+}
+
+// ExportHistorySince returns the samples stored after the given sequence
+// number, whatever their timestamp, and the sequence number of the last
+// sample stored. Passing that number back exports only what was stored since.
+func (c *NWDAFContext) ExportHistorySince(seq uint64) (*HistoryData, uint64) {
+	c.DataMutex.RLock()
+	defer c.DataMutex.RUnlock()
+
+	return &HistoryData{
+		NF:         seriesSince(c.DataStore.NFHistory, seq),
+		UE:         seriesSince(c.DataStore.UEHistory, seq),
+		Slice:      seriesSince(c.DataStore.SliceHistory, seq),
+		UPF:        seriesSince(c.DataStore.UPFHistory, seq),
+		DN:         seriesSince(c.DataStore.DNHistory, seq),
+		Experience: seriesSince(c.DataStore.ExperienceHistory, seq),
+	}, c.DataStore.lastSeq
+}
+
+// ImportHistory adds past samples, e.g. retrieved from an ADRF, and returns
+// the number added. Samples at a timestamp already stored for their key are
+// skipped and UE statistics listeners are not run.
+func (c *NWDAFContext) ImportHistory(h *HistoryData) int {
+	c.DataMutex.Lock()
+	defer c.DataMutex.Unlock()
+
+	ds := c.DataStore
+	added := importSeries(ds, ds.NFHistory, ds.NFStats, h.NF, func(s *NFStatistics) int64 { return s.Timestamp })
+	added += importSeries(ds, ds.UEHistory, ds.UEStats, h.UE, func(s *UEStatistics) int64 { return s.Timestamp })
+	added += importSeries(ds, ds.SliceHistory, ds.SliceStats, h.Slice, func(s *SliceStatistics) int64 { return s.Timestamp })
+	added += importSeries(ds, ds.UPFHistory, ds.UPFStats, h.UPF, func(s *UPFStatistics) int64 { return s.Timestamp })
+	added += importSeries(ds, ds.DNHistory, ds.DNStats, h.DN, func(s *DNStatistics) int64 { return s.Timestamp })
+
+	afTs := func(s *ServiceExperienceSample) int64 { return s.Timestamp }
+	for appId, samples := range h.Experience {
+		for _, s := range samples {
+			if s == nil {
+				continue
+			}
+			series := ds.ExperienceHistory[appId]
+			duplicate := false
+			for _, stored := range inWindow(series, s.Timestamp, s.Timestamp, afTs) {
+				duplicate = duplicate || stored.Supi == s.Supi
+			}
+			if duplicate {
+				continue
+			}
+			ds.ExperienceHistory[appId] = insertSample(ds, series, s, afTs)
+			added++
+		}
+	}
+	return added
+}
+
+// PruneHistory drops the samples collected before the given time and returns
+// the number dropped. The latest statistics of each key are kept, and so are
+// the samples marked imported, which only an ADRF storage run drops.
+func (c *NWDAFContext) PruneHistory(before int64) int {
+	return c.pruneHistory(before, math.MaxUint64, true)
+}
+
+// PruneStoredHistory drops the samples collected before the given time that
+// were stored up to the given sequence number, e.g. those exported to an
+// ADRF, and returns the number dropped. Samples stored later are kept
+// whatever their timestamp.
+func (c *NWDAFContext) PruneStoredHistory(before int64, seq uint64) int {
+	return c.pruneHistory(before, seq, false)
+}
+
+func (c *NWDAFContext) pruneHistory(before int64, seq uint64, keepImported bool) int {
+	c.DataMutex.Lock()
+	defer c.DataMutex.Unlock()
+
+	ds := c.DataStore
+	dropped := pruneSeries(ds.NFHistory, before, seq, keepImported, func(s *NFStatistics) int64 { return s.Timestamp })
+	dropped += pruneSeries(ds.UEHistory, before, seq, keepImported, func(s *UEStatistics) int64 { return s.Timestamp })
+	dropped += pruneSeries(ds.SliceHistory, before, seq, keepImported, func(s *SliceStatistics) int64 { return s.Timestamp })
+	dropped += pruneSeries(ds.UPFHistory, before, seq, keepImported, func(s *UPFStatistics) int64 { return s.Timestamp })
+	dropped += pruneSeries(ds.DNHistory, before, seq, keepImported, func(s *DNStatistics) int64 { return s.Timestamp })
+	dropped += pruneSeries(ds.ExperienceHistory, before, seq, keepImported, func(s *ServiceExperienceSample) int64 { return s.Timestamp })
+	return dropped
+}
+
+// seriesInWindow returns the part of each series within [start, end],
+// omitting the keys without samples in the window
+func seriesInWindow[T any](history map[string][]T, start, end int64, ts func(T) int64) map[string][]T {
+	result := make(map[string][]T)
+	for k, series := range history {
+		if samples := inWindow(series, start, end, ts); len(samples) > 0 {
+			result[k] = samples
+		}
+	}
+	return result
+}
+
+// seriesWindow reports the first and last timestamps of each series
+func seriesWindow[T any](history map[string][]T, extend func(first, last int64), ts func(T) int64) {
+	for _, series := range history {
+		if len(series) > 0 {
+			extend(ts(series[0]), ts(series[len(series)-1]))
+		}
+	}
+}
+
+// sameKey tells statistics of one key apart by timestamp alone
+func sameKey[T any](T, T) bool { return true }
+
+// sameUE tells AF samples of one application apart by timestamp and UE
+func sameUE(a, b *ServiceExperienceSample) bool { return a.Supi == b.Supi }
+
+// mergeHistory merges two histories series by series
+func mergeHistory[T any](a, b map[string][]T, ts func(T) int64, same func(T, T) bool) map[string][]T {
+	if a == nil {
+		a = make(map[string][]T)
+	}
+	for k, series := range b {
+		a[k] = mergeSeries(a[k], series, ts, same)
+	}
+	return a
+}
+
+// mergeWindow merges into local, returned by a window getter, the archived
+// samples within [start, end]
+func mergeWindow[T any](local, archived map[string][]T, start, end int64, ts func(T) int64, same func(T, T) bool) map[string][]T {
+	for k, series := range archived {
+		if samples := inWindow(series, start, end, ts); len(samples) > 0 {
+			local[k] = mergeSeries(local[k], samples, ts, same)
+		}
+	}
+	return local
+}
+
+// mergeSeries merges two time-ordered series into a new one in a single pass.
+// Items of b matching, at the same timestamp, an item already taken are
+// skipped.
+func mergeSeries[T any](a, b []T, ts func(T) int64, same func(T, T) bool) []T {
+	result := make([]T, 0, len(a)+len(b))
+	i := 0
+	for _, item := range b {
+		t := ts(item)
+		for ; i < len(a) && ts(a[i]) < t; i++ {
+			result = append(result, a[i])
+		}
+		duplicate := false
+		for j := i; j < len(a) && ts(a[j]) == t; j++ {
+			duplicate = duplicate || same(a[j], item)
+		}
+		for j := len(result) - 1; j >= 0 && ts(result[j]) == t; j-- {
+			duplicate = duplicate || same(result[j], item)
+		}
+		if !duplicate {
+			result = append(result, item)
+		}
+	}
+	return append(result, a[i:]...)
+}
+
+// seriesSince returns the samples of each series stored after the given
+// sequence number, omitting the keys without any
+func seriesSince[T sequenced](history map[string][]T, seq uint64) map[string][]T {
+	result := make(map[string][]T)
+	for k, series := range history {
+		for _, s := range series {
+			if s.sequence() > seq {
+				result[k] = append(result[k], s)
+			}
+		}
+	}
+	return result
+}
+
+// importSeries inserts samples into a history, skipping those at a timestamp
+// already stored, and updates the latest sample of each key
+func importSeries[T sequenced](ds *DataStore, history map[string][]T, latest map[string]T, samples map[string][]T, ts func(T) int64) int {
+	added := 0
+	for k, series := range samples {
+		for _, s := range series {
+			if hasTimestamp(history[k], ts(s), ts) {
+				continue
+			}
+			history[k] = insertSample(ds, history[k], s, ts)
+			added++
+		}
+		if h := history[k]; len(h) > 0 {
+			latest[k] = h[len(h)-1]
+		}
+	}
+	return added
+}
+
+// pruneSeries drops the samples before the given time stored up to the given
+// sequence number, but for the imported ones when keepImported is set, and the
+// keys left without samples. Series with nothing to drop are left untouched.
+func pruneSeries[T sequenced](history map[string][]T, before int64, seq uint64, keepImported bool, ts func(T) int64) int {
+	dropped := 0
+	for k, series := range history {
+		i := sort.Search(len(series), func(i int) bool { return ts(series[i]) >= before })
+		var kept []T
+		for _, s := range series[:i] {
+			if s.sequence() > seq || keepImported && s.isImported() {
+				kept = append(kept, s)
+			}
+		}
+		if len(kept) == i {
+			continue
+		}
+		// Copy so the dropped samples can be collected
+		if remaining := append(kept, series[i:]...); len(remaining) > 0 {
+			history[k] = remaining
+		} else {
+			delete(history, k)
+		}
+		dropped += i - len(kept)
+	}
+	return dropped
+}
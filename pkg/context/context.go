@@ -4,6 +4,7 @@ import (
 	"sync"
 
 	"github.com/free5gc/nwdaf/pkg/factory"
+	"github.com/google/uuid"
 )
 
 var nwdafContext *NWDAFContext
@@ -21,19 +22,42 @@ type NWDAFContext struct {
 	// Analytics subscriptions
 	Subscriptions map[string]*AnalyticsSubscription
 	SubMutex      sync.RWMutex
+
+	// ML model subscriptions, also guarded by SubMutex
+	MLModelSubscriptions map[string]*MLModelSubscription
+
+	// Data subscriptions, also guarded by SubMutex
+	DataSubscriptions map[string]*DataSubscription
 	
 	// Data storage
 	DataStore     *DataStore
 	DataMutex     sync.RWMutex
+
+	// Callbacks run after each UE statistics update
+	ueListeners   ueListeners
 }
 
 type AnalyticsSubscription struct {
-	SubscriptionId    string
-	EventType         string
-	ConsumerNfId      string
-	NotificationUri   string
-	AnalyticsFilter   map[string]interface{}
-	ReportingPeriod   int
+	SubscriptionId    string                     `json:"subscriptionId"`
+	EventType         string                     `json:"eventType"`
+	ConsumerNfId      string                     `json:"consumerNfId"`
+	NotificationUri   string                     `json:"notificationUri"`
+	AnalyticsFilter   map[string]interface{}     `json:"analyticsFilter,omitempty"`
+	ReportingPeriod   int                        `json:"reportingPeriod,omitempty"`
+	EvtReq            *EventReportingRequirement `json:"evtReq,omitempty"`
+}
+
+// EventReportingRequirement is the reporting part of an analytics request
+// (TS 29.520 EventReportingRequirement). Zero values keep the defaults.
+type EventReportingRequirement struct {
+	// Window (Unix seconds): the past part yields statistics, the future
+	// part predictions
+	StartTs      int64  `json:"startTs,omitempty"`
+	EndTs        int64  `json:"endTs,omitempty"`
+	// Accuracy is the level predictions must reach: LOW, MEDIUM, HIGH or HIGHEST
+	Accuracy     string `json:"accuracy,omitempty"`
+	// MaxObjectNbr caps the objects of each output list, most relevant first
+	MaxObjectNbr int    `json:"maxObjectNbr,omitempty"`
 }
 
 type DataStore struct {
@@ -45,23 +69,52 @@ type DataStore struct {
 	
 	// Slice statistics
 	SliceStats    map[string]*SliceStatistics
+
+	// UPF user plane usage
+	UPFStats      map[string]*UPFStatistics
+
+	// DN performance, keyed by DNAI and application server
+	DNStats       map[string]*DNStatistics
+
+	// Time-ordered history, keyed like the maps above
+	NFHistory     map[string][]*NFStatistics
+	UEHistory     map[string][]*UEStatistics
+	SliceHistory  map[string][]*SliceStatistics
+	UPFHistory    map[string][]*UPFStatistics
+	DNHistory     map[string][]*DNStatistics
+
+	// AF-reported service experience, keyed by application ID
+	ExperienceHistory map[string][]*ServiceExperienceSample
+
+	// lastSeq numbers the samples in the order they are stored
+	lastSeq uint64
 }
 
 type NFStatistics struct {
-	NFInstanceId  string
-	NFType        string
-	Load          float64
-	Timestamp     int64
-	Metrics       map[string]float64
+	NFInstanceId  string             `json:"nfInstanceId"`
+	NFType        string             `json:"nfType,omitempty"`
+	Snssais       []string           `json:"snssais,omitempty"`
+	Tais          []string           `json:"tais,omitempty"` // tracking areas served
+	Load          float64            `json:"load"`
+	Timestamp     int64              `json:"timestamp"`
+	Metrics       map[string]float64 `json:"metrics,omitempty"`
+
+	storeOrder
 }
 
 type UEStatistics struct {
-	SUPI          string
-	Location      string
-	Throughput    float64
-	Latency       float64
-	PacketLoss    float64
-	Timestamp     int64
+	SUPI          string  `json:"supi"`
+	Location      string  `json:"location,omitempty"` // tracking area (TAI)
+	FiveQi        int     `json:"fiveQi,omitempty"`   // 5QI of the reported QoS flow, 0 if unknown
+	AppId         string  `json:"appId,omitempty"`    // application of the reported flow
+	Snssai        string  `json:"snssai,omitempty"`
+	Dnn           string  `json:"dnn,omitempty"`
+	Throughput    float64 `json:"throughput"`
+	Latency       float64 `json:"latency"`
+	PacketLoss    float64 `json:"packetLoss"`
+	Timestamp     int64   `json:"timestamp"`
+
+	storeOrder
 }
 
 type SliceStats struct {
@@ -76,6 +129,8 @@ func init() {
 	nwdafContextOnce.Do(func() {
 		nwdafContext = &NWDAFContext{
 			Subscriptions: make(map[string]*AnalyticsSubscription),
+			MLModelSubscriptions: make(map[string]*MLModelSubscription),
+			DataSubscriptions: make(map[string]*DataSubscription),
 			DataStore:     NewDataStore(),
 		}
 	})
@@ -94,6 +149,11 @@ func (c *NWDAFContext) Init() {
 	c.BindingIPv4 = config.Sbi.BindingIPv4
 	c.SBIPort = config.Sbi.Port
 	c.NrfUri = config.NrfUri
+	if config.NfInstanceId != "" {
+		c.NfId = config.NfInstanceId
+	} else if c.NfId == "" {
+		c.NfId = uuid.New().String()
+	}
 }
 
 func NewDataStore() *DataStore {
@@ -101,6 +161,16 @@ func NewDataStore() *DataStore {
 		NFStats:    make(map[string]*NFStatistics),
 		UEStats:    make(map[string]*UEStatistics),
 		SliceStats: make(map[string]*SliceStatistics),
+		UPFStats:   make(map[string]*UPFStatistics),
+		DNStats:    make(map[string]*DNStatistics),
+
+		NFHistory:    make(map[string][]*NFStatistics),
+		UEHistory:    make(map[string][]*UEStatistics),
+		SliceHistory: make(map[string][]*SliceStatistics),
+		UPFHistory:   make(map[string][]*UPFStatistics),
+		DNHistory:    make(map[string][]*DNStatistics),
+
+		ExperienceHistory: make(map[string][]*ServiceExperienceSample),
 	}
 }
 
@@ -110,29 +180,66 @@ func (c *NWDAFContext) AddSubscription(sub *AnalyticsSubscription) {
 	c.Subscriptions[sub.SubscriptionId] = sub
 }
 
+// AddSubscriptionIfAbsent stores a subscription unless its ID is taken, in
+// which case it returns a copy of the subscription holding it
+func (c *NWDAFContext) AddSubscriptionIfAbsent(sub *AnalyticsSubscription) (*AnalyticsSubscription, bool) {
+	c.SubMutex.Lock()
+	defer c.SubMutex.Unlock()
+	if existing, ok := c.Subscriptions[sub.SubscriptionId]; ok {
+		copied := *existing
+		return &copied, false
+	}
+	c.Subscriptions[sub.SubscriptionId] = sub
+	return sub, true
+}
+
 func (c *NWDAFContext) RemoveSubscription(subId string) {
 	c.SubMutex.Lock()
 	defer c.SubMutex.Unlock()
 	delete(c.Subscriptions, subId)
 }
 
+// ReplaceSubscription swaps in an updated copy of a subscription. Stored
+// subscriptions are never modified in place, so that readers holding one
+// need no lock. It returns false if the subscription no longer exists.
+func (c *NWDAFContext) ReplaceSubscription(sub *AnalyticsSubscription) bool {
+	c.SubMutex.Lock()
+	defer c.SubMutex.Unlock()
+	if _, ok := c.Subscriptions[sub.SubscriptionId]; !ok {
+		return false
+	}
+	c.Subscriptions[sub.SubscriptionId] = sub
+	return true
+}
+
+// GetSubscription returns a copy of a subscription
 func (c *NWDAFContext) GetSubscription(subId string) (*AnalyticsSubscription, bool) {
 	c.SubMutex.RLock()
 	defer c.SubMutex.RUnlock()
 	sub, ok := c.Subscriptions[subId]
-	return sub, ok
+	if !ok {
+		return nil, false
+	}
+	copied := *sub
+	return &copied, true
 }
 
 func (c *NWDAFContext) UpdateNFStatistics(nfId string, stats *NFStatistics) {
 	c.DataMutex.Lock()
 	defer c.DataMutex.Unlock()
-	c.DataStore.NFStats[nfId] = stats
+	history := insertSample(c.DataStore, c.DataStore.NFHistory[nfId], stats, func(s *NFStatistics) int64 { return s.Timestamp })
+	c.DataStore.NFHistory[nfId] = history
+	c.DataStore.NFStats[nfId] = history[len(history)-1]
 }
 
 func (c *NWDAFContext) UpdateUEStatistics(supi string, stats *UEStatistics) {
 	c.DataMutex.Lock()
-	defer c.DataMutex.Unlock()
-	c.DataStore.UEStats[supi] = stats
+	history := insertSample(c.DataStore, c.DataStore.UEHistory[supi], stats, func(s *UEStatistics) int64 { return s.Timestamp })
+	c.DataStore.UEHistory[supi] = history
+	c.DataStore.UEStats[supi] = history[len(history)-1]
+	c.DataMutex.Unlock()
+
+	c.notifyUEStatistics(stats)
 }
 
 func (c *NWDAFContext) GetNFStatistics(nfId string) (*NFStatistics, bool) {
@@ -98,3 +98,175 @@ func TestGetAllNFStatistics(t *testing.T) {
 		t.Errorf("Expected at least 2 NF statistics, got %d", len(allStats))
 	}
 }
+
+func TestStatisticsHistoryWindow(t *testing.T) {
+	ctx := &NWDAFContext{DataStore: NewDataStore()}
+
+	// Imported history arrives out of order
+	for _, ts := range []int64{300, 100, 200} {
+		ctx.UpdateNFStatistics("nf-hist", &NFStatistics{NFInstanceId: "nf-hist", Load: float64(ts) / 1000, Timestamp: ts})
+	}
+
+	latest, _ := ctx.GetNFStatistics("nf-hist")
+	if latest.Timestamp != 300 {
+		t.Errorf("Expected latest sample at 300, got %d", latest.Timestamp)
+	}
+
+	window := ctx.GetNFStatisticsInWindow(150, 300)["nf-hist"]
+	if len(window) != 2 || window[0].Timestamp != 200 || window[1].Timestamp != 300 {
+		t.Errorf("Unexpected window samples: %+v", window)
+	}
+
+	if len(ctx.GetNFStatisticsInWindow(400, 0)) != 0 {
+		t.Error("Expected no samples after the last timestamp")
+	}
+}
+
+func TestUEContextTransfer(t *testing.T) {
+	source := &NWDAFContext{DataStore: NewDataStore()}
+	for i, tai := range []string{"tai-1", "tai-2", "tai-3"} {
+		source.UpdateUEStatistics("imsi-1", &UEStatistics{SUPI: "imsi-1", Location: tai, Timestamp: int64(100 * (i + 1))})
+	}
+	source.UpdateUEStatistics("imsi-2", &UEStatistics{SUPI: "imsi-2", Location: "tai-1", Timestamp: 100})
+	source.AddServiceExperienceSample(&ServiceExperienceSample{AppId: "video", Supi: "imsi-1", Mos: 4, Timestamp: 150})
+	source.AddServiceExperienceSample(&ServiceExperienceSample{AppId: "video", Supi: "imsi-2", Mos: 2, Timestamp: 150})
+
+	uc := source.ExportUEContext("imsi-1")
+	if len(uc.History) != 3 || len(uc.Experience) != 1 {
+		t.Fatalf("Expected 3 samples and 1 AF sample of imsi-1, got %+v", uc)
+	}
+
+	// The target already holds a later sample of the UE
+	target := &NWDAFContext{DataStore: NewDataStore()}
+	notified := 0
+	target.AddUEStatisticsListener(func(*UEStatistics) { notified++ })
+	target.UpdateUEStatistics("imsi-1", &UEStatistics{SUPI: "imsi-1", Location: "tai-4", Timestamp: 400})
+	notified = 0
+
+	if added := target.ImportUEContext(uc); added != 4 {
+		t.Errorf("Expected 4 samples added, got %d", added)
+	}
+	if added := target.ImportUEContext(uc); added != 0 {
+		t.Errorf("Expected a second import to add nothing, got %d", added)
+	}
+	if history := target.GetUEHistory("imsi-1", 0, 0); len(history) != 4 || history[0].Location != "tai-1" {
+		t.Errorf("Expected the imported history before the target's own sample, got %d samples", len(history))
+	}
+	if latest := target.GetAllUEStatistics()["imsi-1"]; latest.Location != "tai-4" {
+		t.Errorf("Expected the latest sample to stay the target's, got %s", latest.Location)
+	}
+	if notified != 0 {
+		t.Errorf("Expected imported samples not to reach listeners, got %d", notified)
+	}
+}
+
+func TestHistoryArchive(t *testing.T) {
+	source := &NWDAFContext{DataStore: NewDataStore()}
+	for ts := int64(100); ts <= 400; ts += 100 {
+		source.UpdateNFStatistics("amf-1", &NFStatistics{NFInstanceId: "amf-1", Load: float64(ts) / 1000, Timestamp: ts})
+		source.UpdateUEStatistics("imsi-1", &UEStatistics{SUPI: "imsi-1", Location: "tai-1", Timestamp: ts})
+	}
+	source.AddServiceExperienceSample(&ServiceExperienceSample{AppId: "video", Supi: "imsi-1", Mos: 4, Timestamp: 150})
+
+	history := source.ExportHistory(150, 300)
+	if history.Samples() != 5 || len(history.NF["amf-1"]) != 2 {
+		t.Fatalf("Expected 2 NF, 2 UE and 1 AF samples in [150, 300], got %d", history.Samples())
+	}
+
+	// Dropped samples leave the latest statistics in place
+	if dropped := source.PruneHistory(300); dropped != 5 {
+		t.Errorf("Expected 5 samples dropped, got %d", dropped)
+	}
+	if _, ok := source.DataStore.ExperienceHistory["video"]; ok {
+		t.Error("Expected an application without samples left to be removed")
+	}
+	if latest, ok := source.GetNFStatistics("amf-1"); !ok || latest.Timestamp != 400 {
+		t.Errorf("Expected the latest NF statistics kept, got %+v", latest)
+	}
+
+	_, seq := source.ExportHistorySince(0)
+	if added := source.ImportHistory(history); added != 3 {
+		t.Errorf("Expected the 3 dropped samples restored and the 2 kept skipped, got %d", added)
+	}
+	if samples := source.GetNFStatisticsInWindow(0, 0)["amf-1"]; len(samples) != 3 || samples[0].Timestamp != 200 {
+		t.Errorf("Expected NF samples at 200, 300 and 400, got %d", len(samples))
+	}
+	if latest, _ := source.GetNFStatistics("amf-1"); latest.Timestamp != 400 {
+		t.Errorf("Expected the latest NF statistics to stay at 400, got %d", latest.Timestamp)
+	}
+
+	// Restored samples follow those already stored, whatever their age
+	if since, _ := source.ExportHistorySince(seq); since.Samples() != 3 {
+		t.Errorf("Expected the 3 restored samples exported, got %d", since.Samples())
+	}
+	if dropped := source.PruneStoredHistory(300, seq); dropped != 0 {
+		t.Errorf("Expected samples not stored yet to be kept, got %d dropped", dropped)
+	}
+
+	// Archived samples complete the local ones without duplicates
+	archived := &HistoryData{NF: map[string][]*NFStatistics{"amf-1": {{NFInstanceId: "amf-1", Timestamp: 100}, {NFInstanceId: "amf-1", Timestamp: 200}}}}
+	samples := WithArchive(source, archived).GetNFStatisticsInWindow(0, 0)["amf-1"]
+	if len(samples) != 4 || samples[0].Timestamp != 100 || samples[1].Timestamp != 200 {
+		t.Errorf("Expected NF samples at 100, 200, 300 and 400, got %d", len(samples))
+	}
+}
+
+func TestPruneImportedHistory(t *testing.T) {
+	ctx := &NWDAFContext{DataStore: NewDataStore()}
+	imported := &NFStatistics{NFInstanceId: "amf-1", Timestamp: 100}
+	imported.MarkImported()
+	ctx.UpdateNFStatistics("amf-1", imported)
+	ctx.UpdateNFStatistics("amf-1", &NFStatistics{NFInstanceId: "amf-1", Timestamp: 200})
+	ctx.UpdateNFStatistics("amf-1", &NFStatistics{NFInstanceId: "amf-1", Timestamp: 400})
+
+	// The retention spares imported samples
+	if dropped := ctx.PruneHistory(300); dropped != 1 {
+		t.Errorf("Expected only the collected sample dropped, got %d", dropped)
+	}
+	if samples := ctx.GetNFStatisticsInWindow(0, 0)["amf-1"]; len(samples) != 2 || samples[0].Timestamp != 100 {
+		t.Errorf("Expected the imported sample kept, got %d samples", len(samples))
+	}
+
+	// Once stored to an ADRF they are dropped like the others
+	_, seq := ctx.ExportHistorySince(0)
+	if dropped := ctx.PruneStoredHistory(300, seq); dropped != 1 {
+		t.Errorf("Expected the stored imported sample dropped, got %d", dropped)
+	}
+}
+
+func TestReplaceSubscription(t *testing.T) {
+	ctx := &NWDAFContext{Subscriptions: make(map[string]*AnalyticsSubscription)}
+	stored := &AnalyticsSubscription{SubscriptionId: "sub-1", EventType: "NF_LOAD"}
+	ctx.AddSubscription(stored)
+
+	updated, _ := ctx.GetSubscription("sub-1")
+	updated.EventType = "SLICE_LOAD"
+	if stored.EventType != "NF_LOAD" {
+		t.Error("Expected the stored subscription to be left untouched")
+	}
+	if !ctx.ReplaceSubscription(updated) {
+		t.Fatal("Expected the subscription to be replaced")
+	}
+	if sub, _ := ctx.GetSubscription("sub-1"); sub.EventType != "SLICE_LOAD" {
+		t.Errorf("Expected the updated event type, got %s", sub.EventType)
+	}
+
+	ctx.RemoveSubscription("sub-1")
+	if ctx.ReplaceSubscription(updated) {
+		t.Error("Expected a removed subscription not to be replaced")
+	}
+}
+
+func TestAddSubscriptionIfAbsent(t *testing.T) {
+	ctx := &NWDAFContext{Subscriptions: make(map[string]*AnalyticsSubscription)}
+	if _, added := ctx.AddSubscriptionIfAbsent(&AnalyticsSubscription{SubscriptionId: "sub-1", EventType: "NF_LOAD"}); !added {
+		t.Fatal("Expected a free ID to be taken")
+	}
+	existing, added := ctx.AddSubscriptionIfAbsent(&AnalyticsSubscription{SubscriptionId: "sub-1", EventType: "SLICE_LOAD"})
+	if added || existing.EventType != "NF_LOAD" {
+		t.Errorf("Expected the first subscription returned and kept, got %+v", existing)
+	}
+	if sub, _ := ctx.GetSubscription("sub-1"); sub.EventType != "NF_LOAD" {
+		t.Errorf("Expected the first subscription kept, got %s", sub.EventType)
+	}
+}
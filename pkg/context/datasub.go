@@ -0,0 +1,51 @@
+package context
+
+// DataSubscription is a subscription to the raw data collected
+// (TS 29.574 Nnwdaf_DataManagement). Its consumer is notified every reporting
+// period of the samples collected since the last notification.
+type DataSubscription struct {
+	SubscriptionId  string                 `json:"subscriptionId"`
+	ConsumerNfId    string                 `json:"consumerNfId,omitempty"`
+	NotificationUri string                 `json:"notificationUri"`
+	DataTypes       []string               `json:"dataTypes"`
+	DataFilter      map[string]interface{} `json:"dataFilter,omitempty"`
+	// ReportingPeriod is the time (seconds) between notifications
+	ReportingPeriod int `json:"reportingPeriod,omitempty"`
+	// Window (Unix seconds) of the data notified: a start in the past first
+	// delivers the data already collected, a zero end never ends
+	StartTs int64 `json:"startTs,omitempty"`
+	EndTs   int64 `json:"endTs,omitempty"`
+}
+
+func (c *NWDAFContext) AddDataSubscription(sub *DataSubscription) {
+	c.SubMutex.Lock()
+	defer c.SubMutex.Unlock()
+	if c.DataSubscriptions == nil {
+		c.DataSubscriptions = make(map[string]*DataSubscription)
+	}
+	c.DataSubscriptions[sub.SubscriptionId] = sub
+}
+
+func (c *NWDAFContext) RemoveDataSubscription(subId string) {
+	c.SubMutex.Lock()
+	defer c.SubMutex.Unlock()
+	delete(c.DataSubscriptions, subId)
+}
+
+func (c *NWDAFContext) GetDataSubscription(subId string) (*DataSubscription, bool) {
+	c.SubMutex.RLock()
+	defer c.SubMutex.RUnlock()
+	sub, ok := c.DataSubscriptions[subId]
+	return sub, ok
+}
+
+// GetDataSubscriptions returns every data subscription
+func (c *NWDAFContext) GetDataSubscriptions() []*DataSubscription {
+	c.SubMutex.RLock()
+	defer c.SubMutex.RUnlock()
+	subs := make([]*DataSubscription, 0, len(c.DataSubscriptions))
+	for _, sub := range c.DataSubscriptions {
+		subs = append(subs, sub)
+	}
+	return subs
+}
@@ -0,0 +1,46 @@
+package context
+
+// DNStatistics holds the performance of one application server reached
+// through a DNAI, as measured at its anchor UPF
+type DNStatistics struct {
+	Dnai          string
+	AppServerAddr string
+	AppId         string
+	Dnn           string
+	UPFId         string // anchor UPF
+	Latency       float64
+	Throughput    float64
+	PacketLoss    float64
+	Timestamp     int64
+
+	storeOrder
+}
+
+// dnKey identifies a DNAI and application server pair
+func dnKey(s *DNStatistics) string {
+	return s.Dnai + "/" + s.AppServerAddr
+}
+
+func (c *NWDAFContext) UpdateDNStatistics(stats *DNStatistics) {
+	c.DataMutex.Lock()
+	defer c.DataMutex.Unlock()
+	key := dnKey(stats)
+	history := insertSample(c.DataStore, c.DataStore.DNHistory[key], stats, func(s *DNStatistics) int64 { return s.Timestamp })
+	c.DataStore.DNHistory[key] = history
+	c.DataStore.DNStats[key] = history[len(history)-1]
+}
+
+// GetDNStatisticsInWindow returns, per DNAI and application server, the
+// samples whose timestamp falls within [start, end].
+func (c *NWDAFContext) GetDNStatisticsInWindow(start, end int64) map[string][]*DNStatistics {
+	c.DataMutex.RLock()
+	defer c.DataMutex.RUnlock()
+
+	result := make(map[string][]*DNStatistics)
+	for k, series := range c.DataStore.DNHistory {
+		if samples := inWindow(series, start, end, func(s *DNStatistics) int64 { return s.Timestamp }); len(samples) > 0 {
+			result[k] = samples
+		}
+	}
+	return result
+}
@@ -0,0 +1,35 @@
+package context
+
+// ServiceExperienceSample is a service experience measured by an AF, used as
+// ground truth for the estimated MOS
+type ServiceExperienceSample struct {
+	AppId     string  `json:"appId"`
+	Supi      string  `json:"supi,omitempty"`
+	Snssai    string  `json:"snssai,omitempty"`
+	Mos       float64 `json:"mos"`
+	Timestamp int64   `json:"timestamp"`
+
+	storeOrder
+}
+
+func (c *NWDAFContext) AddServiceExperienceSample(sample *ServiceExperienceSample) {
+	c.DataMutex.Lock()
+	defer c.DataMutex.Unlock()
+	c.DataStore.ExperienceHistory[sample.AppId] = insertSample(c.DataStore, c.DataStore.ExperienceHistory[sample.AppId], sample,
+		func(s *ServiceExperienceSample) int64 { return s.Timestamp })
+}
+
+// GetServiceExperienceInWindow returns, per application, the AF samples whose
+// timestamp falls within [start, end]
+func (c *NWDAFContext) GetServiceExperienceInWindow(start, end int64) map[string][]*ServiceExperienceSample {
+	c.DataMutex.RLock()
+	defer c.DataMutex.RUnlock()
+
+	result := make(map[string][]*ServiceExperienceSample)
+	for k, series := range c.DataStore.ExperienceHistory {
+		if samples := inWindow(series, start, end, func(s *ServiceExperienceSample) int64 { return s.Timestamp }); len(samples) > 0 {
+			result[k] = samples
+		}
+	}
+	return result
+}
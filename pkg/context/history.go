@@ -0,0 +1,140 @@
+package context
+
+import "sort"
+
+// storeOrder numbers a sample in the order samples are stored, whatever its
+// timestamp, so late and imported samples can be told from those already
+// handed on
+type storeOrder struct {
+	seq      uint64
+	imported bool
+}
+
+func (o *storeOrder) sequence() uint64       { return o.seq }
+func (o *storeOrder) setSequence(seq uint64) { o.seq = seq }
+func (o *storeOrder) isImported() bool       { return o.imported }
+
+// MarkImported exempts a sample of a recorded dataset from the local
+// retention, which its original timestamp would otherwise soon expire. It is
+// called before the sample is stored.
+func (o *storeOrder) MarkImported() { o.imported = true }
+
+// sequenced is implemented by the samples embedding storeOrder
+type sequenced interface {
+	sequence() uint64
+	setSequence(seq uint64)
+	isImported() bool
+}
+
+// insertSample numbers item after the samples stored so far and inserts it
+// into its time-ordered series. The caller holds DataMutex.
+func insertSample[T sequenced](ds *DataStore, series []T, item T, ts func(T) int64) []T {
+	ds.lastSeq++
+	item.setSequence(ds.lastSeq)
+	return insertByTimestamp(series, item, ts)
+}
+
+// insertByTimestamp inserts item into a series kept in ascending timestamp
+// order. Live collection appends at the tail; imported history may land
+// anywhere, so the position is found by binary search. Items sharing a
+// timestamp keep their insertion order.
+func insertByTimestamp[T any](series []T, item T, ts func(T) int64) []T {
+	t := ts(item)
+	i := sort.Search(len(series), func(i int) bool { return ts(series[i]) > t })
+	series = append(series, item)
+	copy(series[i+1:], series[i:])
+	series[i] = item
+	return series
+}
+
+// inWindow returns the part of a time-ordered series with start <= ts <= end.
+// A zero end leaves the window open towards the future.
+func inWindow[T any](series []T, start, end int64, ts func(T) int64) []T {
+	lo := sort.Search(len(series), func(i int) bool { return ts(series[i]) >= start })
+	hi := len(series)
+	if end != 0 {
+		hi = sort.Search(len(series), func(i int) bool { return ts(series[i]) > end })
+	}
+	if lo >= hi {
+		return nil
+	}
+	result := make([]T, hi-lo)
+	copy(result, series[lo:hi])
+	return result
+}
+
+func (c *NWDAFContext) UpdateSliceStatistics(snssai string, stats *SliceStatistics) {
+	c.DataMutex.Lock()
+	defer c.DataMutex.Unlock()
+	history := insertSample(c.DataStore, c.DataStore.SliceHistory[snssai], stats, func(s *SliceStatistics) int64 { return s.Timestamp })
+	c.DataStore.SliceHistory[snssai] = history
+	c.DataStore.SliceStats[snssai] = history[len(history)-1]
+}
+
+func (c *NWDAFContext) GetAllUEStatistics() map[string]*UEStatistics {
+	c.DataMutex.RLock()
+	defer c.DataMutex.RUnlock()
+
+	result := make(map[string]*UEStatistics)
+	for k, v := range c.DataStore.UEStats {
+		result[k] = v
+	}
+	return result
+}
+
+func (c *NWDAFContext) GetAllSliceStatistics() map[string]*SliceStatistics {
+	c.DataMutex.RLock()
+	defer c.DataMutex.RUnlock()
+
+	result := make(map[string]*SliceStatistics)
+	for k, v := range c.DataStore.SliceStats {
+		result[k] = v
+	}
+	return result
+}
+
+// GetNFStatisticsInWindow returns, per NF instance, the samples whose
+// timestamp falls within [start, end]. NF instances without samples in the
+// window are omitted.
+func (c *NWDAFContext) GetNFStatisticsInWindow(start, end int64) map[string][]*NFStatistics {
+	c.DataMutex.RLock()
+	defer c.DataMutex.RUnlock()
+
+	result := make(map[string][]*NFStatistics)
+	for k, series := range c.DataStore.NFHistory {
+		if samples := inWindow(series, start, end, func(s *NFStatistics) int64 { return s.Timestamp }); len(samples) > 0 {
+			result[k] = samples
+		}
+	}
+	return result
+}
+
+// GetUEStatisticsInWindow returns, per SUPI, the samples whose timestamp
+// falls within [start, end].
+func (c *NWDAFContext) GetUEStatisticsInWindow(start, end int64) map[string][]*UEStatistics {
+	c.DataMutex.RLock()
+	defer c.DataMutex.RUnlock()
+
+	result := make(map[string][]*UEStatistics)
+	for k, series := range c.DataStore.UEHistory {
+		if samples := inWindow(series, start, end, func(s *UEStatistics) int64 { return s.Timestamp }); len(samples) > 0 {
+			result[k] = samples
+		}
+	}
+	return result
+}
+
+// GetSliceStatisticsInWindow returns, per S-NSSAI, the samples whose
+// timestamp falls within [start, end].
+func (c *NWDAFContext) GetSliceStatisticsInWindow(start, end int64) map[string][]*SliceStatistics {
+	c.DataMutex.RLock()
+	defer c.DataMutex.RUnlock()
+
+	result := make(map[string][]*SliceStatistics)
+	for k, series := range c.DataStore.SliceHistory {
+		if samples := inWindow(series, start, end, func(s *SliceStatistics) int64 { return s.Timestamp }); len(samples) > 0 {
+			result[k] = samples
+		}
+	}
+	return result
+}
@@ -0,0 +1,50 @@
+package context
+
+import "sync"
+
+// ueListeners holds the callbacks run after each UE statistics update
+type ueListeners struct {
+	mu    sync.RWMutex
+	next  int
+	funcs map[int]func(*UEStatistics)
+}
+
+// AddUEStatisticsListener registers fn to be called, outside the data lock,
+// with every UE sample stored. The returned function removes the listener.
+func (c *NWDAFContext) AddUEStatisticsListener(fn func(*UEStatistics)) (remove func()) {
+	c.ueListeners.mu.Lock()
+	defer c.ueListeners.mu.Unlock()
+	if c.ueListeners.funcs == nil {
+		c.ueListeners.funcs = make(map[int]func(*UEStatistics))
+	}
+	id := c.ueListeners.next
+	c.ueListeners.next++
+	c.ueListeners.funcs[id] = fn
+
+	return func() {
+		c.ueListeners.mu.Lock()
+		defer c.ueListeners.mu.Unlock()
+		delete(c.ueListeners.funcs, id)
+	}
+}
+
+func (c *NWDAFContext) notifyUEStatistics(stats *UEStatistics) {
+	c.ueListeners.mu.RLock()
+	funcs := make([]func(*UEStatistics), 0, len(c.ueListeners.funcs))
+	for _, fn := range c.ueListeners.funcs {
+		funcs = append(funcs, fn)
+	}
+	c.ueListeners.mu.RUnlock()
+
+	for _, fn := range funcs {
+		fn(stats)
+	}
+}
+
+// GetUEHistory returns the samples of one UE whose timestamp falls within
+// [start, end]
+func (c *NWDAFContext) GetUEHistory(supi string, start, end int64) []*UEStatistics {
+	c.DataMutex.RLock()
+	defer c.DataMutex.RUnlock()
+	return inWindow(c.DataStore.UEHistory[supi], start, end, func(s *UEStatistics) int64 { return s.Timestamp })
+}
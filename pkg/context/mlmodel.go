@@ -0,0 +1,57 @@
+package context
+
+// MLModelSubscription is a subscription to the models trained for some event
+// types (TS 29.520 Nnwdaf_MLModelProvision). Its consumer is notified of each
+// new model version.
+type MLModelSubscription struct {
+	SubscriptionId  string
+	EventIds        []string
+	NotificationUri string
+	NotifCorreId    string
+}
+
+// Subscribed reports whether the subscription covers an event type
+func (s *MLModelSubscription) Subscribed(eventId string) bool {
+	for _, id := range s.EventIds {
+		if id == eventId {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *NWDAFContext) AddMLModelSubscription(sub *MLModelSubscription) {
+	c.SubMutex.Lock()
+	defer c.SubMutex.Unlock()
+	if c.MLModelSubscriptions == nil {
+		c.MLModelSubscriptions = make(map[string]*MLModelSubscription)
+	}
+	c.MLModelSubscriptions[sub.SubscriptionId] = sub
+}
+
+func (c *NWDAFContext) RemoveMLModelSubscription(subId string) {
+	c.SubMutex.Lock()
+	defer c.SubMutex.Unlock()
+	delete(c.MLModelSubscriptions, subId)
+}
+
+func (c *NWDAFContext) GetMLModelSubscription(subId string) (*MLModelSubscription, bool) {
+	c.SubMutex.RLock()
+	defer c.SubMutex.RUnlock()
+	sub, ok := c.MLModelSubscriptions[subId]
+	return sub, ok
+}
+
+// GetMLModelSubscriptions returns the model subscriptions covering an event
+// type
+func (c *NWDAFContext) GetMLModelSubscriptions(eventId string) []*MLModelSubscription {
+	c.SubMutex.RLock()
+	defer c.SubMutex.RUnlock()
+	subs := make([]*MLModelSubscription, 0)
+	for _, sub := range c.MLModelSubscriptions {
+		if sub.Subscribed(eventId) {
+			subs = append(subs, sub)
+		}
+	}
+	return subs
+}
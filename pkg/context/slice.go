@@ -7,4 +7,6 @@ type SliceStatistics struct {
 	Throughput    float64
 	ResourceUsage float64
 	Timestamp     int64
+
+	storeOrder
 }
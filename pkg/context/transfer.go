@@ -0,0 +1,84 @@
+package context
+
+import "sort"
+
+// UEContext is the data collected for one UE that follows it to another NWDAF
+// instance: its statistics history and the service experience AFs measured
+// for it
+type UEContext struct {
+	Supi       string                     `json:"supi"`
+	History    []*UEStatistics            `json:"history,omitempty"`
+	Experience []*ServiceExperienceSample `json:"experience,omitempty"`
+}
+
+// ExportUEContext returns the history and AF samples of a UE
+func (c *NWDAFContext) ExportUEContext(supi string) *UEContext {
+	c.DataMutex.RLock()
+	defer c.DataMutex.RUnlock()
+
+	uc := &UEContext{Supi: supi}
+	for _, s := range c.DataStore.UEHistory[supi] {
+		sample := *s
+		uc.History = append(uc.History, &sample)
+	}
+	for _, series := range c.DataStore.ExperienceHistory {
+		for _, s := range series {
+			if s.Supi == supi {
+				sample := *s
+				uc.Experience = append(uc.Experience, &sample)
+			}
+		}
+	}
+	sort.SliceStable(uc.Experience, func(i, j int) bool { return uc.Experience[i].Timestamp < uc.Experience[j].Timestamp })
+	return uc
+}
+
+// ImportUEContext stores the history and AF samples of a UE transferred from
+// another NWDAF and returns the number of samples added. Samples at a
+// timestamp already stored for the UE are skipped, so importing twice is
+// harmless. UE statistics listeners are not run: imported samples are past
+// data, not live reports.
+func (c *NWDAFContext) ImportUEContext(uc *UEContext) int {
+	c.DataMutex.Lock()
+	defer c.DataMutex.Unlock()
+
+	added := 0
+	ueTs := func(s *UEStatistics) int64 { return s.Timestamp }
+	for _, s := range uc.History {
+		if s == nil || hasTimestamp(c.DataStore.UEHistory[uc.Supi], s.Timestamp, ueTs) {
+			continue
+		}
+		sample := *s
+		sample.SUPI = uc.Supi
+		history := insertSample(c.DataStore, c.DataStore.UEHistory[uc.Supi], &sample, ueTs)
+		c.DataStore.UEHistory[uc.Supi] = history
+		c.DataStore.UEStats[uc.Supi] = history[len(history)-1]
+		added++
+	}
+
+	afTs := func(s *ServiceExperienceSample) int64 { return s.Timestamp }
+	for _, s := range uc.Experience {
+		if s == nil || s.AppId == "" {
+			continue
+		}
+		series := c.DataStore.ExperienceHistory[s.AppId]
+		duplicate := false
+		for _, stored := range inWindow(series, s.Timestamp, s.Timestamp, afTs) {
+			duplicate = duplicate || stored.Supi == uc.Supi
+		}
+		if duplicate {
+			continue
+		}
+		sample := *s
+		sample.Supi = uc.Supi
+		c.DataStore.ExperienceHistory[s.AppId] = insertSample(c.DataStore, series, &sample, afTs)
+		added++
+	}
+	return added
+}
+
+// hasTimestamp reports whether a time-ordered series holds an item at ts
+func hasTimestamp[T any](series []T, ts int64, tsOf func(T) int64) bool {
+	i := sort.Search(len(series), func(i int) bool { return tsOf(series[i]) >= ts })
+	return i < len(series) && tsOf(series[i]) == ts
+}
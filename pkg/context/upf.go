@@ -0,0 +1,47 @@
+package context
+
+// UPFStatistics holds user plane traffic observed on one UPF (or edge group
+// of UPFs). Rates are in bytes/sec.
+type UPFStatistics struct {
+	UPFId     string   `json:"upfId"`
+	Tais      []string `json:"tais,omitempty"` // tracking areas or cells served
+	RxRate    float64  `json:"rxRate"`
+	TxRate    float64  `json:"txRate"`
+	Timestamp int64    `json:"timestamp"`
+
+	storeOrder
+}
+
+func (c *NWDAFContext) UpdateUPFStatistics(upfId string, stats *UPFStatistics) {
+	c.DataMutex.Lock()
+	defer c.DataMutex.Unlock()
+	history := insertSample(c.DataStore, c.DataStore.UPFHistory[upfId], stats, func(s *UPFStatistics) int64 { return s.Timestamp })
+	c.DataStore.UPFHistory[upfId] = history
+	c.DataStore.UPFStats[upfId] = history[len(history)-1]
+}
+
+func (c *NWDAFContext) GetAllUPFStatistics() map[string]*UPFStatistics {
+	c.DataMutex.RLock()
+	defer c.DataMutex.RUnlock()
+
+	result := make(map[string]*UPFStatistics)
+	for k, v := range c.DataStore.UPFStats {
+		result[k] = v
+	}
+	return result
+}
+
+// GetUPFStatisticsInWindow returns, per UPF, the samples whose timestamp
+// falls within [start, end].
+func (c *NWDAFContext) GetUPFStatisticsInWindow(start, end int64) map[string][]*UPFStatistics {
+	c.DataMutex.RLock()
+	defer c.DataMutex.RUnlock()
+
+	result := make(map[string][]*UPFStatistics)
+	for k, series := range c.DataStore.UPFHistory {
+		if samples := inWindow(series, start, end, func(s *UPFStatistics) int64 { return s.Timestamp }); len(samples) > 0 {
+			result[k] = samples
+		}
+	}
+	return result
+}
@@ -3,7 +3,10 @@ package factory
 import (
 	"fmt"
 	"os"
+	"regexp"
+	"strings"
 
+	"github.com/google/uuid"
 	"gopkg.in/yaml.v2"
 )
 
@@ -22,12 +25,70 @@ type Info struct {
 
 type Configuration struct {
 	NwdafName        string            `yaml:"nwdafName"`
+	// NfInstanceId is the NF instance ID (a UUID) kept across restarts, under
+	// which the NWDAF registers and stores its data; random when unset
+	NfInstanceId     string            `yaml:"nfInstanceId,omitempty"`
+	// Mode selects the logical functions run: anlf, mtlf or combined
+	Mode             string            `yaml:"mode,omitempty"`
 	Sbi              *Sbi              `yaml:"sbi"`
 	ServiceNameList  []string          `yaml:"serviceNameList"`
 	NrfUri           string            `yaml:"nrfUri"`
 	PlmnList         []PlmnId          `yaml:"plmnList"`
 	AnalyticsDelay   int               `yaml:"analyticsDelay,omitempty"`
+	// AnalyticsWindow is the history (seconds) used when a request has no window
+	AnalyticsWindow  int               `yaml:"analyticsWindow,omitempty"`
+	// AnalyticsWorkers bounds the subscription groups computed in parallel
+	AnalyticsWorkers int               `yaml:"analyticsWorkers,omitempty"`
+	// AnalyticsCacheTTL is how long (seconds) computed analytics are reused
+	AnalyticsCacheTTL int              `yaml:"analyticsCacheTtl,omitempty"`
+	// AreasOfInterest names groups of TAIs that analytics can be requested for
+	AreasOfInterest  map[string][]string `yaml:"areasOfInterest,omitempty"`
+	// UeGroups maps internal group identifiers to their member SUPIs
+	UeGroups         map[string][]string `yaml:"ueGroups,omitempty"`
 	DataCollectionConfig *DataCollectionConfig `yaml:"dataCollection,omitempty"`
+	NfLoad           *NfLoadConfig     `yaml:"nfLoad,omitempty"`
+	Forecast         *ForecastConfig   `yaml:"forecast,omitempty"`
+	AbnormalBehaviour *AbnormalBehaviourConfig `yaml:"abnormalBehaviour,omitempty"`
+	ServiceExperience *ServiceExperienceConfig `yaml:"serviceExperience,omitempty"`
+	UserDataCongestion *UserDataCongestionConfig `yaml:"userDataCongestion,omitempty"`
+	Accuracy         *AccuracyConfig   `yaml:"accuracy,omitempty"`
+	Training         *TrainingConfig   `yaml:"training,omitempty"`
+	// ServingTais are the TAIs this NWDAF serves, advertised to the NRF so
+	// that aggregators can select it
+	ServingTais      []string          `yaml:"servingTais,omitempty"`
+	Aggregation      *AggregationConfig `yaml:"aggregation,omitempty"`
+	Adrf             *AdrfConfig       `yaml:"adrf,omitempty"`
+	// Edges are the DNAIs the traffic steering agent can steer traffic to
+	Edges            []*EdgeConfig     `yaml:"edges,omitempty"`
+	// BranchingUpf is the ULCL branching UPF, which carries the traffic not
+	// steered to an edge
+	BranchingUpf     *BranchingUpfConfig `yaml:"branchingUpf,omitempty"`
+}
+
+// Run modes
+const (
+	// ModeAnlf serves analytics and consumes models (Analytics Logical Function)
+	ModeAnlf = "anlf"
+	// ModeMtlf collects data and trains models (Model Training Logical Function)
+	ModeMtlf = "mtlf"
+	// ModeCombined runs both
+	ModeCombined = "combined"
+)
+
+// SBI services
+const (
+	ServiceEventsSubscription = "nnwdaf-eventssubscription"
+	ServiceAnalyticsInfo      = "nnwdaf-analyticsinfo"
+	ServiceMLModelProvision   = "nnwdaf-mlmodelprovision"
+	ServiceDataManagement     = "nnwdaf-datamanagement"
+)
+
+// modeServices are the SBI services each mode provides. Every mode collects
+// data and serves it.
+var modeServices = map[string][]string{
+	ModeAnlf:     {ServiceEventsSubscription, ServiceAnalyticsInfo, ServiceDataManagement},
+	ModeMtlf:     {ServiceMLModelProvision, ServiceDataManagement},
+	ModeCombined: {ServiceEventsSubscription, ServiceAnalyticsInfo, ServiceMLModelProvision, ServiceDataManagement},
 }
 
 type Sbi struct {
@@ -52,8 +113,332 @@ type DataCollectionConfig struct {
 	Enabled           bool     `yaml:"enabled"`
 	CollectionPeriod  int      `yaml:"collectionPeriod"`
 	TargetNFs         []string `yaml:"targetNFs"`
+	// Retention is how long (seconds) collected samples are kept locally
+	Retention         int      `yaml:"retention,omitempty"`
+}
+
+// NfLoadConfig tunes NF load analytics (TS 23.288 §6.5)
+type NfLoadConfig struct {
+	// Window is the history (seconds) used when a request carries no time window
+	Window     int                        `yaml:"window,omitempty"`
+	Default    *LoadThresholds            `yaml:"default,omitempty"`
+	Thresholds map[string]*LoadThresholds `yaml:"thresholds,omitempty"` // keyed by NF type
+}
+
+// LoadThresholds classify an NF load (0..1) into LOW, NORMAL, HIGH or OVERLOAD
+type LoadThresholds struct {
+	Low      float64 `yaml:"low"`
+	High     float64 `yaml:"high"`
+	Overload float64 `yaml:"overload"`
+}
+
+var defaultLoadThresholds = LoadThresholds{Low: 0.3, High: 0.8, Overload: 0.95}
+
+const (
+	defaultAnalyticsWindow   = 300
+	defaultAnalyticsWorkers  = 4
+	defaultAnalyticsCacheTTL = 5
+)
+
+// ForecastConfig selects and tunes the built-in prediction models
+type ForecastConfig struct {
+	// Step is the resampling interval (seconds) of the history fed to models
+	Step int `yaml:"step,omitempty"`
+	// History is how far back (seconds) models are trained
+	History int `yaml:"history,omitempty"`
+	// Horizon is how far ahead (seconds) subscriptions are predicted
+	Horizon int `yaml:"horizon,omitempty"`
+	// DefaultModel is one of auto, ewma, holt-winters or linear
+	DefaultModel string             `yaml:"defaultModel,omitempty"`
+	Models       map[string]string  `yaml:"models,omitempty"` // model per NF type
+	EwmaAlpha    float64            `yaml:"ewmaAlpha,omitempty"`
+	HoltWinters  *HoltWintersParams `yaml:"holtWinters,omitempty"`
+}
+
+type HoltWintersParams struct {
+	Alpha float64 `yaml:"alpha"`
+	Beta  float64 `yaml:"beta"`
+	Gamma float64 `yaml:"gamma"`
+}
+
+var defaultForecastConfig = ForecastConfig{
+	Step:         300,
+	History:      7 * 86400,
+	Horizon:      900,
+	DefaultModel: "auto",
+	EwmaAlpha:    0.3,
+	HoltWinters:  &HoltWintersParams{Alpha: 0.3, Beta: 0.05, Gamma: 0.2},
+}
+
+// AccuracyConfig tunes the monitoring of prediction accuracy: predictions
+// are checked against the observed values once their window has elapsed
+type AccuracyConfig struct {
+	// Window is the number of checked predictions the rolling accuracy covers
+	Window int `yaml:"window,omitempty"`
+	// Threshold (0..1) is the accuracy below which subscribers are notified
+	Threshold float64 `yaml:"threshold,omitempty"`
+	// MinSamples checked predictions are needed before the threshold applies
+	MinSamples int `yaml:"minSamples,omitempty"`
+	// MaxPending caps the predictions waiting for their window to elapse
+	MaxPending int `yaml:"maxPending,omitempty"`
+}
+
+var defaultAccuracyConfig = AccuracyConfig{
+	Window:     50,
+	Threshold:  0.7,
+	MinSamples: 10,
+	MaxPending: 1000,
+}
+
+// TrainingConfig schedules the training of prediction models from the
+// collected history (MTLF role). Trained models are written to ModelDir and
+// replace the models in use without a restart.
+type TrainingConfig struct {
+	// Enabled turns training on in combined mode; an MTLF always trains
+	Enabled bool `yaml:"enabled"`
+	// Interval is the time (seconds) between training runs
+	Interval int `yaml:"interval,omitempty"`
+	// ModelDir holds the trained model files and is watched for new versions
+	ModelDir string `yaml:"modelDir,omitempty"`
+	// Holdout is the share (0..1) of the history models are scored on
+	Holdout float64 `yaml:"holdout,omitempty"`
+	// Keep is the number of model versions kept per event type
+	Keep int `yaml:"keep,omitempty"`
+	// ProviderUri is an MTLF whose models are subscribed to and fetched
+	// (Nnwdaf_MLModelProvision)
+	ProviderUri string `yaml:"providerUri,omitempty"`
+}
+
+var defaultTrainingConfig = TrainingConfig{
+	Interval: 3600,
+	ModelDir: "models",
+	Holdout:  0.2,
+	Keep:     5,
+}
+
+// AggregationConfig makes the NWDAF an aggregator (TS 23.288 §6.1A) that
+// federates the analytics of peer NWDAFs serving other areas
+type AggregationConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Peers are the NWDAFs known from configuration
+	Peers []*PeerNwdaf `yaml:"peers,omitempty"`
+	// Discover also selects the NWDAFs registered with the NRF
+	Discover bool `yaml:"discover,omitempty"`
+	// DiscoveryInterval is the time (seconds) between NRF discoveries
+	DiscoveryInterval int `yaml:"discoveryInterval,omitempty"`
+	// Timeout (seconds) bounds each request to a peer
+	Timeout int `yaml:"timeout,omitempty"`
+}
+
+// PeerNwdaf is an NWDAF whose analytics are federated
+type PeerNwdaf struct {
+	NfInstanceId string `yaml:"nfInstanceId,omitempty"`
+	// Uri is the API root of the peer, e.g. http://nwdaf-east:8000
+	Uri string `yaml:"uri"`
+	// Tais served by the peer; a peer without TAIs serves every area
+	Tais []string `yaml:"tais,omitempty"`
+}
+
+var defaultAggregationConfig = AggregationConfig{
+	DiscoveryInterval: 60,
+	Timeout:           3,
+}
+
+// AdrfConfig stores the generated analytics and the collected data in an
+// ADRF (Nadrf_DataManagement, TS 29.575). Once stored, collected data is only
+// kept locally for Retention; history requested beyond it is retrieved from
+// the ADRF.
+type AdrfConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Uri is the API root of the ADRF; without one the embedded stub ADRF is
+	// used and served on the SBI
+	Uri string `yaml:"uri,omitempty"`
+	// Retention is how long (seconds) stored data is kept locally
+	Retention int `yaml:"retention,omitempty"`
+	// StoreInterval is the time (seconds) between storage runs
+	StoreInterval int `yaml:"storeInterval,omitempty"`
+	// Timeout (seconds) bounds each request to the ADRF
+	Timeout int `yaml:"timeout,omitempty"`
+	// MaxRecords caps the records the embedded stub ADRF keeps, oldest
+	// dropped first
+	MaxRecords int `yaml:"maxRecords,omitempty"`
+}
+
+var defaultAdrfConfig = AdrfConfig{
+	Retention:     86400,
+	StoreInterval: 60,
+	Timeout:       5,
+	MaxRecords:    10000,
+}
+
+// EdgeConfig is a DNAI the traffic steering agent can steer traffic to
+type EdgeConfig struct {
+	Dnai string `yaml:"dnai"`
+	// AnchorUpf is the UPF anchoring the PDU sessions routed to the DNAI
+	AnchorUpf string `yaml:"anchorUpf"`
+	// Pool is the UE IP pool allocated through the anchor UPF
+	Pool string `yaml:"pool,omitempty"`
+	// PodSelector is a regular expression matching the Prometheus pod label
+	// of the anchor UPF
+	PodSelector string `yaml:"podSelector"`
+	// Capacity is the traffic (bytes/sec) the edge can take, 0 if unbounded
+	Capacity float64 `yaml:"capacity,omitempty"`
+
+	// podPattern is PodSelector compiled when the configuration is validated
+	podPattern *regexp.Regexp
+}
+
+// MatchesPod reports whether the pod selector matches a Prometheus pod
+// label, case-insensitively
+func (e EdgeConfig) MatchesPod(pod string) bool {
+	return matchPod(e.podPattern, e.PodSelector, pod)
+}
+
+// defaultEdges are the two edges of the free5GC ULCL lab
+var defaultEdges = []EdgeConfig{
+	{Dnai: "edge1", AnchorUpf: "AnchorUPF1", Pool: "10.1.0.0/17", PodSelector: "upf1|anchor.*1", podPattern: mustCompilePodSelector("upf1|anchor.*1")},
+	{Dnai: "edge2", AnchorUpf: "AnchorUPF2", Pool: "10.1.128.0/17", PodSelector: "upf2|anchor.*2", podPattern: mustCompilePodSelector("upf2|anchor.*2")},
+}
+
+// BranchingUpfConfig is the ULCL branching UPF of the traffic steering agent
+type BranchingUpfConfig struct {
+	// Name keys the rate of the branching UPF; replayed records carry it as
+	// their UPF ID
+	Name string `yaml:"name,omitempty"`
+	// PodSelector is a regular expression matching the Prometheus pod label
+	// of the branching UPF, the name if empty
+	PodSelector string `yaml:"podSelector,omitempty"`
+
+	// podPattern is PodSelector compiled when the configuration is validated
+	podPattern *regexp.Regexp
+}
+
+// MatchesPod reports whether the pod selector matches a Prometheus pod
+// label, case-insensitively
+func (b BranchingUpfConfig) MatchesPod(pod string) bool {
+	return matchPod(b.podPattern, b.PodSelector, pod)
+}
+
+// defaultBranchingUpf is the branching UPF of the free5GC ULCL lab
+var defaultBranchingUpf = BranchingUpfConfig{Name: "upfb", PodSelector: "upfb", podPattern: mustCompilePodSelector("upfb")}
+
+// compilePodSelector compiles a pod selector, matched case-insensitively
+func compilePodSelector(selector string) (*regexp.Regexp, error) {
+	return regexp.Compile("(?i)" + selector)
+}
+
+func mustCompilePodSelector(selector string) *regexp.Regexp {
+	return regexp.MustCompile("(?i)" + selector)
+}
+
+// matchPod matches a pod label with a compiled selector. Selectors of
+// settings built in code rather than loaded are compiled on the spot.
+func matchPod(pattern *regexp.Regexp, selector, pod string) bool {
+	if pattern == nil {
+		var err error
+		if pattern, err = compilePodSelector(selector); err != nil {
+			return false
+		}
+	}
+	return pattern.MatchString(pod)
 }
 
+// AbnormalBehaviourConfig tunes abnormal UE behaviour detection (TS 23.288 §6.7.5)
+type AbnormalBehaviourConfig struct {
+	// ZScore is the deviation, in standard deviations, that counts as abnormal
+	ZScore float64 `yaml:"zScore,omitempty"`
+	// EwmaAlpha smooths the EWMA band a sample must also leave
+	EwmaAlpha float64 `yaml:"ewmaAlpha,omitempty"`
+	// MinSamples is the history a UE needs before it is checked
+	MinSamples int `yaml:"minSamples,omitempty"`
+	// History is how far back (seconds) baselines are learnt
+	History int `yaml:"history,omitempty"`
+	// RareLocationRatio is the share of past reports below which a location
+	// is unexpected
+	RareLocationRatio float64 `yaml:"rareLocationRatio,omitempty"`
+	// PingPongWindow (seconds) and PingPongCount: returns to the previous
+	// location within the window that count as ping-pong
+	PingPongWindow int `yaml:"pingPongWindow,omitempty"`
+	PingPongCount  int `yaml:"pingPongCount,omitempty"`
+	// DdosRatio is the share of a group's UEs that must surge together
+	DdosRatio float64 `yaml:"ddosRatio,omitempty"`
+	// GroupStep is the bucket (seconds) of group traffic baselines
+	GroupStep int `yaml:"groupStep,omitempty"`
+	// Suppress (seconds) holds back repeats of the same exception
+	Suppress int `yaml:"suppress,omitempty"`
+}
+
+var defaultAbnormalBehaviourConfig = AbnormalBehaviourConfig{
+	ZScore:            3,
+	EwmaAlpha:         0.3,
+	MinSamples:        10,
+	History:           86400,
+	RareLocationRatio: 0.05,
+	PingPongWindow:    600,
+	PingPongCount:     3,
+	DdosRatio:         0.3,
+	GroupStep:         60,
+	Suppress:          300,
+}
+
+// ServiceExperienceConfig holds the MOS scoring models of service experience
+// analytics (TS 23.288 §6.4)
+type ServiceExperienceConfig struct {
+	Default      *ScoringModel            `yaml:"default,omitempty"`
+	Applications map[string]*ScoringModel `yaml:"applications,omitempty"` // keyed by application ID
+	// CalibrationWindow is how far back (seconds) AF samples calibrate scores
+	CalibrationWindow int `yaml:"calibrationWindow,omitempty"`
+}
+
+// ScoringModel maps QoS flow metrics to a 1..5 MOS. Each metric scores 1 at
+// or beyond Good, 0 at or beyond Bad and linearly in between; the MOS is
+// 1 + 4 times their weighted average.
+type ScoringModel struct {
+	Latency    MetricRange    `yaml:"latency"`    // ms
+	PacketLoss MetricRange    `yaml:"packetLoss"` // ratio
+	Throughput MetricRange    `yaml:"throughput"` // Mbps
+	Weights    ScoringWeights `yaml:"weights"`
+}
+
+type MetricRange struct {
+	Good float64 `yaml:"good"`
+	Bad  float64 `yaml:"bad"`
+}
+
+type ScoringWeights struct {
+	Latency    float64 `yaml:"latency"`
+	PacketLoss float64 `yaml:"packetLoss"`
+	Throughput float64 `yaml:"throughput"`
+}
+
+var defaultScoringModel = ScoringModel{
+	Latency:    MetricRange{Good: 20, Bad: 200},
+	PacketLoss: MetricRange{Good: 0.001, Bad: 0.05},
+	Throughput: MetricRange{Good: 5, Bad: 0.5},
+	Weights:    ScoringWeights{Latency: 0.4, PacketLoss: 0.3, Throughput: 0.3},
+}
+
+const defaultCalibrationWindow = 7 * 86400
+
+// UserDataCongestionConfig holds the capacities that user data congestion
+// analytics (TS 23.288 §6.8) compare traffic against. Capacities are keyed by
+// TAI or cell ID.
+type UserDataCongestionConfig struct {
+	// UserPlaneCapacity is in bytes/sec, like UPF rates
+	UserPlaneCapacity        map[string]float64 `yaml:"userPlaneCapacity,omitempty"`
+	DefaultUserPlaneCapacity float64            `yaml:"defaultUserPlaneCapacity,omitempty"`
+	// ControlPlaneCapacity is in signalling messages/sec
+	ControlPlaneCapacity        map[string]float64 `yaml:"controlPlaneCapacity,omitempty"`
+	DefaultControlPlaneCapacity float64            `yaml:"defaultControlPlaneCapacity,omitempty"`
+	// Thresholds classify the utilization (0..1) into congestion levels
+	Thresholds *LoadThresholds `yaml:"thresholds,omitempty"`
+}
+
+const (
+	defaultUserPlaneCapacity    = 1.25e9 // 10 Gbps
+	defaultControlPlaneCapacity = 1000
+)
+
 type Logger struct {
 	Level string `yaml:"level,omitempty"`
 	File  string `yaml:"file,omitempty"`
@@ -89,6 +474,35 @@ func InitConfigFactory(configPath string) error {
 		config.Configuration.Sbi.Scheme = "http"
 	}
 
+	if id := config.Configuration.NfInstanceId; id != "" {
+		if _, err := uuid.Parse(id); err != nil {
+			return fmt.Errorf("nfInstanceId %q is not a UUID: %w", id, err)
+		}
+	}
+	if err := validateEdges(config.Configuration.Edges); err != nil {
+		return err
+	}
+	if err := validateBranchingUpf(config.Configuration.BranchingUpf); err != nil {
+		return err
+	}
+
+	if config.Configuration.NfLoad != nil {
+		// Thresholds are looked up by upper-case NF type
+		thresholds := make(map[string]*LoadThresholds, len(config.Configuration.NfLoad.Thresholds))
+		for nfType, t := range config.Configuration.NfLoad.Thresholds {
+			thresholds[strings.ToUpper(nfType)] = t
+		}
+		config.Configuration.NfLoad.Thresholds = thresholds
+	}
+
+	if config.Configuration.Forecast != nil {
+		models := make(map[string]string, len(config.Configuration.Forecast.Models))
+		for nfType, model := range config.Configuration.Forecast.Models {
+			models[strings.ToUpper(nfType)] = model
+		}
+		config.Configuration.Forecast.Models = models
+	}
+
 	return nil
 }
 
@@ -98,3 +512,457 @@ func (c *Config) GetVersion() string {
 	}
 	return "1.0.0"
 }
+
+// ParseMode checks a run mode, case-insensitively. An empty mode is combined.
+func ParseMode(mode string) (string, error) {
+	mode = strings.ToLower(mode)
+	if mode == "" {
+		return ModeCombined, nil
+	}
+	if _, ok := modeServices[mode]; !ok {
+		return "", fmt.Errorf("unknown mode %q, expected %s, %s or %s", mode, ModeAnlf, ModeMtlf, ModeCombined)
+	}
+	return mode, nil
+}
+
+// GetMode returns the run mode, combined unless set
+func (c *Configuration) GetMode() string {
+	if c == nil {
+		return ModeCombined
+	}
+	if mode, err := ParseMode(c.Mode); err == nil {
+		return mode
+	}
+	return ModeCombined
+}
+
+// RunsAnlf reports whether analytics are served
+func (c *Configuration) RunsAnlf() bool {
+	return c.GetMode() != ModeMtlf
+}
+
+// RunsMtlf reports whether models are trained and provided
+func (c *Configuration) RunsMtlf() bool {
+	return c.GetMode() != ModeAnlf
+}
+
+// GetServiceNameList returns the SBI services advertised: the configured
+// ones the mode provides, or all of them when none are configured
+func (c *Configuration) GetServiceNameList() []string {
+	provided := modeServices[c.GetMode()]
+	if c == nil || len(c.ServiceNameList) == 0 {
+		return provided
+	}
+	names := make([]string, 0, len(c.ServiceNameList))
+	for _, name := range c.ServiceNameList {
+		for _, p := range provided {
+			if strings.EqualFold(name, p) {
+				names = append(names, p)
+			}
+		}
+	}
+	return names
+}
+
+// GetSbiUri returns the URI other NFs reach the SBI at
+func (c *Configuration) GetSbiUri() string {
+	scheme, host, port := "http", "127.0.0.1", 8000
+	if c != nil && c.Sbi != nil {
+		if c.Sbi.Scheme != "" {
+			scheme = c.Sbi.Scheme
+		}
+		if c.Sbi.RegisterIPv4 != "" {
+			host = c.Sbi.RegisterIPv4
+		} else if c.Sbi.BindingIPv4 != "" && c.Sbi.BindingIPv4 != "0.0.0.0" {
+			host = c.Sbi.BindingIPv4
+		}
+		if c.Sbi.Port > 0 {
+			port = c.Sbi.Port
+		}
+	}
+	return fmt.Sprintf("%s://%s:%d", scheme, host, port)
+}
+
+// GetDataRetention returns how long (seconds) collected samples are kept
+// locally: the configured retention, or else the longest history analytics
+// read
+func (c *Configuration) GetDataRetention() int {
+	if c != nil && c.DataCollectionConfig != nil && c.DataCollectionConfig.Retention > 0 {
+		return c.DataCollectionConfig.Retention
+	}
+	return max(c.GetForecast().History, c.GetAbnormalBehaviour().History, c.GetAnalyticsWindow(), c.GetNfLoadWindow(), c.GetCalibrationWindow())
+}
+
+// GetNfLoadThresholds returns the load thresholds of an NF type, falling back
+// to the configured default and then to built-in values
+func (c *Configuration) GetNfLoadThresholds(nfType string) LoadThresholds {
+	if c == nil || c.NfLoad == nil {
+		return defaultLoadThresholds
+	}
+	if t, ok := c.NfLoad.Thresholds[strings.ToUpper(nfType)]; ok && t != nil {
+		return *t
+	}
+	if c.NfLoad.Default != nil {
+		return *c.NfLoad.Default
+	}
+	return defaultLoadThresholds
+}
+
+// GetAnalyticsWindow returns the default analytics window in seconds
+func (c *Configuration) GetAnalyticsWindow() int {
+	if c == nil || c.AnalyticsWindow <= 0 {
+		return defaultAnalyticsWindow
+	}
+	return c.AnalyticsWindow
+}
+
+// GetAnalyticsWorkers returns the number of analytics computation workers
+func (c *Configuration) GetAnalyticsWorkers() int {
+	if c == nil || c.AnalyticsWorkers <= 0 {
+		return defaultAnalyticsWorkers
+	}
+	return c.AnalyticsWorkers
+}
+
+// GetAnalyticsCacheTTL returns how long (seconds) computed analytics are
+// reused. A negative TTL disables the cache.
+func (c *Configuration) GetAnalyticsCacheTTL() int {
+	if c == nil || c.AnalyticsCacheTTL == 0 {
+		return defaultAnalyticsCacheTTL
+	}
+	return max(c.AnalyticsCacheTTL, 0)
+}
+
+// GetNfLoadWindow returns the default NF load analytics window in seconds
+func (c *Configuration) GetNfLoadWindow() int {
+	if c == nil || c.NfLoad == nil || c.NfLoad.Window <= 0 {
+		return c.GetAnalyticsWindow()
+	}
+	return c.NfLoad.Window
+}
+
+// GetAreaOfInterest returns the TAIs of a named area of interest
+func (c *Configuration) GetAreaOfInterest(name string) ([]string, bool) {
+	if c == nil {
+		return nil, false
+	}
+	tais, ok := c.AreasOfInterest[name]
+	return tais, ok
+}
+
+// GetUeGroup returns the SUPIs of an internal UE group
+func (c *Configuration) GetUeGroup(groupId string) ([]string, bool) {
+	if c == nil {
+		return nil, false
+	}
+	supis, ok := c.UeGroups[groupId]
+	return supis, ok
+}
+
+// GetForecast returns the forecast settings with defaults filled in
+func (c *Configuration) GetForecast() ForecastConfig {
+	result := defaultForecastConfig
+	if c == nil || c.Forecast == nil {
+		return result
+	}
+
+	f := c.Forecast
+	if f.Step > 0 {
+		result.Step = f.Step
+	}
+	if f.History > 0 {
+		result.History = f.History
+	}
+	if f.Horizon > 0 {
+		result.Horizon = f.Horizon
+	}
+	if f.DefaultModel != "" {
+		result.DefaultModel = strings.ToLower(f.DefaultModel)
+	}
+	if f.EwmaAlpha > 0 {
+		result.EwmaAlpha = f.EwmaAlpha
+	}
+	if f.HoltWinters != nil {
+		result.HoltWinters = f.HoltWinters
+	}
+	result.Models = f.Models
+	return result
+}
+
+// GetForecastModel returns the prediction model configured for an NF type
+func (c *Configuration) GetForecastModel(nfType string) string {
+	f := c.GetForecast()
+	if model, ok := f.Models[strings.ToUpper(nfType)]; ok && model != "" {
+		return strings.ToLower(model)
+	}
+	return f.DefaultModel
+}
+
+// GetAccuracy returns the accuracy monitoring settings with defaults filled in
+func (c *Configuration) GetAccuracy() AccuracyConfig {
+	result := defaultAccuracyConfig
+	if c == nil || c.Accuracy == nil {
+		return result
+	}
+
+	a := c.Accuracy
+	if a.Window > 0 {
+		result.Window = a.Window
+	}
+	if a.Threshold > 0 {
+		result.Threshold = a.Threshold
+	}
+	if a.MinSamples > 0 {
+		result.MinSamples = a.MinSamples
+	}
+	if a.MaxPending > 0 {
+		result.MaxPending = a.MaxPending
+	}
+	return result
+}
+
+// GetTraining returns the model training settings with defaults filled in
+func (c *Configuration) GetTraining() TrainingConfig {
+	result := defaultTrainingConfig
+	// An MTLF always trains, an AnLF never does
+	result.Enabled = c.GetMode() == ModeMtlf
+	if c == nil || c.Training == nil {
+		return result
+	}
+
+	t := c.Training
+	result.Enabled = result.Enabled || (t.Enabled && c.RunsMtlf())
+	if t.Interval > 0 {
+		result.Interval = t.Interval
+	}
+	if t.ModelDir != "" {
+		result.ModelDir = t.ModelDir
+	}
+	if t.Holdout > 0 && t.Holdout < 1 {
+		result.Holdout = t.Holdout
+	}
+	if t.Keep > 0 {
+		result.Keep = t.Keep
+	}
+	result.ProviderUri = t.ProviderUri
+	return result
+}
+
+// GetAggregation returns the aggregator settings with defaults filled in.
+// Only an AnLF aggregates analytics.
+func (c *Configuration) GetAggregation() AggregationConfig {
+	result := defaultAggregationConfig
+	if c == nil || c.Aggregation == nil {
+		return result
+	}
+
+	a := c.Aggregation
+	result.Enabled = a.Enabled && c.RunsAnlf()
+	result.Peers = a.Peers
+	result.Discover = a.Discover
+	if a.DiscoveryInterval > 0 {
+		result.DiscoveryInterval = a.DiscoveryInterval
+	}
+	if a.Timeout > 0 {
+		result.Timeout = a.Timeout
+	}
+	return result
+}
+
+// GetAdrf returns the ADRF settings with defaults filled in
+func (c *Configuration) GetAdrf() AdrfConfig {
+	result := defaultAdrfConfig
+	if c == nil || c.Adrf == nil {
+		return result
+	}
+
+	a := c.Adrf
+	result.Enabled = a.Enabled
+	result.Uri = strings.TrimRight(a.Uri, "/")
+	if a.Retention > 0 {
+		result.Retention = a.Retention
+	}
+	if a.StoreInterval > 0 {
+		result.StoreInterval = a.StoreInterval
+	}
+	if a.Timeout > 0 {
+		result.Timeout = a.Timeout
+	}
+	if a.MaxRecords > 0 {
+		result.MaxRecords = a.MaxRecords
+	}
+	return result
+}
+
+// GetEdges returns the edge catalog, the lab edges if none is configured
+func (c *Configuration) GetEdges() []EdgeConfig {
+	if c == nil || len(c.Edges) == 0 {
+		return append([]EdgeConfig(nil), defaultEdges...)
+	}
+
+	result := make([]EdgeConfig, 0, len(c.Edges))
+	for _, e := range c.Edges {
+		if e != nil {
+			result = append(result, *e)
+		}
+	}
+	return result
+}
+
+// GetBranchingUpf returns the branching UPF, the lab one if none is
+// configured
+func (c *Configuration) GetBranchingUpf() BranchingUpfConfig {
+	if c == nil || c.BranchingUpf == nil {
+		return defaultBranchingUpf
+	}
+	return *c.BranchingUpf
+}
+
+// validateEdges checks that every edge is complete and named once, and
+// compiles the pod selectors
+func validateEdges(edges []*EdgeConfig) error {
+	seen := make(map[string]bool, len(edges))
+	for i, e := range edges {
+		if e == nil || e.Dnai == "" || e.AnchorUpf == "" || e.PodSelector == "" {
+			return fmt.Errorf("edges[%d]: dnai, anchorUpf and podSelector are required", i)
+		}
+		pattern, err := compilePodSelector(e.PodSelector)
+		if err != nil {
+			return fmt.Errorf("edges[%d]: invalid podSelector: %w", i, err)
+		}
+		e.podPattern = pattern
+		if e.Capacity < 0 {
+			return fmt.Errorf("edges[%d]: negative capacity", i)
+		}
+		dnai := strings.ToLower(e.Dnai)
+		if seen[dnai] {
+			return fmt.Errorf("edges[%d]: duplicate dnai %q", i, e.Dnai)
+		}
+		seen[dnai] = true
+	}
+	return nil
+}
+
+// validateBranchingUpf fills in the defaults of a configured branching UPF
+// and compiles its pod selector
+func validateBranchingUpf(b *BranchingUpfConfig) error {
+	if b == nil {
+		return nil
+	}
+	if b.Name == "" {
+		b.Name = defaultBranchingUpf.Name
+	}
+	if b.PodSelector == "" {
+		b.PodSelector = regexp.QuoteMeta(b.Name)
+	}
+	pattern, err := compilePodSelector(b.PodSelector)
+	if err != nil {
+		return fmt.Errorf("branchingUpf: invalid podSelector: %w", err)
+	}
+	b.podPattern = pattern
+	return nil
+}
+
+// GetAbnormalBehaviour returns the abnormal behaviour settings with defaults
+// filled in
+func (c *Configuration) GetAbnormalBehaviour() AbnormalBehaviourConfig {
+	result := defaultAbnormalBehaviourConfig
+	if c == nil || c.AbnormalBehaviour == nil {
+		return result
+	}
+
+	a := c.AbnormalBehaviour
+	if a.ZScore > 0 {
+		result.ZScore = a.ZScore
+	}
+	if a.EwmaAlpha > 0 {
+		result.EwmaAlpha = a.EwmaAlpha
+	}
+	if a.MinSamples > 0 {
+		result.MinSamples = a.MinSamples
+	}
+	if a.History > 0 {
+		result.History = a.History
+	}
+	if a.RareLocationRatio > 0 {
+		result.RareLocationRatio = a.RareLocationRatio
+	}
+	if a.PingPongWindow > 0 {
+		result.PingPongWindow = a.PingPongWindow
+	}
+	if a.PingPongCount > 0 {
+		result.PingPongCount = a.PingPongCount
+	}
+	if a.DdosRatio > 0 {
+		result.DdosRatio = a.DdosRatio
+	}
+	if a.GroupStep > 0 {
+		result.GroupStep = a.GroupStep
+	}
+	if a.Suppress > 0 {
+		result.Suppress = a.Suppress
+	}
+	return result
+}
+
+// GetScoringModel returns the MOS scoring model of an application, falling
+// back to the configured default and then to built-in values
+func (c *Configuration) GetScoringModel(appId string) ScoringModel {
+	if c == nil || c.ServiceExperience == nil {
+		return defaultScoringModel
+	}
+	if m, ok := c.ServiceExperience.Applications[appId]; ok && m != nil {
+		return *m
+	}
+	if c.ServiceExperience.Default != nil {
+		return *c.ServiceExperience.Default
+	}
+	return defaultScoringModel
+}
+
+// GetCalibrationWindow returns how far back AF experience samples are used
+func (c *Configuration) GetCalibrationWindow() int {
+	if c == nil || c.ServiceExperience == nil || c.ServiceExperience.CalibrationWindow <= 0 {
+		return defaultCalibrationWindow
+	}
+	return c.ServiceExperience.CalibrationWindow
+}
+
+// GetUserPlaneCapacity returns the user plane capacity (bytes/sec) of a TAI
+// or cell
+func (c *Configuration) GetUserPlaneCapacity(area string) float64 {
+	if c == nil || c.UserDataCongestion == nil {
+		return defaultUserPlaneCapacity
+	}
+	if v, ok := c.UserDataCongestion.UserPlaneCapacity[area]; ok && v > 0 {
+		return v
+	}
+	if c.UserDataCongestion.DefaultUserPlaneCapacity > 0 {
+		return c.UserDataCongestion.DefaultUserPlaneCapacity
+	}
+	return defaultUserPlaneCapacity
+}
+
+// GetControlPlaneCapacity returns the signalling capacity (messages/sec) of
+// a TAI or cell
+func (c *Configuration) GetControlPlaneCapacity(area string) float64 {
+	if c == nil || c.UserDataCongestion == nil {
+		return defaultControlPlaneCapacity
+	}
+	if v, ok := c.UserDataCongestion.ControlPlaneCapacity[area]; ok && v > 0 {
+		return v
+	}
+	if c.UserDataCongestion.DefaultControlPlaneCapacity > 0 {
+		return c.UserDataCongestion.DefaultControlPlaneCapacity
+	}
+	return defaultControlPlaneCapacity
+}
+
+// GetCongestionThresholds returns the utilization thresholds of user data
+// congestion levels
+func (c *Configuration) GetCongestionThresholds() LoadThresholds {
+	if c == nil || c.UserDataCongestion == nil || c.UserDataCongestion.Thresholds == nil {
+		return defaultLoadThresholds
+	}
+	return *c.UserDataCongestion.Thresholds
+}
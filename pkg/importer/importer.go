@@ -0,0 +1,368 @@
+package importer
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	nwdafContext "github.com/free5gc/nwdaf/pkg/context"
+)
+
+// maxReportedErrors bounds the row errors kept in a Batch
+const maxReportedErrors = 20
+
+// Batch holds the statistics parsed from one dataset
+type Batch struct {
+	NF      []*nwdafContext.NFStatistics
+	UE      []*nwdafContext.UEStatistics
+	Slice   []*nwdafContext.SliceStatistics
+	UPF     []*nwdafContext.UPFStatistics
+	DN      []*nwdafContext.DNStatistics
+	Skipped int
+	Errors  []string
+}
+
+// Summary is the JSON-friendly result of an import
+type Summary struct {
+	NFStatistics    int      `json:"nfStatistics"`
+	UEStatistics    int      `json:"ueStatistics"`
+	SliceStatistics int      `json:"sliceStatistics"`
+	UPFStatistics   int      `json:"upfStatistics"`
+	DNStatistics    int      `json:"dnStatistics"`
+	Skipped         int      `json:"skipped"`
+	Errors          []string `json:"errors,omitempty"`
+}
+
+func (b *Batch) Summary() Summary {
+	return Summary{
+		NFStatistics:    len(b.NF),
+		UEStatistics:    len(b.UE),
+		SliceStatistics: len(b.Slice),
+		UPFStatistics:   len(b.UPF),
+		DNStatistics:    len(b.DN),
+		Skipped:         b.Skipped,
+		Errors:          b.Errors,
+	}
+}
+
+func (b *Batch) skip(line int, err error) {
+	b.Skipped++
+	if len(b.Errors) < maxReportedErrors {
+		b.Errors = append(b.Errors, fmt.Sprintf("line %d: %v", line, err))
+	}
+}
+
+// Parse reads a dataset in the format given by the mapping. Rows that cannot
+// be converted are skipped and reported in the batch rather than aborting the
+// whole import.
+func Parse(r io.Reader, m *Mapping) (*Batch, error) {
+	switch m.Format {
+	case FormatCSV:
+		return parseCSV(r, m)
+	case FormatJSONL:
+		return parseJSONL(r, m)
+	default:
+		return nil, fmt.Errorf("unknown format %q", m.Format)
+	}
+}
+
+// Load stores every record of the batch in the NWDAF context, keeping the
+// original timestamps. The records are marked imported so that the local
+// retention does not drop those older than it.
+func Load(ctx *nwdafContext.NWDAFContext, b *Batch) {
+	for _, s := range b.NF {
+		s.MarkImported()
+		ctx.UpdateNFStatistics(s.NFInstanceId, s)
+	}
+	for _, s := range b.UE {
+		s.MarkImported()
+		ctx.UpdateUEStatistics(s.SUPI, s)
+	}
+	for _, s := range b.Slice {
+		s.MarkImported()
+		ctx.UpdateSliceStatistics(s.SNSSAI, s)
+	}
+	for _, s := range b.UPF {
+		s.MarkImported()
+		ctx.UpdateUPFStatistics(s.UPFId, s)
+	}
+	for _, s := range b.DN {
+		s.MarkImported()
+		ctx.UpdateDNStatistics(s)
+	}
+}
+
+func parseCSV(r io.Reader, m *Mapping) (*Batch, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+
+	batch := &Batch{}
+	line := 1
+	for {
+		record, err := reader.Read()
+		line++
+		if err == io.EOF {
+			break
+		}
+		// Malformed records are skipped; a failing reader ends the parse
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			batch.skip(line, err)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV: %w", err)
+		}
+
+		get := func(col string) (string, bool) {
+			i, ok := columns[col]
+			if !ok || i >= len(record) {
+				return "", false
+			}
+			return record[i], true
+		}
+		if err := batch.add(m, get); err != nil {
+			batch.skip(line, err)
+		}
+	}
+	return batch, nil
+}
+
+func parseJSONL(r io.Reader, m *Mapping) (*Batch, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+	batch := &Batch{}
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var obj map[string]interface{}
+		decoder := json.NewDecoder(strings.NewReader(text))
+		decoder.UseNumber()
+		if err := decoder.Decode(&obj); err != nil {
+			batch.skip(line, err)
+			continue
+		}
+
+		get := func(key string) (string, bool) {
+			return lookup(obj, key)
+		}
+		if err := batch.add(m, get); err != nil {
+			batch.skip(line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read JSON Lines: %w", err)
+	}
+	return batch, nil
+}
+
+// lookup resolves a key in a decoded JSON object. Dotted keys walk nested
+// objects, e.g. "load.cpu".
+func lookup(obj map[string]interface{}, key string) (string, bool) {
+	var current interface{} = obj
+	for _, part := range strings.Split(key, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		if current, ok = m[part]; !ok {
+			return "", false
+		}
+	}
+
+	switch v := current.(type) {
+	case nil:
+		return "", false
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case bool:
+		return strconv.FormatBool(v), true
+	default:
+		return fmt.Sprint(v), true
+	}
+}
+
+// splitList splits a multi-valued column on ';', '|', ',' or whitespace.
+// Commas only work in quoted CSV cells.
+func splitList(raw string) []string {
+	return strings.FieldsFunc(raw, func(r rune) bool {
+		return r == ';' || r == '|' || r == ',' || r == ' '
+	})
+}
+
+// add converts one source row into a statistics record of the mapped kind
+func (b *Batch) add(m *Mapping, get func(string) (string, bool)) error {
+	kind := m.Kind
+	if m.KindField != "" {
+		if raw, ok := get(m.KindField); ok && strings.TrimSpace(raw) != "" {
+			kind = strings.ToLower(strings.TrimSpace(raw))
+		}
+	}
+	if _, ok := kindKeys[kind]; !ok {
+		return fmt.Errorf("unknown kind %q", kind)
+	}
+
+	rawTs, ok := get(m.Timestamp.Field)
+	if !ok {
+		return fmt.Errorf("missing timestamp field %q", m.Timestamp.Field)
+	}
+	ts, err := m.parseTimestamp(rawTs)
+	if err != nil {
+		return err
+	}
+
+	key, ok := get(m.source(kindKeys[kind]))
+	if !ok || strings.TrimSpace(key) == "" {
+		return fmt.Errorf("missing %s", kindKeys[kind])
+	}
+	key = strings.TrimSpace(key)
+
+	// Optional numeric fields default to zero when absent
+	number := func(target string) (float64, error) {
+		raw, ok := get(m.source(target))
+		if !ok || strings.TrimSpace(raw) == "" {
+			return 0, nil
+		}
+		f, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s %q", target, raw)
+		}
+		return f, nil
+	}
+	text := func(target string) string {
+		raw, _ := get(m.source(target))
+		return strings.TrimSpace(raw)
+	}
+
+	switch kind {
+	case KindNF:
+		load, err := number("load")
+		if err != nil {
+			return err
+		}
+		stats := &nwdafContext.NFStatistics{
+			NFInstanceId: key,
+			NFType:       strings.ToUpper(text("nfType")),
+			Snssais:      splitList(text("snssais")),
+			Tais:         splitList(text("tais")),
+			Load:         load,
+			Timestamp:    ts,
+		}
+		if len(m.Metrics) > 0 {
+			stats.Metrics = make(map[string]float64, len(m.Metrics))
+			for name, src := range m.Metrics {
+				raw, ok := get(src)
+				if !ok || strings.TrimSpace(raw) == "" {
+					continue
+				}
+				f, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+				if err != nil {
+					return fmt.Errorf("invalid metric %s %q", name, raw)
+				}
+				stats.Metrics[name] = f
+			}
+		}
+		b.NF = append(b.NF, stats)
+
+	case KindUE:
+		values := make(map[string]float64)
+		for _, target := range []string{"fiveQi", "throughput", "latency", "packetLoss"} {
+			f, err := number(target)
+			if err != nil {
+				return err
+			}
+			values[target] = f
+		}
+		b.UE = append(b.UE, &nwdafContext.UEStatistics{
+			SUPI:       key,
+			Location:   text("location"),
+			FiveQi:     int(values["fiveQi"]),
+			AppId:      text("appId"),
+			Snssai:     text("snssai"),
+			Dnn:        text("dnn"),
+			Throughput: values["throughput"],
+			Latency:    values["latency"],
+			PacketLoss: values["packetLoss"],
+			Timestamp:  ts,
+		})
+
+	case KindSlice:
+		values := make(map[string]float64)
+		for _, target := range []string{"activeUes", "throughput", "resourceUsage"} {
+			f, err := number(target)
+			if err != nil {
+				return err
+			}
+			values[target] = f
+		}
+		b.Slice = append(b.Slice, &nwdafContext.SliceStatistics{
+			SNSSAI:        key,
+			ActiveUEs:     int(values["activeUes"]),
+			Throughput:    values["throughput"],
+			ResourceUsage: values["resourceUsage"],
+			Timestamp:     ts,
+		})
+
+	case KindUPF:
+		rx, err := number("rxRate")
+		if err != nil {
+			return err
+		}
+		tx, err := number("txRate")
+		if err != nil {
+			return err
+		}
+		b.UPF = append(b.UPF, &nwdafContext.UPFStatistics{
+			UPFId:     key,
+			Tais:      splitList(text("tais")),
+			RxRate:    rx,
+			TxRate:    tx,
+			Timestamp: ts,
+		})
+
+	case KindDN:
+		values := make(map[string]float64)
+		for _, target := range []string{"latency", "throughput", "packetLoss"} {
+			f, err := number(target)
+			if err != nil {
+				return err
+			}
+			values[target] = f
+		}
+		b.DN = append(b.DN, &nwdafContext.DNStatistics{
+			Dnai:          key,
+			AppServerAddr: text("appServerAddr"),
+			AppId:         text("appId"),
+			Dnn:           text("dnn"),
+			UPFId:         text("upfId"),
+			Latency:       values["latency"],
+			Throughput:    values["throughput"],
+			PacketLoss:    values["packetLoss"],
+			Timestamp:     ts,
+		})
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package importer
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestParseCSV(t *testing.T) {
+	mapping, err := ParseMapping([]byte(`
+kind: nf
+format: csv
+timestamp:
+  field: time
+  format: rfc3339
+fields:
+  nfInstanceId: id
+  nfType: type
+  load: cpu
+metrics:
+  memory: mem
+`))
+	if err != nil {
+		t.Fatalf("ParseMapping() error = %v", err)
+	}
+
+	data := `time,id,type,cpu,mem
+2024-01-01T00:00:00Z,amf-1,amf,0.5,0.3
+2024-01-01T00:01:00Z,amf-1,amf,not-a-number,0.3
+2024-01-01T00:02:00Z,smf-1,SMF,0.7,
+`
+	batch, err := Parse(strings.NewReader(data), mapping)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	if len(batch.NF) != 2 {
+		t.Fatalf("Expected 2 NF records, got %d", len(batch.NF))
+	}
+	if batch.Skipped != 1 {
+		t.Errorf("Expected 1 skipped row, got %d", batch.Skipped)
+	}
+	if batch.NF[0].Timestamp != 1704067200 {
+		t.Errorf("Expected original timestamp to be kept, got %d", batch.NF[0].Timestamp)
+	}
+	if batch.NF[0].NFType != "AMF" || batch.NF[0].Metrics["memory"] != 0.3 {
+		t.Errorf("Unexpected record: %+v", batch.NF[0])
+	}
+
+	// A failing reader ends the parse instead of being skipped forever
+	failing := io.MultiReader(strings.NewReader("time,id,type,cpu,mem\n"), iotest.ErrReader(errors.New("connection reset")))
+	if _, err := Parse(failing, mapping); err == nil {
+		t.Error("Expected an error from a failing reader")
+	}
+}
+
+func TestParseJSONL(t *testing.T) {
+	mapping, err := ParseMapping([]byte(`{"kind": "ue", "format": "jsonl", "timestamp": {"field": "ts", "format": "unix_ms"}, "fields": {"latency": "qos.latency"}}`))
+	if err != nil {
+		t.Fatalf("ParseMapping() error = %v", err)
+	}
+
+	data := `{"ts": 1704067200000, "supi": "imsi-1", "location": "tai-1", "throughput": 1000, "qos": {"latency": 12.5}}
+
+{"ts": 1704067260000, "location": "tai-2"}
+`
+	batch, err := Parse(strings.NewReader(data), mapping)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	if len(batch.UE) != 1 || batch.Skipped != 1 {
+		t.Fatalf("Expected 1 UE record and 1 skipped, got %d and %d", len(batch.UE), batch.Skipped)
+	}
+	if ue := batch.UE[0]; ue.Timestamp != 1704067200 || ue.Latency != 12.5 || ue.Location != "tai-1" {
+		t.Errorf("Unexpected record: %+v", ue)
+	}
+}
+
+func TestMappingValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		mapping string
+	}{
+		{"Unknown kind", "kind: pdu\nformat: csv\ntimestamp: {field: ts}"},
+		{"Unknown format", "kind: nf\nformat: xml\ntimestamp: {field: ts}"},
+		{"Missing timestamp", "kind: nf\nformat: csv"},
+		{"Unknown field", "kind: slice\nformat: csv\ntimestamp: {field: ts}\nfields: {load: x}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseMapping([]byte(tt.mapping)); err == nil {
+				t.Error("Expected mapping to be rejected")
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package importer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Record kinds accepted by the importer
+const (
+	KindNF    = "nf"
+	KindUE    = "ue"
+	KindSlice = "slice"
+	KindUPF   = "upf"
+	KindDN    = "dn"
+)
+
+// Input formats accepted by the importer
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+)
+
+// Timestamp encodings; anything else is treated as a Go time layout
+const (
+	TimestampUnix    = "unix"
+	TimestampUnixMs  = "unix_ms"
+	TimestampRFC3339 = "rfc3339"
+)
+
+// Mapping describes how the columns (CSV) or keys (JSON Lines) of a recorded
+// dataset map onto NWDAF statistics. Fields is keyed by the target field name
+// and holds the source column; unmapped target fields default to a source
+// column of the same name. Mixed datasets, such as replay traces, name the
+// column holding each row's kind in KindField; Kind is then the fallback.
+type Mapping struct {
+	Kind      string            `yaml:"kind" json:"kind"`
+	KindField string            `yaml:"kindField,omitempty" json:"kindField,omitempty"`
+	Format    string            `yaml:"format" json:"format"`
+	Timestamp TimestampMapping  `yaml:"timestamp" json:"timestamp"`
+	Fields    map[string]string `yaml:"fields,omitempty" json:"fields,omitempty"`
+	// Metrics copies extra numeric source columns into NFStatistics.Metrics,
+	// keyed by metric name
+	Metrics map[string]string `yaml:"metrics,omitempty" json:"metrics,omitempty"`
+}
+
+type TimestampMapping struct {
+	Field  string `yaml:"field" json:"field"`
+	Format string `yaml:"format,omitempty" json:"format,omitempty"`
+}
+
+// Target fields per kind
+var kindFields = map[string][]string{
+	KindNF:    {"nfInstanceId", "nfType", "snssais", "tais", "load"},
+	KindUE:    {"supi", "location", "fiveQi", "appId", "snssai", "dnn", "throughput", "latency", "packetLoss"},
+	KindSlice: {"snssai", "activeUes", "throughput", "resourceUsage"},
+	KindUPF:   {"upfId", "tais", "rxRate", "txRate"},
+	KindDN:    {"dnai", "appServerAddr", "appId", "dnn", "upfId", "latency", "throughput", "packetLoss"},
+}
+
+// Key field per kind, required on every record
+var kindKeys = map[string]string{
+	KindNF:    "nfInstanceId",
+	KindUE:    "supi",
+	KindSlice: "snssai",
+	KindUPF:   "upfId",
+	KindDN:    "dnai",
+}
+
+// ParseMapping decodes a mapping spec. YAML is expected, which also covers
+// JSON documents.
+func ParseMapping(content []byte) (*Mapping, error) {
+	m := &Mapping{}
+	if err := yaml.Unmarshal(content, m); err != nil {
+		return nil, fmt.Errorf("failed to parse mapping: %w", err)
+	}
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *Mapping) Validate() error {
+	m.Kind = strings.ToLower(m.Kind)
+	m.Format = strings.ToLower(m.Format)
+
+	fields, ok := kindFields[m.Kind]
+	if !ok && !(m.KindField != "" && m.Kind == "") {
+		return fmt.Errorf("unknown kind %q (expected nf, ue, slice, upf or dn)", m.Kind)
+	}
+	if m.KindField != "" {
+		// Rows may be of any kind, so accept every target field
+		fields = nil
+		for _, f := range kindFields {
+			fields = append(fields, f...)
+		}
+	}
+	if m.Format != FormatCSV && m.Format != FormatJSONL {
+		return fmt.Errorf("unknown format %q (expected csv or jsonl)", m.Format)
+	}
+	if m.Timestamp.Field == "" {
+		return fmt.Errorf("timestamp.field is required")
+	}
+	if m.Timestamp.Format == "" {
+		m.Timestamp.Format = TimestampUnix
+	}
+
+	for target := range m.Fields {
+		if !contains(fields, target) {
+			return fmt.Errorf("unknown %s field %q", m.Kind, target)
+		}
+	}
+	if len(m.Metrics) > 0 && m.Kind != KindNF && m.KindField == "" {
+		return fmt.Errorf("metrics are only supported for kind nf")
+	}
+	return nil
+}
+
+// source returns the source column for a target field
+func (m *Mapping) source(target string) string {
+	if src, ok := m.Fields[target]; ok && src != "" {
+		return src
+	}
+	return target
+}
+
+// parseTimestamp converts a raw timestamp value to Unix seconds
+func (m *Mapping) parseTimestamp(raw string) (int64, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return 0, fmt.Errorf("empty timestamp")
+	}
+
+	switch strings.ToLower(m.Timestamp.Format) {
+	case TimestampUnix:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid unix timestamp %q", raw)
+		}
+		return int64(f), nil
+	case TimestampUnixMs:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid unix_ms timestamp %q", raw)
+		}
+		return int64(f) / 1000, nil
+	case TimestampRFC3339:
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return 0, fmt.Errorf("invalid rfc3339 timestamp %q", raw)
+		}
+		return t.Unix(), nil
+	default:
+		t, err := time.Parse(m.Timestamp.Format, raw)
+		if err != nil {
+			return 0, fmt.Errorf("timestamp %q does not match layout %q", raw, m.Timestamp.Format)
+		}
+		return t.Unix(), nil
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
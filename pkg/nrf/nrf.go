@@ -0,0 +1,231 @@
+// Package nrf registers the NWDAF with the NRF (Nnrf_NFManagement, TS 29.510)
+// and discovers peer NWDAFs (Nnrf_NFDiscovery)
+package nrf
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/free5gc/nwdaf/pkg/factory"
+)
+
+const (
+	nfManagementPath = "/nnrf-nfm/v1/nf-instances/"
+	nfDiscoveryPath  = "/nnrf-disc/v1/nf-instances"
+	requestTimeout   = 5 * time.Second
+)
+
+// NFProfile is the part of the NF profile (TS 29.510 §6.1.6.2.2) the NWDAF
+// registers
+type NFProfile struct {
+	NfInstanceId   string      `json:"nfInstanceId"`
+	NfInstanceName string      `json:"nfInstanceName,omitempty"`
+	NfType         string      `json:"nfType"`
+	NfStatus       string      `json:"nfStatus"`
+	PlmnList       []PlmnId    `json:"plmnList,omitempty"`
+	Ipv4Addresses  []string    `json:"ipv4Addresses,omitempty"`
+	NfServices     []NFService `json:"nfServices,omitempty"`
+	NwdafInfo      *NwdafInfo  `json:"nwdafInfo,omitempty"`
+}
+
+type PlmnId struct {
+	Mcc string `json:"mcc"`
+	Mnc string `json:"mnc"`
+}
+
+type NFService struct {
+	ServiceInstanceId string       `json:"serviceInstanceId"`
+	ServiceName       string       `json:"serviceName"`
+	Versions          []NFVersion  `json:"versions"`
+	Scheme            string       `json:"scheme"`
+	NfServiceStatus   string       `json:"nfServiceStatus"`
+	IpEndPoints       []IpEndPoint `json:"ipEndPoints,omitempty"`
+}
+
+type NFVersion struct {
+	ApiVersionInUri string `json:"apiVersionInUri"`
+	ApiFullVersion  string `json:"apiFullVersion"`
+}
+
+type IpEndPoint struct {
+	Ipv4Address string `json:"ipv4Address,omitempty"`
+	Port        int    `json:"port,omitempty"`
+}
+
+// NwdafInfo advertises the analytics the NWDAF serves, the areas it serves
+// them for and the models it trains
+type NwdafInfo struct {
+	NwdafEvents     []string           `json:"nwdafEvents,omitempty"`
+	TaiList         []string           `json:"taiList,omitempty"`
+	MlAnalyticsList []*MlAnalyticsInfo `json:"mlAnalyticsList,omitempty"`
+}
+
+// MlAnalyticsInfo lists the event types an MTLF provides models for
+type MlAnalyticsInfo struct {
+	MlAnalyticsIds []string `json:"mlAnalyticsIds"`
+}
+
+// BuildProfile builds the NWDAF profile from the configuration and run mode.
+// An AnLF lists the given event types in nwdafInfo, i.e. those of the
+// registered analytics modules; an MTLF lists the event types it trains
+// models for in mlAnalyticsList. A combined NWDAF lists both.
+func BuildProfile(nfInstanceId string, config *factory.Configuration, events, mlEvents []string) *NFProfile {
+	info := &NwdafInfo{}
+	if config.RunsAnlf() {
+		info.NwdafEvents = events
+		info.TaiList = config.ServingTais
+	}
+	if config.RunsMtlf() && len(mlEvents) > 0 {
+		info.MlAnalyticsList = []*MlAnalyticsInfo{{MlAnalyticsIds: mlEvents}}
+	}
+	profile := &NFProfile{
+		NfInstanceId:   nfInstanceId,
+		NfInstanceName: config.NwdafName,
+		NfType:         "NWDAF",
+		NfStatus:       "REGISTERED",
+		NwdafInfo:      info,
+	}
+	for _, plmn := range config.PlmnList {
+		profile.PlmnList = append(profile.PlmnList, PlmnId{Mcc: plmn.Mcc, Mnc: plmn.Mnc})
+	}
+
+	var endPoints []IpEndPoint
+	scheme := "http"
+	if config.Sbi != nil {
+		if config.Sbi.RegisterIPv4 != "" {
+			profile.Ipv4Addresses = []string{config.Sbi.RegisterIPv4}
+			endPoints = []IpEndPoint{{Ipv4Address: config.Sbi.RegisterIPv4, Port: config.Sbi.Port}}
+		}
+		if config.Sbi.Scheme != "" {
+			scheme = config.Sbi.Scheme
+		}
+	}
+	for i, name := range config.GetServiceNameList() {
+		profile.NfServices = append(profile.NfServices, NFService{
+			ServiceInstanceId: fmt.Sprintf("%d", i),
+			ServiceName:       name,
+			Versions:          []NFVersion{{ApiVersionInUri: "v1", ApiFullVersion: "1.0.0"}},
+			Scheme:            scheme,
+			NfServiceStatus:   "REGISTERED",
+			IpEndPoints:       endPoints,
+		})
+	}
+	return profile
+}
+
+// ServiceUri returns the API root of a service of the profile, or "" when
+// the profile has no address for it
+func (p *NFProfile) ServiceUri(serviceName string) string {
+	for _, service := range p.NfServices {
+		if service.ServiceName != serviceName {
+			continue
+		}
+		scheme := service.Scheme
+		if scheme == "" {
+			scheme = "http"
+		}
+		for _, endPoint := range service.IpEndPoints {
+			if endPoint.Ipv4Address == "" {
+				continue
+			}
+			if endPoint.Port == 0 {
+				return fmt.Sprintf("%s://%s", scheme, endPoint.Ipv4Address)
+			}
+			return fmt.Sprintf("%s://%s:%d", scheme, endPoint.Ipv4Address, endPoint.Port)
+		}
+		if len(p.Ipv4Addresses) > 0 {
+			return fmt.Sprintf("%s://%s", scheme, p.Ipv4Addresses[0])
+		}
+	}
+	return ""
+}
+
+// SearchResult is the reply to an NF discovery (TS 29.510 §6.2.6.2.2)
+type SearchResult struct {
+	NfInstances []*NFProfile `json:"nfInstances"`
+}
+
+// Client talks to one NRF
+type Client struct {
+	nrfUri string
+	client *http.Client
+}
+
+func NewClient(nrfUri string) *Client {
+	return &Client{
+		nrfUri: strings.TrimRight(nrfUri, "/"),
+		client: &http.Client{Timeout: requestTimeout},
+	}
+}
+
+// Register creates or replaces the NF profile (NFRegister)
+func (c *Client) Register(ctx context.Context, profile *NFProfile) error {
+	body, err := json.Marshal(profile)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.nrfUri+nfManagementPath+profile.NfInstanceId, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return c.do(req, http.StatusOK, http.StatusCreated)
+}
+
+// Deregister removes the NF profile (NFDeregister)
+func (c *Client) Deregister(ctx context.Context, nfInstanceId string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, c.nrfUri+nfManagementPath+nfInstanceId, nil)
+	if err != nil {
+		return err
+	}
+	return c.do(req, http.StatusNoContent, http.StatusOK)
+}
+
+// Discover returns the registered NF instances of a type (NFDiscover)
+func (c *Client) Discover(ctx context.Context, targetNfType, requesterNfType string) ([]*NFProfile, error) {
+	query := url.Values{}
+	query.Set("target-nf-type", targetNfType)
+	query.Set("requester-nf-type", requesterNfType)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.nrfUri+nfDiscoveryPath+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("NRF returned %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+
+	var result SearchResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	return result.NfInstances, nil
+}
+
+func (c *Client) do(req *http.Request, expected ...int) error {
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	for _, status := range expected {
+		if resp.StatusCode == status {
+			return nil
+		}
+	}
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("NRF returned %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+}
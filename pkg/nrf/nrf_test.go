@@ -0,0 +1,139 @@
+package nrf
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/free5gc/nwdaf/pkg/factory"
+)
+
+func TestBuildProfile(t *testing.T) {
+	config := &factory.Configuration{
+		NwdafName:       "NWDAF",
+		Sbi:             &factory.Sbi{Scheme: "http", RegisterIPv4: "127.0.0.10", Port: 8000},
+		ServiceNameList: []string{"nnwdaf-eventssubscription", "nnwdaf-analyticsinfo"},
+		PlmnList:        []factory.PlmnId{{Mcc: "208", Mnc: "93"}},
+	}
+
+	profile := BuildProfile("nf-1", config, []string{"NF_LOAD", "UE_MOBILITY"}, nil)
+	if profile.NfType != "NWDAF" || profile.NfInstanceId != "nf-1" {
+		t.Errorf("Expected an NWDAF profile for nf-1, got %+v", profile)
+	}
+	if len(profile.NfServices) != 2 || profile.NfServices[0].IpEndPoints[0].Port != 8000 {
+		t.Errorf("Expected 2 services on port 8000, got %+v", profile.NfServices)
+	}
+	if events := profile.NwdafInfo.NwdafEvents; len(events) != 2 || events[1] != "UE_MOBILITY" {
+		t.Errorf("Expected nwdafInfo to list the given events, got %v", events)
+	}
+}
+
+func TestBuildProfileModes(t *testing.T) {
+	tests := []struct {
+		mode       string
+		services   int
+		events     int
+		mlAnalytic bool
+	}{
+		{factory.ModeAnlf, 3, 2, false},
+		{factory.ModeMtlf, 2, 0, true},
+		{factory.ModeCombined, 4, 2, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			config := &factory.Configuration{Mode: tt.mode, Sbi: &factory.Sbi{RegisterIPv4: "127.0.0.10", Port: 8000}}
+			profile := BuildProfile("nf-1", config, []string{"NF_LOAD", "UE_MOBILITY"}, []string{"NF_LOAD"})
+			if len(profile.NfServices) != tt.services {
+				t.Errorf("Expected %d services, got %+v", tt.services, profile.NfServices)
+			}
+			if len(profile.NwdafInfo.NwdafEvents) != tt.events {
+				t.Errorf("Expected %d nwdafEvents, got %v", tt.events, profile.NwdafInfo.NwdafEvents)
+			}
+			if (len(profile.NwdafInfo.MlAnalyticsList) == 1) != tt.mlAnalytic {
+				t.Errorf("Expected mlAnalyticsList %v, got %+v", tt.mlAnalytic, profile.NwdafInfo.MlAnalyticsList)
+			}
+		})
+	}
+
+	// Configured services the mode does not provide are not advertised
+	config := &factory.Configuration{Mode: factory.ModeMtlf, ServiceNameList: []string{"nnwdaf-analyticsinfo", "nnwdaf-mlmodelprovision"}}
+	if profile := BuildProfile("nf-1", config, nil, nil); len(profile.NfServices) != 1 || profile.NfServices[0].ServiceName != "nnwdaf-mlmodelprovision" {
+		t.Errorf("Expected the ML model provision service only, got %+v", profile.NfServices)
+	}
+}
+
+func TestRegisterAndDeregister(t *testing.T) {
+	var registered *NFProfile
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/nnrf-nfm/v1/nf-instances/nf-1" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		switch r.Method {
+		case http.MethodPut:
+			registered = &NFProfile{}
+			if err := json.NewDecoder(r.Body).Decode(registered); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodDelete:
+			registered = nil
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL + "/")
+	profile := &NFProfile{NfInstanceId: "nf-1", NfType: "NWDAF", NfStatus: "REGISTERED", NwdafInfo: &NwdafInfo{NwdafEvents: []string{"NF_LOAD"}}}
+	if err := client.Register(context.Background(), profile); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	if registered == nil || registered.NwdafInfo == nil || registered.NwdafInfo.NwdafEvents[0] != "NF_LOAD" {
+		t.Errorf("Expected the NRF to receive nwdafInfo, got %+v", registered)
+	}
+
+	if err := client.Deregister(context.Background(), "nf-1"); err != nil {
+		t.Fatalf("Deregister() error = %v", err)
+	}
+	if registered != nil {
+		t.Error("Expected the profile to be removed")
+	}
+
+	if err := client.Deregister(context.Background(), "nf-2"); err == nil {
+		t.Error("Expected an error for an unknown instance")
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/nnrf-disc/v1/nf-instances" || r.URL.Query().Get("target-nf-type") != "NWDAF" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		config := &factory.Configuration{
+			Mode:        factory.ModeAnlf,
+			Sbi:         &factory.Sbi{Scheme: "http", RegisterIPv4: "10.0.0.2", Port: 8000},
+			ServingTais: []string{"tai-1", "tai-2"},
+		}
+		_ = json.NewEncoder(w).Encode(SearchResult{NfInstances: []*NFProfile{BuildProfile("nf-2", config, []string{"NF_LOAD"}, nil)}})
+	}))
+	defer server.Close()
+
+	profiles, err := NewClient(server.URL).Discover(context.Background(), "NWDAF", "NWDAF")
+	if err != nil {
+		t.Fatalf("Discover() error = %v", err)
+	}
+	if len(profiles) != 1 || len(profiles[0].NwdafInfo.TaiList) != 2 {
+		t.Fatalf("Expected one NWDAF serving 2 TAIs, got %+v", profiles)
+	}
+	if uri := profiles[0].ServiceUri("nnwdaf-analyticsinfo"); uri != "http://10.0.0.2:8000" {
+		t.Errorf("Expected the analytics service at http://10.0.0.2:8000, got %q", uri)
+	}
+	if uri := profiles[0].ServiceUri("nnwdaf-mlmodelprovision"); uri != "" {
+		t.Errorf("Expected no URI for a service not provided, got %q", uri)
+	}
+}
@@ -0,0 +1,125 @@
+package replay
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/free5gc/nwdaf/internal/logger"
+	"github.com/free5gc/nwdaf/pkg/clock"
+	nwdafContext "github.com/free5gc/nwdaf/pkg/context"
+	"github.com/free5gc/nwdaf/pkg/factory"
+	"github.com/free5gc/nwdaf/pkg/importer"
+)
+
+// event is one trace record, applied to the context once the virtual clock
+// reaches its timestamp
+type event struct {
+	ts    int64
+	apply func(ctx *nwdafContext.NWDAFContext)
+}
+
+// Driver feeds a recorded trace into the NWDAF context on a virtual clock
+// that starts at the first record and runs Speed times faster than real time.
+type Driver struct {
+	ctx    *nwdafContext.NWDAFContext
+	clock  *clock.Virtual
+	events []event
+}
+
+func NewDriver(ctx *nwdafContext.NWDAFContext, batch *importer.Batch, speed float64) (*Driver, error) {
+	var events []event
+	for _, s := range batch.NF {
+		s := s
+		events = append(events, event{s.Timestamp, func(c *nwdafContext.NWDAFContext) { c.UpdateNFStatistics(s.NFInstanceId, s) }})
+	}
+	for _, s := range batch.UE {
+		s := s
+		events = append(events, event{s.Timestamp, func(c *nwdafContext.NWDAFContext) { c.UpdateUEStatistics(s.SUPI, s) }})
+	}
+	for _, s := range batch.Slice {
+		s := s
+		events = append(events, event{s.Timestamp, func(c *nwdafContext.NWDAFContext) { c.UpdateSliceStatistics(s.SNSSAI, s) }})
+	}
+	for _, s := range batch.UPF {
+		s := s
+		events = append(events, event{s.Timestamp, func(c *nwdafContext.NWDAFContext) { c.UpdateUPFStatistics(s.UPFId, s) }})
+	}
+	for _, s := range batch.DN {
+		s := s
+		events = append(events, event{s.Timestamp, func(c *nwdafContext.NWDAFContext) { c.UpdateDNStatistics(s) }})
+	}
+	if len(events) == 0 {
+		return nil, fmt.Errorf("trace contains no records")
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].ts < events[j].ts })
+
+	return &Driver{
+		ctx:    ctx,
+		clock:  clock.NewVirtual(time.Unix(events[0].ts, 0), speed),
+		events: events,
+	}, nil
+}
+
+// Clock returns the virtual clock the rest of the pipeline must run on
+func (d *Driver) Clock() *clock.Virtual {
+	return d.clock
+}
+
+// Span returns the virtual time covered by the trace
+func (d *Driver) Span() time.Duration {
+	return time.Duration(d.events[len(d.events)-1].ts-d.events[0].ts) * time.Second
+}
+
+// Run applies the trace records as virtual time passes. It returns once the
+// last record has been applied or the context is cancelled.
+func (d *Driver) Run(ctx context.Context) error {
+	logger.AppLog.Infof("Replaying %d records spanning %v at %.0fx", len(d.events), d.Span(), d.clock.Speed())
+
+	for i, ev := range d.events {
+		due := time.Unix(ev.ts, 0)
+		if wait := due.Sub(d.clock.Now()); wait > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(d.clock.RealDuration(wait)):
+			}
+		}
+		ev.apply(d.ctx)
+
+		if (i+1)%1000 == 0 {
+			logger.AppLog.Infof("Replayed %d/%d records (virtual time %s)", i+1, len(d.events), d.clock.Now().UTC().Format(time.RFC3339))
+		}
+	}
+
+	logger.AppLog.Infof("Replay finished at virtual time %s", d.clock.Now().UTC().Format(time.RFC3339))
+	return nil
+}
+
+// RateSource serves the auto-steer monitor with the receive rates of the
+// replayed UPF records instead of querying Prometheus. Records of an edge's
+// anchor UPF count for its DNAI, those of the branching UPF for its name;
+// other UPFs are keyed by their ID.
+func RateSource(ctx *nwdafContext.NWDAFContext, edges []factory.EdgeConfig, branching factory.BranchingUpfConfig) func() (map[string]float64, error) {
+	return func() (map[string]float64, error) {
+		rates := map[string]float64{branching.Name: 0}
+		for _, e := range edges {
+			rates[e.Dnai] = 0
+		}
+		for upfId, stats := range ctx.GetAllUPFStatistics() {
+			key := upfId
+			if strings.EqualFold(upfId, branching.Name) {
+				key = branching.Name
+			}
+			for _, e := range edges {
+				if strings.EqualFold(upfId, e.AnchorUpf) || strings.EqualFold(upfId, e.Dnai) {
+					key = e.Dnai
+				}
+			}
+			rates[key] += stats.RxRate
+		}
+		return rates, nil
+	}
+}
@@ -0,0 +1,54 @@
+package replay
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	nwdafContext "github.com/free5gc/nwdaf/pkg/context"
+	"github.com/free5gc/nwdaf/pkg/factory"
+	"github.com/free5gc/nwdaf/pkg/importer"
+)
+
+func TestDriverRun(t *testing.T) {
+	ctx := &nwdafContext.NWDAFContext{DataStore: nwdafContext.NewDataStore()}
+	batch := &importer.Batch{
+		NF: []*nwdafContext.NFStatistics{
+			{NFInstanceId: "amf-1", Load: 0.5, Timestamp: 1060},
+			{NFInstanceId: "amf-1", Load: 0.3, Timestamp: 1000},
+		},
+		UPF: []*nwdafContext.UPFStatistics{
+			{UPFId: "edge1", RxRate: 2000, Timestamp: 1030},
+			{UPFId: "AnchorUPF2", RxRate: 500, Timestamp: 1030},
+			{UPFId: "upfb", RxRate: 300, Timestamp: 1030},
+		},
+	}
+
+	// One virtual minute in 10ms
+	driver, err := NewDriver(ctx, batch, 6000)
+	if err != nil {
+		t.Fatalf("NewDriver() error = %v", err)
+	}
+	if driver.Span() != time.Minute {
+		t.Errorf("Expected a one minute span, got %v", driver.Span())
+	}
+
+	runCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := driver.Run(runCtx); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if driver.Clock().Now().Unix() < 1060 {
+		t.Errorf("Expected virtual clock past the last record, got %d", driver.Clock().Now().Unix())
+	}
+	if latest, _ := ctx.GetNFStatistics("amf-1"); latest.Load != 0.5 {
+		t.Errorf("Expected latest load 0.5, got %.2f", latest.Load)
+	}
+
+	edges := []factory.EdgeConfig{{Dnai: "edge1", AnchorUpf: "AnchorUPF1"}, {Dnai: "edge2", AnchorUpf: "AnchorUPF2"}}
+	rates, _ := RateSource(ctx, edges, factory.BranchingUpfConfig{Name: "upfb"})()
+	if rates["edge1"] != 2000 || rates["edge2"] != 500 || rates["upfb"] != 300 {
+		t.Errorf("Expected replayed rates keyed by DNAI, got %v", rates)
+	}
+}
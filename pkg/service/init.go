@@ -12,10 +12,13 @@ import (
 
 	"github.com/free5gc/nwdaf/internal/logger"
 	"github.com/free5gc/nwdaf/internal/sbi"
+	"github.com/free5gc/nwdaf/pkg/adrf"
 	"github.com/free5gc/nwdaf/pkg/agent"
 	"github.com/free5gc/nwdaf/pkg/analytics"
+	"github.com/free5gc/nwdaf/pkg/clock"
 	nwdafContext "github.com/free5gc/nwdaf/pkg/context"
 	"github.com/free5gc/nwdaf/pkg/factory"
+	"github.com/free5gc/nwdaf/pkg/nrf"
 	"github.com/gin-gonic/gin"
 	"github.com/urfave/cli"
 )
@@ -28,20 +31,37 @@ type NWDAF struct {
 	nwdafContext    *nwdafContext.NWDAFContext
 	analyticsEngine *analytics.AnalyticsEngine
 	agent           *agent.Agent
+	nrfClient       *nrf.Client
+
+	// Clock drives the analytics engine and the auto-steer monitor. Defaults to
+	// the wall clock; trace replay sets a virtual clock before Initialize.
+	Clock clock.Clock
+	// RateSource, when set, replaces the Prometheus UPF rate query of the agent
+	RateSource func() (map[string]float64, error)
 }
 
 func (nwdaf *NWDAF) Initialize(c *cli.Context) {
 	nwdaf.ctx, nwdaf.cancel = context.WithCancel(context.Background())
 
+	if nwdaf.Clock == nil {
+		nwdaf.Clock = clock.Real
+	}
+
 	// Initialize NWDAF context
 	nwdaf.nwdafContext = nwdafContext.GetSelf()
 	nwdaf.nwdafContext.Init()
 
 	// Initialize analytics engine
 	nwdaf.analyticsEngine = analytics.NewAnalyticsEngine(nwdaf.nwdafContext)
+	nwdaf.analyticsEngine.SetClock(nwdaf.Clock)
+	if config := factory.NwdafConfig.Configuration.GetAdrf(); config.Enabled {
+		nwdaf.analyticsEngine.SetADRF(newADRF(config))
+	}
 
 	// Initialize Traffic Steering Agent
 	nwdaf.agent = agent.NewAgent()
+	nwdaf.agent.Clock = nwdaf.Clock
+	nwdaf.agent.RateSource = nwdaf.RateSource
 
 	// Set up HTTP router
 	nwdaf.setUpRouter()
@@ -51,7 +71,7 @@ func (nwdaf *NWDAF) setUpRouter() {
 	router := gin.Default()
 
 	// Register SBI routes
-	sbi.RegisterRoutes(router, nwdaf.nwdafContext, nwdaf.analyticsEngine, nwdaf.agent)
+	sbi.RegisterRoutes(router, nwdaf.nwdafContext, nwdaf.analyticsEngine, nwdaf.agent, factory.NwdafConfig.Configuration.GetMode())
 
 	nwdaf.router = router
 
@@ -73,12 +93,50 @@ func (nwdaf *NWDAF) Start() {
 	wg.Add(1)
 	go nwdaf.listenAndServe(&wg)
 
-	// Start analytics engine
+	config := factory.NwdafConfig.Configuration
+	logger.InitLog.Infof("Running in %s mode", config.GetMode())
+
+	// Start analytics engine (AnLF)
+	if config.RunsAnlf() {
+		wg.Add(1)
+		go nwdaf.startAnalytics(&wg)
+	}
+
+	// Start model training (MTLF)
+	if config.GetTraining().Enabled {
+		wg.Add(1)
+		go nwdaf.startTraining(&wg)
+	}
+
+	// Notify the subscribers of collected data
 	wg.Add(1)
-	go nwdaf.startAnalytics(&wg)
+	go nwdaf.startDataNotifications(&wg)
+
+	// Store analytics and collected data in the ADRF
+	if config.GetAdrf().Enabled {
+		wg.Add(1)
+		go nwdaf.startStorage(&wg)
+	}
+
+	// Register with NRF
+	nwdaf.registerNF()
 
-	// Start agent
-	nwdaf.agent.Start(nwdaf.ctx)
+	if config.RunsAnlf() {
+		// Subscribe to the models of the configured MTLF
+		if config.GetTraining().ProviderUri != "" {
+			wg.Add(1)
+			go nwdaf.subscribeModels(&wg)
+		}
+
+		// Discover the peers of an aggregator
+		if aggregation := config.GetAggregation(); aggregation.Enabled && aggregation.Discover && config.NrfUri != "" {
+			wg.Add(1)
+			go nwdaf.discoverPeers(&wg)
+		}
+
+		// Start agent
+		nwdaf.agent.Start(nwdaf.ctx)
+	}
 
 	// Wait for interrupt signal
 	signalChannel := make(chan os.Signal, 1)
@@ -117,9 +175,117 @@ func (nwdaf *NWDAF) startAnalytics(wg *sync.WaitGroup) {
 	nwdaf.analyticsEngine.Start(nwdaf.ctx)
 }
 
+func (nwdaf *NWDAF) startTraining(wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	logger.InitLog.Infoln("Starting model training...")
+	nwdaf.analyticsEngine.StartTraining(nwdaf.ctx)
+}
+
+func (nwdaf *NWDAF) startDataNotifications(wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	nwdaf.analyticsEngine.StartDataNotifications(nwdaf.ctx)
+}
+
+func (nwdaf *NWDAF) startStorage(wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	logger.InitLog.Infoln("Starting ADRF storage...")
+	nwdaf.analyticsEngine.StartStorage(nwdaf.ctx)
+}
+
+// newADRF returns a client of the configured ADRF, or the embedded stub ADRF
+// when no URI is configured
+func newADRF(config factory.AdrfConfig) adrf.Repository {
+	if config.Uri == "" {
+		logger.InitLog.Infof("Using the embedded stub ADRF, keeping up to %d records", config.MaxRecords)
+		return adrf.NewStub(config.MaxRecords)
+	}
+	logger.InitLog.Infof("Using the ADRF at %s", config.Uri)
+	return adrf.NewClient(config.Uri, time.Duration(config.Timeout)*time.Second)
+}
+
+// registerNF registers the NWDAF profile of the run mode with the NRF,
+// advertising the event types of the registered analytics modules and those
+// models are trained for
+func (nwdaf *NWDAF) registerNF() {
+	config := factory.NwdafConfig.Configuration
+	if config.NrfUri == "" {
+		return
+	}
+
+	client := nrf.NewClient(config.NrfUri)
+	profile := nrf.BuildProfile(nwdaf.nwdafContext.NfId, config, analytics.EventIds(), analytics.TrainedEvents())
+	if err := client.Register(nwdaf.ctx, profile); err != nil {
+		logger.NrfLog.Errorf("NRF registration failed: %v", err)
+		return
+	}
+	nwdaf.nrfClient = client
+	logger.NrfLog.Infof("Registered with NRF as %s (%s): %v", profile.NfInstanceId, config.GetMode(), profile.NwdafInfo.NwdafEvents)
+}
+
+// subscribeModels keeps a subscription to the models trained by the
+// configured MTLF (Nnwdaf_MLModelProvision), retrying until the MTLF is up
+func (nwdaf *NWDAF) subscribeModels(wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	providerUri := factory.NwdafConfig.Configuration.GetTraining().ProviderUri
+	logger.InitLog.Infof("Subscribing to the models of %s...", providerUri)
+	nwdaf.analyticsEngine.StartModelSubscription(nwdaf.ctx, providerUri, analytics.TrainedEvents())
+}
+
+// discoverPeers periodically looks up the NWDAFs registered with the NRF and
+// hands the analytics services of the others to the aggregator
+func (nwdaf *NWDAF) discoverPeers(wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	config := factory.NwdafConfig.Configuration
+	client := nrf.NewClient(config.NrfUri)
+	ticker := nwdaf.Clock.NewTicker(time.Duration(config.GetAggregation().DiscoveryInterval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		profiles, err := client.Discover(nwdaf.ctx, "NWDAF", "NWDAF")
+		if err != nil {
+			logger.NrfLog.Warnf("NWDAF discovery failed: %v", err)
+		} else {
+			var peers []*analytics.Peer
+			for _, profile := range profiles {
+				uri := profile.ServiceUri(factory.ServiceAnalyticsInfo)
+				if profile.NfInstanceId == nwdaf.nwdafContext.NfId || uri == "" {
+					continue
+				}
+				peer := &analytics.Peer{NfInstanceId: profile.NfInstanceId, Uri: uri}
+				if profile.NwdafInfo != nil {
+					peer.Tais = profile.NwdafInfo.TaiList
+				}
+				peers = append(peers, peer)
+			}
+			nwdaf.analyticsEngine.SetDiscoveredPeers(peers)
+			logger.NrfLog.Debugf("Discovered %d peer NWDAFs", len(peers))
+		}
+
+		select {
+		case <-nwdaf.ctx.Done():
+			return
+		case <-ticker.C():
+		}
+	}
+}
+
 func (nwdaf *NWDAF) Terminate() {
 	logger.AppLog.Infoln("Terminating NWDAF...")
 
+	// Deregister from NRF
+	if nwdaf.nrfClient != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := nwdaf.nrfClient.Deregister(ctx, nwdaf.nwdafContext.NfId); err != nil {
+			logger.NrfLog.Errorf("NRF deregistration failed: %v", err)
+		}
+		cancel()
+	}
+
 	// Stop agent
 	if nwdaf.agent != nil {
 		nwdaf.agent.Stop()